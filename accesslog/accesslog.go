@@ -0,0 +1,221 @@
+package accesslog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// Fields is the list of all the fields the access log can contain
+var Fields = []string{
+	"time",
+	"request_id",
+	"method",
+	"path",
+	"client_ip",
+	"user_agent",
+	"referer",
+	"status",
+	"duration",
+	"bytes_in",
+	"bytes_out",
+	"source_url",
+	"source_format",
+	"result_format",
+	"processing_options",
+	"cache_status",
+	"stages",
+	"error",
+}
+
+type recordCtxKey struct{}
+
+// record collects the access log fields during the request handling
+type record struct {
+	mu       sync.Mutex
+	fields   map[string]interface{}
+	stages   map[string]float64
+	bytesOut int
+}
+
+var (
+	output   io.Writer = os.Stdout
+	outputMu sync.Mutex
+)
+
+func Enabled() bool {
+	return config.AccessLogFormat == "json"
+}
+
+// RecordsEnabled returns true if the request records should be collected.
+// Besides the access log, the records are used by the slow requests logging
+func RecordsEnabled() bool {
+	return Enabled() || config.SlowRequestThreshold > 0
+}
+
+// SetOutput sets the writer the access log is written to
+func SetOutput(w io.Writer) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	output = w
+}
+
+// WithRecord returns a context containing a new access log record
+func WithRecord(ctx context.Context) context.Context {
+	if !RecordsEnabled() {
+		return ctx
+	}
+
+	return context.WithValue(ctx, recordCtxKey{}, &record{
+		fields: make(map[string]interface{}),
+		stages: make(map[string]float64),
+	})
+}
+
+func getRecord(ctx context.Context) *record {
+	rec, _ := ctx.Value(recordCtxKey{}).(*record)
+	return rec
+}
+
+// Set sets the access log field value for the request
+func Set(ctx context.Context, key string, value interface{}) {
+	rec := getRecord(ctx)
+	if rec == nil {
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.fields[key] = value
+}
+
+// ObserveStage adds the duration of the image handling stage to the access log
+func ObserveStage(ctx context.Context, stage string, d time.Duration) {
+	rec := getRecord(ctx)
+	if rec == nil {
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.stages[stage] += d.Seconds()
+}
+
+// Get returns the collected field value for the request
+func Get(ctx context.Context, key string) (interface{}, bool) {
+	rec := getRecord(ctx)
+	if rec == nil {
+		return nil, false
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	v, ok := rec.fields[key]
+	return v, ok
+}
+
+// Stages returns the durations of the image handling stages of the request
+func Stages(ctx context.Context) map[string]float64 {
+	rec := getRecord(ctx)
+	if rec == nil {
+		return nil
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	stages := make(map[string]float64, len(rec.stages))
+	for k, v := range rec.stages {
+		stages[k] = v
+	}
+
+	return stages
+}
+
+// Write writes the access log entry for the request.
+// The provided fields override the collected ones
+func Write(ctx context.Context, fields map[string]interface{}) {
+	if !Enabled() {
+		return
+	}
+
+	rec := getRecord(ctx)
+	if rec == nil {
+		return
+	}
+
+	rec.mu.Lock()
+
+	for k, v := range fields {
+		rec.fields[k] = v
+	}
+
+	if len(rec.stages) > 0 {
+		rec.fields["stages"] = rec.stages
+	}
+
+	rec.fields["bytes_out"] = rec.bytesOut
+
+	keys := config.AccessLogFields
+	if len(keys) == 0 {
+		keys = Fields
+	}
+
+	entry := make(map[string]interface{}, len(keys))
+	for _, f := range keys {
+		if v, ok := rec.fields[f]; ok {
+			entry[f] = v
+		}
+	}
+
+	data, err := json.Marshal(entry)
+
+	rec.mu.Unlock()
+
+	if err != nil {
+		log.Warningf("Can't encode access log entry: %s", err)
+		return
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	output.Write(append(data, '\n'))
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	rec *record
+}
+
+func (rw responseWriter) Write(data []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(data)
+
+	rw.rec.mu.Lock()
+	rw.rec.bytesOut += n
+	rw.rec.mu.Unlock()
+
+	return n, err
+}
+
+// WrapResponseWriter wraps the response writer to count the sent bytes
+func WrapResponseWriter(ctx context.Context, rw http.ResponseWriter) http.ResponseWriter {
+	rec := getRecord(ctx)
+	if rec == nil {
+		return rw
+	}
+
+	return responseWriter{ResponseWriter: rw, rec: rec}
+}
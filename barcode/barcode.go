@@ -0,0 +1,189 @@
+package barcode
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+)
+
+// MaxImageSize is the maximum size of the image side that is passed to the decoder.
+// Barcodes should be large enough to be decoded, so the limit is quite high
+const MaxImageSize = 2048
+
+const (
+	msgBarcodeDetectionFailed = "Barcode detection failed"
+
+	// zbarimg exits with this code when no symbols were found
+	zbarNoSymbolsExitCode = 4
+
+	maxOutputSize = 1024 * 1024
+)
+
+var (
+	zbarimgPath string
+
+	errOutputTooBig = errors.New("zbarimg output is too big")
+)
+
+// Symbol is a decoded QR code or barcode
+type Symbol struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+// Init looks up the zbarimg binary if barcode detection is enabled
+func Init() error {
+	if !config.InfoBarcodes {
+		return nil
+	}
+
+	path, err := exec.LookPath(config.ZbarimgPath)
+	if err != nil {
+		return fmt.Errorf("Can't find zbarimg: %s", err)
+	}
+
+	zbarimgPath = path
+
+	return nil
+}
+
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errOutputTooBig
+	}
+
+	return b.Buffer.Write(p)
+}
+
+// encodePGM encodes the grayscale pixels as a binary PGM image
+func encodePGM(pixels []byte, width, height int) []byte {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "P5\n%d %d\n255\n", width, height)
+	buf.Write(pixels[:width*height])
+
+	return buf.Bytes()
+}
+
+func zbarimgArgs(path string) []string {
+	return []string{"--quiet", "--xml", path}
+}
+
+type zbarData struct {
+	Format string `xml:"format,attr"`
+	Text   string `xml:",chardata"`
+}
+
+type zbarSymbol struct {
+	Type string   `xml:"type,attr"`
+	Data zbarData `xml:"data"`
+}
+
+type zbarBarcodes struct {
+	Sources []struct {
+		Indexes []struct {
+			Symbols []zbarSymbol `xml:"symbol"`
+		} `xml:"index"`
+	} `xml:"source"`
+}
+
+// parseZbarXML parses the XML output of zbarimg
+func parseZbarXML(data []byte) ([]Symbol, error) {
+	var doc zbarBarcodes
+
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	symbols := make([]Symbol, 0)
+
+	for _, source := range doc.Sources {
+		for _, index := range source.Indexes {
+			for _, s := range index.Symbols {
+				text := s.Data.Text
+
+				// zbarimg encodes binary data with base64
+				if s.Data.Format == "base64" {
+					decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+					if err != nil {
+						return nil, err
+					}
+					text = string(decoded)
+				}
+
+				symbols = append(symbols, Symbol{Type: s.Type, Data: text})
+			}
+		}
+	}
+
+	return symbols, nil
+}
+
+// Detect detects and decodes QR codes and barcodes on the grayscale image.
+// When ctx is done before the detection finishes, ctx.Err() is returned
+func Detect(ctx context.Context, pixels []byte, width, height int) ([]Symbol, error) {
+	f, err := ioutil.TempFile("", "imgproxy-barcode-*.pgm")
+	if err != nil {
+		return nil, ierrors.New(500, fmt.Sprintf("Can't create temporary file: %s", err), "Internal error")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(encodePGM(pixels, width, height))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, ierrors.New(500, fmt.Sprintf("Can't write temporary file: %s", err), "Internal error")
+	}
+
+	timeout := time.Duration(config.BarcodeTimeout) * time.Second
+
+	zbarCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout := limitedBuffer{limit: maxOutputSize}
+
+	cmd := exec.CommandContext(zbarCtx, zbarimgPath, zbarimgArgs(f.Name())...)
+	cmd.Env = []string{}
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == zbarNoSymbolsExitCode {
+			return []Symbol{}, nil
+		}
+
+		if zbarCtx.Err() == context.DeadlineExceeded {
+			return nil, ierrors.New(500, fmt.Sprintf("Barcode detection timed out after %v", timeout), msgBarcodeDetectionFailed)
+		}
+
+		return nil, ierrors.New(500, fmt.Sprintf("Can't detect barcodes: %s", err), msgBarcodeDetectionFailed)
+	}
+
+	symbols, err := parseZbarXML(stdout.Bytes())
+	if err != nil {
+		return nil, ierrors.New(500, fmt.Sprintf("Can't parse zbarimg output: %s", err), msgBarcodeDetectionFailed)
+	}
+
+	return symbols, nil
+}
@@ -0,0 +1,92 @@
+package barcode
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type BarcodeTestSuite struct {
+	suite.Suite
+}
+
+func (s *BarcodeTestSuite) SetupTest() {
+	config.Reset()
+}
+
+func (s *BarcodeTestSuite) TestParseZbarXML() {
+	output := `<barcodes xmlns='http://zbar.sourceforge.net/2008/barcode'>
+<source href='/tmp/imgproxy-barcode-1.pgm'>
+<index num='0'>
+<symbol type='QR-Code' quality='1' orientation='UP'><polygon points='+10,10 +10,90 +90,90 +90,10'/><data><![CDATA[https://imgproxy.net]]></data></symbol>
+<symbol type='EAN-13' quality='42'><data><![CDATA[5901234123457]]></data></symbol>
+<symbol type='QR-Code' quality='1'><data format='base64' length='3'><![CDATA[AAEC
+]]></data></symbol>
+</index>
+</source>
+</barcodes>
+`
+
+	symbols, err := parseZbarXML([]byte(output))
+
+	s.Require().Nil(err)
+	s.Require().Equal([]Symbol{
+		{Type: "QR-Code", Data: "https://imgproxy.net"},
+		{Type: "EAN-13", Data: "5901234123457"},
+		{Type: "QR-Code", Data: "\x00\x01\x02"},
+	}, symbols)
+}
+
+func (s *BarcodeTestSuite) TestParseZbarXMLEmpty() {
+	symbols, err := parseZbarXML([]byte("<barcodes><source href='x'></source></barcodes>"))
+
+	s.Require().Nil(err)
+	s.Require().NotNil(symbols)
+	s.Require().Empty(symbols)
+}
+
+func (s *BarcodeTestSuite) TestEncodePGM() {
+	pgm := encodePGM([]byte{0, 128, 255, 64, 1, 2}, 3, 2)
+
+	s.Require().Equal("P5\n3 2\n255\n\x00\x80\xff\x40\x01\x02", string(pgm))
+}
+
+func (s *BarcodeTestSuite) TestLimitedBuffer() {
+	b := limitedBuffer{limit: 4}
+
+	_, err := b.Write([]byte("abc"))
+	s.Require().Nil(err)
+
+	_, err = b.Write([]byte("de"))
+	s.Require().Equal(errOutputTooBig, err)
+	s.Require().Equal("abc", b.String())
+}
+
+func (s *BarcodeTestSuite) TestDetectCancelled() {
+	path, err := exec.LookPath("true")
+	s.Require().Nil(err)
+
+	zbarimgPath = path
+	defer func() { zbarimgPath = "" }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = Detect(ctx, []byte{0, 128, 255, 64, 1, 2}, 3, 2)
+	s.Require().Equal(context.Canceled, err)
+}
+
+func (s *BarcodeTestSuite) TestInitDisabled() {
+	config.InfoBarcodes = false
+	config.ZbarimgPath = "/nonexistent/zbarimg"
+
+	s.Require().Nil(Init())
+}
+
+func TestBarcode(t *testing.T) {
+	suite.Run(t, new(BarcodeTestSuite))
+}
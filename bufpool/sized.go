@@ -0,0 +1,78 @@
+package bufpool
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// sizeClasses are the capacities of the buffers kept in the sized pools
+var sizeClasses = [...]int{
+	32 * 1024,
+	128 * 1024,
+	512 * 1024,
+	2 * 1024 * 1024,
+	8 * 1024 * 1024,
+	32 * 1024 * 1024,
+}
+
+var sizedPools [len(sizeClasses)]sync.Pool
+
+func sizeClass(size int) int {
+	for i, s := range sizeClasses {
+		if size <= s {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// GetSized returns an empty buffer with the capacity of at least size bytes.
+// Buffers are taken from the pool of the matching size class,
+// so they should be returned with PutSized when they're not needed anymore
+func GetSized(size int) *bytes.Buffer {
+	class := sizeClass(size)
+	if class < 0 {
+		buf := new(bytes.Buffer)
+		buf.Grow(size)
+		return buf
+	}
+
+	if buf, ok := sizedPools[class].Get().(*bytes.Buffer); ok {
+		buf.Reset()
+		return buf
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Grow(sizeClasses[class])
+
+	return buf
+}
+
+// PutSized returns the buffer to the pool of its size class.
+// Buffers that are larger than the largest size class are dropped
+func PutSized(buf *bytes.Buffer) {
+	// A buffer can be put to a pool only if it can satisfy
+	// any request to this pool
+	class := sizeClass(buf.Cap())
+	if class < 0 {
+		return
+	}
+
+	if buf.Cap() < sizeClasses[class] {
+		class--
+	}
+
+	if class >= 0 {
+		sizedPools[class].Put(buf)
+	}
+}
+
+// Copy is like io.Copy but uses a pooled buffer instead of allocating a new one
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := GetSized(sizeClasses[0])
+	defer PutSized(buf)
+
+	return io.CopyBuffer(dst, src, buf.Bytes()[:buf.Cap()])
+}
@@ -0,0 +1,50 @@
+package bufpool
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SizedPoolTestSuite struct{ suite.Suite }
+
+func (s *SizedPoolTestSuite) TestGetSized() {
+	buf := GetSized(1000)
+	assert.Equal(s.T(), 0, buf.Len())
+	assert.Equal(s.T(), sizeClasses[0], buf.Cap())
+
+	buf = GetSized(sizeClasses[1] + 1)
+	assert.Equal(s.T(), sizeClasses[2], buf.Cap())
+
+	size := sizeClasses[len(sizeClasses)-1] + 1
+	buf = GetSized(size)
+	assert.GreaterOrEqual(s.T(), buf.Cap(), size)
+}
+
+func (s *SizedPoolTestSuite) TestPutSizedSmallBuffer() {
+	// The buffer is smaller than the smallest size class, so it shouldn't be pooled
+	PutSized(bytes.NewBuffer(make([]byte, 0, 10)))
+
+	for i := 0; i < 10; i++ {
+		assert.GreaterOrEqual(s.T(), GetSized(sizeClasses[0]).Cap(), sizeClasses[0])
+	}
+}
+
+func (s *SizedPoolTestSuite) TestCopy() {
+	var dst bytes.Buffer
+
+	src := strings.Repeat("a", sizeClasses[0]*3)
+
+	n, err := Copy(&dst, strings.NewReader(src))
+
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(len(src)), n)
+	assert.Equal(s.T(), src, dst.String())
+}
+
+func TestSizedPool(t *testing.T) {
+	suite.Run(t, new(SizedPoolTestSuite))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/metrics"
+	"github.com/imgproxy/imgproxy/v3/router"
+)
+
+var (
+	openConnections int64
+
+	clientRequests   = make(map[string]int)
+	clientRequestsMu sync.Mutex
+
+	errTooManyConnections    = ierrors.New(503, "Too many open connections", "Service temporarily unavailable")
+	errTooManyClientRequests = ierrors.New(503, "Too many concurrent requests from the client", "Service temporarily unavailable")
+)
+
+// trackConnState counts open client connections
+func trackConnState(c net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&openConnections, 1)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt64(&openConnections, -1)
+	}
+}
+
+func acquireClientSlot(clientIP string) bool {
+	clientRequestsMu.Lock()
+	defer clientRequestsMu.Unlock()
+
+	if clientRequests[clientIP] >= config.MaxRequestsPerIP {
+		return false
+	}
+
+	clientRequests[clientIP]++
+
+	return true
+}
+
+func releaseClientSlot(clientIP string) {
+	clientRequestsMu.Lock()
+	defer clientRequestsMu.Unlock()
+
+	if clientRequests[clientIP] <= 1 {
+		delete(clientRequests, clientIP)
+	} else {
+		clientRequests[clientIP]--
+	}
+}
+
+// withClientLimits rejects requests beyond the open connections and
+// per-client limits right away, before they get to the requests queue
+func withClientLimits(h router.RouteHandler) router.RouteHandler {
+	if config.MaxOpenConnections <= 0 && config.MaxRequestsPerIP <= 0 {
+		return h
+	}
+
+	return func(reqID string, rw http.ResponseWriter, r *http.Request) {
+		if config.MaxOpenConnections > 0 && atomic.LoadInt64(&openConnections) > int64(config.MaxOpenConnections) {
+			// Ask the client to close the connection to free up the slot
+			rw.Header().Set("Connection", "close")
+			metrics.SendError(r.Context(), "client_limit", errTooManyConnections)
+			panic(errTooManyConnections)
+		}
+
+		if config.MaxRequestsPerIP > 0 {
+			// Forwarded headers can be set by the client, so we rely
+			// on the address of the peer only
+			clientIP, _, _ := net.SplitHostPort(router.PeerAddr(r))
+
+			if !acquireClientSlot(clientIP) {
+				metrics.SendError(r.Context(), "client_limit", errTooManyClientRequests)
+				panic(errTooManyClientRequests)
+			}
+			defer releaseClientSlot(clientIP)
+		}
+
+		h(reqID, rw, r)
+	}
+}
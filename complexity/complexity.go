@@ -0,0 +1,62 @@
+package complexity
+
+import (
+	"math"
+)
+
+const (
+	// SampleSize is the maximum size of the image side that is enough to estimate
+	// the entropy. Larger images should be downscaled before the estimation
+	SampleSize = 256
+
+	// MaxEntropy is the maximum entropy of the 8-bit grayscale image
+	MaxEntropy = 8
+)
+
+// Entropy calculates the Shannon entropy of the grayscale pixels histogram in bits.
+// Flat images with a few tones have entropy close to 0, while detailed
+// photos have entropy close to MaxEntropy
+func Entropy(pixels []byte) float64 {
+	if len(pixels) == 0 {
+		return 0
+	}
+
+	var hist [256]int
+	for _, p := range pixels {
+		hist[p]++
+	}
+
+	var entropy float64
+
+	total := float64(len(pixels))
+
+	for _, count := range hist {
+		if count == 0 {
+			continue
+		}
+
+		p := float64(count) / total
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
+// AdaptQuality adjusts the quality according to the image entropy.
+// The quality is decreased by delta for the images with zero entropy
+// and increased by delta for the images with the max entropy.
+// The result is clamped to the [1, 100] range
+func AdaptQuality(quality, delta int, entropy float64) int {
+	score := math.Max(0, math.Min(1, entropy/MaxEntropy))
+
+	q := quality + int(math.Round(float64(delta)*(2*score-1)))
+
+	switch {
+	case q < 1:
+		return 1
+	case q > 100:
+		return 100
+	}
+
+	return q
+}
@@ -0,0 +1,28 @@
+package complexity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntropy(t *testing.T) {
+	assert.Equal(t, float64(0), Entropy(nil))
+	assert.Equal(t, float64(0), Entropy([]byte{42, 42, 42, 42}))
+	assert.Equal(t, float64(1), Entropy([]byte{0, 255, 0, 255}))
+
+	pixels := make([]byte, 256*4)
+	for i := range pixels {
+		pixels[i] = byte(i)
+	}
+	assert.InDelta(t, float64(MaxEntropy), Entropy(pixels), 1e-9)
+}
+
+func TestAdaptQuality(t *testing.T) {
+	assert.Equal(t, 70, AdaptQuality(80, 10, 0))
+	assert.Equal(t, 80, AdaptQuality(80, 10, MaxEntropy/2))
+	assert.Equal(t, 90, AdaptQuality(80, 10, MaxEntropy))
+	assert.Equal(t, 80, AdaptQuality(80, 0, MaxEntropy))
+	assert.Equal(t, 100, AdaptQuality(95, 10, MaxEntropy))
+	assert.Equal(t, 1, AdaptQuality(5, 10, 0))
+}
@@ -4,9 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"math"
+	"net"
 	"os"
 	"regexp"
 	"runtime"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
@@ -16,38 +18,95 @@ import (
 )
 
 var (
-	Network          string
-	Bind             string
-	ReadTimeout      int
-	WriteTimeout     int
-	KeepAliveTimeout int
-	DownloadTimeout  int
-	Concurrency      int
-	MaxClients       int
+	Network                   string
+	Bind                      string
+	UnixSocketMode            os.FileMode
+	ReadTimeout               int
+	WriteTimeout              int
+	KeepAliveTimeout          int
+	ReadHeaderTimeout         int
+	MaxHeaderBytes            int
+	EnableH2C                 bool
+	TLSCertPath               string
+	TLSKeyPath                string
+	HTTP2MaxConcurrentStreams int
+	EnableHTTP3               bool
+	HTTP3Bind                 string
+	DownloadTimeout           int
+	ProcessingTimeout         int
+	WriteResponseTimeout      int
+	Concurrency               int
+	RequestsQueueSize         int
+	RequestsQueueRetryAfter   int
+	MaxClients                int
+	MaxOpenConnections        int
+	MaxRequestsPerIP          int
+
+	DownloadMaxIdleConns        int
+	DownloadMaxIdleConnsPerHost int
+	DownloadMaxConnsPerHost     int
+	DownloadIdleConnTimeout     int
+	DownloadTLSSessionCacheSize int
+	DownloadCAPath              string
+	DownloadClientCertPath      string
+	DownloadClientKeyPath       string
+	DownloadHostTLS             []string
+	DownloadErrorCacheTTL       int
+	DownloadErrorCacheSize      int
 
 	TTL                     int
+	StaleWhileRevalidate    int
+	StaleIfError            int
 	CacheControlPassthrough bool
 	SetCanonicalHeader      bool
 
-	SoReuseport bool
+	SurrogateKeyHeader  string
+	SurrogateKeySources []string
 
-	PathPrefix string
+	CustomResponseHeaders map[string]string
+	SendServerHeader      bool
 
-	MaxSrcResolution   int
-	MaxSrcFileSize     int
-	MaxAnimationFrames int
-	MaxSvgCheckBytes   int
+	SoReuseport bool
 
-	JpegProgressive       bool
-	PngInterlaced         bool
-	PngQuantize           bool
-	PngQuantizationColors int
-	AvifSpeed             int
-	Quality               int
-	FormatQuality         map[imagetype.Type]int
-	StripMetadata         bool
-	StripColorProfile     bool
-	AutoRotate            bool
+	PathPrefix      string
+	HealthPath      string
+	LivenessPath    string
+	ReadinessPath   string
+	ReadinessChecks []string
+
+	MaxSrcResolution            int
+	MaxSrcFileSize              int
+	MaxAnimationFrames          int
+	MaxAnimationResolution      int
+	MaxAnimationResultDimension int
+	RejectOversizedAnimations   bool
+	MaxSvgCheckBytes            int
+	MaxResultDimension          int
+
+	AllowedProcessingOptions   []string
+	ForbiddenProcessingOptions []string
+	AllowedURLResponseHeaders  []string
+
+	URLOptionAliases         map[string]string
+	DisabledURLOptionAliases []string
+
+	JpegProgressive         bool
+	PngInterlaced           bool
+	PngQuantize             bool
+	PngQuantizationColors   int
+	GifDither               float64
+	GifEffort               int
+	GifOptimizeFrames       bool
+	GifOptimizeTransparency bool
+	AvifSpeed               int
+	Quality                 int
+	FormatQuality           map[imagetype.Type]int
+	AdaptiveQualityDelta    int
+	StripMetadata           bool
+	StripGPS                bool
+	StripColorProfile       bool
+	AutoRotate              bool
+	EnableUpscale           bool
 
 	EnableWebpDetection bool
 	EnforceWebp         bool
@@ -56,9 +115,24 @@ var (
 	EnableClientHints   bool
 
 	SkipProcessingFormats []imagetype.Type
+	SkipNoopProcessing    bool
+	AllowRaw              bool
 
 	UseLinearColorspace bool
 	DisableShrinkOnLoad bool
+	SmartCropCacheSize  int
+
+	FaceDetectionCascadePath string
+	FaceDetectionMinScore    float64
+	ObjectDetectionCascades  map[string]string
+	ObjectDetectionMinScore  float64
+
+	EnableVideoSources      bool
+	FFmpegPath              string
+	VideoConcurrency        int
+	VideoTimeout            int
+	MaxVideoSegmentDuration float64
+	VideoSegmentFPS         int
 
 	Keys          [][]byte
 	Salts         [][]byte
@@ -66,55 +140,130 @@ var (
 
 	Secret string
 
-	AllowOrigin string
+	EnableJSONAPI bool
+
+	EnableInfoEndpoint     bool
+	EnableValidateEndpoint bool
 
-	UserAgent string
+	AllowOrigins      []string
+	CORSAllowMethods  string
+	CORSAllowHeaders  string
+	CORSExposeHeaders string
+	CORSMaxAge        int
+
+	UserAgent        string
+	ForwardRequestID bool
 
 	IgnoreSslVerification bool
 	DevelopmentErrorsMode bool
 
 	AllowedSources []*regexp.Regexp
 
+	AllowLoopbackSourceAddresses  bool
+	AllowLinkLocalSourceAddresses bool
+	AllowPrivateSourceAddresses   bool
+	AllowedSourceNetworks         []*net.IPNet
+
+	AllowedReferers   []*regexp.Regexp
+	AllowEmptyReferer bool
+	RefererBlockMode  string
+
 	CookiePassthrough bool
 	CookieBaseURL     string
 
-	LocalFileSystemRoot string
-	S3Enabled           bool
-	S3Region            string
-	S3Endpoint          string
-	GCSEnabled          bool
-	GCSKey              string
-	ABSEnabled          bool
-	ABSName             string
-	ABSKey              string
-	ABSEndpoint         string
+	LocalFileSystemRoot        string
+	S3Enabled                  bool
+	S3Region                   string
+	S3Endpoint                 string
+	S3ForcePathStyle           bool
+	S3IgnoreSslVerification    bool
+	GCSEnabled                 bool
+	GCSKey                     string
+	ABSEnabled                 bool
+	ABSName                    string
+	ABSKey                     string
+	ABSEndpoint                string
+	ABSSASToken                string
+	ABSSASTokens               map[string]string
+	ABSUseManagedIdentity      bool
+	ABSManagedIdentityClientID string
 
 	ETagEnabled bool
 	ETagBuster  string
 
+	LastModifiedEnabled bool
+
+	ResultCache                  string
+	ResultCacheTTL               int
+	ResultCacheDiskPath          string
+	ResultCacheDiskMaxSize       int
+	ResultCacheDiskSweepInterval int
+	ResultCacheRedisAddr         string
+	ResultCacheRedisPassword     string
+	ResultCacheRedisDB           int
+	ResultCacheS3Bucket          string
+	ResultCacheS3Prefix          string
+
 	BaseURL string
 
-	Presets     []string
-	OnlyPresets bool
+	Presets                 []string
+	OnlyPresets             bool
+	OnlyPresetsExtraOptions []string
+	AllowUnsignedPresets    bool
+	SkipInvalidPresets      bool
+
+	SourceHostOptions []string
+
+	Filters []string
+	LUTs    map[string]string
+
+	PathPrefixPresets map[string][]string
+
+	EnableThumborCompat bool
+	ThumborPathPrefix   string
+	ThumborSecurityKey  string
+
+	EnableCloudinaryCompat bool
+	CloudinaryPathPrefix   string
+	CloudinaryAPISecret    string
+
+	ReloadCheckInterval int
 
 	WatermarkData    string
 	WatermarkPath    string
 	WatermarkURL     string
 	WatermarkOpacity float64
 
+	WatermarkFirstFrameOnly bool
+
+	AttributionCopyright string
+	AttributionCreator   string
+
+	MaxOverlays int
+
 	FallbackImageData     string
 	FallbackImagePath     string
 	FallbackImageURL      string
 	FallbackImageHTTPCode int
 
-	DataDogEnable bool
+	DataDogEnable        bool
+	DataDogEnableMetrics bool
 
 	NewRelicAppName string
 	NewRelicKey     string
 
 	PrometheusBind      string
+	PrometheusPath      string
 	PrometheusNamespace string
 
+	OpenTelemetryEndpoint    string
+	OpenTelemetryServiceName string
+
+	AccessLogFormat string
+	AccessLogFields []string
+
+	SlowRequestThreshold float64
+
 	BugsnagKey   string
 	BugsnagStage string
 
@@ -129,19 +278,50 @@ var (
 	AirbrakeProjecKey string
 	AirbrakeEnv       string
 
+	ErrorWebhookURL    string
+	ErrorWebhookSecret string
+
 	ReportDownloadingErrors bool
 
-	EnableDebugHeaders bool
+	EnableDebugHeaders          bool
+	EnableImageSizeHeaders      bool
+	EnablePerceptualHashHeaders bool
+	EnableAverageColorHeader    bool
+	InfoPerceptualHashes        bool
+	InfoEntropy                 bool
+	InfoFaces                   bool
+	InfoBarcodes                bool
+	ZbarimgPath                 string
+	BarcodeTimeout              int
+
+	DebugEndpointsSecret string
 
 	FreeMemoryInterval             int
 	DownloadBufferSize             int
 	BufferPoolCalibrationThreshold int
+
+	MemorySoftLimit              int
+	MemorySoftLimitWait          int
+	MemorySoftLimitMinResolution int
+
+	VipsCacheMax      int
+	VipsCacheMaxMem   int
+	VipsCacheMaxFiles int
+	VipsConcurrency   int
+
+	PerformanceProfile string
+	GCPercent          int
+	MemoryBallastSize  int
 )
 
 var (
 	keyPath     string
 	saltPath    string
 	presetsPath string
+	configPath  string
+
+	// configFilePath is the path of the loaded config file
+	configFilePath string
 )
 
 func init() {
@@ -150,41 +330,99 @@ func init() {
 	flag.StringVar(&keyPath, "keypath", "", "path of the file with hex-encoded key")
 	flag.StringVar(&saltPath, "saltpath", "", "path of the file with hex-encoded salt")
 	flag.StringVar(&presetsPath, "presets", "", "path of the file with presets")
+	flag.StringVar(&configPath, "config", "", "path of the YAML config file")
 }
 
 func Reset() {
 	Network = "tcp"
 	Bind = ":8080"
+	UnixSocketMode = 0
 	ReadTimeout = 10
 	WriteTimeout = 10
 	KeepAliveTimeout = 10
+	ReadHeaderTimeout = 0
+	MaxHeaderBytes = 1 << 20
+	EnableH2C = false
+	TLSCertPath = ""
+	TLSKeyPath = ""
+	HTTP2MaxConcurrentStreams = 0
+	EnableHTTP3 = false
+	HTTP3Bind = ""
 	DownloadTimeout = 5
+	ProcessingTimeout = 0
+	WriteResponseTimeout = 0
 	Concurrency = runtime.NumCPU() * 2
+	RequestsQueueSize = 0
+	RequestsQueueRetryAfter = 1
 	MaxClients = 0
+	MaxOpenConnections = 0
+	MaxRequestsPerIP = 0
+
+	DownloadMaxIdleConns = 0
+	DownloadMaxIdleConnsPerHost = 0
+	DownloadMaxConnsPerHost = 0
+	DownloadIdleConnTimeout = 0
+	DownloadTLSSessionCacheSize = 0
+	DownloadCAPath = ""
+	DownloadClientCertPath = ""
+	DownloadClientKeyPath = ""
+	DownloadHostTLS = make([]string, 0)
+	DownloadErrorCacheTTL = 0
+	DownloadErrorCacheSize = 10000
 
 	TTL = 3600
+	StaleWhileRevalidate = 0
+	StaleIfError = 0
 	CacheControlPassthrough = false
 	SetCanonicalHeader = false
 
+	SurrogateKeyHeader = ""
+	SurrogateKeySources = []string{"url", "host"}
+
+	CustomResponseHeaders = make(map[string]string)
+	SendServerHeader = true
+
 	SoReuseport = false
 
 	PathPrefix = ""
+	HealthPath = "/health"
+	LivenessPath = "/healthz"
+	ReadinessPath = "/readyz"
+	ReadinessChecks = []string{"queue", "vips", "result_cache"}
 
 	MaxSrcResolution = 16800000
 	MaxSrcFileSize = 0
 	MaxAnimationFrames = 1
+	MaxAnimationResolution = 0
+	MaxAnimationResultDimension = 0
+	RejectOversizedAnimations = false
 	MaxSvgCheckBytes = 32 * 1024
+	MaxResultDimension = 0
+
+	AllowedProcessingOptions = make([]string, 0)
+	AllowedURLResponseHeaders = make([]string, 0)
+	ForbiddenProcessingOptions = make([]string, 0)
+
+	URLOptionAliases = make(map[string]string)
+	DisabledURLOptionAliases = make([]string, 0)
 
 	JpegProgressive = false
 	PngInterlaced = false
 	PngQuantize = false
 	PngQuantizationColors = 256
+	GifDither = 1
+	GifEffort = 7
+	GifOptimizeFrames = false
+	GifOptimizeTransparency = false
 	AvifSpeed = 5
 	Quality = 80
 	FormatQuality = map[imagetype.Type]int{imagetype.AVIF: 50}
+	AdaptiveQualityDelta = 0
 	StripMetadata = true
+	StripGPS = false
 	StripColorProfile = true
 	AutoRotate = true
+	EnableUpscale = false
 
 	EnableWebpDetection = false
 	EnforceWebp = false
@@ -193,9 +431,24 @@ func Reset() {
 	EnableClientHints = false
 
 	SkipProcessingFormats = make([]imagetype.Type, 0)
+	SkipNoopProcessing = false
+	AllowRaw = false
 
 	UseLinearColorspace = false
 	DisableShrinkOnLoad = false
+	SmartCropCacheSize = 1000
+
+	FaceDetectionCascadePath = ""
+	FaceDetectionMinScore = 5
+	ObjectDetectionCascades = make(map[string]string)
+	ObjectDetectionMinScore = 5
+
+	EnableVideoSources = false
+	FFmpegPath = "ffmpeg"
+	VideoConcurrency = runtime.NumCPU()
+	VideoTimeout = 10
+	MaxVideoSegmentDuration = 5
+	VideoSegmentFPS = 10
 
 	Keys = make([][]byte, 0)
 	Salts = make([][]byte, 0)
@@ -203,15 +456,34 @@ func Reset() {
 
 	Secret = ""
 
-	AllowOrigin = ""
+	EnableJSONAPI = false
+
+	EnableInfoEndpoint = false
+	EnableValidateEndpoint = false
+
+	AllowOrigins = make([]string, 0)
+	CORSAllowMethods = "GET, OPTIONS"
+	CORSAllowHeaders = ""
+	CORSExposeHeaders = ""
+	CORSMaxAge = 0
 
 	UserAgent = fmt.Sprintf("imgproxy/%s", version.Version())
+	ForwardRequestID = true
 
 	IgnoreSslVerification = false
 	DevelopmentErrorsMode = false
 
 	AllowedSources = make([]*regexp.Regexp, 0)
 
+	AllowLoopbackSourceAddresses = false
+	AllowLinkLocalSourceAddresses = false
+	AllowPrivateSourceAddresses = false
+	AllowedSourceNetworks = make([]*net.IPNet, 0)
+
+	AllowedReferers = make([]*regexp.Regexp, 0)
+	AllowEmptyReferer = true
+	RefererBlockMode = "forbidden"
+
 	CookiePassthrough = false
 	CookieBaseURL = ""
 
@@ -219,39 +491,95 @@ func Reset() {
 	S3Enabled = false
 	S3Region = ""
 	S3Endpoint = ""
+	S3ForcePathStyle = true
+	S3IgnoreSslVerification = false
 	GCSEnabled = false
 	GCSKey = ""
 	ABSEnabled = false
 	ABSName = ""
 	ABSKey = ""
 	ABSEndpoint = ""
+	ABSSASToken = ""
+	ABSSASTokens = make(map[string]string)
+	ABSUseManagedIdentity = false
+	ABSManagedIdentityClientID = ""
 
 	ETagEnabled = false
 	ETagBuster = ""
 
+	LastModifiedEnabled = false
+
+	ResultCache = ""
+	ResultCacheTTL = 0
+	ResultCacheDiskPath = ""
+	ResultCacheDiskMaxSize = 0
+	ResultCacheDiskSweepInterval = 600
+	ResultCacheRedisAddr = "localhost:6379"
+	ResultCacheRedisPassword = ""
+	ResultCacheRedisDB = 0
+	ResultCacheS3Bucket = ""
+	ResultCacheS3Prefix = ""
+
 	BaseURL = ""
 
 	Presets = make([]string, 0)
 	OnlyPresets = false
+	OnlyPresetsExtraOptions = make([]string, 0)
+	AllowUnsignedPresets = false
+	SkipInvalidPresets = false
+
+	SourceHostOptions = make([]string, 0)
+
+	Filters = make([]string, 0)
+	LUTs = make(map[string]string)
+
+	PathPrefixPresets = make(map[string][]string)
+
+	EnableThumborCompat = false
+	ThumborPathPrefix = ""
+	ThumborSecurityKey = ""
+
+	EnableCloudinaryCompat = false
+	CloudinaryPathPrefix = ""
+	CloudinaryAPISecret = ""
+
+	ReloadCheckInterval = 0
 
 	WatermarkData = ""
 	WatermarkPath = ""
 	WatermarkURL = ""
 	WatermarkOpacity = 1
 
+	WatermarkFirstFrameOnly = false
+
+	AttributionCopyright = ""
+	AttributionCreator = ""
+
+	MaxOverlays = 5
+
 	FallbackImageData = ""
 	FallbackImagePath = ""
 	FallbackImageURL = ""
 	FallbackImageHTTPCode = 200
 
 	DataDogEnable = false
+	DataDogEnableMetrics = false
 
 	NewRelicAppName = ""
 	NewRelicKey = ""
 
 	PrometheusBind = ""
+	PrometheusPath = ""
 	PrometheusNamespace = ""
 
+	OpenTelemetryEndpoint = ""
+	OpenTelemetryServiceName = "imgproxy"
+
+	AccessLogFormat = ""
+	AccessLogFields = make([]string, 0)
+
+	SlowRequestThreshold = 0
+
 	BugsnagKey = ""
 	BugsnagStage = "production"
 
@@ -266,57 +594,176 @@ func Reset() {
 	AirbrakeProjecKey = ""
 	AirbrakeEnv = "production"
 
+	ErrorWebhookURL = ""
+	ErrorWebhookSecret = ""
+
 	ReportDownloadingErrors = true
 
 	EnableDebugHeaders = false
+	EnableImageSizeHeaders = false
+	EnablePerceptualHashHeaders = false
+	EnableAverageColorHeader = false
+	InfoPerceptualHashes = false
+	InfoEntropy = false
+	InfoFaces = false
+	InfoBarcodes = false
+	ZbarimgPath = "zbarimg"
+	BarcodeTimeout = 5
+
+	DebugEndpointsSecret = ""
 
 	FreeMemoryInterval = 10
 	DownloadBufferSize = 0
 	BufferPoolCalibrationThreshold = 1024
+
+	MemorySoftLimit = 0
+	MemorySoftLimitWait = 5
+	MemorySoftLimitMinResolution = 0
+
+	VipsCacheMax = 0
+	VipsCacheMaxMem = 0
+	VipsCacheMaxFiles = 0
+	VipsConcurrency = 1
+
+	PerformanceProfile = ""
+	GCPercent = 0
+	MemoryBallastSize = 0
 }
 
 func Configure() error {
+	// Config file sets only the environment variables that are not set,
+	// so it should be loaded before anything else is read
+	configFilePath = configPath
+	if len(configFilePath) == 0 {
+		configFilePath = os.Getenv("IMGPROXY_CONFIG_FILE")
+	}
+	if err := loadConfigFile(configFilePath); err != nil {
+		return err
+	}
+
 	if port := os.Getenv("PORT"); len(port) > 0 {
 		Bind = fmt.Sprintf(":%s", port)
 	}
 
+	// Performance profile changes the defaults, so it should be applied
+	// before the other config values are read
+	configurators.String(&PerformanceProfile, "IMGPROXY_PERFORMANCE_PROFILE")
+	if err := applyPerformanceProfile(PerformanceProfile); err != nil {
+		return err
+	}
+
 	configurators.String(&Network, "IMGPROXY_NETWORK")
 	configurators.String(&Bind, "IMGPROXY_BIND")
+	if err := configurators.FileMode(&UnixSocketMode, "IMGPROXY_UNIX_SOCKET_MODE"); err != nil {
+		return err
+	}
 	configurators.Int(&ReadTimeout, "IMGPROXY_READ_TIMEOUT")
 	configurators.Int(&WriteTimeout, "IMGPROXY_WRITE_TIMEOUT")
 	configurators.Int(&KeepAliveTimeout, "IMGPROXY_KEEP_ALIVE_TIMEOUT")
+	configurators.Int(&ReadHeaderTimeout, "IMGPROXY_READ_HEADER_TIMEOUT")
+	configurators.Int(&MaxHeaderBytes, "IMGPROXY_MAX_HEADER_BYTES")
+	configurators.Bool(&EnableH2C, "IMGPROXY_ENABLE_H2C")
+	configurators.String(&TLSCertPath, "IMGPROXY_TLS_CERT_PATH")
+	configurators.String(&TLSKeyPath, "IMGPROXY_TLS_KEY_PATH")
+	configurators.Int(&HTTP2MaxConcurrentStreams, "IMGPROXY_HTTP2_MAX_CONCURRENT_STREAMS")
+	configurators.Bool(&EnableHTTP3, "IMGPROXY_ENABLE_HTTP3")
+	configurators.String(&HTTP3Bind, "IMGPROXY_HTTP3_BIND")
 	configurators.Int(&DownloadTimeout, "IMGPROXY_DOWNLOAD_TIMEOUT")
+	configurators.Int(&ProcessingTimeout, "IMGPROXY_PROCESSING_TIMEOUT")
+	configurators.Int(&WriteResponseTimeout, "IMGPROXY_WRITE_RESPONSE_TIMEOUT")
 	configurators.Int(&Concurrency, "IMGPROXY_CONCURRENCY")
+	configurators.Int(&RequestsQueueSize, "IMGPROXY_REQUESTS_QUEUE_SIZE")
+	configurators.Int(&RequestsQueueRetryAfter, "IMGPROXY_REQUESTS_QUEUE_RETRY_AFTER")
 	configurators.Int(&MaxClients, "IMGPROXY_MAX_CLIENTS")
+	configurators.Int(&MaxOpenConnections, "IMGPROXY_MAX_OPEN_CONNECTIONS")
+	configurators.Int(&MaxRequestsPerIP, "IMGPROXY_MAX_REQUESTS_PER_IP")
+
+	configurators.Int(&DownloadMaxIdleConns, "IMGPROXY_DOWNLOAD_MAX_IDLE_CONNS")
+	configurators.Int(&DownloadMaxIdleConnsPerHost, "IMGPROXY_DOWNLOAD_MAX_IDLE_CONNS_PER_HOST")
+	configurators.Int(&DownloadMaxConnsPerHost, "IMGPROXY_DOWNLOAD_MAX_CONNS_PER_HOST")
+	configurators.Int(&DownloadIdleConnTimeout, "IMGPROXY_DOWNLOAD_IDLE_CONN_TIMEOUT")
+	configurators.Int(&DownloadTLSSessionCacheSize, "IMGPROXY_DOWNLOAD_TLS_SESSION_CACHE_SIZE")
+	configurators.String(&DownloadCAPath, "IMGPROXY_DOWNLOAD_CA_PATH")
+	configurators.String(&DownloadClientCertPath, "IMGPROXY_DOWNLOAD_CLIENT_CERT_PATH")
+	configurators.String(&DownloadClientKeyPath, "IMGPROXY_DOWNLOAD_CLIENT_KEY_PATH")
+	configurators.StringSlice(&DownloadHostTLS, "IMGPROXY_DOWNLOAD_HOST_TLS")
+	configurators.Int(&DownloadErrorCacheTTL, "IMGPROXY_DOWNLOAD_ERROR_CACHE_TTL")
+	configurators.Int(&DownloadErrorCacheSize, "IMGPROXY_DOWNLOAD_ERROR_CACHE_SIZE")
 
 	configurators.Int(&TTL, "IMGPROXY_TTL")
+	configurators.Int(&StaleWhileRevalidate, "IMGPROXY_STALE_WHILE_REVALIDATE")
+	configurators.Int(&StaleIfError, "IMGPROXY_STALE_IF_ERROR")
 	configurators.Bool(&CacheControlPassthrough, "IMGPROXY_CACHE_CONTROL_PASSTHROUGH")
 	configurators.Bool(&SetCanonicalHeader, "IMGPROXY_SET_CANONICAL_HEADER")
 
+	configurators.String(&SurrogateKeyHeader, "IMGPROXY_SURROGATE_KEY_HEADER")
+	configurators.StringSlice(&SurrogateKeySources, "IMGPROXY_SURROGATE_KEY_SOURCES")
+
+	if err := configurators.HeadersMap(CustomResponseHeaders, "IMGPROXY_CUSTOM_RESPONSE_HEADERS"); err != nil {
+		return err
+	}
+	configurators.Bool(&SendServerHeader, "IMGPROXY_SEND_SERVER_HEADER")
+
 	configurators.Bool(&SoReuseport, "IMGPROXY_SO_REUSEPORT")
 
 	configurators.String(&PathPrefix, "IMGPROXY_PATH_PREFIX")
+	configurators.String(&HealthPath, "IMGPROXY_HEALTH_PATH")
+	configurators.String(&LivenessPath, "IMGPROXY_LIVENESS_PATH")
+	configurators.String(&ReadinessPath, "IMGPROXY_READINESS_PATH")
+	configurators.StringSlice(&ReadinessChecks, "IMGPROXY_READINESS_CHECKS")
 
 	configurators.MegaInt(&MaxSrcResolution, "IMGPROXY_MAX_SRC_RESOLUTION")
 	configurators.Int(&MaxSrcFileSize, "IMGPROXY_MAX_SRC_FILE_SIZE")
 	configurators.Int(&MaxSvgCheckBytes, "IMGPROXY_MAX_SVG_CHECK_BYTES")
 
 	configurators.Int(&MaxAnimationFrames, "IMGPROXY_MAX_ANIMATION_FRAMES")
+	configurators.MegaInt(&MaxAnimationResolution, "IMGPROXY_MAX_ANIMATION_RESOLUTION")
+	configurators.Int(&MaxAnimationResultDimension, "IMGPROXY_MAX_ANIMATION_RESULT_DIMENSION")
+	configurators.Bool(&RejectOversizedAnimations, "IMGPROXY_REJECT_OVERSIZED_ANIMATIONS")
+
+	configurators.Int(&MaxResultDimension, "IMGPROXY_MAX_RESULT_DIMENSION")
+
+	configurators.StringSlice(&AllowedProcessingOptions, "IMGPROXY_ALLOWED_PROCESSING_OPTIONS")
+	configurators.StringSlice(&AllowedURLResponseHeaders, "IMGPROXY_ALLOWED_URL_RESPONSE_HEADERS")
+	configurators.StringSlice(&ForbiddenProcessingOptions, "IMGPROXY_FORBIDDEN_PROCESSING_OPTIONS")
+
+	if err := configurators.StringMap(URLOptionAliases, "IMGPROXY_URL_OPTION_ALIASES"); err != nil {
+		return err
+	}
+	configurators.StringSlice(&DisabledURLOptionAliases, "IMGPROXY_DISABLED_URL_OPTION_ALIASES")
 
 	configurators.Patterns(&AllowedSources, "IMGPROXY_ALLOWED_SOURCES")
 
+	configurators.Bool(&AllowLoopbackSourceAddresses, "IMGPROXY_ALLOW_LOOPBACK_SOURCE_ADDRESSES")
+	configurators.Bool(&AllowLinkLocalSourceAddresses, "IMGPROXY_ALLOW_LINK_LOCAL_SOURCE_ADDRESSES")
+	configurators.Bool(&AllowPrivateSourceAddresses, "IMGPROXY_ALLOW_PRIVATE_SOURCE_ADDRESSES")
+	if err := configurators.IPNets(&AllowedSourceNetworks, "IMGPROXY_ALLOWED_SOURCE_NETWORKS"); err != nil {
+		return err
+	}
+
+	configurators.Patterns(&AllowedReferers, "IMGPROXY_ALLOWED_REFERERS")
+	configurators.Bool(&AllowEmptyReferer, "IMGPROXY_ALLOW_EMPTY_REFERER")
+	configurators.String(&RefererBlockMode, "IMGPROXY_REFERER_BLOCK_MODE")
+
 	configurators.Bool(&JpegProgressive, "IMGPROXY_JPEG_PROGRESSIVE")
 	configurators.Bool(&PngInterlaced, "IMGPROXY_PNG_INTERLACED")
 	configurators.Bool(&PngQuantize, "IMGPROXY_PNG_QUANTIZE")
 	configurators.Int(&PngQuantizationColors, "IMGPROXY_PNG_QUANTIZATION_COLORS")
+	configurators.Float(&GifDither, "IMGPROXY_GIF_DITHER")
+	configurators.Int(&GifEffort, "IMGPROXY_GIF_EFFORT")
+	configurators.Bool(&GifOptimizeFrames, "IMGPROXY_GIF_OPTIMIZE_FRAMES")
+	configurators.Bool(&GifOptimizeTransparency, "IMGPROXY_GIF_OPTIMIZE_TRANSPARENCY")
 	configurators.Int(&AvifSpeed, "IMGPROXY_AVIF_SPEED")
 	configurators.Int(&Quality, "IMGPROXY_QUALITY")
 	if err := configurators.ImageTypesQuality(FormatQuality, "IMGPROXY_FORMAT_QUALITY"); err != nil {
 		return err
 	}
+	configurators.Int(&AdaptiveQualityDelta, "IMGPROXY_ADAPTIVE_QUALITY_DELTA")
 	configurators.Bool(&StripMetadata, "IMGPROXY_STRIP_METADATA")
+	configurators.Bool(&StripGPS, "IMGPROXY_STRIP_GPS")
 	configurators.Bool(&StripColorProfile, "IMGPROXY_STRIP_COLOR_PROFILE")
 	configurators.Bool(&AutoRotate, "IMGPROXY_AUTO_ROTATE")
+	configurators.Bool(&EnableUpscale, "IMGPROXY_ENABLE_UPSCALE")
 
 	configurators.Bool(&EnableWebpDetection, "IMGPROXY_ENABLE_WEBP_DETECTION")
 	configurators.Bool(&EnforceWebp, "IMGPROXY_ENFORCE_WEBP")
@@ -327,9 +774,26 @@ func Configure() error {
 	if err := configurators.ImageTypes(&SkipProcessingFormats, "IMGPROXY_SKIP_PROCESSING_FORMATS"); err != nil {
 		return err
 	}
+	configurators.Bool(&SkipNoopProcessing, "IMGPROXY_SKIP_NOOP_PROCESSING")
+	configurators.Bool(&AllowRaw, "IMGPROXY_ALLOW_RAW")
 
 	configurators.Bool(&UseLinearColorspace, "IMGPROXY_USE_LINEAR_COLORSPACE")
 	configurators.Bool(&DisableShrinkOnLoad, "IMGPROXY_DISABLE_SHRINK_ON_LOAD")
+	configurators.Int(&SmartCropCacheSize, "IMGPROXY_SMART_CROP_CACHE_SIZE")
+
+	configurators.String(&FaceDetectionCascadePath, "IMGPROXY_FACE_DETECTION_CASCADE_PATH")
+	configurators.Float(&FaceDetectionMinScore, "IMGPROXY_FACE_DETECTION_MIN_SCORE")
+	if err := configurators.StringMap(ObjectDetectionCascades, "IMGPROXY_OBJECT_DETECTION_CASCADES"); err != nil {
+		return err
+	}
+	configurators.Float(&ObjectDetectionMinScore, "IMGPROXY_OBJECT_DETECTION_MIN_SCORE")
+
+	configurators.Bool(&EnableVideoSources, "IMGPROXY_ENABLE_VIDEO_SOURCES")
+	configurators.String(&FFmpegPath, "IMGPROXY_FFMPEG_PATH")
+	configurators.Int(&VideoConcurrency, "IMGPROXY_VIDEO_CONCURRENCY")
+	configurators.Int(&VideoTimeout, "IMGPROXY_VIDEO_TIMEOUT")
+	configurators.Float(&MaxVideoSegmentDuration, "IMGPROXY_MAX_VIDEO_SEGMENT_DURATION")
+	configurators.Int(&VideoSegmentFPS, "IMGPROXY_VIDEO_SEGMENT_FPS")
 
 	if err := configurators.Hex(&Keys, "IMGPROXY_KEY"); err != nil {
 		return err
@@ -348,9 +812,18 @@ func Configure() error {
 
 	configurators.String(&Secret, "IMGPROXY_SECRET")
 
-	configurators.String(&AllowOrigin, "IMGPROXY_ALLOW_ORIGIN")
+	configurators.Bool(&EnableJSONAPI, "IMGPROXY_ENABLE_JSON_API")
+	configurators.Bool(&EnableInfoEndpoint, "IMGPROXY_ENABLE_INFO_ENDPOINT")
+	configurators.Bool(&EnableValidateEndpoint, "IMGPROXY_ENABLE_VALIDATE_ENDPOINT")
+
+	configurators.StringSlice(&AllowOrigins, "IMGPROXY_ALLOW_ORIGIN")
+	configurators.String(&CORSAllowMethods, "IMGPROXY_CORS_ALLOW_METHODS")
+	configurators.String(&CORSAllowHeaders, "IMGPROXY_CORS_ALLOW_HEADERS")
+	configurators.String(&CORSExposeHeaders, "IMGPROXY_CORS_EXPOSE_HEADERS")
+	configurators.Int(&CORSMaxAge, "IMGPROXY_CORS_MAX_AGE")
 
 	configurators.String(&UserAgent, "IMGPROXY_USER_AGENT")
+	configurators.Bool(&ForwardRequestID, "IMGPROXY_FORWARD_REQUEST_ID")
 
 	configurators.Bool(&IgnoreSslVerification, "IMGPROXY_IGNORE_SSL_VERIFICATION")
 	configurators.Bool(&DevelopmentErrorsMode, "IMGPROXY_DEVELOPMENT_ERRORS_MODE")
@@ -363,6 +836,8 @@ func Configure() error {
 	configurators.Bool(&S3Enabled, "IMGPROXY_USE_S3")
 	configurators.String(&S3Region, "IMGPROXY_S3_REGION")
 	configurators.String(&S3Endpoint, "IMGPROXY_S3_ENDPOINT")
+	configurators.Bool(&S3ForcePathStyle, "IMGPROXY_S3_FORCE_PATH_STYLE")
+	configurators.Bool(&S3IgnoreSslVerification, "IMGPROXY_S3_IGNORE_SSL_VERIFICATION")
 
 	configurators.Bool(&GCSEnabled, "IMGPROXY_USE_GCS")
 	configurators.String(&GCSKey, "IMGPROXY_GCS_KEY")
@@ -371,22 +846,74 @@ func Configure() error {
 	configurators.String(&ABSName, "IMGPROXY_ABS_NAME")
 	configurators.String(&ABSKey, "IMGPROXY_ABS_KEY")
 	configurators.String(&ABSEndpoint, "IMGPROXY_ABS_ENDPOINT")
+	configurators.String(&ABSSASToken, "IMGPROXY_ABS_SAS_TOKEN")
+	if err := configurators.StringMap(ABSSASTokens, "IMGPROXY_ABS_SAS_TOKENS"); err != nil {
+		return err
+	}
+	configurators.Bool(&ABSUseManagedIdentity, "IMGPROXY_ABS_USE_MANAGED_IDENTITY")
+	configurators.String(&ABSManagedIdentityClientID, "IMGPROXY_ABS_MANAGED_IDENTITY_CLIENT_ID")
 
 	configurators.Bool(&ETagEnabled, "IMGPROXY_USE_ETAG")
 	configurators.String(&ETagBuster, "IMGPROXY_ETAG_BUSTER")
 
+	configurators.Bool(&LastModifiedEnabled, "IMGPROXY_USE_LAST_MODIFIED")
+
+	configurators.String(&ResultCache, "IMGPROXY_RESULT_CACHE")
+	configurators.Int(&ResultCacheTTL, "IMGPROXY_RESULT_CACHE_TTL")
+	configurators.String(&ResultCacheDiskPath, "IMGPROXY_RESULT_CACHE_DISK_PATH")
+	configurators.Int(&ResultCacheDiskMaxSize, "IMGPROXY_RESULT_CACHE_DISK_MAX_SIZE")
+	configurators.Int(&ResultCacheDiskSweepInterval, "IMGPROXY_RESULT_CACHE_DISK_SWEEP_INTERVAL")
+	configurators.String(&ResultCacheRedisAddr, "IMGPROXY_RESULT_CACHE_REDIS_ADDR")
+	configurators.String(&ResultCacheRedisPassword, "IMGPROXY_RESULT_CACHE_REDIS_PASSWORD")
+	configurators.Int(&ResultCacheRedisDB, "IMGPROXY_RESULT_CACHE_REDIS_DB")
+	configurators.String(&ResultCacheS3Bucket, "IMGPROXY_RESULT_CACHE_S3_BUCKET")
+	configurators.String(&ResultCacheS3Prefix, "IMGPROXY_RESULT_CACHE_S3_PREFIX")
+
 	configurators.String(&BaseURL, "IMGPROXY_BASE_URL")
 
-	configurators.StringSlice(&Presets, "IMGPROXY_PRESETS")
-	if err := configurators.StringSliceFile(&Presets, presetsPath); err != nil {
+	if err := readPresets(&Presets); err != nil {
 		return err
 	}
 	configurators.Bool(&OnlyPresets, "IMGPROXY_ONLY_PRESETS")
+	configurators.StringSlice(&OnlyPresetsExtraOptions, "IMGPROXY_ONLY_PRESETS_EXTRA_OPTIONS")
+	configurators.Bool(&AllowUnsignedPresets, "IMGPROXY_ALLOW_UNSIGNED_PRESETS")
+	configurators.Bool(&SkipInvalidPresets, "IMGPROXY_SKIP_INVALID_PRESETS")
+
+	configurators.StringSlice(&SourceHostOptions, "IMGPROXY_SOURCE_HOST_OPTIONS")
+
+	configurators.StringSlice(&Filters, "IMGPROXY_FILTERS")
+	if err := configurators.StringMap(LUTs, "IMGPROXY_LUTS"); err != nil {
+		return err
+	}
+
+	pathPrefixPresets := make(map[string]string)
+	if err := configurators.StringMap(pathPrefixPresets, "IMGPROXY_PATH_PREFIX_PRESETS"); err != nil {
+		return err
+	}
+	for prefix, presets := range pathPrefixPresets {
+		PathPrefixPresets[prefix] = strings.Split(presets, ":")
+	}
+
+	configurators.Bool(&EnableThumborCompat, "IMGPROXY_ENABLE_THUMBOR_COMPAT")
+	configurators.String(&ThumborPathPrefix, "IMGPROXY_THUMBOR_PATH_PREFIX")
+	configurators.String(&ThumborSecurityKey, "IMGPROXY_THUMBOR_SECURITY_KEY")
+
+	configurators.Bool(&EnableCloudinaryCompat, "IMGPROXY_ENABLE_CLOUDINARY_COMPAT")
+	configurators.String(&CloudinaryPathPrefix, "IMGPROXY_CLOUDINARY_PATH_PREFIX")
+	configurators.String(&CloudinaryAPISecret, "IMGPROXY_CLOUDINARY_API_SECRET")
+
+	configurators.Int(&ReloadCheckInterval, "IMGPROXY_RELOAD_CHECK_INTERVAL")
 
 	configurators.String(&WatermarkData, "IMGPROXY_WATERMARK_DATA")
 	configurators.String(&WatermarkPath, "IMGPROXY_WATERMARK_PATH")
 	configurators.String(&WatermarkURL, "IMGPROXY_WATERMARK_URL")
 	configurators.Float(&WatermarkOpacity, "IMGPROXY_WATERMARK_OPACITY")
+	configurators.Bool(&WatermarkFirstFrameOnly, "IMGPROXY_WATERMARK_FIRST_FRAME_ONLY")
+
+	configurators.String(&AttributionCopyright, "IMGPROXY_ATTRIBUTION_COPYRIGHT")
+	configurators.String(&AttributionCreator, "IMGPROXY_ATTRIBUTION_CREATOR")
+
+	configurators.Int(&MaxOverlays, "IMGPROXY_MAX_OVERLAYS")
 
 	configurators.String(&FallbackImageData, "IMGPROXY_FALLBACK_IMAGE_DATA")
 	configurators.String(&FallbackImagePath, "IMGPROXY_FALLBACK_IMAGE_PATH")
@@ -394,13 +921,23 @@ func Configure() error {
 	configurators.Int(&FallbackImageHTTPCode, "IMGPROXY_FALLBACK_IMAGE_HTTP_CODE")
 
 	configurators.Bool(&DataDogEnable, "IMGPROXY_DATADOG_ENABLE")
+	configurators.Bool(&DataDogEnableMetrics, "IMGPROXY_DATADOG_ENABLE_ADDITIONAL_METRICS")
 
 	configurators.String(&NewRelicAppName, "IMGPROXY_NEW_RELIC_APP_NAME")
 	configurators.String(&NewRelicKey, "IMGPROXY_NEW_RELIC_KEY")
 
 	configurators.String(&PrometheusBind, "IMGPROXY_PROMETHEUS_BIND")
+	configurators.String(&PrometheusPath, "IMGPROXY_PROMETHEUS_PATH")
 	configurators.String(&PrometheusNamespace, "IMGPROXY_PROMETHEUS_NAMESPACE")
 
+	configurators.String(&OpenTelemetryEndpoint, "IMGPROXY_OPEN_TELEMETRY_ENDPOINT")
+	configurators.String(&OpenTelemetryServiceName, "IMGPROXY_OPEN_TELEMETRY_SERVICE_NAME")
+
+	configurators.String(&AccessLogFormat, "IMGPROXY_ACCESS_LOG_FORMAT")
+	configurators.StringSlice(&AccessLogFields, "IMGPROXY_ACCESS_LOG_FIELDS")
+
+	configurators.Float(&SlowRequestThreshold, "IMGPROXY_SLOW_REQUEST_THRESHOLD")
+
 	configurators.String(&BugsnagKey, "IMGPROXY_BUGSNAG_KEY")
 	configurators.String(&BugsnagStage, "IMGPROXY_BUGSNAG_STAGE")
 	configurators.String(&HoneybadgerKey, "IMGPROXY_HONEYBADGER_KEY")
@@ -411,16 +948,47 @@ func Configure() error {
 	configurators.Int(&AirbrakeProjecID, "IMGPROXY_AIRBRAKE_PROJECT_ID")
 	configurators.String(&AirbrakeProjecKey, "IMGPROXY_AIRBRAKE_PROJECT_KEY")
 	configurators.String(&AirbrakeEnv, "IMGPROXY_AIRBRAKE_ENVIRONMENT")
+	configurators.String(&ErrorWebhookURL, "IMGPROXY_ERROR_WEBHOOK_URL")
+	configurators.String(&ErrorWebhookSecret, "IMGPROXY_ERROR_WEBHOOK_SECRET")
 	configurators.Bool(&ReportDownloadingErrors, "IMGPROXY_REPORT_DOWNLOADING_ERRORS")
 	configurators.Bool(&EnableDebugHeaders, "IMGPROXY_ENABLE_DEBUG_HEADERS")
+	configurators.Bool(&EnableImageSizeHeaders, "IMGPROXY_ENABLE_IMAGE_SIZE_HEADERS")
+	configurators.Bool(&EnablePerceptualHashHeaders, "IMGPROXY_ENABLE_PERCEPTUAL_HASH_HEADERS")
+	configurators.Bool(&EnableAverageColorHeader, "IMGPROXY_ENABLE_AVERAGE_COLOR_HEADER")
+	configurators.Bool(&InfoPerceptualHashes, "IMGPROXY_INFO_PERCEPTUAL_HASHES")
+	configurators.Bool(&InfoEntropy, "IMGPROXY_INFO_ENTROPY")
+	configurators.Bool(&InfoFaces, "IMGPROXY_INFO_FACES")
+	configurators.Bool(&InfoBarcodes, "IMGPROXY_INFO_BARCODES")
+	configurators.String(&ZbarimgPath, "IMGPROXY_ZBARIMG_PATH")
+	configurators.Int(&BarcodeTimeout, "IMGPROXY_BARCODE_TIMEOUT")
+
+	configurators.String(&DebugEndpointsSecret, "IMGPROXY_DEBUG_ENDPOINTS_SECRET")
 
 	configurators.Int(&FreeMemoryInterval, "IMGPROXY_FREE_MEMORY_INTERVAL")
 	configurators.Int(&DownloadBufferSize, "IMGPROXY_DOWNLOAD_BUFFER_SIZE")
 	configurators.Int(&BufferPoolCalibrationThreshold, "IMGPROXY_BUFFER_POOL_CALIBRATION_THRESHOLD")
 
+	configurators.Int(&MemorySoftLimit, "IMGPROXY_MEMORY_SOFT_LIMIT")
+	configurators.Int(&MemorySoftLimitWait, "IMGPROXY_MEMORY_SOFT_LIMIT_WAIT")
+	configurators.MegaInt(&MemorySoftLimitMinResolution, "IMGPROXY_MEMORY_SOFT_LIMIT_MIN_RESOLUTION")
+
+	configurators.Int(&VipsCacheMax, "IMGPROXY_VIPS_CACHE_MAX")
+	configurators.Int(&VipsCacheMaxMem, "IMGPROXY_VIPS_CACHE_MAX_MEM")
+	configurators.Int(&VipsCacheMaxFiles, "IMGPROXY_VIPS_CACHE_MAX_FILES")
+	configurators.Int(&VipsConcurrency, "IMGPROXY_VIPS_CONCURRENCY")
+
+	configurators.Int(&GCPercent, "IMGPROXY_GC_PERCENT")
+	configurators.Int(&MemoryBallastSize, "IMGPROXY_MEMORY_BALLAST_SIZE")
+
 	if len(Keys) != len(Salts) {
 		return fmt.Errorf("Number of keys and number of salts should be equal. Keys: %d, salts: %d", len(Keys), len(Salts))
 	}
+
+	// JSON API signs the requested URLs itself, so it should be protected
+	// with the secret when URL signature is enabled
+	if EnableJSONAPI && len(Keys) > 0 && len(Secret) == 0 {
+		return fmt.Errorf("IMGPROXY_SECRET should be set to enable JSON API when URL signature is enabled")
+	}
 	if len(Keys) == 0 {
 		log.Warning("No keys defined, so signature checking is disabled")
 	}
@@ -436,6 +1004,44 @@ func Configure() error {
 		return fmt.Errorf("Bind address is not defined")
 	}
 
+	// Path prefix like /img/ is used as /img
+	PathPrefix = strings.TrimSuffix(PathPrefix, "/")
+	if len(PathPrefix) > 0 && !strings.HasPrefix(PathPrefix, "/") {
+		return fmt.Errorf("Path prefix should start with /, now - %s", PathPrefix)
+	}
+
+	if !strings.HasPrefix(HealthPath, "/") || HealthPath == "/" {
+		return fmt.Errorf("Health path should start with / and can't be /, now - %s", HealthPath)
+	}
+
+	if len(LivenessPath) > 0 && (!strings.HasPrefix(LivenessPath, "/") || LivenessPath == "/") {
+		return fmt.Errorf("Liveness path should start with / and can't be /, now - %s", LivenessPath)
+	}
+
+	if len(ReadinessPath) > 0 && (!strings.HasPrefix(ReadinessPath, "/") || ReadinessPath == "/") {
+		return fmt.Errorf("Readiness path should start with / and can't be /, now - %s", ReadinessPath)
+	}
+
+	for _, check := range ReadinessChecks {
+		switch check {
+		case "queue", "vips", "result_cache":
+		default:
+			return fmt.Errorf("Unknown readiness check: %s", check)
+		}
+	}
+
+	if len(PrometheusPath) > 0 && !strings.HasPrefix(PrometheusPath, "/") {
+		return fmt.Errorf("Prometheus path should start with /, now - %s", PrometheusPath)
+	}
+
+	if (len(TLSCertPath) > 0) != (len(TLSKeyPath) > 0) {
+		return fmt.Errorf("Both IMGPROXY_TLS_CERT_PATH and IMGPROXY_TLS_KEY_PATH should be set to enable TLS")
+	}
+
+	if EnableHTTP3 && len(TLSCertPath) == 0 {
+		return fmt.Errorf("HTTP/3 requires TLS. Set IMGPROXY_TLS_CERT_PATH and IMGPROXY_TLS_KEY_PATH to enable it")
+	}
+
 	if ReadTimeout <= 0 {
 		return fmt.Errorf("Read timeout should be greater than 0, now - %d\n", ReadTimeout)
 	}
@@ -447,22 +1053,112 @@ func Configure() error {
 		return fmt.Errorf("KeepAlive timeout should be greater than or equal to 0, now - %d\n", KeepAliveTimeout)
 	}
 
+	if ReadHeaderTimeout < 0 {
+		return fmt.Errorf("Read header timeout should be greater than or equal to 0, now - %d\n", ReadHeaderTimeout)
+	}
+
+	if MaxHeaderBytes <= 0 {
+		return fmt.Errorf("Max header bytes should be greater than 0, now - %d\n", MaxHeaderBytes)
+	}
+
+	if HTTP2MaxConcurrentStreams < 0 {
+		return fmt.Errorf("HTTP/2 max concurrent streams should be greater than or equal to 0, now - %d\n", HTTP2MaxConcurrentStreams)
+	}
+
 	if DownloadTimeout <= 0 {
 		return fmt.Errorf("Download timeout should be greater than 0, now - %d\n", DownloadTimeout)
 	}
 
+	if DownloadTimeout >= WriteTimeout {
+		log.Warningf("Download timeout (%d) is not less than write timeout (%d), so a slow source can consume the whole request time", DownloadTimeout, WriteTimeout)
+	}
+
+	if ProcessingTimeout < 0 {
+		return fmt.Errorf("Processing timeout should be greater than or equal to 0, now - %d\n", ProcessingTimeout)
+	}
+
+	if WriteResponseTimeout < 0 {
+		return fmt.Errorf("Write response timeout should be greater than or equal to 0, now - %d\n", WriteResponseTimeout)
+	}
+
 	if Concurrency <= 0 {
 		return fmt.Errorf("Concurrency should be greater than 0, now - %d\n", Concurrency)
 	}
 
+	if RequestsQueueSize < 0 {
+		return fmt.Errorf("Requests queue size should be greater than or equal to 0, now - %d\n", RequestsQueueSize)
+	}
+
+	if RequestsQueueRetryAfter <= 0 {
+		return fmt.Errorf("Requests queue retry after should be greater than 0, now - %d\n", RequestsQueueRetryAfter)
+	}
+
 	if MaxClients <= 0 {
 		MaxClients = Concurrency * 10
 	}
 
+	if MaxOpenConnections < 0 {
+		return fmt.Errorf("Max open connections should be greater than or equal to 0, now - %d\n", MaxOpenConnections)
+	}
+
+	if MaxRequestsPerIP < 0 {
+		return fmt.Errorf("Max requests per IP should be greater than or equal to 0, now - %d\n", MaxRequestsPerIP)
+	}
+
+	if DownloadMaxIdleConns <= 0 {
+		DownloadMaxIdleConns = Concurrency
+	}
+
+	if DownloadMaxIdleConnsPerHost <= 0 {
+		DownloadMaxIdleConnsPerHost = Concurrency
+	}
+
+	if DownloadMaxConnsPerHost < 0 {
+		return fmt.Errorf("Download max connections per host should be greater than or equal to 0, now - %d\n", DownloadMaxConnsPerHost)
+	}
+
+	if DownloadIdleConnTimeout < 0 {
+		return fmt.Errorf("Download idle connection timeout should be greater than or equal to 0, now - %d\n", DownloadIdleConnTimeout)
+	}
+
+	if DownloadTLSSessionCacheSize < 0 {
+		return fmt.Errorf("Download TLS session cache size should be greater than or equal to 0, now - %d\n", DownloadTLSSessionCacheSize)
+	}
+
+	if (len(DownloadClientCertPath) > 0) != (len(DownloadClientKeyPath) > 0) {
+		return fmt.Errorf("Both IMGPROXY_DOWNLOAD_CLIENT_CERT_PATH and IMGPROXY_DOWNLOAD_CLIENT_KEY_PATH should be set")
+	}
+
+	if DownloadErrorCacheTTL < 0 {
+		return fmt.Errorf("Download error cache TTL should be greater than or equal to 0, now - %d\n", DownloadErrorCacheTTL)
+	}
+
+	if DownloadErrorCacheSize <= 0 {
+		return fmt.Errorf("Download error cache size should be greater than 0, now - %d\n", DownloadErrorCacheSize)
+	}
+
 	if TTL <= 0 {
 		return fmt.Errorf("TTL should be greater than 0, now - %d\n", TTL)
 	}
 
+	for _, src := range SurrogateKeySources {
+		if src != "url" && src != "host" && src != "preset" {
+			return fmt.Errorf("Unknown surrogate key source: %s", src)
+		}
+	}
+
+	if CORSMaxAge < 0 {
+		return fmt.Errorf("CORS max age should be greater than or equal to 0, now - %d\n", CORSMaxAge)
+	}
+
+	if StaleWhileRevalidate < 0 {
+		return fmt.Errorf("Stale-while-revalidate should be greater than or equal to 0, now - %d\n", StaleWhileRevalidate)
+	}
+
+	if StaleIfError < 0 {
+		return fmt.Errorf("Stale-if-error should be greater than or equal to 0, now - %d\n", StaleIfError)
+	}
+
 	if MaxSrcResolution <= 0 {
 		return fmt.Errorf("Max src resolution should be greater than 0, now - %d\n", MaxSrcResolution)
 	}
@@ -475,12 +1171,71 @@ func Configure() error {
 		return fmt.Errorf("Max animation frames should be greater than 0, now - %d\n", MaxAnimationFrames)
 	}
 
+	if MaxAnimationResolution < 0 {
+		return fmt.Errorf("Max animation resolution should be greater than or equal to 0, now - %d\n", MaxAnimationResolution)
+	}
+
+	if MaxAnimationResultDimension < 0 {
+		return fmt.Errorf("Max animation result dimension should be greater than or equal to 0, now - %d\n", MaxAnimationResultDimension)
+	}
+
+	if MaxResultDimension < 0 {
+		return fmt.Errorf("Max result dimension should be greater than or equal to 0, now - %d\n", MaxResultDimension)
+	}
+
+	if len(ThumborPathPrefix) > 0 && (!strings.HasPrefix(ThumborPathPrefix, "/") || strings.HasSuffix(ThumborPathPrefix, "/")) {
+		return fmt.Errorf("Thumbor path prefix should start with '/' and should not end with '/': %s", ThumborPathPrefix)
+	}
+
+	if len(CloudinaryPathPrefix) > 0 && (!strings.HasPrefix(CloudinaryPathPrefix, "/") || strings.HasSuffix(CloudinaryPathPrefix, "/")) {
+		return fmt.Errorf("Cloudinary path prefix should start with '/' and should not end with '/': %s", CloudinaryPathPrefix)
+	}
+
+	// Thumbor and Cloudinary URLs are signed with their own keys, so they
+	// would bypass the URL signature if the keys are not set
+	if EnableThumborCompat && len(Keys) > 0 && len(ThumborSecurityKey) == 0 {
+		return fmt.Errorf("IMGPROXY_THUMBOR_SECURITY_KEY should be set to enable Thumbor compatibility when URL signature is enabled")
+	}
+
+	if EnableCloudinaryCompat && len(Keys) > 0 && len(CloudinaryAPISecret) == 0 {
+		return fmt.Errorf("IMGPROXY_CLOUDINARY_API_SECRET should be set to enable Cloudinary compatibility when URL signature is enabled")
+	}
+
+	if EnableThumborCompat && EnableCloudinaryCompat && (len(ThumborPathPrefix) == 0 || len(CloudinaryPathPrefix) == 0) {
+		return fmt.Errorf("Path prefixes should be set for both Thumbor and Cloudinary URLs when both are enabled")
+	}
+
+	for prefix := range PathPrefixPresets {
+		if !strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") {
+			return fmt.Errorf("Path prefix should start with '/' and should not end with '/': %s", prefix)
+		}
+	}
+
+	for alias, target := range URLOptionAliases {
+		if strings.ContainsAny(alias, ":/") {
+			return fmt.Errorf("URL option alias can't contain ':' or '/': %s", alias)
+		}
+		if strings.Contains(target, "/") || strings.HasPrefix(target, ":") {
+			return fmt.Errorf("Invalid URL option alias target: %s=%s", alias, target)
+		}
+	}
+
 	if PngQuantizationColors < 2 {
 		return fmt.Errorf("Png quantization colors should be greater than 1, now - %d\n", PngQuantizationColors)
 	} else if PngQuantizationColors > 256 {
 		return fmt.Errorf("Png quantization colors can't be greater than 256, now - %d\n", PngQuantizationColors)
 	}
 
+	if GifDither < 0 || GifDither > 1 {
+		return fmt.Errorf("GIF dither should be between 0 and 1, now - %g\n", GifDither)
+	}
+
+	if GifEffort < 1 {
+		return fmt.Errorf("GIF effort should be greater than 0, now - %d\n", GifEffort)
+	} else if GifEffort > 10 {
+		return fmt.Errorf("GIF effort can't be greater than 10, now - %d\n", GifEffort)
+	}
+
 	if AvifSpeed <= 0 {
 		return fmt.Errorf("Avif speed should be greater than 0, now - %d\n", AvifSpeed)
 	} else if AvifSpeed > 8 {
@@ -493,10 +1248,20 @@ func Configure() error {
 		return fmt.Errorf("Quality can't be greater than 100, now - %d\n", Quality)
 	}
 
+	if AdaptiveQualityDelta < 0 {
+		return fmt.Errorf("Adaptive quality delta should be greater than or equal to 0, now - %d\n", AdaptiveQualityDelta)
+	} else if AdaptiveQualityDelta > 100 {
+		return fmt.Errorf("Adaptive quality delta can't be greater than 100, now - %d\n", AdaptiveQualityDelta)
+	}
+
 	if IgnoreSslVerification {
 		log.Warning("Ignoring SSL verification is very unsafe")
 	}
 
+	if S3IgnoreSslVerification {
+		log.Warning("Ignoring S3 SSL verification is very unsafe")
+	}
+
 	if LocalFileSystemRoot != "" {
 		stat, err := os.Stat(LocalFileSystemRoot)
 
@@ -518,20 +1283,85 @@ func Configure() error {
 		GCSEnabled = true
 	}
 
+	if ABSUseManagedIdentity && len(ABSKey) > 0 {
+		return fmt.Errorf("IMGPROXY_ABS_KEY can't be used with IMGPROXY_ABS_USE_MANAGED_IDENTITY")
+	}
+
+	switch ResultCache {
+	case "":
+	case "disk":
+		if len(ResultCacheDiskPath) == 0 {
+			return fmt.Errorf("Result cache disk path is not set")
+		}
+	case "redis":
+		if len(ResultCacheRedisAddr) == 0 {
+			return fmt.Errorf("Result cache Redis address is not set")
+		}
+	case "s3":
+		if len(ResultCacheS3Bucket) == 0 {
+			return fmt.Errorf("Result cache S3 bucket is not set")
+		}
+	default:
+		return fmt.Errorf("Unknown result cache: %s", ResultCache)
+	}
+
+	if ResultCacheTTL < 0 {
+		return fmt.Errorf("Result cache TTL should be greater than or equal to 0, now - %d\n", ResultCacheTTL)
+	} else if ResultCacheTTL == 0 {
+		ResultCacheTTL = TTL
+	}
+
+	if ResultCacheDiskMaxSize < 0 {
+		return fmt.Errorf("Result cache disk max size should be greater than or equal to 0, now - %d\n", ResultCacheDiskMaxSize)
+	}
+
+	if ResultCacheDiskSweepInterval < 0 {
+		return fmt.Errorf("Result cache disk sweep interval should be greater than or equal to 0, now - %d\n", ResultCacheDiskSweepInterval)
+	}
+
+	if ResultCacheRedisDB < 0 {
+		return fmt.Errorf("Result cache Redis DB should be greater than or equal to 0, now - %d\n", ResultCacheRedisDB)
+	}
+
+	if RefererBlockMode != "forbidden" && RefererBlockMode != "watermark" {
+		return fmt.Errorf("Referer block mode should be one of: forbidden, watermark, now - %s\n", RefererBlockMode)
+	}
+
+	if RefererBlockMode == "watermark" && len(AllowedReferers) > 0 &&
+		len(WatermarkData) == 0 && len(WatermarkPath) == 0 && len(WatermarkURL) == 0 {
+		return fmt.Errorf("Referer block mode is set to watermark but watermark is not configured")
+	}
+
 	if WatermarkOpacity <= 0 {
 		return fmt.Errorf("Watermark opacity should be greater than 0")
 	} else if WatermarkOpacity > 1 {
 		return fmt.Errorf("Watermark opacity should be less than or equal to 1")
 	}
 
+	if MaxOverlays < 0 {
+		return fmt.Errorf("Max overlays should be greater than or equal to 0, now - %d\n", MaxOverlays)
+	}
+
 	if FallbackImageHTTPCode < 100 || FallbackImageHTTPCode > 599 {
 		return fmt.Errorf("Fallback image HTTP code should be between 100 and 599")
 	}
 
+	if SlowRequestThreshold < 0 {
+		return fmt.Errorf("Slow request threshold should be greater than or equal to 0, now - %g\n", SlowRequestThreshold)
+	}
+
+	if len(AccessLogFormat) > 0 && AccessLogFormat != "json" {
+		return fmt.Errorf("Access log format should be blank or json, now - %s\n", AccessLogFormat)
+	}
+
 	if len(PrometheusBind) > 0 && PrometheusBind == Bind {
 		return fmt.Errorf("Can't use the same binding for the main server and Prometheus")
 	}
 
+	if ReloadCheckInterval < 0 {
+		return fmt.Errorf("Reload check interval should be greater than or equal to 0, now - %d\n", ReloadCheckInterval)
+	}
+
 	if FreeMemoryInterval <= 0 {
 		return fmt.Errorf("Free memory interval should be greater than zero")
 	}
@@ -546,5 +1376,111 @@ func Configure() error {
 		return fmt.Errorf("Buffer pool calibration threshold should be greater than or equal to 64")
 	}
 
+	if FaceDetectionMinScore < 0 {
+		return fmt.Errorf("Face detection min score should be greater than or equal to 0, now - %f\n", FaceDetectionMinScore)
+	}
+
+	if ObjectDetectionMinScore < 0 {
+		return fmt.Errorf("Object detection min score should be greater than or equal to 0, now - %f\n", ObjectDetectionMinScore)
+	}
+
+	if BarcodeTimeout <= 0 {
+		return fmt.Errorf("Barcode timeout should be greater than 0, now - %d\n", BarcodeTimeout)
+	}
+
+	if VideoConcurrency <= 0 {
+		return fmt.Errorf("Video concurrency should be greater than 0, now - %d\n", VideoConcurrency)
+	}
+
+	if VideoTimeout <= 0 {
+		return fmt.Errorf("Video timeout should be greater than 0, now - %d\n", VideoTimeout)
+	}
+
+	if MaxVideoSegmentDuration < 0 {
+		return fmt.Errorf("Max video segment duration should be greater than or equal to 0, now - %f\n", MaxVideoSegmentDuration)
+	}
+
+	if VideoSegmentFPS <= 0 {
+		return fmt.Errorf("Video segment FPS should be greater than 0, now - %d\n", VideoSegmentFPS)
+	} else if VideoSegmentFPS > 50 {
+		return fmt.Errorf("Video segment FPS can't be greater than 50, now - %d\n", VideoSegmentFPS)
+	}
+
+	if SmartCropCacheSize < 0 {
+		return fmt.Errorf("Smart crop cache size should be greater than or equal to 0, now - %d\n", SmartCropCacheSize)
+	}
+
+	if MemorySoftLimit < 0 {
+		return fmt.Errorf("Memory soft limit should be greater than or equal to 0, now - %d\n", MemorySoftLimit)
+	}
+
+	if MemorySoftLimitWait < 0 {
+		return fmt.Errorf("Memory soft limit wait should be greater than or equal to 0, now - %d\n", MemorySoftLimitWait)
+	}
+
+	if MemorySoftLimitMinResolution < 0 {
+		return fmt.Errorf("Memory soft limit min resolution should be greater than or equal to 0, now - %d\n", MemorySoftLimitMinResolution)
+	}
+
+	if VipsCacheMax < 0 {
+		return fmt.Errorf("Vips cache max should be greater than or equal to 0, now - %d\n", VipsCacheMax)
+	}
+
+	if VipsCacheMaxMem < 0 {
+		return fmt.Errorf("Vips cache max mem should be greater than or equal to 0, now - %d\n", VipsCacheMaxMem)
+	}
+
+	if VipsCacheMaxFiles < 0 {
+		return fmt.Errorf("Vips cache max files should be greater than or equal to 0, now - %d\n", VipsCacheMaxFiles)
+	}
+
+	if VipsConcurrency <= 0 {
+		return fmt.Errorf("Vips concurrency should be greater than 0, now - %d\n", VipsConcurrency)
+	}
+
+	if GCPercent < 0 {
+		return fmt.Errorf("GC percent should be greater than or equal to 0, now - %d\n", GCPercent)
+	}
+
+	if MemoryBallastSize < 0 {
+		return fmt.Errorf("Memory ballast size should be greater than or equal to 0, now - %d\n", MemoryBallastSize)
+	}
+
 	return nil
 }
+
+func readPresets(presets *[]string) error {
+	configurators.StringSlice(presets, "IMGPROXY_PRESETS")
+	return configurators.StringSliceFile(presets, presetsPath)
+}
+
+// ReloadPresets reads the presets again from the config file,
+// the environment, and the presets file
+func ReloadPresets() ([]string, error) {
+	if err := loadConfigFile(configFilePath); err != nil {
+		return nil, err
+	}
+
+	var presets []string
+
+	if err := readPresets(&presets); err != nil {
+		return nil, err
+	}
+
+	return presets, nil
+}
+
+// PresetsFiles returns the paths of the files the presets are read from
+func PresetsFiles() []string {
+	files := make([]string, 0, 2)
+
+	if len(configFilePath) > 0 {
+		files = append(files, configFilePath)
+	}
+
+	if len(presetsPath) > 0 {
+		files = append(files, presetsPath)
+	}
+
+	return files
+}
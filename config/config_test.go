@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThumborCompatRequiresSecurityKey(t *testing.T) {
+	names := []string{
+		"IMGPROXY_KEY",
+		"IMGPROXY_SALT",
+		"IMGPROXY_ENABLE_THUMBOR_COMPAT",
+		"IMGPROXY_THUMBOR_SECURITY_KEY",
+	}
+	for _, name := range names {
+		defer os.Unsetenv(name)
+	}
+	defer Reset()
+
+	os.Setenv("IMGPROXY_KEY", "746573742d6b6579")
+	os.Setenv("IMGPROXY_SALT", "746573742d73616c74")
+	os.Setenv("IMGPROXY_ENABLE_THUMBOR_COMPAT", "true")
+
+	Reset()
+	assert.Error(t, Configure())
+
+	os.Setenv("IMGPROXY_THUMBOR_SECURITY_KEY", "MY_SECURE_KEY")
+
+	Reset()
+	require.Nil(t, Configure())
+}
+
+func TestCloudinaryCompatRequiresAPISecret(t *testing.T) {
+	names := []string{
+		"IMGPROXY_KEY",
+		"IMGPROXY_SALT",
+		"IMGPROXY_ENABLE_CLOUDINARY_COMPAT",
+		"IMGPROXY_CLOUDINARY_API_SECRET",
+	}
+	for _, name := range names {
+		defer os.Unsetenv(name)
+	}
+	defer Reset()
+
+	os.Setenv("IMGPROXY_KEY", "746573742d6b6579")
+	os.Setenv("IMGPROXY_SALT", "746573742d73616c74")
+	os.Setenv("IMGPROXY_ENABLE_CLOUDINARY_COMPAT", "true")
+
+	Reset()
+	assert.Error(t, Configure())
+
+	os.Setenv("IMGPROXY_CLOUDINARY_API_SECRET", "abcd")
+
+	Reset()
+	require.Nil(t, Configure())
+}
+
+func TestHTTP3RequiresTLS(t *testing.T) {
+	names := []string{
+		"IMGPROXY_ENABLE_HTTP3",
+		"IMGPROXY_TLS_CERT_PATH",
+		"IMGPROXY_TLS_KEY_PATH",
+	}
+	for _, name := range names {
+		defer os.Unsetenv(name)
+	}
+	defer Reset()
+
+	os.Setenv("IMGPROXY_ENABLE_HTTP3", "true")
+
+	Reset()
+	assert.Error(t, Configure())
+
+	os.Setenv("IMGPROXY_TLS_CERT_PATH", "/certs/cert.pem")
+	os.Setenv("IMGPROXY_TLS_KEY_PATH", "/certs/key.pem")
+
+	Reset()
+	require.Nil(t, Configure())
+}
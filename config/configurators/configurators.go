@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"encoding/hex"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"regexp"
 	"strconv"
@@ -82,6 +84,20 @@ func Bool(b *bool, name string) {
 	}
 }
 
+// FileMode parses the file mode in the octal notation like 0660
+func FileMode(m *os.FileMode, name string) error {
+	if env := os.Getenv(name); len(env) > 0 {
+		mode, err := strconv.ParseUint(env, 8, 32)
+		if err != nil || mode > 0777 {
+			return fmt.Errorf("Invalid %s: %s", name, env)
+		}
+
+		*m = os.FileMode(mode)
+	}
+
+	return nil
+}
+
 func ImageTypes(it *[]imagetype.Type, name string) error {
 	*it = []imagetype.Type{}
 
@@ -130,6 +146,52 @@ func ImageTypesQuality(m map[imagetype.Type]int, name string) error {
 	return nil
 }
 
+func StringMap(m map[string]string, name string) error {
+	if env := os.Getenv(name); len(env) > 0 {
+		parts := strings.Split(env, ",")
+
+		for _, p := range parts {
+			i := strings.Index(p, "=")
+			if i < 0 {
+				return fmt.Errorf("Invalid key/value pair: %s", p)
+			}
+
+			key, value := strings.TrimSpace(p[:i]), strings.TrimSpace(p[i+1:])
+			if len(key) == 0 || len(value) == 0 {
+				return fmt.Errorf("Invalid key/value pair: %s", p)
+			}
+
+			m[key] = value
+		}
+	}
+
+	return nil
+}
+
+// HeadersMap reads HTTP headers in the Header1=value1\;Header2=value2 format.
+// Header values may contain commas, so the headers are divided with \;
+func HeadersMap(m map[string]string, name string) error {
+	if env := os.Getenv(name); len(env) > 0 {
+		parts := strings.Split(env, `\;`)
+
+		for _, p := range parts {
+			i := strings.Index(p, "=")
+			if i < 0 {
+				return fmt.Errorf("Invalid header: %s", p)
+			}
+
+			key, value := strings.TrimSpace(p[:i]), strings.TrimSpace(p[i+1:])
+			if len(key) == 0 {
+				return fmt.Errorf("Invalid header: %s", p)
+			}
+
+			m[http.CanonicalHeaderKey(key)] = value
+		}
+	}
+
+	return nil
+}
+
 func Hex(b *[][]byte, name string) error {
 	var err error
 
@@ -186,6 +248,27 @@ func HexFile(b *[][]byte, filepath string) error {
 	return nil
 }
 
+func IPNets(s *[]*net.IPNet, name string) error {
+	if env := os.Getenv(name); len(env) > 0 {
+		parts := strings.Split(env, ",")
+		result := make([]*net.IPNet, len(parts))
+
+		for i, p := range parts {
+			_, ipnet, err := net.ParseCIDR(strings.TrimSpace(p))
+			if err != nil {
+				return fmt.Errorf("Invalid network in %s: %s", name, p)
+			}
+			result[i] = ipnet
+		}
+
+		*s = result
+	} else {
+		*s = []*net.IPNet{}
+	}
+
+	return nil
+}
+
 func Patterns(s *[]*regexp.Regexp, name string) {
 	if env := os.Getenv(name); len(env) > 0 {
 		parts := strings.Split(env, ",")
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileVars are the names of the environment variables set
+// from the config file
+var configFileVars = make(map[string]struct{})
+
+// loadConfigFile reads the YAML config file and sets the environment variables
+// defined in it. The variables that are already set in the environment are
+// not overridden, so the environment has priority over the config file.
+// When the config file is loaded again, the variables set from it are updated.
+//
+// The keys of the file are the names of the environment variables either with
+// or without the IMGPROXY_ prefix, case-insensitive. The nested objects are
+// flattened with _ as a separator, and the lists are joined with commas.
+func loadConfigFile(path string) error {
+	if len(path) == 0 {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Can't read config file %s: %s", path, err)
+	}
+
+	var values map[string]interface{}
+
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("Can't parse config file %s: %s", path, err)
+	}
+
+	env := make(map[string]string)
+
+	if err = flattenConfigFileValues(env, "", values); err != nil {
+		return fmt.Errorf("Invalid config file %s: %s", path, err)
+	}
+
+	// The variables removed from the config file should be unset
+	// so they don't affect the reloaded values
+	for name := range configFileVars {
+		if _, ok := env[name]; !ok {
+			os.Unsetenv(name)
+			delete(configFileVars, name)
+		}
+	}
+
+	for name, value := range env {
+		if _, ok := configFileVars[name]; !ok {
+			if _, ok := os.LookupEnv(name); ok {
+				continue
+			}
+		}
+
+		if err = os.Setenv(name, value); err != nil {
+			return err
+		}
+
+		configFileVars[name] = struct{}{}
+	}
+
+	return nil
+}
+
+func configFileEnvName(prefix, key string) string {
+	name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+
+	if len(prefix) > 0 {
+		return prefix + "_" + name
+	}
+
+	if !strings.HasPrefix(name, "IMGPROXY_") {
+		name = "IMGPROXY_" + name
+	}
+
+	return name
+}
+
+func flattenConfigFileValues(env map[string]string, prefix string, values map[string]interface{}) error {
+	for key, value := range values {
+		name := configFileEnvName(prefix, key)
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			if err := flattenConfigFileValues(env, name, nested); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if list, ok := value.([]interface{}); ok {
+			strs := make([]string, len(list))
+
+			for i, v := range list {
+				str, err := configFileScalar(name, v)
+				if err != nil {
+					return err
+				}
+				strs[i] = str
+			}
+
+			env[name] = strings.Join(strs, ",")
+			continue
+		}
+
+		str, err := configFileScalar(name, value)
+		if err != nil {
+			return err
+		}
+
+		env[name] = str
+	}
+
+	return nil
+}
+
+func configFileScalar(name string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("Invalid value of %s: %v", name, value)
+	}
+}
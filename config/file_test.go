@@ -0,0 +1,66 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imgproxy-config")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yml")
+
+	data := `
+bind: ":9090"
+IMGPROXY_QUALITY: 70
+max-src-resolution: 12.5
+jpeg:
+  progressive: true
+presets:
+  - default=rs:fill:100:100
+  - sharp=sh:0.7
+`
+	require.Nil(t, ioutil.WriteFile(path, []byte(data), 0644))
+
+	names := []string{
+		"IMGPROXY_BIND",
+		"IMGPROXY_QUALITY",
+		"IMGPROXY_MAX_SRC_RESOLUTION",
+		"IMGPROXY_JPEG_PROGRESSIVE",
+		"IMGPROXY_PRESETS",
+	}
+	for _, name := range names {
+		defer os.Unsetenv(name)
+	}
+
+	// Environment has priority over the config file
+	os.Setenv("IMGPROXY_QUALITY", "90")
+
+	require.Nil(t, loadConfigFile(path))
+
+	assert.Equal(t, ":9090", os.Getenv("IMGPROXY_BIND"))
+	assert.Equal(t, "90", os.Getenv("IMGPROXY_QUALITY"))
+	assert.Equal(t, "12.5", os.Getenv("IMGPROXY_MAX_SRC_RESOLUTION"))
+	assert.Equal(t, "true", os.Getenv("IMGPROXY_JPEG_PROGRESSIVE"))
+	assert.Equal(t, "default=rs:fill:100:100,sharp=sh:0.7", os.Getenv("IMGPROXY_PRESETS"))
+}
+
+func TestLoadConfigFileInvalid(t *testing.T) {
+	assert.NotNil(t, loadConfigFile("/nonexistent/config.yml"))
+
+	dir, err := ioutil.TempDir("", "imgproxy-config")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yml")
+	require.Nil(t, ioutil.WriteFile(path, []byte("presets:\n  - name: default\n"), 0644))
+
+	assert.NotNil(t, loadConfigFile(path))
+}
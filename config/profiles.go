@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/imgproxy/imgproxy/v3/imath"
+)
+
+// applyPerformanceProfile sets the defaults of the performance-related
+// config values. The values explicitly set via environment variables
+// override the profile defaults
+func applyPerformanceProfile(profile string) error {
+	switch profile {
+	case "":
+		// Keep the defaults
+	case "latency":
+		// Fewer images are processed simultaneously, but libvips uses
+		// several threads to process each of them. The memory ballast
+		// reduces the number of GC cycles on small heaps
+		Concurrency = runtime.NumCPU()
+		VipsConcurrency = imath.Max(1, runtime.NumCPU()/2)
+		GCPercent = 100
+		MemoryBallastSize = 256 * 1024 * 1024
+	case "throughput":
+		// Many images are processed simultaneously, each of them in a single
+		// libvips thread. GC runs less often at the cost of the higher memory usage
+		Concurrency = runtime.NumCPU() * 2
+		VipsConcurrency = 1
+		GCPercent = 200
+		MemoryBallastSize = 0
+	default:
+		return fmt.Errorf("Unknown performance profile: %s", profile)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/router"
+)
+
+// corsOriginMatches checks if the origin matches the allowed origin.
+// The allowed origin can contain a single `*` wildcard, e.g. `https://*.example.com`
+func corsOriginMatches(allowed, origin string) bool {
+	if i := strings.IndexByte(allowed, '*'); i >= 0 {
+		prefix, suffix := allowed[:i], allowed[i+1:]
+
+		return len(origin) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) &&
+			strings.HasSuffix(origin, suffix)
+	}
+
+	return allowed == origin
+}
+
+// corsAllowedOrigin returns the value of the Access-Control-Allow-Origin header
+func corsAllowedOrigin(origin string) string {
+	for _, allowed := range config.AllowOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+
+		if len(origin) > 0 && corsOriginMatches(allowed, origin) {
+			return origin
+		}
+	}
+
+	return ""
+}
+
+func withCORS(h router.RouteHandler) router.RouteHandler {
+	return func(reqID string, rw http.ResponseWriter, r *http.Request) {
+		if len(config.AllowOrigins) == 0 {
+			h(reqID, rw, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		allowedOrigin := corsAllowedOrigin(origin)
+
+		if allowedOrigin != "*" {
+			rw.Header().Add("Vary", "Origin")
+		}
+
+		if len(allowedOrigin) > 0 {
+			rw.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+
+			if len(config.CORSExposeHeaders) > 0 {
+				rw.Header().Set("Access-Control-Expose-Headers", config.CORSExposeHeaders)
+			}
+		}
+
+		// Preflight request
+		if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+			if len(allowedOrigin) > 0 {
+				rw.Header().Set("Access-Control-Allow-Methods", config.CORSAllowMethods)
+
+				if len(config.CORSAllowHeaders) > 0 {
+					rw.Header().Set("Access-Control-Allow-Headers", config.CORSAllowHeaders)
+				}
+
+				if config.CORSMaxAge > 0 {
+					rw.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.CORSMaxAge))
+				}
+			}
+
+			router.LogResponse(reqID, r, 204, nil)
+			rw.WriteHeader(204)
+			return
+		}
+
+		h(reqID, rw, r)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+var errInvalidDebugSecret = ierrors.New(403, "Invalid debug endpoints secret", "Forbidden")
+
+type debugStats struct {
+	Goroutines int `json:"goroutines"`
+
+	GC struct {
+		NumGC          uint32  `json:"num_gc"`
+		PauseTotal     float64 `json:"pause_total_seconds"`
+		LastPause      float64 `json:"last_pause_seconds"`
+		LastGC         string  `json:"last_gc,omitempty"`
+		HeapAlloc      uint64  `json:"heap_alloc_bytes"`
+		HeapSys        uint64  `json:"heap_sys_bytes"`
+		HeapObjects    uint64  `json:"heap_objects"`
+		NextGC         uint64  `json:"next_gc_bytes"`
+		Sys            uint64  `json:"sys_bytes"`
+		GCCPUFraction  float64 `json:"gc_cpu_fraction"`
+		ForcedGCsCount uint32  `json:"forced_gcs"`
+	} `json:"gc"`
+
+	Vips struct {
+		Memory         float64 `json:"memory_bytes"`
+		MaxMemory      float64 `json:"max_memory_bytes"`
+		Allocs         float64 `json:"allocs"`
+		CacheSize      int     `json:"cache_size"`
+		CacheMax       int     `json:"cache_max"`
+		CacheMaxMemory int     `json:"cache_max_memory_bytes"`
+	} `json:"vips"`
+}
+
+type debugPresets struct {
+	Presets  []options.PresetInfo     `json:"presets"`
+	Rejected []options.RejectedPreset `json:"rejected"`
+}
+
+func withDebugSecret(h router.RouteHandler) router.RouteHandler {
+	authHeader := []byte(fmt.Sprintf("Bearer %s", config.DebugEndpointsSecret))
+
+	return withPanicHandler(func(reqID string, rw http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), authHeader) != 1 {
+			panic(errInvalidDebugSecret)
+		}
+
+		h(reqID, rw, r)
+	})
+}
+
+func handleDebugPprof(reqID string, rw http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, config.PathPrefix+"/debug/pprof/")
+
+	// pprof handlers expect the requests to be served at /debug/pprof/
+	r.URL.Path = "/debug/pprof/" + name
+
+	switch name {
+	case "":
+		pprof.Index(rw, r)
+	case "cmdline":
+		pprof.Cmdline(rw, r)
+	case "profile":
+		pprof.Profile(rw, r)
+	case "symbol":
+		pprof.Symbol(rw, r)
+	case "trace":
+		pprof.Trace(rw, r)
+	default:
+		pprof.Handler(name).ServeHTTP(rw, r)
+	}
+
+	router.LogResponse(reqID, r, 200, nil)
+}
+
+func handleDebugStats(reqID string, rw http.ResponseWriter, r *http.Request) {
+	var (
+		stats debugStats
+		mem   runtime.MemStats
+	)
+
+	runtime.ReadMemStats(&mem)
+
+	stats.Goroutines = runtime.NumGoroutine()
+
+	stats.GC.NumGC = mem.NumGC
+	stats.GC.PauseTotal = time.Duration(mem.PauseTotalNs).Seconds()
+	stats.GC.LastPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256]).Seconds()
+	if mem.LastGC > 0 {
+		stats.GC.LastGC = time.Unix(0, int64(mem.LastGC)).Format(time.RFC3339Nano)
+	}
+	stats.GC.HeapAlloc = mem.HeapAlloc
+	stats.GC.HeapSys = mem.HeapSys
+	stats.GC.HeapObjects = mem.HeapObjects
+	stats.GC.NextGC = mem.NextGC
+	stats.GC.Sys = mem.Sys
+	stats.GC.GCCPUFraction = mem.GCCPUFraction
+	stats.GC.ForcedGCsCount = mem.NumForcedGC
+
+	stats.Vips.Memory = vips.GetMem()
+	stats.Vips.MaxMemory = vips.GetMemHighwater()
+	stats.Vips.Allocs = vips.GetAllocs()
+	stats.Vips.CacheSize = vips.GetCacheSize()
+	stats.Vips.CacheMax = vips.GetCacheMax()
+	stats.Vips.CacheMaxMemory = vips.GetCacheMaxMem()
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(200)
+	json.NewEncoder(rw).Encode(stats)
+
+	router.LogResponse(reqID, r, 200, nil)
+}
+
+func handleDebugDropVipsCache(reqID string, rw http.ResponseWriter, r *http.Request) {
+	vips.DropCache()
+
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(204)
+
+	router.LogResponse(reqID, r, 204, nil)
+}
+
+func handleDebugPresets(reqID string, rw http.ResponseWriter, r *http.Request) {
+	presets := debugPresets{
+		Presets:  options.LoadedPresets(),
+		Rejected: options.RejectedPresets(),
+	}
+
+	if presets.Rejected == nil {
+		presets.Rejected = []options.RejectedPreset{}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(200)
+	json.NewEncoder(rw).Encode(presets)
+
+	router.LogResponse(reqID, r, 200, nil)
+}
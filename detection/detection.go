@@ -0,0 +1,327 @@
+package detection
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imath"
+)
+
+// The detector runs pixel intensity comparison cascades in the format
+// of the pico object detection framework (https://github.com/nenadmarkus/pico).
+// It is fast enough to run on every request and doesn't need any external libraries.
+// Each cascade detects objects of a single class.
+// ONNX and TFLite models are not supported, as running them requires an external runtime
+
+const (
+	// MaxImageSize is the maximum size of the image side that is analyzed.
+	// Larger images should be downscaled before detection
+	MaxImageSize = 512
+
+	minObjectSize = 20
+	scaleFactor   = 1.1
+	shiftFactor   = 0.1
+	iouThreshold  = 0.2
+)
+
+// FaceClass is the class of the objects detected with the face detection cascade
+const FaceClass = "face"
+
+// Object is a detected object. X and Y are the coordinates of the object center
+type Object struct {
+	Class string
+	X, Y  int
+	Size  int
+	Score float32
+}
+
+type cascade struct {
+	depth      int
+	trees      int
+	codes      []int8
+	preds      []float32
+	thresholds []float32
+}
+
+type model struct {
+	cascade  *cascade
+	minScore float32
+}
+
+var (
+	models map[string]model
+
+	errInvalidCascade = errors.New("Invalid cascade")
+)
+
+func loadModel(class, path string, minScore float64) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Can't read %s detection cascade: %s", class, err)
+	}
+
+	if format := unsupportedModelFormat(path, data); len(format) > 0 {
+		return fmt.Errorf("Can't load %s detection cascade: %s models are not supported, only pico cascades can be used", class, format)
+	}
+
+	c, err := parseCascade(data)
+	if err != nil {
+		return fmt.Errorf("Can't load %s detection cascade: %s", class, err)
+	}
+
+	models[class] = model{cascade: c, minScore: float32(minScore)}
+
+	return nil
+}
+
+// unsupportedModelFormat returns the name of the model format if the file
+// looks like a neural network model instead of a pico cascade
+func unsupportedModelFormat(path string, data []byte) string {
+	// TFLite models are FlatBuffers with the "TFL3" file identifier
+	if len(data) >= 8 && string(data[4:8]) == "TFL3" {
+		return "TFLite"
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".onnx":
+		return "ONNX"
+	case ".tflite":
+		return "TFLite"
+	}
+
+	return ""
+}
+
+func Init() error {
+	models = make(map[string]model)
+
+	if len(config.FaceDetectionCascadePath) > 0 {
+		if err := loadModel(FaceClass, config.FaceDetectionCascadePath, config.FaceDetectionMinScore); err != nil {
+			return err
+		}
+	}
+
+	for class, path := range config.ObjectDetectionCascades {
+		if err := loadModel(class, path, config.ObjectDetectionMinScore); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Enabled checks if objects of the class can be detected.
+// When the class is empty, it checks if any cascade is loaded
+func Enabled(class string) bool {
+	if len(class) == 0 {
+		return len(models) > 0
+	}
+
+	_, ok := models[class]
+	return ok
+}
+
+func parseCascade(data []byte) (*cascade, error) {
+	// The first 8 bytes contain the cascade version and the unused fields
+	pos := 8
+
+	if len(data) < pos+8 {
+		return nil, errInvalidCascade
+	}
+
+	depth := binary.LittleEndian.Uint32(data[pos:])
+	trees := binary.LittleEndian.Uint32(data[pos+4:])
+	pos += 8
+
+	if depth == 0 || depth > 16 || trees == 0 {
+		return nil, errInvalidCascade
+	}
+
+	leaves := 1 << depth
+	codesSize := 4*leaves - 4
+	treeSize := codesSize + 4*leaves + 4
+
+	if uint64(len(data)-pos) < uint64(trees)*uint64(treeSize) {
+		return nil, errInvalidCascade
+	}
+
+	c := &cascade{
+		depth:      int(depth),
+		trees:      int(trees),
+		codes:      make([]int8, 0, int(trees)*4*leaves),
+		preds:      make([]float32, 0, int(trees)*leaves),
+		thresholds: make([]float32, 0, int(trees)),
+	}
+
+	for t := 0; t < c.trees; t++ {
+		// The root node has index 1, so the first 4 codes are unused
+		c.codes = append(c.codes, 0, 0, 0, 0)
+		for _, b := range data[pos : pos+codesSize] {
+			c.codes = append(c.codes, int8(b))
+		}
+		pos += codesSize
+
+		for i := 0; i < leaves; i++ {
+			c.preds = append(c.preds, math.Float32frombits(binary.LittleEndian.Uint32(data[pos:])))
+			pos += 4
+		}
+
+		c.thresholds = append(c.thresholds, math.Float32frombits(binary.LittleEndian.Uint32(data[pos:])))
+		pos += 4
+	}
+
+	return c, nil
+}
+
+// classify runs the cascade on the square region with the center at row, col
+// and the provided size. It returns a positive score when the region contains an object
+func (c *cascade) classify(row, col, size int, pixels []byte, width, height int) float32 {
+	leaves := 1 << c.depth
+
+	var (
+		root  int
+		score float32
+	)
+
+	row *= 256
+	col *= 256
+
+	pixel := func(r, c int) byte {
+		r = imath.Min(imath.Max(r>>8, 0), height-1)
+		c = imath.Min(imath.Max(c>>8, 0), width-1)
+		return pixels[r*width+c]
+	}
+
+	for t := 0; t < c.trees; t++ {
+		idx := 1
+
+		for d := 0; d < c.depth; d++ {
+			code := c.codes[root+4*idx : root+4*idx+4]
+
+			p1 := pixel(row+int(code[0])*size, col+int(code[1])*size)
+			p2 := pixel(row+int(code[2])*size, col+int(code[3])*size)
+
+			idx *= 2
+			if p1 <= p2 {
+				idx++
+			}
+		}
+
+		score += c.preds[leaves*t+idx-leaves]
+
+		if score <= c.thresholds[t] {
+			return -1
+		}
+
+		root += 4 * leaves
+	}
+
+	return score - c.thresholds[c.trees-1]
+}
+
+func (c *cascade) detect(pixels []byte, width, height int) []Object {
+	var objects []Object
+
+	maxSize := imath.Min(width, height)
+
+	for size := float64(minObjectSize); int(size) <= maxSize; size *= scaleFactor {
+		s := int(size)
+		step := imath.Max(int(shiftFactor*size), 1)
+		offset := s/2 + 1
+
+		for row := offset; row <= height-offset; row += step {
+			for col := offset; col <= width-offset; col += step {
+				if score := c.classify(row, col, s, pixels, width, height); score > 0 {
+					objects = append(objects, Object{X: col, Y: row, Size: s, Score: score})
+				}
+			}
+		}
+	}
+
+	return clusterObjects(objects)
+}
+
+// iou calculates the intersection over union of the object areas
+func iou(f1, f2 Object) float64 {
+	overlap := func(c1, s1, c2, s2 int) float64 {
+		h1, h2 := float64(s1)/2, float64(s2)/2
+		return math.Max(0, math.Min(float64(c1)+h1, float64(c2)+h2)-math.Max(float64(c1)-h1, float64(c2)-h2))
+	}
+
+	inter := overlap(f1.X, f1.Size, f2.X, f2.Size) * overlap(f1.Y, f1.Size, f2.Y, f2.Size)
+
+	return inter / (float64(f1.Size*f1.Size+f2.Size*f2.Size) - inter)
+}
+
+// clusterObjects merges the overlapping detections of the same object
+func clusterObjects(objects []Object) []Object {
+	assigned := make([]bool, len(objects))
+	clusters := make([]Object, 0)
+
+	for i := range objects {
+		if assigned[i] {
+			continue
+		}
+
+		var (
+			x, y, size, n int
+			score         float32
+		)
+
+		for j := i; j < len(objects); j++ {
+			if !assigned[j] && iou(objects[i], objects[j]) > iouThreshold {
+				assigned[j] = true
+
+				x += objects[j].X
+				y += objects[j].Y
+				size += objects[j].Size
+				score += objects[j].Score
+				n++
+			}
+		}
+
+		clusters = append(clusters, Object{X: x / n, Y: y / n, Size: size / n, Score: score})
+	}
+
+	return clusters
+}
+
+// Detect finds objects of the provided classes on the grayscale image.
+// Pixels should contain one byte per pixel, row by row.
+// When no classes are provided, objects of all the known classes are detected
+func Detect(pixels []byte, width, height int, classes []string) []Object {
+	if width <= 0 || height <= 0 || len(pixels) < width*height {
+		return nil
+	}
+
+	if len(classes) == 0 {
+		for class := range models {
+			classes = append(classes, class)
+		}
+	}
+
+	var found []Object
+
+	for _, class := range classes {
+		m, ok := models[class]
+		if !ok {
+			continue
+		}
+
+		// Clusters of a few weak detections are usually false positives
+		for _, o := range m.cascade.detect(pixels, width, height) {
+			if o.Score >= m.minScore {
+				o.Class = class
+				found = append(found, o)
+			}
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,152 @@
+package detection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type DetectionTestSuite struct {
+	suite.Suite
+}
+
+func (s *DetectionTestSuite) SetupTest() {
+	config.Reset()
+	config.FaceDetectionMinScore = 0
+	config.ObjectDetectionMinScore = 0
+}
+
+// testCascade builds a single-node cascade that detects regions
+// which are brighter in the center than on the right side
+func (s *DetectionTestSuite) testCascade() []byte {
+	var buf bytes.Buffer
+
+	buf.Write(make([]byte, 8))
+
+	binary.Write(&buf, binary.LittleEndian, uint32(1)) // depth
+	binary.Write(&buf, binary.LittleEndian, uint32(1)) // trees
+
+	// center pixel vs pixel on the right
+	buf.Write([]byte{0, 0, 0, 100})
+
+	// center pixel is brighter
+	binary.Write(&buf, binary.LittleEndian, float32(1))
+	// center pixel is darker or the same
+	binary.Write(&buf, binary.LittleEndian, float32(-1))
+	// threshold
+	binary.Write(&buf, binary.LittleEndian, float32(0))
+
+	return buf.Bytes()
+}
+
+func (s *DetectionTestSuite) writeCascade(data []byte) string {
+	path := filepath.Join(s.T().TempDir(), "cascade")
+	s.Require().Nil(ioutil.WriteFile(path, data, 0644))
+	return path
+}
+
+func (s *DetectionTestSuite) init(data []byte) {
+	config.FaceDetectionCascadePath = s.writeCascade(data)
+	s.Require().Nil(Init())
+}
+
+func (s *DetectionTestSuite) brightSquare(width, height int) []byte {
+	pixels := make([]byte, width*height)
+
+	// Bright square in the dark image
+	for y := 30; y < 70; y++ {
+		for x := 120; x < 160; x++ {
+			pixels[y*width+x] = 255
+		}
+	}
+
+	return pixels
+}
+
+func (s *DetectionTestSuite) TestDetect() {
+	s.init(s.testCascade())
+	s.Require().True(Enabled(FaceClass))
+	s.Require().True(Enabled(""))
+
+	width, height := 200, 100
+
+	faces := Detect(s.brightSquare(width, height), width, height, []string{FaceClass})
+	s.Require().NotEmpty(faces)
+
+	for _, f := range faces {
+		s.Require().Equal(FaceClass, f.Class)
+		s.Require().InDelta(50, f.Y, 20)
+		s.Require().InDelta(140, f.X, 40)
+	}
+
+	// Nothing to detect on the flat image
+	s.Require().Empty(Detect(make([]byte, width*height), width, height, nil))
+}
+
+func (s *DetectionTestSuite) TestDetectObjects() {
+	config.ObjectDetectionCascades = map[string]string{"cat": s.writeCascade(s.testCascade())}
+	s.Require().Nil(Init())
+
+	s.Require().True(Enabled("cat"))
+	s.Require().False(Enabled(FaceClass))
+
+	width, height := 200, 100
+	pixels := s.brightSquare(width, height)
+
+	objects := Detect(pixels, width, height, []string{"cat"})
+	s.Require().NotEmpty(objects)
+
+	for _, o := range objects {
+		s.Require().Equal("cat", o.Class)
+	}
+
+	// All the loaded classes are detected when no classes are specified
+	s.Require().NotEmpty(Detect(pixels, width, height, nil))
+
+	// Classes without models are ignored
+	s.Require().Empty(Detect(pixels, width, height, []string{"dog"}))
+}
+
+func (s *DetectionTestSuite) TestDisabled() {
+	s.Require().Nil(Init())
+	s.Require().False(Enabled(""))
+	s.Require().Nil(Detect(make([]byte, 100), 10, 10, nil))
+}
+
+func (s *DetectionTestSuite) TestInvalidCascade() {
+	path := filepath.Join(s.T().TempDir(), "cascade")
+	s.Require().Nil(ioutil.WriteFile(path, s.testCascade()[:20], 0644))
+
+	config.FaceDetectionCascadePath = path
+	s.Require().NotNil(Init())
+}
+
+func (s *DetectionTestSuite) TestUnsupportedModelFormat() {
+	dir := s.T().TempDir()
+
+	onnxPath := filepath.Join(dir, "car.onnx")
+	s.Require().Nil(ioutil.WriteFile(onnxPath, s.testCascade(), 0644))
+
+	config.ObjectDetectionCascades = map[string]string{"car": onnxPath}
+	err := Init()
+	s.Require().Error(err)
+	s.Require().Contains(err.Error(), "ONNX models are not supported")
+
+	tflitePath := filepath.Join(dir, "pet")
+	s.Require().Nil(ioutil.WriteFile(tflitePath, append([]byte("\x1c\x00\x00\x00TFL3"), make([]byte, 32)...), 0644))
+
+	config.ObjectDetectionCascades = map[string]string{"pet": tflitePath}
+	err = Init()
+	s.Require().Error(err)
+	s.Require().Contains(err.Error(), "TFLite models are not supported")
+}
+
+func TestDetection(t *testing.T) {
+	suite.Run(t, new(DetectionTestSuite))
+}
@@ -19,9 +19,11 @@ func Init() {
 	}
 }
 
-func Report(err error, req *http.Request) {
+func Report(err error, reqID string, req *http.Request) {
 	if notifier != nil {
-		notifier.Notify(err, req)
+		notice := notifier.Notice(err, req, 1)
+		notice.Context["request_id"] = reqID
+		notifier.SendNoticeAsync(notice)
 	}
 }
 
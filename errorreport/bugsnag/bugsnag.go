@@ -19,8 +19,10 @@ func Init() {
 	}
 }
 
-func Report(err error, req *http.Request) {
+func Report(err error, reqID string, req *http.Request) {
 	if enabled {
-		bugsnag.Notify(err, req)
+		bugsnag.Notify(err, req, bugsnag.MetaData{
+			"request": {"id": reqID},
+		})
 	}
 }
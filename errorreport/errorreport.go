@@ -1,28 +1,75 @@
 package errorreport
 
 import (
+	"context"
 	"net/http"
+	"sync"
 
 	"github.com/imgproxy/imgproxy/v3/errorreport/airbrake"
 	"github.com/imgproxy/imgproxy/v3/errorreport/bugsnag"
 	"github.com/imgproxy/imgproxy/v3/errorreport/honeybadger"
 	"github.com/imgproxy/imgproxy/v3/errorreport/sentry"
+	"github.com/imgproxy/imgproxy/v3/errorreport/webhook"
 )
 
+type metadataCtxKey struct{}
+
+// metadata holds the request details that are known only after the request
+// is parsed, like the source image URL and the processing options
+type metadata struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
 func Init() {
 	bugsnag.Init()
 	honeybadger.Init()
 	sentry.Init()
 	airbrake.Init()
+	webhook.Init()
+}
+
+// StartRequest returns a context that can hold the error report metadata
+func StartRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, metadataCtxKey{}, &metadata{values: make(map[string]interface{})})
+}
+
+// SetMetadata sets the metadata value that will be sent with the error report
+func SetMetadata(ctx context.Context, key string, value interface{}) {
+	if md, ok := ctx.Value(metadataCtxKey{}).(*metadata); ok {
+		md.mu.Lock()
+		defer md.mu.Unlock()
+
+		md.values[key] = value
+	}
+}
+
+func getMetadata(ctx context.Context) map[string]interface{} {
+	md, ok := ctx.Value(metadataCtxKey{}).(*metadata)
+	if !ok {
+		return nil
+	}
+
+	md.mu.Lock()
+	defer md.mu.Unlock()
+
+	values := make(map[string]interface{}, len(md.values))
+	for k, v := range md.values {
+		values[k] = v
+	}
+
+	return values
 }
 
-func Report(err error, req *http.Request) {
-	bugsnag.Report(err, req)
-	honeybadger.Report(err, req)
-	sentry.Report(err, req)
-	airbrake.Report(err, req)
+func Report(err error, reqID string, req *http.Request) {
+	bugsnag.Report(err, reqID, req)
+	honeybadger.Report(err, reqID, req)
+	sentry.Report(err, reqID, req)
+	airbrake.Report(err, reqID, req)
+	webhook.Report(err, reqID, req, getMetadata(req.Context()))
 }
 
 func Close() {
 	airbrake.Close()
+	webhook.Close()
 }
@@ -24,7 +24,7 @@ func Init() {
 	}
 }
 
-func Report(err error, req *http.Request) {
+func Report(err error, reqID string, req *http.Request) {
 	if enabled {
 		headers := make(honeybadger.CGIData)
 
@@ -33,6 +33,6 @@ func Report(err error, req *http.Request) {
 			headers[key] = v[0]
 		}
 
-		honeybadger.Notify(err, req.URL, headers)
+		honeybadger.Notify(err, req.URL, headers, honeybadger.Context{"request_id": reqID})
 	}
 }
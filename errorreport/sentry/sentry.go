@@ -26,10 +26,11 @@ func Init() {
 	}
 }
 
-func Report(err error, req *http.Request) {
+func Report(err error, reqID string, req *http.Request) {
 	if enabled {
 		hub := sentry.CurrentHub().Clone()
 		hub.Scope().SetRequest(req)
+		hub.Scope().SetTag("request_id", reqID)
 		hub.Scope().SetLevel(sentry.LevelError)
 		eventID := hub.CaptureException(err)
 		if eventID != nil {
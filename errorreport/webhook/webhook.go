@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/version"
+)
+
+const (
+	timeout     = 5 * time.Second
+	maxInFlight = 16
+)
+
+var (
+	enabled bool
+
+	client   = &http.Client{Timeout: timeout}
+	inFlight = make(chan struct{}, maxInFlight)
+	wg       sync.WaitGroup
+)
+
+type requestPayload struct {
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Referer   string `json:"referer,omitempty"`
+}
+
+type payload struct {
+	RequestID string                 `json:"request_id"`
+	Time      string                 `json:"time"`
+	Version   string                 `json:"version"`
+	Error     string                 `json:"error"`
+	Status    int                    `json:"status"`
+	Stack     string                 `json:"stack,omitempty"`
+	Request   requestPayload         `json:"request"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+func Init() {
+	enabled = len(config.ErrorWebhookURL) > 0
+}
+
+func Report(err error, reqID string, req *http.Request, metadata map[string]interface{}) {
+	if !enabled {
+		return
+	}
+
+	ierr := ierrors.Wrap(err, 1)
+
+	p := payload{
+		RequestID: reqID,
+		Time:      time.Now().Format(time.RFC3339Nano),
+		Version:   version.Version(),
+		Error:     ierr.Message,
+		Status:    ierr.StatusCode,
+		Stack:     ierr.FormatStack(),
+		Request: requestPayload{
+			Method:    req.Method,
+			URL:       req.RequestURI,
+			UserAgent: req.UserAgent(),
+			Referer:   req.Referer(),
+		},
+		Metadata: metadata,
+	}
+
+	body, jerr := json.Marshal(p)
+	if jerr != nil {
+		log.Warningf("Can't encode error webhook payload: %s", jerr)
+		return
+	}
+
+	// Don't let a slow webhook pile up goroutines
+	select {
+	case inFlight <- struct{}{}:
+	default:
+		log.Warning("Too many error webhook requests in flight, dropping the report")
+		return
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		defer func() { <-inFlight }()
+
+		send(body)
+	}()
+}
+
+func send(body []byte) {
+	req, err := http.NewRequest(http.MethodPost, config.ErrorWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Warningf("Can't send error webhook: %s", err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", config.UserAgent)
+
+	if len(config.ErrorWebhookSecret) > 0 {
+		mac := hmac.New(sha256.New, []byte(config.ErrorWebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Imgproxy-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		log.Warningf("Can't send error webhook: %s", err)
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		log.Warningf("Can't send error webhook: webhook responded with %s", res.Status)
+	}
+}
+
+// Close waits for the pending webhook requests to finish
+func Close() {
+	wg.Wait()
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+)
+
+type WebhookTestSuite struct {
+	suite.Suite
+}
+
+func (s *WebhookTestSuite) SetupTest() {
+	config.Reset()
+}
+
+func (s *WebhookTestSuite) TearDownTest() {
+	enabled = false
+}
+
+func (s *WebhookTestSuite) TestReport() {
+	var (
+		p         payload
+		signature string
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(s.T(), err)
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+		assert.Equal(s.T(), signature, r.Header.Get("X-Imgproxy-Signature"))
+		assert.Nil(s.T(), json.Unmarshal(body, &p))
+	}))
+	defer ts.Close()
+
+	config.ErrorWebhookURL = ts.URL
+	config.ErrorWebhookSecret = "secret"
+	Init()
+
+	req := httptest.NewRequest(http.MethodGet, "/unsafe/rs:fit:100:100/plain/http://example.com/test.png", nil)
+
+	Report(errors.New("Processing failed"), "test-request-id", req, map[string]interface{}{
+		"source_url": "http://example.com/test.png",
+	})
+	Close()
+
+	assert.NotEmpty(s.T(), signature)
+	assert.Equal(s.T(), "test-request-id", p.RequestID)
+	assert.Equal(s.T(), "Processing failed", p.Error)
+	assert.Equal(s.T(), 500, p.Status)
+	assert.NotEmpty(s.T(), p.Stack)
+	assert.Equal(s.T(), http.MethodGet, p.Request.Method)
+	assert.Equal(s.T(), "/unsafe/rs:fit:100:100/plain/http://example.com/test.png", p.Request.URL)
+	assert.Equal(s.T(), "http://example.com/test.png", p.Metadata["source_url"])
+}
+
+func (s *WebhookTestSuite) TestReportDisabled() {
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	Init()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	Report(ierrors.New(422, "Invalid", "Invalid"), "test-request-id", req, nil)
+	Close()
+
+	assert.Equal(s.T(), 0, requests)
+}
+
+func TestWebhook(t *testing.T) {
+	suite.Run(t, new(WebhookTestSuite))
+}
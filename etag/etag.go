@@ -88,6 +88,10 @@ func (h *Handler) ProcessingOptionsMatch() bool {
 	return h.poHashActual == h.poHashExpected
 }
 
+// SetActualProcessingOptions calculates the processing options part of the ETag.
+// ProcessingOptions are marshaled as their Diff(), so only the options that differ
+// from the defaults are taken into account and the hash doesn't depend
+// on the order of the options in the URL
 func (h *Handler) SetActualProcessingOptions(po *options.ProcessingOptions) bool {
 	c := eTagCalcPool.Get().(*eTagCalc)
 	defer eTagCalcPool.Put(c)
@@ -133,6 +137,15 @@ func (h *Handler) SetActualImageData(imgdata *imagedata.ImageData) bool {
 	return false
 }
 
+// SetActualImageETag is used when the image data is not available
+// (e.g. when the image is streamed). Only the source image ETag is used then
+func (h *Handler) SetActualImageETag(imgEtag string) bool {
+	h.imgEtagActual = imgEtag
+	h.imgHashActual = ""
+
+	return len(imgEtag) > 0 && h.imgEtagExpected == imgEtag
+}
+
 func (h *Handler) GenerateActualETag() string {
 	return h.generate(h.poHashActual, h.imgEtagActual, h.imgHashActual)
 }
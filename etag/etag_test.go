@@ -2,6 +2,7 @@ package etag
 
 import (
 	"io/ioutil"
+	"net/http"
 	"os"
 	"strings"
 	"testing"
@@ -11,6 +12,7 @@ import (
 	"github.com/imgproxy/imgproxy/v3/options"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -89,6 +91,25 @@ func (s *EtagTestSuite) TestProcessingOptionsCheckFailure() {
 	assert.False(s.T(), s.h.ProcessingOptionsMatch())
 }
 
+func (s *EtagTestSuite) TestProcessingOptionsOrderIndependent() {
+	po1, _, err := options.ParsePath("/rs:fill:100:100/q:50/plain/http://images.dev/lorem.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	po2, _, err := options.ParsePath("/q:50/rs:fill:100:100/plain/http://images.dev/lorem.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	s.h.SetActualProcessingOptions(po1)
+	s.h.SetActualImageData(&imgWithETag)
+	etag1 := s.h.GenerateActualETag()
+
+	s.h.SetActualProcessingOptions(po2)
+	s.h.SetActualImageData(&imgWithETag)
+	etag2 := s.h.GenerateActualETag()
+
+	assert.Equal(s.T(), etag1, etag2)
+	assert.NotEqual(s.T(), etagReq, etag1)
+}
+
 func (s *EtagTestSuite) TestImageETagExpectedPresent() {
 	s.h.ParseExpectedETag(etagReq)
 
@@ -2,34 +2,54 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/config/configurators"
+	"github.com/imgproxy/imgproxy/v3/listener"
 )
 
 func healthcheck() int {
 	network := config.Network
 	bind := config.Bind
 	pathprefix := config.PathPrefix
+	tlsCertPath := config.TLSCertPath
+	healthPath := config.HealthPath
 
 	configurators.String(&network, "IMGPROXY_NETWORK")
 	configurators.String(&bind, "IMGPROXY_BIND")
 	configurators.String(&pathprefix, "IMGPROXY_PATH_PREFIX")
+	configurators.String(&tlsCertPath, "IMGPROXY_TLS_CERT_PATH")
+	configurators.String(&healthPath, "IMGPROXY_HEALTH_PATH")
+
+	network, addr, err := listener.DialAddress(network, bind)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	scheme := "http"
+	if len(tlsCertPath) > 0 {
+		scheme = "https"
+	}
 
 	httpc := http.Client{
 		Transport: &http.Transport{
 			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-				return net.Dial(network, bind)
+				return net.Dial(network, addr)
 			},
+			// The certificate is issued for the public host name, not for the local address
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		},
 	}
 
-	res, err := httpc.Get(fmt.Sprintf("http://imgproxy%s/health", pathprefix))
+	res, err := httpc.Get(fmt.Sprintf("%s://imgproxy%s%s", scheme, strings.TrimSuffix(pathprefix, "/"), healthPath))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		return 1
@@ -2,16 +2,23 @@ package imagedata
 
 import (
 	"compress/gzip"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/metrics/prometheus"
+	"github.com/imgproxy/imgproxy/v3/security"
 
 	azureTransport "github.com/imgproxy/imgproxy/v3/transport/azure"
 	fsTransport "github.com/imgproxy/imgproxy/v3/transport/fs"
@@ -31,6 +38,7 @@ var (
 		"Cache-Control",
 		"Expires",
 		"ETag",
+		"Last-Modified",
 	}
 
 	// For tests
@@ -48,17 +56,53 @@ func (e *ErrorNotModified) Error() string {
 	return e.Message
 }
 
+// countedConn decrements the open source connections metric when closed
+type countedConn struct {
+	net.Conn
+
+	closeOnce sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(prometheus.DecrementSourceConnections)
+	return c.Conn.Close()
+}
+
 func initDownloading() error {
+	dialer := &net.Dialer{
+		KeepAlive: 600 * time.Second,
+		// Control is called after the address is resolved for every connection
+		// including the ones made while following redirects
+		Control: func(network, address string, c syscall.RawConn) error {
+			return security.VerifySourceNetwork(address)
+		},
+	}
+
 	transport := &http.Transport{
 		Proxy:               http.ProxyFromEnvironment,
-		MaxIdleConns:        config.Concurrency,
-		MaxIdleConnsPerHost: config.Concurrency,
+		MaxIdleConns:        config.DownloadMaxIdleConns,
+		MaxIdleConnsPerHost: config.DownloadMaxIdleConnsPerHost,
+		MaxConnsPerHost:     config.DownloadMaxConnsPerHost,
+		IdleConnTimeout:     time.Duration(config.DownloadIdleConnTimeout) * time.Second,
 		DisableCompression:  true,
-		DialContext:         (&net.Dialer{KeepAlive: 600 * time.Second}).DialContext,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+
+			prometheus.IncrementSourceConnections()
+
+			return &countedConn{Conn: conn}, nil
+		},
 	}
 
-	if config.IgnoreSslVerification {
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	if config.IgnoreSslVerification || config.DownloadTLSSessionCacheSize > 0 {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: config.IgnoreSslVerification}
+
+		if config.DownloadTLSSessionCacheSize > 0 {
+			transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(config.DownloadTLSSessionCacheSize)
+		}
 	}
 
 	registerProtocol := func(scheme string, rt http.RoundTripper) {
@@ -94,9 +138,14 @@ func initDownloading() error {
 		}
 	}
 
+	rt, err := configureDownloadTLS(transport)
+	if err != nil {
+		return err
+	}
+
 	downloadClient = &http.Client{
 		Timeout:   time.Duration(config.DownloadTimeout) * time.Second,
-		Transport: transport,
+		Transport: rt,
 	}
 
 	return nil
@@ -114,7 +163,7 @@ func headersToStore(res *http.Response) map[string]string {
 	return m
 }
 
-func requestImage(imageURL string, header http.Header, jar *cookiejar.Jar) (*http.Response, error) {
+func sendImageRequest(imageURL string, header http.Header, jar *cookiejar.Jar) (*http.Response, error) {
 	req, err := http.NewRequest("GET", imageURL, nil)
 	if err != nil {
 		return nil, ierrors.New(404, err.Error(), msgSourceImageIsUnreachable)
@@ -144,41 +193,103 @@ func requestImage(imageURL string, header http.Header, jar *cookiejar.Jar) (*htt
 
 	res, err := downloadClient.Do(req)
 	if err != nil {
+		var addrErr security.SourceAddressError
+		if errors.As(err, &addrErr) {
+			return nil, ierrors.New(404, addrErr.Error(), msgSourceImageIsUnreachable)
+		}
 		return nil, ierrors.New(500, checkTimeoutErr(err).Error(), msgSourceImageIsUnreachable)
 	}
 
+	return res, nil
+}
+
+func responseStatusError(res *http.Response) error {
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	status := 404
+	if res.StatusCode >= 500 {
+		status = 500
+	}
+
+	msg := fmt.Sprintf("Status: %d; %s", res.StatusCode, string(body))
+	return ierrors.New(status, msg, msgSourceImageIsUnreachable)
+}
+
+func requestImage(imageURL string, header http.Header, jar *cookiejar.Jar) (*http.Response, error) {
+	res, err := sendImageRequest(imageURL, header, jar)
+	if err != nil {
+		return nil, err
+	}
+
 	if res.StatusCode == http.StatusNotModified {
 		return nil, &ErrorNotModified{Message: "Not Modified", Headers: headersToStore(res)}
 	}
 
 	if res.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(res.Body)
-		res.Body.Close()
+		return nil, responseStatusError(res)
+	}
 
-		status := 404
-		if res.StatusCode >= 500 {
-			status = 500
+	return res, nil
+}
+
+// RequestRaw requests the source image without reading and checking it.
+// Partial content, not modified, and range not satisfiable responses
+// are returned as is
+func RequestRaw(imageURL string, header http.Header, jar *cookiejar.Jar) (*http.Response, error) {
+	// We use this for testing
+	if len(redirectAllRequestsTo) > 0 {
+		imageURL = redirectAllRequestsTo
+	}
+
+	cacheFailure := canCacheFailure(imageURL, header, jar)
+
+	if cacheFailure {
+		if err := sourceFailures.get(imageURL); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := sendImageRequest(imageURL, header, jar)
+	if err == nil {
+		switch res.StatusCode {
+		case http.StatusOK, http.StatusPartialContent, http.StatusNotModified, http.StatusRequestedRangeNotSatisfiable:
+			return res, nil
 		}
 
-		msg := fmt.Sprintf("Status: %d; %s", res.StatusCode, string(body))
-		return nil, ierrors.New(status, msg, msgSourceImageIsUnreachable)
+		err = responseStatusError(res)
 	}
 
-	return res, nil
+	if cacheFailure {
+		sourceFailures.add(imageURL, err)
+	}
+
+	return nil, ierrors.WrapWithPrefix(err, 1, "Can't download source image")
 }
 
-func download(imageURL string, header http.Header, jar *cookiejar.Jar) (*ImageData, error) {
+func download(imageURL string, header http.Header, jar *cookiejar.Jar, secopts security.Options, canStream func(imagetype.Type) bool) (*ImageData, *Stream, error) {
 	// We use this for testing
 	if len(redirectAllRequestsTo) > 0 {
 		imageURL = redirectAllRequestsTo
 	}
 
-	res, err := requestImage(imageURL, header, jar)
-	if res != nil {
-		defer res.Body.Close()
+	cacheFailure := canCacheFailure(imageURL, header, jar)
+
+	if cacheFailure {
+		if err := sourceFailures.get(imageURL); err != nil {
+			return nil, nil, err
+		}
 	}
+
+	res, err := requestImage(imageURL, header, jar)
 	if err != nil {
-		return nil, err
+		if res != nil {
+			res.Body.Close()
+		}
+		if _, ok := err.(*ErrorNotModified); !ok && cacheFailure {
+			sourceFailures.add(imageURL, err)
+		}
+		return nil, nil, err
 	}
 
 	body := res.Body
@@ -186,24 +297,37 @@ func download(imageURL string, header http.Header, jar *cookiejar.Jar) (*ImageDa
 
 	if res.Header.Get("Content-Encoding") == "gzip" {
 		gzipBody, errGzip := gzip.NewReader(res.Body)
-		if gzipBody != nil {
-			defer gzipBody.Close()
-		}
 		if errGzip != nil {
-			return nil, err
+			res.Body.Close()
+			return nil, nil, errGzip
 		}
 		body = gzipBody
 		contentLength = 0
 	}
 
-	imgdata, err := readAndCheckImage(body, contentLength)
+	imgdata, stream, err := readAndCheckImageOrStream(body, contentLength, secopts, canStream)
 	if err != nil {
-		return nil, ierrors.Wrap(err, 0)
+		res.Body.Close()
+		return nil, nil, ierrors.Wrap(err, 0)
 	}
 
+	if stream != nil {
+		// The response body should stay open until the stream is closed
+		bufCancel := stream.cancel
+		stream.cancel = func() {
+			res.Body.Close()
+			bufCancel()
+		}
+		stream.Headers = headersToStore(res)
+
+		return nil, stream, nil
+	}
+
+	res.Body.Close()
+
 	imgdata.Headers = headersToStore(res)
 
-	return imgdata, nil
+	return imgdata, nil, nil
 }
 
 func RedirectAllRequestsTo(u string) {
@@ -0,0 +1,170 @@
+package imagedata
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// hostTLSTransport uses a dedicated transport for the source hosts
+// that have their own TLS config
+type hostTLSTransport struct {
+	base  *http.Transport
+	hosts []hostTLS
+}
+
+type hostTLS struct {
+	pattern   *regexp.Regexp
+	transport *http.Transport
+}
+
+func (t *hostTLSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		host := strings.ToLower(req.URL.Hostname())
+
+		for _, h := range t.hosts {
+			if h.pattern.MatchString(host) {
+				return h.transport.RoundTrip(req)
+			}
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// hostPattern converts the host pattern to a regexp.
+// * matches any sequence of characters
+func hostPattern(pattern string) *regexp.Regexp {
+	parts := strings.Split(strings.ToLower(pattern), "*")
+
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+
+	// It is safe to use regexp.MustCompile since the expression is always valid
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// withTLSFiles returns a copy of the TLS config with the CA bundle
+// and the client certificate loaded from the files. Empty paths are ignored
+func withTLSFiles(base *tls.Config, caPath, certPath, keyPath string) (*tls.Config, error) {
+	var conf *tls.Config
+
+	if base != nil {
+		conf = base.Clone()
+	} else {
+		conf = &tls.Config{}
+	}
+
+	if len(caPath) > 0 {
+		data, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("Can't read CA bundle: %s", err)
+		}
+
+		// Custom CAs are added to the system ones
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("No certificates found in CA bundle %s", caPath)
+		}
+
+		conf.RootCAs = pool
+	}
+
+	if len(certPath) > 0 || len(keyPath) > 0 {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("Can't load client certificate: %s", err)
+		}
+
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
+
+// parseHostTLS parses the host TLS config string in the
+// %host_pattern=%ca_path:%cert_path:%key_path format
+func parseHostTLS(str string) (pattern, caPath, certPath, keyPath string, err error) {
+	i := strings.Index(str, "=")
+	if i < 0 {
+		err = fmt.Errorf("Invalid source host TLS config: %s", str)
+		return
+	}
+
+	pattern = strings.TrimSpace(str[:i])
+
+	paths := strings.Split(str[i+1:], ":")
+	if len(pattern) == 0 || len(paths) > 3 {
+		err = fmt.Errorf("Invalid source host TLS config: %s", str)
+		return
+	}
+
+	for len(paths) < 3 {
+		paths = append(paths, "")
+	}
+
+	caPath, certPath, keyPath = strings.TrimSpace(paths[0]), strings.TrimSpace(paths[1]), strings.TrimSpace(paths[2])
+
+	if (len(certPath) > 0) != (len(keyPath) > 0) {
+		err = fmt.Errorf("Both client certificate and key should be set: %s", str)
+	}
+
+	return
+}
+
+// configureDownloadTLS sets the global CA bundle and client certificate
+// to the transport and wraps it with per-host TLS configs
+func configureDownloadTLS(transport *http.Transport) (http.RoundTripper, error) {
+	if len(config.DownloadCAPath) > 0 || len(config.DownloadClientCertPath) > 0 {
+		conf, err := withTLSFiles(transport.TLSClientConfig, config.DownloadCAPath, config.DownloadClientCertPath, config.DownloadClientKeyPath)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = conf
+	}
+
+	if len(config.DownloadHostTLS) == 0 {
+		return transport, nil
+	}
+
+	hosts := make([]hostTLS, 0, len(config.DownloadHostTLS))
+
+	for _, str := range config.DownloadHostTLS {
+		if len(strings.TrimSpace(str)) == 0 {
+			continue
+		}
+
+		pattern, caPath, certPath, keyPath, err := parseHostTLS(str)
+		if err != nil {
+			return nil, err
+		}
+
+		// Unset paths are inherited from the global config
+		conf, err := withTLSFiles(transport.TLSClientConfig, caPath, certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error in source host TLS config `%s`: %s", pattern, err)
+		}
+
+		hostTransport := transport.Clone()
+		hostTransport.TLSClientConfig = conf
+
+		hosts = append(hosts, hostTLS{
+			pattern:   hostPattern(pattern),
+			transport: hostTransport,
+		})
+	}
+
+	return &hostTLSTransport{base: transport, hosts: hosts}, nil
+}
@@ -0,0 +1,158 @@
+package imagedata
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type DownloadTLSTestSuite struct {
+	suite.Suite
+
+	server   *httptest.Server
+	caPath   string
+	certPath string
+	keyPath  string
+}
+
+func (s *DownloadTLSTestSuite) SetupSuite() {
+	tmpDir := s.T().TempDir()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().Nil(err)
+
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	s.Require().Nil(err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	s.Require().Nil(err)
+
+	s.certPath = filepath.Join(tmpDir, "client.pem")
+	s.keyPath = filepath.Join(tmpDir, "client.key")
+	s.caPath = filepath.Join(tmpDir, "ca.pem")
+
+	s.Require().Nil(ioutil.WriteFile(s.certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	s.Require().Nil(ioutil.WriteFile(s.keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	clientCert, err := x509.ParseCertificate(der)
+	s.Require().Nil(err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	s.server = httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	s.server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	s.server.StartTLS()
+
+	s.Require().Nil(ioutil.WriteFile(s.caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.server.Certificate().Raw}), 0644))
+}
+
+func (s *DownloadTLSTestSuite) TearDownSuite() {
+	s.server.Close()
+}
+
+func (s *DownloadTLSTestSuite) SetupTest() {
+	config.Reset()
+}
+
+func (s *DownloadTLSTestSuite) get() (string, error) {
+	rt, err := configureDownloadTLS(&http.Transport{})
+	s.Require().Nil(err)
+
+	client := http.Client{Transport: rt}
+
+	res, err := client.Get(s.server.URL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+
+	return string(body), err
+}
+
+func (s *DownloadTLSTestSuite) TestNoConfig() {
+	_, err := s.get()
+	s.Require().NotNil(err)
+}
+
+func (s *DownloadTLSTestSuite) TestGlobal() {
+	config.DownloadCAPath = s.caPath
+	config.DownloadClientCertPath = s.certPath
+	config.DownloadClientKeyPath = s.keyPath
+
+	body, err := s.get()
+	s.Require().Nil(err)
+	s.Require().Equal("client", body)
+}
+
+func (s *DownloadTLSTestSuite) TestHost() {
+	config.DownloadHostTLS = []string{
+		"*.example.com=" + s.caPath,
+		fmt.Sprintf("127.0.*=%s:%s:%s", s.caPath, s.certPath, s.keyPath),
+	}
+
+	body, err := s.get()
+	s.Require().Nil(err)
+	s.Require().Equal("client", body)
+}
+
+func (s *DownloadTLSTestSuite) TestHostInheritsGlobal() {
+	config.DownloadClientCertPath = s.certPath
+	config.DownloadClientKeyPath = s.keyPath
+	config.DownloadHostTLS = []string{"127.0.0.1=" + s.caPath}
+
+	body, err := s.get()
+	s.Require().Nil(err)
+	s.Require().Equal("client", body)
+}
+
+func (s *DownloadTLSTestSuite) TestHostNotMatching() {
+	config.DownloadHostTLS = []string{
+		fmt.Sprintf("*.example.com=%s:%s:%s", s.caPath, s.certPath, s.keyPath),
+	}
+
+	_, err := s.get()
+	s.Require().NotNil(err)
+}
+
+func (s *DownloadTLSTestSuite) TestInvalidHostConfig() {
+	config.DownloadHostTLS = []string{"127.0.0.1=" + s.caPath + ":" + s.certPath}
+
+	_, err := configureDownloadTLS(&http.Transport{})
+	s.Require().NotNil(err)
+}
+
+func TestDownloadTLS(t *testing.T) {
+	suite.Run(t, new(DownloadTLSTestSuite))
+}
@@ -0,0 +1,100 @@
+package imagedata
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+)
+
+type failure struct {
+	err       *ierrors.Error
+	expiresAt time.Time
+}
+
+// failuresCache remembers the source images that failed to download recently
+// so we don't hammer the source with the requests that will fail anyway.
+// Failures are keyed by the source URL only, so the requests with credentials
+// (cookies or the Authorization header) are neither cached nor served from the cache
+type failuresCache struct {
+	mu       sync.Mutex
+	failures map[string]failure
+}
+
+var sourceFailures = failuresCache{failures: make(map[string]failure)}
+
+// canCacheFailure checks if the request to the source can be served
+// from the failures cache and if its failure can be cached
+func canCacheFailure(imageURL string, header http.Header, jar *cookiejar.Jar) bool {
+	if len(header.Get("Authorization")) > 0 || len(header.Get("Cookie")) > 0 {
+		return false
+	}
+
+	if jar != nil {
+		u, err := url.Parse(imageURL)
+		if err != nil || len(jar.Cookies(u)) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *failuresCache) get(imageURL string) error {
+	if config.DownloadErrorCacheTTL <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.failures[imageURL]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(f.expiresAt) {
+		delete(c.failures, imageURL)
+		return nil
+	}
+
+	return ierrors.WrapWithPrefix(f.err, 1, "Source image failed recently")
+}
+
+func (c *failuresCache) add(imageURL string, err error) {
+	if config.DownloadErrorCacheTTL <= 0 {
+		return
+	}
+
+	ierr, ok := err.(*ierrors.Error)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if len(c.failures) >= config.DownloadErrorCacheSize {
+		for u, f := range c.failures {
+			if now.After(f.expiresAt) {
+				delete(c.failures, u)
+			}
+		}
+
+		// Still full, don't cache this failure
+		if len(c.failures) >= config.DownloadErrorCacheSize {
+			return
+		}
+	}
+
+	c.failures[imageURL] = failure{
+		err:       ierr,
+		expiresAt: now.Add(time.Duration(config.DownloadErrorCacheTTL) * time.Second),
+	}
+}
@@ -0,0 +1,33 @@
+package imagedata
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanCacheFailure(t *testing.T) {
+	imageURL := "http://example.com/image.jpg"
+
+	require.True(t, canCacheFailure(imageURL, make(http.Header), nil))
+
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer secret")
+	require.False(t, canCacheFailure(imageURL, header, nil))
+
+	header = make(http.Header)
+	header.Set("Cookie", "session=secret")
+	require.False(t, canCacheFailure(imageURL, header, nil))
+
+	jar, err := cookiejar.New(nil)
+	require.Nil(t, err)
+	require.True(t, canCacheFailure(imageURL, make(http.Header), jar))
+
+	u, _ := url.Parse(imageURL)
+	jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "secret"}})
+	require.False(t, canCacheFailure(imageURL, make(http.Header), jar))
+	require.True(t, canCacheFailure("http://example.org/image.jpg", make(http.Header), jar))
+}
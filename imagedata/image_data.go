@@ -1,6 +1,7 @@
 package imagedata
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
@@ -9,14 +10,18 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/security"
 )
 
 var (
-	Watermark     *ImageData
+	// watermark holds *ImageData. It's stored atomically since
+	// the watermark can be reloaded while the images are processed
+	watermark     atomic.Value
 	FallbackImage *ImageData
 )
 
@@ -48,7 +53,7 @@ func Init() error {
 		return err
 	}
 
-	if err := loadWatermark(); err != nil {
+	if err := ReloadWatermark(); err != nil {
 		return err
 	}
 
@@ -59,23 +64,42 @@ func Init() error {
 	return nil
 }
 
-func loadWatermark() (err error) {
+// Watermark returns the loaded watermark image data or nil
+// if the watermark is not configured
+func Watermark() *ImageData {
+	wm, _ := watermark.Load().(*ImageData)
+	return wm
+}
+
+// ReloadWatermark loads the watermark and replaces the current one with it.
+// If the watermark can't be loaded, the current one is kept
+func ReloadWatermark() error {
+	wm, err := loadWatermark()
+	if err != nil {
+		return err
+	}
+
+	if wm != nil {
+		watermark.Store(wm)
+	}
+
+	return nil
+}
+
+func loadWatermark() (*ImageData, error) {
 	if len(config.WatermarkData) > 0 {
-		Watermark, err = FromBase64(config.WatermarkData, "watermark")
-		return
+		return FromBase64(config.WatermarkData, "watermark")
 	}
 
 	if len(config.WatermarkPath) > 0 {
-		Watermark, err = FromFile(config.WatermarkPath, "watermark")
-		return
+		return FromFile(config.WatermarkPath, "watermark")
 	}
 
 	if len(config.WatermarkURL) > 0 {
-		Watermark, err = Download(config.WatermarkURL, "watermark", nil, nil)
-		return
+		return Download(config.WatermarkURL, "watermark", nil, nil)
 	}
 
-	return nil
+	return nil, nil
 }
 
 func loadFallbackImage() (err error) {
@@ -101,7 +125,7 @@ func FromBase64(encoded, desc string) (*ImageData, error) {
 	dec := base64.NewDecoder(base64.StdEncoding, strings.NewReader(encoded))
 	size := 4 * (len(encoded)/3 + 1)
 
-	imgdata, err := readAndCheckImage(dec, size)
+	imgdata, err := readAndCheckImage(dec, size, security.DefaultOptions())
 	if err != nil {
 		return nil, fmt.Errorf("Can't decode %s: %s", desc, err)
 	}
@@ -109,6 +133,17 @@ func FromBase64(encoded, desc string) (*ImageData, error) {
 	return imgdata, nil
 }
 
+// FromBytes reads the image from data and checks it against
+// the provided security options
+func FromBytes(data []byte, desc string, secopts security.Options) (*ImageData, error) {
+	imgdata, err := readAndCheckImage(bytes.NewReader(data), len(data), secopts)
+	if err != nil {
+		return nil, ierrors.WrapWithPrefix(err, 1, fmt.Sprintf("Can't read %s", desc))
+	}
+
+	return imgdata, nil
+}
+
 func FromFile(path, desc string) (*ImageData, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -120,7 +155,7 @@ func FromFile(path, desc string) (*ImageData, error) {
 		return nil, fmt.Errorf("Can't read %s: %s", desc, err)
 	}
 
-	imgdata, err := readAndCheckImage(f, int(fi.Size()))
+	imgdata, err := readAndCheckImage(f, int(fi.Size()), security.DefaultOptions())
 	if err != nil {
 		return nil, fmt.Errorf("Can't read %s: %s", desc, err)
 	}
@@ -129,14 +164,22 @@ func FromFile(path, desc string) (*ImageData, error) {
 }
 
 func Download(imageURL, desc string, header http.Header, jar *cookiejar.Jar) (*ImageData, error) {
-	imgdata, err := download(imageURL, header, jar)
+	imgdata, _, err := DownloadOrStream(imageURL, desc, header, jar, security.DefaultOptions(), nil)
+	return imgdata, err
+}
+
+// DownloadOrStream downloads the image. If canStream returns true for
+// the image format, the image is not read into memory and a Stream
+// is returned instead of ImageData
+func DownloadOrStream(imageURL, desc string, header http.Header, jar *cookiejar.Jar, secopts security.Options, canStream func(imagetype.Type) bool) (*ImageData, *Stream, error) {
+	imgdata, stream, err := download(imageURL, header, jar, secopts, canStream)
 	if err != nil {
 		if nmErr, ok := err.(*ErrorNotModified); ok {
 			nmErr.Message = fmt.Sprintf("Can't download %s: %s", desc, nmErr.Message)
-			return nil, nmErr
+			return nil, nil, nmErr
 		}
-		return nil, ierrors.WrapWithPrefix(err, 1, fmt.Sprintf("Can't download %s", desc))
+		return nil, nil, ierrors.WrapWithPrefix(err, 1, fmt.Sprintf("Can't download %s", desc))
 	}
 
-	return imgdata, nil
+	return imgdata, stream, nil
 }
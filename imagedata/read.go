@@ -1,6 +1,7 @@
 package imagedata
 
 import (
+	"bytes"
 	"io"
 
 	"github.com/imgproxy/imgproxy/v3/bufpool"
@@ -8,6 +9,7 @@ import (
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
 	"github.com/imgproxy/imgproxy/v3/imagemeta"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
 	"github.com/imgproxy/imgproxy/v3/security"
 )
 
@@ -39,40 +41,98 @@ func (lr *hardLimitReader) Read(p []byte) (n int, err error) {
 	return
 }
 
-func readAndCheckImage(r io.Reader, contentLength int) (*ImageData, error) {
-	if config.MaxSrcFileSize > 0 && contentLength > config.MaxSrcFileSize {
-		return nil, ErrSourceFileTooBig
+// LimitReader returns the reader that fails with ErrSourceFileTooBig
+// when more than secopts.MaxSrcFileSize bytes are read
+func LimitReader(r io.Reader, secopts security.Options) io.Reader {
+	if secopts.MaxSrcFileSize <= 0 {
+		return r
+	}
+
+	return &hardLimitReader{r: r, left: secopts.MaxSrcFileSize}
+}
+
+// checkAnimation counts the animation frames before the image is decoded
+// and checks if the animation exceeds the limits
+func checkAnimation(meta imagemeta.Meta, data []byte, secopts security.Options) error {
+	if secopts.MaxAnimationFrames <= 1 || !meta.Format().SupportsAnimation() {
+		return nil
+	}
+
+	framesCount := imagemeta.CountFrames(meta.Format(), data)
+	if framesCount <= 1 {
+		return nil
+	}
+
+	framesCount, err := security.CheckAnimationFrames(meta.Width(), meta.Height(), framesCount, secopts)
+	if err != nil {
+		return err
+	}
+
+	return security.CheckDimensions(meta.Width(), meta.Height()*framesCount, secopts)
+}
+
+func readAndCheckImage(r io.Reader, contentLength int, secopts security.Options) (*ImageData, error) {
+	imgdata, _, err := readAndCheckImageOrStream(r, contentLength, secopts, nil)
+	return imgdata, err
+}
+
+// readAndCheckImageOrStream reads the image meta and checks it. If canStream
+// returns true for the image format, the rest of the image is not read
+// and a Stream is returned instead
+func readAndCheckImageOrStream(r io.Reader, contentLength int, secopts security.Options, canStream func(imagetype.Type) bool) (*ImageData, *Stream, error) {
+	if secopts.MaxSrcFileSize > 0 && contentLength > secopts.MaxSrcFileSize {
+		return nil, nil, ErrSourceFileTooBig
 	}
 
 	buf := downloadBufPool.Get(contentLength)
 	cancel := func() { downloadBufPool.Put(buf) }
 
-	if config.MaxSrcFileSize > 0 {
-		r = &hardLimitReader{r: r, left: config.MaxSrcFileSize}
+	if secopts.MaxSrcFileSize > 0 {
+		r = &hardLimitReader{r: r, left: secopts.MaxSrcFileSize}
 	}
 
 	br := bufreader.New(r, buf)
 
 	meta, err := imagemeta.DecodeMeta(br)
 	if err == imagemeta.ErrFormat {
-		return nil, ErrSourceImageTypeNotSupported
+		return nil, nil, ErrSourceImageTypeNotSupported
 	}
 	if err != nil {
-		return nil, checkTimeoutErr(err)
+		return nil, nil, checkTimeoutErr(err)
+	}
+
+	if err = security.CheckDimensions(meta.Width(), meta.Height(), secopts); err != nil {
+		return nil, nil, err
 	}
 
-	if err = security.CheckDimensions(meta.Width(), meta.Height()); err != nil {
-		return nil, err
+	if canStream != nil && canStream(meta.Format()) {
+		if contentLength <= 0 {
+			contentLength = -1
+		}
+
+		return nil, &Stream{
+			Type:          meta.Format(),
+			ContentLength: contentLength,
+			// The buffer contains the beginning of the image that was read
+			// while decoding the meta
+			r:      io.MultiReader(bytes.NewReader(buf.Bytes()), r),
+			cancel: cancel,
+		}, nil
 	}
 
 	if err = br.Flush(); err != nil {
 		cancel()
-		return nil, checkTimeoutErr(err)
+		return nil, nil, checkTimeoutErr(err)
+	}
+
+	if err = checkAnimation(meta, buf.Bytes(), secopts); err != nil {
+		cancel()
+		return nil, nil, err
 	}
 
 	return &ImageData{
 		Data:   buf.Bytes(),
 		Type:   meta.Format(),
 		cancel: cancel,
-	}, nil
+	}, nil, nil
 }
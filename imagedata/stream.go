@@ -0,0 +1,48 @@
+package imagedata
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/imgproxy/imgproxy/v3/bufpool"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+)
+
+// Stream is a source image that is passed to the client as is
+// without reading the whole image into memory
+type Stream struct {
+	Type    imagetype.Type
+	Headers map[string]string
+	// ContentLength is -1 when the size of the source image is unknown
+	ContentLength int
+
+	r io.Reader
+
+	cancel     context.CancelFunc
+	cancelOnce sync.Once
+}
+
+func (s *Stream) WriteTo(w io.Writer) (int64, error) {
+	return bufpool.Copy(w, s.r)
+}
+
+// SetRange makes the stream to skip the first offset bytes
+// and to write no more than length bytes
+func (s *Stream) SetRange(offset, length int) error {
+	if _, err := io.CopyN(io.Discard, s.r, int64(offset)); err != nil {
+		return checkTimeoutErr(err)
+	}
+
+	s.r = io.LimitReader(s.r, int64(length))
+
+	return nil
+}
+
+func (s *Stream) Close() {
+	s.cancelOnce.Do(func() {
+		if s.cancel != nil {
+			s.cancel()
+		}
+	})
+}
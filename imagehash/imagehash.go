@@ -0,0 +1,139 @@
+package imagehash
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// SampleSize is the maximum size of the image side that is enough to calculate
+// the hashes. Larger images should be downscaled before hashing
+const SampleSize = 256
+
+const (
+	dctSize  = 32
+	hashSize = 8
+)
+
+// DHash calculates the difference hash of the grayscale image.
+// The image is downscaled to 9x8, and each bit of the hash shows
+// whether the pixel is brighter than its left neighbour
+func DHash(pixels []byte, width, height int) uint64 {
+	sample := downscale(pixels, width, height, hashSize+1, hashSize)
+
+	var hash uint64
+
+	for y := 0; y < hashSize; y++ {
+		row := sample[y*(hashSize+1) : (y+1)*(hashSize+1)]
+
+		for x := 0; x < hashSize; x++ {
+			hash <<= 1
+			if row[x+1] > row[x] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// PHash calculates the perceptual hash of the grayscale image.
+// The image is downscaled to 32x32, and each bit of the hash shows
+// whether the corresponding low frequency DCT coefficient is greater than
+// the median of the 8x8 lowest frequencies
+func PHash(pixels []byte, width, height int) uint64 {
+	sample := downscale(pixels, width, height, dctSize, dctSize)
+
+	// 2D DCT is separable, so we transform the rows first, and then the columns.
+	// We need only the lowest frequencies, so we don't calculate the rest
+	rows := make([]float64, dctSize*hashSize)
+	for y := 0; y < dctSize; y++ {
+		for u := 0; u < hashSize; u++ {
+			rows[y*hashSize+u] = dctCoef(sample[y*dctSize:(y+1)*dctSize], 1, u)
+		}
+	}
+
+	coefs := make([]float64, hashSize*hashSize)
+	for v := 0; v < hashSize; v++ {
+		for u := 0; u < hashSize; u++ {
+			coefs[v*hashSize+u] = dctCoef(rows[u:], hashSize, v)
+		}
+	}
+
+	sorted := make([]float64, len(coefs))
+	copy(sorted, coefs)
+	sort.Float64s(sorted)
+
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+
+	for _, c := range coefs {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+
+	return hash
+}
+
+// String formats the hash as a 16 characters long hex string
+func String(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// dctCoef calculates the k-th DCT-II coefficient of dctSize values
+// taken from data with the provided stride
+func dctCoef(data []float64, stride, k int) float64 {
+	var sum float64
+
+	for i := 0; i < dctSize; i++ {
+		sum += data[i*stride] * math.Cos(math.Pi*float64(k)*(2*float64(i)+1)/(2*dctSize))
+	}
+
+	return sum
+}
+
+// downscale resizes the grayscale image to the provided size
+// averaging the source pixels that fall into each of the result pixels
+func downscale(pixels []byte, width, height, w, h int) []float64 {
+	res := make([]float64, w*h)
+
+	if width < 1 || height < 1 || len(pixels) < width*height {
+		return res
+	}
+
+	for y := 0; y < h; y++ {
+		sy0, sy1 := sampleRange(y, h, height)
+
+		for x := 0; x < w; x++ {
+			sx0, sx1 := sampleRange(x, w, width)
+
+			var sum float64
+
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					sum += float64(pixels[sy*width+sx])
+				}
+			}
+
+			res[y*w+x] = sum / float64((sy1-sy0)*(sx1-sx0))
+		}
+	}
+
+	return res
+}
+
+// sampleRange returns the range of the source pixels that fall into
+// the i-th of n result pixels. The range contains at least one pixel
+func sampleRange(i, n, size int) (int, int) {
+	start := i * size / n
+	end := (i + 1) * size / n
+
+	if end <= start {
+		end = start + 1
+	}
+
+	return start, end
+}
@@ -0,0 +1,73 @@
+package imagehash
+
+import (
+	"math"
+	"math/bits"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testImage generates the grayscale image with a smooth wavy pattern
+func testImage(width, height int, invert bool) []byte {
+	pixels := make([]byte, width*height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx := float64(x) / float64(width)
+			fy := float64(y) / float64(height)
+
+			v := 128 + 60*math.Sin(fx*7) + 60*math.Cos(fy*5+fx*3)
+			if invert {
+				v = 255 - v
+			}
+
+			pixels[y*width+x] = byte(v)
+		}
+	}
+
+	return pixels
+}
+
+func TestDHashGradient(t *testing.T) {
+	width, height := 90, 40
+	pixels := make([]byte, width*height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixels[y*width+x] = byte(x * 2)
+		}
+	}
+
+	assert.Equal(t, "ffffffffffffffff", String(DHash(pixels, width, height)))
+}
+
+func TestHashesScaleInvariant(t *testing.T) {
+	large := testImage(256, 192, false)
+	small := testImage(64, 48, false)
+
+	for name, hash := range map[string]func([]byte, int, int) uint64{"dhash": DHash, "phash": PHash} {
+		dist := bits.OnesCount64(hash(large, 256, 192) ^ hash(small, 64, 48))
+		assert.LessOrEqualf(t, dist, 4, "%s distance is too large", name)
+	}
+}
+
+func TestHashesDifferentImages(t *testing.T) {
+	img := testImage(128, 128, false)
+	inv := testImage(128, 128, true)
+
+	for name, hash := range map[string]func([]byte, int, int) uint64{"dhash": DHash, "phash": PHash} {
+		dist := bits.OnesCount64(hash(img, 128, 128) ^ hash(inv, 128, 128))
+		assert.GreaterOrEqualf(t, dist, 20, "%s distance is too small", name)
+	}
+}
+
+func TestHashesTinyImage(t *testing.T) {
+	pixels := []byte{0, 255, 255, 0}
+
+	assert.NotPanics(t, func() {
+		DHash(pixels, 2, 2)
+		PHash(pixels, 2, 2)
+		PHash(nil, 0, 0)
+	})
+}
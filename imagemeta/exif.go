@@ -0,0 +1,116 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const exifGPSInfoTag = 0x8825
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// exifTypeSizes are the sizes of the EXIF value types in bytes
+var exifTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// StripExifGPS removes the GPS IFD contents from the EXIF data.
+// The data may start either with the "Exif" header or with the TIFF header.
+// It returns the modified copy of the data and true if the GPS IFD was found.
+// If the data is malformed or contains no GPS info, it's returned as is
+func StripExifGPS(data []byte) ([]byte, bool) {
+	tiff := data
+	if bytes.HasPrefix(tiff, exifHeader) {
+		tiff = tiff[len(exifHeader):]
+	}
+
+	if len(tiff) < 8 {
+		return data, false
+	}
+
+	var order binary.ByteOrder
+
+	switch {
+	case bytes.Equal(tiff[:4], tiffLeHeader):
+		order = binary.LittleEndian
+	case bytes.Equal(tiff[:4], tiffBeHeader):
+		order = binary.BigEndian
+	default:
+		return data, false
+	}
+
+	ifd0 := order.Uint32(tiff[4:8])
+
+	gpsOffset, ok := findExifIFDEntry(tiff, order, ifd0, exifGPSInfoTag)
+	if !ok {
+		return data, false
+	}
+
+	count, ok := exifIFDCount(tiff, order, gpsOffset)
+	if !ok {
+		return data, false
+	}
+
+	res := make([]byte, len(data))
+	copy(res, data)
+
+	rtiff := res[len(data)-len(tiff):]
+
+	for i := uint32(0); i < count; i++ {
+		entry := rtiff[gpsOffset+2+i*12 : gpsOffset+2+(i+1)*12]
+
+		// Values that don't fit the entry are stored separately
+		size := exifTypeSizes[order.Uint16(entry[2:4])] * order.Uint32(entry[4:8])
+		if size > 4 {
+			if off := order.Uint32(entry[8:12]); uint64(off)+uint64(size) <= uint64(len(rtiff)) {
+				zeroBytes(rtiff[off : off+size])
+			}
+		}
+
+		zeroBytes(entry)
+	}
+
+	// Leave the empty IFD without the link to the next one
+	order.PutUint16(rtiff[gpsOffset:], 0)
+	zeroBytes(rtiff[gpsOffset+2 : gpsOffset+6])
+
+	return res, true
+}
+
+func exifIFDCount(tiff []byte, order binary.ByteOrder, offset uint32) (uint32, bool) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0, false
+	}
+
+	count := uint32(order.Uint16(tiff[offset:]))
+
+	// The entries and the next IFD offset should fit the data
+	if uint64(offset)+2+uint64(count)*12+4 > uint64(len(tiff)) {
+		return 0, false
+	}
+
+	return count, true
+}
+
+func findExifIFDEntry(tiff []byte, order binary.ByteOrder, ifdOffset uint32, tag uint16) (uint32, bool) {
+	count, ok := exifIFDCount(tiff, order, ifdOffset)
+	if !ok {
+		return 0, false
+	}
+
+	for i := uint32(0); i < count; i++ {
+		entry := tiff[ifdOffset+2+i*12:]
+
+		if order.Uint16(entry) == tag {
+			return order.Uint32(entry[8:12]), true
+		}
+	}
+
+	return 0, false
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,103 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildExif builds the EXIF data with IFD0 containing the Make tag
+// and the GPS IFD containing the GPSLatitude tag
+func buildExif(order binary.ByteOrder, withGPS bool) []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(exifHeader)
+
+	if order == binary.LittleEndian {
+		buf.Write(tiffLeHeader)
+	} else {
+		buf.Write(tiffBeHeader)
+	}
+	binary.Write(buf, order, uint32(8))
+
+	entries := uint16(1)
+	if withGPS {
+		entries = 2
+	}
+
+	// IFD0 starts at 8 and takes 2 + entries*12 + 4 bytes
+	makeOffset := uint32(8 + 2 + int(entries)*12 + 4)
+	gpsOffset := makeOffset + 8
+
+	binary.Write(buf, order, entries)
+	binary.Write(buf, order, []uint16{0x010F, 2})
+	binary.Write(buf, order, []uint32{8, makeOffset})
+	if withGPS {
+		binary.Write(buf, order, []uint16{exifGPSInfoTag, 4})
+		binary.Write(buf, order, []uint32{1, gpsOffset})
+	}
+	binary.Write(buf, order, uint32(0))
+
+	buf.WriteString("imgprox\x00")
+
+	if withGPS {
+		latOffset := gpsOffset + 2 + 12 + 4
+
+		binary.Write(buf, order, uint16(1))
+		binary.Write(buf, order, []uint16{0x0002, 5})
+		binary.Write(buf, order, []uint32{3, latOffset})
+		binary.Write(buf, order, uint32(0))
+		binary.Write(buf, order, []uint32{55, 1, 45, 1, 30, 1})
+	}
+
+	return buf.Bytes()
+}
+
+func TestStripExifGPS(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		data := buildExif(order, true)
+		orig := append([]byte(nil), data...)
+
+		res, ok := StripExifGPS(data)
+
+		require.True(t, ok)
+		require.Len(t, res, len(data))
+		assert.Equal(t, orig, data, "Source data should not be modified")
+
+		tiff := res[len(exifHeader):]
+		gpsOffset, found := findExifIFDEntry(tiff, order, 8, exifGPSInfoTag)
+		require.True(t, found)
+
+		count, valid := exifIFDCount(tiff, order, gpsOffset)
+		require.True(t, valid)
+		assert.Equal(t, uint32(0), count)
+
+		// Latitude values should be erased
+		assert.True(t, bytes.Equal(tiff[gpsOffset:], make([]byte, len(tiff)-int(gpsOffset))))
+
+		// The rest of the data should stay the same
+		assert.Equal(t, orig[:len(exifHeader)+int(gpsOffset)], res[:len(exifHeader)+int(gpsOffset)])
+	}
+}
+
+func TestStripExifGPSNoGPS(t *testing.T) {
+	data := buildExif(binary.LittleEndian, false)
+
+	res, ok := StripExifGPS(data)
+
+	assert.False(t, ok)
+	assert.Equal(t, data, res)
+}
+
+func TestStripExifGPSMalformed(t *testing.T) {
+	data := buildExif(binary.LittleEndian, true)
+
+	for _, d := range [][]byte{data[:10], data[:30], []byte("not exif at all")} {
+		res, ok := StripExifGPS(d)
+
+		assert.False(t, ok)
+		assert.Equal(t, d, res)
+	}
+}
@@ -0,0 +1,142 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+)
+
+// CountFrames counts the frames of the animated image without decoding it.
+// Only GIF, WebP, and APNG are supported, 1 is returned for the other formats.
+// If the data is truncated, the number of frames found so far is returned
+func CountFrames(imgtype imagetype.Type, data []byte) int {
+	switch imgtype {
+	case imagetype.GIF:
+		return countGifFrames(data)
+	case imagetype.WEBP:
+		return countWebpFrames(data)
+	case imagetype.PNG:
+		return countApngFrames(data)
+	}
+
+	return 1
+}
+
+func gifColorTableSize(flags byte) int {
+	if flags&0x80 == 0 {
+		return 0
+	}
+	return 3 << ((flags & 7) + 1)
+}
+
+// skipGifSubBlocks returns the position after the sub-blocks sequence
+func skipGifSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos++
+
+		if size == 0 {
+			return pos
+		}
+
+		pos += size
+	}
+
+	return len(data)
+}
+
+func countGifFrames(data []byte) int {
+	// Header + logical screen descriptor
+	if len(data) < 13 {
+		return 0
+	}
+
+	pos := 13 + gifColorTableSize(data[10])
+	frames := 0
+
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension
+			pos = skipGifSubBlocks(data, pos+2)
+		case 0x2C: // Image descriptor
+			if pos+10 > len(data) {
+				return frames
+			}
+
+			frames++
+
+			pos += 10 + gifColorTableSize(data[pos+9])
+			// Skip LZW minimum code size and image data
+			pos = skipGifSubBlocks(data, pos+1)
+		default: // Trailer or garbage
+			return frames
+		}
+	}
+
+	return frames
+}
+
+func countWebpFrames(data []byte) int {
+	if len(data) < 12 || !bytes.Equal(data[8:12], webpFccWEBP[:]) {
+		return 0
+	}
+
+	pos := 12
+	frames := 0
+
+	for pos+8 <= len(data) {
+		chunkID := data[pos : pos+4]
+		chunkLen := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+
+		if bytes.Equal(chunkID, []byte("ANMF")) {
+			frames++
+		}
+
+		if chunkLen < 0 {
+			break
+		}
+
+		// Chunks are padded to the even size
+		pos += 8 + chunkLen + chunkLen&1
+	}
+
+	if frames == 0 {
+		return 1
+	}
+
+	return frames
+}
+
+func countApngFrames(data []byte) int {
+	if !bytes.HasPrefix(data, pngMagick) {
+		return 0
+	}
+
+	pos := len(pngMagick)
+
+	for pos+8 <= len(data) {
+		chunkLen := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkID := data[pos+4 : pos+8]
+
+		switch string(chunkID) {
+		case "acTL":
+			// acTL should precede the image data, so the regular PNG images are not scanned entirely
+			if pos+12 > len(data) {
+				return 1
+			}
+			return int(binary.BigEndian.Uint32(data[pos+8 : pos+12]))
+		case "IDAT":
+			return 1
+		}
+
+		if chunkLen < 0 {
+			break
+		}
+
+		// Length + chunk type + data + CRC
+		pos += 12 + chunkLen
+	}
+
+	return 1
+}
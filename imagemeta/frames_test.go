@@ -0,0 +1,74 @@
+package imagemeta
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+)
+
+func TestCountGifFrames(t *testing.T) {
+	anim := gif.GIF{}
+
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 10, 10), color.Palette{color.Black, color.White})
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	require.Nil(t, gif.EncodeAll(&buf, &anim))
+
+	assert.Equal(t, 3, CountFrames(imagetype.GIF, buf.Bytes()))
+	assert.Equal(t, 1, CountFrames(imagetype.GIF, buf.Bytes()[:buf.Len()/2]))
+}
+
+func TestCountApngFrames(t *testing.T) {
+	chunk := func(id string, data []byte) []byte {
+		c := []byte{0, 0, 0, byte(len(data))}
+		c = append(c, id...)
+		c = append(c, data...)
+		return append(c, 0, 0, 0, 0)
+	}
+
+	png := append([]byte(nil), pngMagick...)
+	png = append(png, chunk("IHDR", make([]byte, 13))...)
+
+	apng := append([]byte(nil), png...)
+	apng = append(apng, chunk("acTL", []byte{0, 0, 0, 3, 0, 0, 0, 0})...)
+	apng = append(apng, chunk("IDAT", make([]byte, 10))...)
+
+	png = append(png, chunk("IDAT", make([]byte, 10))...)
+
+	assert.Equal(t, 3, CountFrames(imagetype.PNG, apng))
+	assert.Equal(t, 1, CountFrames(imagetype.PNG, png))
+}
+
+func TestCountWebpFrames(t *testing.T) {
+	chunk := func(id string, data []byte) []byte {
+		c := []byte(id)
+		c = append(c, byte(len(data)), 0, 0, 0)
+		c = append(c, data...)
+		if len(data)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+
+	body := []byte("WEBP")
+	body = append(body, chunk("VP8X", make([]byte, 10))...)
+	body = append(body, chunk("ANIM", make([]byte, 6))...)
+	body = append(body, chunk("ANMF", make([]byte, 17))...)
+	body = append(body, chunk("ANMF", make([]byte, 17))...)
+
+	data := append([]byte("RIFF"), byte(len(body)), 0, 0, 0)
+	data = append(data, body...)
+
+	assert.Equal(t, 2, CountFrames(imagetype.WEBP, data))
+}
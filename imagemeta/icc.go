@@ -0,0 +1,92 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+const iccHeaderSize = 128
+
+// ICCProfileDescription returns the description of the ICC profile stored
+// in its "desc" tag. Both ICC v2 textDescriptionType and ICC v4
+// multiLocalizedUnicodeType are supported. For the latter, the first record
+// is returned. It returns an empty string if the profile is malformed
+// or doesn't have a description
+func ICCProfileDescription(data []byte) string {
+	if len(data) < iccHeaderSize+4 {
+		return ""
+	}
+
+	count := binary.BigEndian.Uint32(data[iccHeaderSize:])
+	if uint64(count)*12 > uint64(len(data)-iccHeaderSize-4) {
+		return ""
+	}
+
+	for i := uint32(0); i < count; i++ {
+		entry := data[iccHeaderSize+4+i*12:]
+
+		if string(entry[:4]) != "desc" {
+			continue
+		}
+
+		offset := binary.BigEndian.Uint32(entry[4:8])
+		size := binary.BigEndian.Uint32(entry[8:12])
+
+		if uint64(offset)+uint64(size) > uint64(len(data)) {
+			return ""
+		}
+
+		return iccTagText(data[offset : offset+size])
+	}
+
+	return ""
+}
+
+func iccTagText(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+
+	switch string(tag[:4]) {
+	case "desc":
+		length := binary.BigEndian.Uint32(tag[8:12])
+		if uint64(length) > uint64(len(tag)-12) {
+			return ""
+		}
+
+		text := tag[12 : 12+length]
+		if end := bytes.IndexByte(text, 0); end >= 0 {
+			text = text[:end]
+		}
+
+		return string(text)
+
+	case "mluc":
+		if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:12]) == 0 {
+			return ""
+		}
+
+		length := binary.BigEndian.Uint32(tag[20:24])
+		offset := binary.BigEndian.Uint32(tag[24:28])
+
+		if uint64(offset)+uint64(length) > uint64(len(tag)) {
+			return ""
+		}
+
+		text := tag[offset : offset+length]
+
+		chars := make([]uint16, len(text)/2)
+		for i := range chars {
+			chars[i] = binary.BigEndian.Uint16(text[i*2:])
+		}
+
+		for len(chars) > 0 && chars[len(chars)-1] == 0 {
+			chars = chars[:len(chars)-1]
+		}
+
+		return string(utf16.Decode(chars))
+	}
+
+	return ""
+}
@@ -0,0 +1,56 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildICC builds the ICC profile containing the single "desc" tag
+func buildICC(tag []byte) []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(make([]byte, iccHeaderSize))
+
+	binary.Write(buf, binary.BigEndian, uint32(1))
+	buf.WriteString("desc")
+	binary.Write(buf, binary.BigEndian, []uint32{iccHeaderSize + 4 + 12, uint32(len(tag))})
+	buf.Write(tag)
+
+	return buf.Bytes()
+}
+
+func TestICCProfileDescriptionV2(t *testing.T) {
+	text := "sRGB IEC61966-2.1\x00"
+
+	tag := new(bytes.Buffer)
+	tag.WriteString("desc\x00\x00\x00\x00")
+	binary.Write(tag, binary.BigEndian, uint32(len(text)))
+	tag.WriteString(text)
+
+	assert.Equal(t, "sRGB IEC61966-2.1", ICCProfileDescription(buildICC(tag.Bytes())))
+}
+
+func TestICCProfileDescriptionV4(t *testing.T) {
+	text := utf16.Encode([]rune("Display P3"))
+
+	tag := new(bytes.Buffer)
+	tag.WriteString("mluc\x00\x00\x00\x00")
+	binary.Write(tag, binary.BigEndian, []uint32{1, 12})
+	tag.WriteString("enUS")
+	binary.Write(tag, binary.BigEndian, []uint32{uint32(len(text) * 2), 28})
+	binary.Write(tag, binary.BigEndian, text)
+
+	assert.Equal(t, "Display P3", ICCProfileDescription(buildICC(tag.Bytes())))
+}
+
+func TestICCProfileDescriptionMalformed(t *testing.T) {
+	tag := []byte("desc\x00\x00\x00\x00\xff\xff\xff\xffabc")
+	icc := buildICC(tag)
+
+	for _, d := range [][]byte{nil, icc[:100], icc[:iccHeaderSize+10], icc} {
+		assert.Empty(t, ICCProfileDescription(d))
+	}
+}
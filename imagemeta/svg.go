@@ -5,7 +5,10 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"math"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/imgproxy/imgproxy/v3/config"
 	"golang.org/x/text/encoding/charmap"
@@ -58,3 +61,160 @@ func IsSVG(r io.Reader) (bool, error) {
 
 	return false, nil
 }
+
+// SVGDimensions are the dimensions of the SVG image declared in its root element
+type SVGDimensions struct {
+	// WidthAttr and HeightAttr are the raw values of the width and height attributes
+	WidthAttr  string
+	HeightAttr string
+
+	// Width and Height are the intrinsic size of the image in pixels.
+	// They are 0 if the size can't be resolved without a viewport
+	Width  float64
+	Height float64
+
+	// ViewBox contains min-x, min-y, width, and height of the viewBox if HasViewBox is true
+	ViewBox    [4]float64
+	HasViewBox bool
+}
+
+// AspectRatio returns the intrinsic aspect ratio of the image.
+// It returns 0 if the aspect ratio is unknown
+func (d SVGDimensions) AspectRatio() float64 {
+	if d.Width > 0 && d.Height > 0 {
+		return d.Width / d.Height
+	}
+
+	if d.HasViewBox {
+		return d.ViewBox[2] / d.ViewBox[3]
+	}
+
+	return 0
+}
+
+// svgUnits maps the absolute length units to their size in pixels.
+// Font-relative units are resolved using the default 16px font size
+var svgUnits = map[string]float64{
+	"":   1,
+	"px": 1,
+	"pt": 96.0 / 72.0,
+	"pc": 16,
+	"in": 96,
+	"cm": 96 / 2.54,
+	"mm": 96 / 25.4,
+	"q":  96 / 101.6,
+	"em": 16,
+	"ex": 8,
+}
+
+// parseSVGLength parses the absolute SVG length and converts it to pixels.
+// Percentages and other relative lengths are not resolved
+func parseSVGLength(s string) (float64, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	end := len(s)
+	for end > 0 && s[end-1] >= 'a' && s[end-1] <= 'z' {
+		end--
+	}
+
+	scale, ok := svgUnits[s[end:]]
+	if !ok || end == 0 {
+		return 0, false
+	}
+
+	v, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil || v <= 0 || math.IsInf(v, 0) {
+		return 0, false
+	}
+
+	return v * scale, true
+}
+
+func parseSVGViewBox(s string) ([4]float64, bool) {
+	var vb [4]float64
+
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	if len(parts) != 4 {
+		return vb, false
+	}
+
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			return vb, false
+		}
+		vb[i] = v
+	}
+
+	// Non-positive viewBox size disables rendering of the element
+	if vb[2] <= 0 || vb[3] <= 0 {
+		return vb, false
+	}
+
+	return vb, true
+}
+
+// DecodeSVGDimensions reads the width, height, and viewBox attributes
+// of the SVG root element and resolves the intrinsic size of the image.
+// When the width or the height is missing or relative, it's calculated
+// using the viewBox the same way librsvg does
+func DecodeSVGDimensions(r io.Reader) (SVGDimensions, error) {
+	var d SVGDimensions
+
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	dec.CharsetReader = xmlCharsetReader
+
+	var root xml.StartElement
+
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return d, fmt.Errorf("Can't find SVG root element: %s", err)
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			root = start
+			break
+		}
+	}
+
+	if root.Name.Local != "svg" {
+		return d, fmt.Errorf("Root element is not SVG: %s", root.Name.Local)
+	}
+
+	for _, attr := range root.Attr {
+		switch attr.Name.Local {
+		case "width":
+			d.WidthAttr = attr.Value
+		case "height":
+			d.HeightAttr = attr.Value
+		case "viewBox":
+			d.ViewBox, d.HasViewBox = parseSVGViewBox(attr.Value)
+		}
+	}
+
+	width, widthOk := parseSVGLength(d.WidthAttr)
+	height, heightOk := parseSVGLength(d.HeightAttr)
+
+	if d.HasViewBox {
+		switch {
+		case !widthOk && !heightOk:
+			width, height = d.ViewBox[2], d.ViewBox[3]
+		case !widthOk:
+			width = height * d.ViewBox[2] / d.ViewBox[3]
+		case !heightOk:
+			height = width * d.ViewBox[3] / d.ViewBox[2]
+		}
+		widthOk, heightOk = true, true
+	}
+
+	if widthOk && heightOk {
+		d.Width, d.Height = width, height
+	}
+
+	return d, nil
+}
@@ -0,0 +1,87 @@
+package imagemeta
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeSVGDimensions(t *testing.T, svg string) SVGDimensions {
+	d, err := DecodeSVGDimensions(strings.NewReader(svg))
+	require.Nil(t, err)
+
+	return d
+}
+
+func TestDecodeSVGDimensionsAbsolute(t *testing.T) {
+	d := decodeSVGDimensions(t, `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" width="200" height="1in" viewBox="0 0 20 10"></svg>`)
+
+	assert.Equal(t, "200", d.WidthAttr)
+	assert.Equal(t, "1in", d.HeightAttr)
+	assert.Equal(t, float64(200), d.Width)
+	assert.Equal(t, float64(96), d.Height)
+	assert.True(t, d.HasViewBox)
+	assert.Equal(t, [4]float64{0, 0, 20, 10}, d.ViewBox)
+	assert.InDelta(t, 200.0/96.0, d.AspectRatio(), 1e-9)
+}
+
+func TestDecodeSVGDimensionsViewBox(t *testing.T) {
+	d := decodeSVGDimensions(t, `<svg xmlns="http://www.w3.org/2000/svg" width="100%" viewBox="-5,-5 , 40 30"></svg>`)
+
+	assert.Equal(t, [4]float64{-5, -5, 40, 30}, d.ViewBox)
+	assert.Equal(t, float64(40), d.Width)
+	assert.Equal(t, float64(30), d.Height)
+}
+
+func TestDecodeSVGDimensionsOneSide(t *testing.T) {
+	d := decodeSVGDimensions(t, `<svg xmlns="http://www.w3.org/2000/svg" height="15pt" viewBox="0 0 40 10"></svg>`)
+
+	assert.Equal(t, float64(80), d.Width)
+	assert.Equal(t, float64(20), d.Height)
+}
+
+func TestDecodeSVGDimensionsUnresolved(t *testing.T) {
+	d := decodeSVGDimensions(t, `<svg xmlns="http://www.w3.org/2000/svg" width="50%" height="120"></svg>`)
+
+	assert.Equal(t, float64(0), d.Width)
+	assert.Equal(t, float64(0), d.Height)
+	assert.False(t, d.HasViewBox)
+	assert.Equal(t, float64(0), d.AspectRatio())
+
+	d = decodeSVGDimensions(t, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 0 10"></svg>`)
+
+	assert.False(t, d.HasViewBox)
+	assert.Equal(t, float64(0), d.Width)
+}
+
+func TestDecodeSVGDimensionsNotSVG(t *testing.T) {
+	_, err := DecodeSVGDimensions(strings.NewReader(`<html></html>`))
+	assert.Error(t, err)
+
+	_, err = DecodeSVGDimensions(strings.NewReader(`not xml at all`))
+	assert.Error(t, err)
+}
+
+func TestParseSVGLength(t *testing.T) {
+	for s, expected := range map[string]float64{
+		"10":     10,
+		" 10px ": 10,
+		"1.5E1":  15,
+		"2.54cm": 96,
+		"25.4mm": 96,
+		"12PT":   16,
+		"1pc":    16,
+		"2em":    32,
+	} {
+		v, ok := parseSVGLength(s)
+		assert.Truef(t, ok, "%q should be parsed", s)
+		assert.InDeltaf(t, expected, v, 1e-9, "%q", s)
+	}
+
+	for _, s := range []string{"", "px", "50%", "10vw", "-10", "0", "auto", "1e400"} {
+		_, ok := parseSVGLength(s)
+		assert.Falsef(t, ok, "%q should not be parsed", s)
+	}
+}
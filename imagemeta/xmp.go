@@ -0,0 +1,36 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+// AttributionXMP builds the XMP packet with the provided copyright and creator
+// stored as dc:rights and dc:creator. Empty values are omitted
+func AttributionXMP(copyright, creator string) []byte {
+	buf := new(bytes.Buffer)
+
+	buf.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	buf.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	buf.WriteString("  <rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\">\n")
+
+	if len(creator) > 0 {
+		buf.WriteString("   <dc:creator><rdf:Seq><rdf:li>")
+		xml.EscapeText(buf, []byte(creator))
+		buf.WriteString("</rdf:li></rdf:Seq></dc:creator>\n")
+	}
+
+	if len(copyright) > 0 {
+		buf.WriteString("   <dc:rights><rdf:Alt><rdf:li xml:lang=\"x-default\">")
+		xml.EscapeText(buf, []byte(copyright))
+		buf.WriteString("</rdf:li></rdf:Alt></dc:rights>\n")
+	}
+
+	buf.WriteString("  </rdf:Description>\n")
+	buf.WriteString(" </rdf:RDF>\n")
+	buf.WriteString("</x:xmpmeta>\n")
+	buf.WriteString("<?xpacket end=\"w\"?>")
+
+	return buf.Bytes()
+}
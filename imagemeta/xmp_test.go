@@ -0,0 +1,35 @@
+package imagemeta
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributionXMP(t *testing.T) {
+	xmp := AttributionXMP("© 2024 Foo & Bar, Inc.", "Jane <Doe>")
+
+	var doc struct {
+		Creator []string `xml:"RDF>Description>creator>Seq>li"`
+		Rights  []string `xml:"RDF>Description>rights>Alt>li"`
+	}
+
+	// Strip the packet wrapper since it's a processing instruction with BOM
+	body := string(xmp)
+	body = body[strings.Index(body, "<x:xmpmeta"):strings.Index(body, "<?xpacket end")]
+
+	require.Nil(t, xml.Unmarshal([]byte(body), &doc))
+
+	assert.Equal(t, []string{"Jane <Doe>"}, doc.Creator)
+	assert.Equal(t, []string{"© 2024 Foo & Bar, Inc."}, doc.Rights)
+}
+
+func TestAttributionXMPOmitsEmpty(t *testing.T) {
+	xmp := string(AttributionXMP("Copyright", ""))
+
+	assert.Contains(t, xmp, "dc:rights")
+	assert.NotContains(t, xmp, "dc:creator")
+}
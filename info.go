@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/barcode"
+	"github.com/imgproxy/imgproxy/v3/complexity"
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/detection"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagehash"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/imath"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// infoSignaturePrefix is added to the signed path of the info URLs
+// to separate their signatures from the processing ones
+const infoSignaturePrefix = "info"
+
+// infoExifFields maps the names of the EXIF fields included to the info
+// to the names of the corresponding vips image fields
+var infoExifFields = map[string]string{
+	"Make":             "exif-ifd0-Make",
+	"Model":            "exif-ifd0-Model",
+	"Software":         "exif-ifd0-Software",
+	"Artist":           "exif-ifd0-Artist",
+	"Copyright":        "exif-ifd0-Copyright",
+	"DateTimeOriginal": "exif-ifd2-DateTimeOriginal",
+	"ExposureTime":     "exif-ifd2-ExposureTime",
+	"FNumber":          "exif-ifd2-FNumber",
+	"ISOSpeedRatings":  "exif-ifd2-ISOSpeedRatings",
+	"FocalLength":      "exif-ifd2-FocalLength",
+}
+
+// imageFaceBox is the bounding box of the detected face.
+// The coordinates and the size are relative to the image size
+type imageFaceBox struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Score  float64 `json:"score"`
+}
+
+type imageFaces struct {
+	Count int            `json:"count"`
+	Boxes []imageFaceBox `json:"boxes"`
+}
+
+type imageSVGInfo struct {
+	Width       string    `json:"width,omitempty"`
+	Height      string    `json:"height,omitempty"`
+	ViewBox     []float64 `json:"view_box,omitempty"`
+	AspectRatio float64   `json:"aspect_ratio,omitempty"`
+}
+
+type imageInfo struct {
+	Format      string            `json:"format"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Orientation int               `json:"orientation"`
+	Frames      int               `json:"frames"`
+	Size        int               `json:"size"`
+	HasAlpha    bool              `json:"has_alpha"`
+	Grayscale   bool              `json:"grayscale"`
+	ICCProfile  string            `json:"icc_profile,omitempty"`
+	BitDepth    int               `json:"bit_depth"`
+	Exif        map[string]string `json:"exif,omitempty"`
+	Entropy     *float64          `json:"entropy,omitempty"`
+	PHash       string            `json:"phash,omitempty"`
+	DHash       string            `json:"dhash,omitempty"`
+	Faces       *imageFaces       `json:"faces,omitempty"`
+	Barcodes    *[]barcode.Symbol `json:"barcodes,omitempty"`
+	SVG         *imageSVGInfo     `json:"svg,omitempty"`
+}
+
+// vipsExifValue extracts the value from the vips EXIF field string
+// that looks like "Canon (Canon, ASCII, 6 components, 6 bytes)"
+func vipsExifValue(s string) string {
+	if end := strings.LastIndex(s, " ("); end >= 0 {
+		return s[:end]
+	}
+
+	return s
+}
+
+func readVipsInfo(ctx context.Context, imgdata *imagedata.ImageData, info *imageInfo) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	defer vips.Cleanup()
+
+	img := new(vips.Image)
+	defer img.Clear()
+
+	if err := img.Load(imgdata, 1, 1.0, 1); err != nil {
+		return err
+	}
+
+	info.Orientation = img.Orientation()
+
+	frames, err := img.GetIntDefault("n-pages", 1)
+	if err != nil {
+		return err
+	}
+	info.Frames = frames
+
+	info.HasAlpha = img.HasAlpha()
+	info.Grayscale = img.IsGrayscale()
+	info.BitDepth = img.BitDepth()
+
+	icc, err := img.GetBlobDefault("icc-profile-data", nil)
+	if err != nil {
+		return err
+	}
+	info.ICCProfile = imagemeta.ICCProfileDescription(icc)
+
+	for name, field := range infoExifFields {
+		value, err := img.GetStringDefault(field, "")
+		if err != nil {
+			return err
+		}
+
+		if len(value) == 0 {
+			continue
+		}
+
+		if info.Exif == nil {
+			info.Exif = make(map[string]string)
+		}
+
+		info.Exif[name] = vipsExifValue(value)
+	}
+
+	if config.InfoPerceptualHashes || config.InfoEntropy {
+		if err := readPixelStats(img, info); err != nil {
+			return err
+		}
+	}
+
+	if config.InfoFaces && detection.Enabled(detection.FaceClass) {
+		if err := readFaces(img, info); err != nil {
+			return err
+		}
+	}
+
+	if config.InfoBarcodes {
+		if err := readBarcodes(ctx, img, info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readPixelStats(img *vips.Image, info *imageInfo) error {
+	// Both the hashes and the entropy are calculated using the same downscaled
+	// grayscale copy of the image, so we decode it only once
+	pixels, width, height, err := img.GrayscalePixels(imath.Max(imagehash.SampleSize, complexity.SampleSize))
+	if err != nil {
+		return err
+	}
+
+	if config.InfoPerceptualHashes {
+		info.PHash = imagehash.String(imagehash.PHash(pixels, width, height))
+		info.DHash = imagehash.String(imagehash.DHash(pixels, width, height))
+	}
+
+	if config.InfoEntropy {
+		entropy := roundInfoValue(complexity.Entropy(pixels))
+		info.Entropy = &entropy
+	}
+
+	return nil
+}
+
+func readFaces(img *vips.Image, info *imageInfo) error {
+	pixels, width, height, err := img.GrayscalePixels(detection.MaxImageSize)
+	if err != nil {
+		return err
+	}
+
+	objects := detection.Detect(pixels, width, height, []string{detection.FaceClass})
+
+	info.Faces = &imageFaces{
+		Count: len(objects),
+		Boxes: make([]imageFaceBox, 0, len(objects)),
+	}
+
+	for _, f := range objects {
+		left := imath.Max(f.X-f.Size/2, 0)
+		top := imath.Max(f.Y-f.Size/2, 0)
+		right := imath.Min(f.X+f.Size/2, width)
+		bottom := imath.Min(f.Y+f.Size/2, height)
+
+		info.Faces.Boxes = append(info.Faces.Boxes, imageFaceBox{
+			X:      roundInfoValue(float64(left) / float64(width)),
+			Y:      roundInfoValue(float64(top) / float64(height)),
+			Width:  roundInfoValue(float64(right-left) / float64(width)),
+			Height: roundInfoValue(float64(bottom-top) / float64(height)),
+			Score:  roundInfoValue(float64(f.Score)),
+		})
+	}
+
+	return nil
+}
+
+func readSVGInfo(imgdata *imagedata.ImageData, info *imageInfo) error {
+	dims, err := imagemeta.DecodeSVGDimensions(bytes.NewReader(imgdata.Data))
+	if err != nil {
+		return ierrors.New(422, fmt.Sprintf("Can't read SVG dimensions: %s", err), "Invalid source image")
+	}
+
+	info.SVG = &imageSVGInfo{
+		Width:       dims.WidthAttr,
+		Height:      dims.HeightAttr,
+		AspectRatio: roundInfoValue(dims.AspectRatio()),
+	}
+
+	if dims.HasViewBox {
+		info.SVG.ViewBox = dims.ViewBox[:]
+	}
+
+	// librsvg rounds the intrinsic size to the nearest integer
+	// but never renders an empty image
+	if dims.Width > 0 && dims.Height > 0 {
+		info.Width = imath.Max(1, int(math.Round(dims.Width)))
+		info.Height = imath.Max(1, int(math.Round(dims.Height)))
+	}
+
+	return nil
+}
+
+func readBarcodes(ctx context.Context, img *vips.Image, info *imageInfo) error {
+	pixels, width, height, err := img.GrayscalePixels(barcode.MaxImageSize)
+	if err != nil {
+		return err
+	}
+
+	symbols, err := barcode.Detect(ctx, pixels, width, height)
+	if err != nil {
+		// Responds with the timeout error if the request context is done
+		router.CheckTimeout(ctx)
+		return err
+	}
+
+	info.Barcodes = &symbols
+
+	return nil
+}
+
+func roundInfoValue(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+func handleInfo(reqID string, rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	path := r.RequestURI
+	if queryStart := strings.IndexByte(path, '?'); queryStart >= 0 {
+		path = path[:queryStart]
+	}
+
+	path = strings.TrimPrefix(path, config.PathPrefix+"/info")
+	path = strings.TrimPrefix(path, "/")
+
+	signature := ""
+
+	if signatureEnd := strings.IndexByte(path, '/'); signatureEnd > 0 {
+		signature = path[:signatureEnd]
+		path = path[signatureEnd:]
+	} else {
+		panic(ierrors.New(404, fmt.Sprintf("Invalid path: %s", path), "Invalid URL"))
+	}
+
+	var claims *security.Claims
+
+	if security.IsSignatureV2(signature) {
+		var err error
+		if claims, path, err = security.VerifySignatureV2(signature, infoSignaturePrefix, path); err != nil {
+			panic(ierrors.New(403, err.Error(), "Forbidden"))
+		}
+	} else if err := security.VerifySignature(signature, infoSignaturePrefix+path); err != nil {
+		panic(ierrors.New(403, err.Error(), "Forbidden"))
+	}
+
+	imageURL, _, err := options.DecodeURL(strings.Split(strings.TrimPrefix(path, "/"), "/"))
+	if err != nil {
+		panic(ierrors.New(404, err.Error(), "Invalid URL"))
+	}
+
+	if claims != nil {
+		if err := claims.VerifySourceURL(imageURL); err != nil {
+			panic(ierrors.New(403, err.Error(), "Forbidden"))
+		}
+	}
+
+	if !security.VerifySourceURL(imageURL) {
+		panic(ierrors.New(404, fmt.Sprintf("Source URL is not allowed: %s", imageURL), "Invalid source"))
+	}
+
+	// The info endpoint doesn't accept processing options,
+	// but the security options of the default preset still apply
+	secopts, err := options.SourceSecurityOptions(imageURL)
+	if err != nil {
+		panic(ierrors.New(404, err.Error(), "Invalid URL"))
+	}
+
+	imgRequestHeader := make(http.Header)
+
+	if config.ForwardRequestID {
+		imgRequestHeader.Set(router.RequestIDHeader, reqID)
+	}
+
+	// Reading the image info is not as heavy as processing,
+	// but it still requires downloading and decoding the image
+	defer acquireProcessingSlot(ctx, rw)()
+
+	imgdata, _, err := imagedata.DownloadOrStream(imageURL, "source image", imgRequestHeader, nil, secopts, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer imgdata.Close()
+
+	router.CheckTimeout(ctx)
+
+	checkMemorySoftLimit(ctx, rw, imgdata)
+
+	meta, err := imagemeta.DecodeMeta(bytes.NewReader(imgdata.Data))
+	if err != nil {
+		panic(ierrors.New(422, fmt.Sprintf("Can't read image info: %s", err), "Invalid source image"))
+	}
+
+	info := imageInfo{
+		Format:      imgdata.Type.String(),
+		Width:       meta.Width(),
+		Height:      meta.Height(),
+		Orientation: 1,
+		Frames:      1,
+		Size:        len(imgdata.Data),
+		BitDepth:    8,
+	}
+
+	// SVG is not loaded with vips here since we can get its size
+	// from the root element attributes without rendering it.
+	// SVG images are rendered with transparent background
+	if imgdata.Type == imagetype.SVG {
+		info.HasAlpha = true
+
+		if err := readSVGInfo(imgdata, &info); err != nil {
+			panic(err)
+		}
+	} else if vips.SupportsLoad(imgdata.Type) {
+		if err := readVipsInfo(ctx, imgdata, &info); err != nil {
+			panic(err)
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(200)
+	json.NewEncoder(rw).Encode(info)
+
+	router.LogResponse(reqID, r, 200, nil, log.Fields{"image_url": imageURL})
+}
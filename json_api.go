@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+const jsonAPIMaxBodySize = 1024 * 1024
+
+type jsonAPIRequest struct {
+	URL      string          `json:"url"`
+	Options  json.RawMessage `json:"options"`
+	Response string          `json:"response"`
+}
+
+type jsonAPIURLResponse struct {
+	URL string `json:"url"`
+}
+
+func newJSONAPIError(format string, args ...interface{}) *ierrors.Error {
+	return ierrors.New(422, fmt.Sprintf(format, args...), "Invalid request")
+}
+
+// jsonOptionArg converts a JSON scalar to the processing option argument
+func jsonOptionArg(name string, value interface{}) (string, error) {
+	var arg string
+
+	switch v := value.(type) {
+	case string:
+		arg = v
+	case json.Number:
+		arg = v.String()
+	case bool:
+		arg = strconv.FormatBool(v)
+	default:
+		return "", fmt.Errorf("Invalid %s option argument: %v", name, value)
+	}
+
+	if strings.ContainsAny(arg, ":/") {
+		return "", fmt.Errorf("Invalid %s option argument: %s", name, arg)
+	}
+
+	return arg, nil
+}
+
+// jsonOptionsPath converts the JSON object with the processing options
+// to the URL path part. The keys of the object are the names of the options,
+// and the values are either scalars or arrays of scalars that are the arguments.
+// The options order is preserved
+func jsonOptionsPath(data json.RawMessage) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return "", fmt.Errorf("Options should be an object")
+	}
+
+	var sb strings.Builder
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return "", fmt.Errorf("Invalid options: %s", err)
+		}
+
+		name, _ := t.(string)
+		if len(name) == 0 || strings.ContainsAny(name, ":/") {
+			return "", fmt.Errorf("Invalid option name: %v", t)
+		}
+
+		var value interface{}
+		if err = dec.Decode(&value); err != nil {
+			return "", fmt.Errorf("Invalid %s option: %s", name, err)
+		}
+
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+
+		sb.WriteByte('/')
+		sb.WriteString(name)
+
+		for _, v := range values {
+			arg, err := jsonOptionArg(name, v)
+			if err != nil {
+				return "", err
+			}
+
+			sb.WriteByte(':')
+			sb.WriteString(arg)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func handleJSONAPI(reqID string, rw http.ResponseWriter, r *http.Request) {
+	var req jsonAPIRequest
+
+	body := http.MaxBytesReader(rw, r.Body, jsonAPIMaxBodySize)
+
+	if err := json.NewDecoder(body).Decode(&req); err != nil && err != io.EOF {
+		panic(newJSONAPIError("Invalid JSON: %s", err))
+	}
+
+	if len(req.URL) == 0 {
+		panic(newJSONAPIError("Source URL is empty"))
+	}
+
+	optionsPath, err := jsonOptionsPath(req.Options)
+	if err != nil {
+		panic(newJSONAPIError("%s", err))
+	}
+
+	// Base64-encoded source URL doesn't need escaping
+	path := optionsPath + "/" + base64.RawURLEncoding.EncodeToString([]byte(req.URL))
+	path = "/" + security.Sign(path) + path
+
+	switch req.Response {
+	case "url":
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.WriteHeader(200)
+		json.NewEncoder(rw).Encode(jsonAPIURLResponse{URL: config.PathPrefix + path})
+
+		router.LogResponse(reqID, r, 200, nil)
+	case "", "image":
+		// Process the image as if the signed URL was requested
+		pr := r.Clone(r.Context())
+		pr.Method = http.MethodGet
+		pr.Body = http.NoBody
+		pr.ContentLength = 0
+		pr.RequestURI = config.PathPrefix + path
+		pr.URL.Path = pr.RequestURI
+		pr.URL.RawQuery = ""
+
+		handleProcessing(reqID, rw, pr)
+	default:
+		panic(newJSONAPIError("Invalid response type: %s", req.Response))
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const lambdaRuntimeAPIVersion = "2018-06-01"
+
+// lambdaEventFormat is the format of the event that invoked the function.
+// The response is encoded in the same format
+type lambdaEventFormat int
+
+const (
+	lambdaAPIGatewayV1 lambdaEventFormat = iota
+	lambdaAPIGatewayV2
+)
+
+// lambdaEvent contains the fields of API Gateway REST API (v1),
+// and HTTP API and function URL (v2) events
+type lambdaEvent struct {
+	Version string `json:"version"`
+
+	// API Gateway v1
+	HTTPMethod            string              `json:"httpMethod"`
+	Path                  string              `json:"path"`
+	MultiValueHeaders     map[string][]string `json:"multiValueHeaders"`
+	QueryStringParameters map[string]string   `json:"queryStringParameters"`
+
+	// API Gateway v2 and function URLs
+	RawPath        string   `json:"rawPath"`
+	RawQueryString string   `json:"rawQueryString"`
+	Cookies        []string `json:"cookies"`
+
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+
+	RequestContext struct {
+		Identity struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+		HTTP struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+type lambdaAPIGatewayResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Cookies           []string            `json:"cookies,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// lambdaResponseWriter collects the response to send it to the Lambda runtime API
+type lambdaResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newLambdaResponseWriter() *lambdaResponseWriter {
+	return &lambdaResponseWriter{header: make(http.Header)}
+}
+
+func (rw *lambdaResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *lambdaResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+}
+
+func (rw *lambdaResponseWriter) Write(b []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	return rw.body.Write(b)
+}
+
+func (e *lambdaEvent) format() lambdaEventFormat {
+	if e.Version == "2.0" {
+		return lambdaAPIGatewayV2
+	}
+
+	return lambdaAPIGatewayV1
+}
+
+// toRequest converts the Lambda event into the HTTP request
+func (e *lambdaEvent) toRequest(ctx context.Context) (*http.Request, error) {
+	var (
+		method, path, query, clientIP string
+		body                          []byte
+		header                        = make(http.Header)
+	)
+
+	switch e.format() {
+	case lambdaAPIGatewayV2:
+		method, path, query = e.RequestContext.HTTP.Method, e.RawPath, e.RawQueryString
+		clientIP = e.RequestContext.HTTP.SourceIP
+
+		for k, v := range e.Headers {
+			header.Set(k, v)
+		}
+
+		if len(e.Cookies) > 0 {
+			header.Set("Cookie", strings.Join(e.Cookies, "; "))
+		}
+
+	default:
+		method, path = e.HTTPMethod, e.Path
+		clientIP = e.RequestContext.Identity.SourceIP
+
+		for k, v := range e.Headers {
+			header.Set(k, v)
+		}
+		for k, values := range e.MultiValueHeaders {
+			header.Del(k)
+			for _, v := range values {
+				header.Add(k, v)
+			}
+		}
+
+		q := make(url.Values)
+		for k, v := range e.QueryStringParameters {
+			q.Set(k, v)
+		}
+		query = q.Encode()
+	}
+
+	if len(e.Body) > 0 {
+		if e.IsBase64Encoded {
+			var err error
+			if body, err = base64.StdEncoding.DecodeString(e.Body); err != nil {
+				return nil, fmt.Errorf("Invalid request body encoding: %s", err)
+			}
+		} else {
+			body = []byte(e.Body)
+		}
+	}
+
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	requestURI := path
+	if len(query) > 0 {
+		requestURI += "?" + query
+	}
+
+	host := header.Get("Host")
+	if len(host) == 0 {
+		host = "localhost"
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, "http://"+host+requestURI, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header = header
+	r.RequestURI = requestURI
+	r.RemoteAddr = net.JoinHostPort(clientIP, "80")
+
+	return r, nil
+}
+
+// encodeLambdaResponse encodes the response in the format of the event.
+// The body is always base64-encoded since it's usually binary
+func encodeLambdaResponse(format lambdaEventFormat, rw *lambdaResponseWriter) ([]byte, error) {
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	body := base64.StdEncoding.EncodeToString(rw.body.Bytes())
+
+	switch format {
+	case lambdaAPIGatewayV2:
+		headers := make(map[string]string)
+		var cookies []string
+
+		for k, values := range rw.header {
+			if k == "Set-Cookie" {
+				cookies = values
+				continue
+			}
+			headers[k] = strings.Join(values, ", ")
+		}
+
+		return json.Marshal(lambdaAPIGatewayResponse{
+			StatusCode:      status,
+			Headers:         headers,
+			Cookies:         cookies,
+			Body:            body,
+			IsBase64Encoded: true,
+		})
+
+	default:
+		return json.Marshal(lambdaAPIGatewayResponse{
+			StatusCode:        status,
+			MultiValueHeaders: rw.header,
+			Body:              body,
+			IsBase64Encoded:   true,
+		})
+	}
+}
+
+// handleLambdaEvent handles the event with the handler and returns
+// the encoded response
+func handleLambdaEvent(ctx context.Context, handler http.Handler, payload []byte) ([]byte, error) {
+	var event lambdaEvent
+
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("Invalid event: %s", err)
+	}
+
+	r, err := event.toRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := newLambdaResponseWriter()
+
+	handler.ServeHTTP(rw, r)
+
+	return encodeLambdaResponse(event.format(), rw)
+}
+
+type lambdaRuntime struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (rt *lambdaRuntime) post(path string, body []byte) error {
+	res, err := rt.client.Post(rt.baseURL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("Lambda runtime API responded with %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// invokeNext gets the next event from the Lambda runtime API, handles it,
+// and sends the response back
+func (rt *lambdaRuntime) invokeNext(handler http.Handler) error {
+	res, err := rt.client.Get(rt.baseURL + "/invocation/next")
+	if err != nil {
+		return fmt.Errorf("Can't get the next Lambda invocation: %s", err)
+	}
+	defer res.Body.Close()
+
+	payload, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("Can't read the Lambda invocation: %s", err)
+	}
+
+	requestID := res.Header.Get("Lambda-Runtime-Aws-Request-Id")
+
+	ctx := context.Background()
+
+	if deadlineMs, err := strconv.ParseInt(res.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Unix(0, deadlineMs*int64(time.Millisecond)))
+		defer cancel()
+	}
+
+	response, err := handleLambdaEvent(ctx, handler, payload)
+	if err != nil {
+		log.Errorf("Can't handle the Lambda invocation %s: %s", requestID, err)
+
+		errBody, _ := json.Marshal(map[string]string{
+			"errorMessage": err.Error(),
+			"errorType":    "InvalidEvent",
+		})
+
+		return rt.post("/invocation/"+requestID+"/error", errBody)
+	}
+
+	return rt.post("/invocation/"+requestID+"/response", response)
+}
+
+// runLambda runs imgproxy as an AWS Lambda custom runtime
+func runLambda() error {
+	api := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if len(api) == 0 {
+		return errors.New("AWS_LAMBDA_RUNTIME_API is not set. Is imgproxy running in AWS Lambda?")
+	}
+
+	if err := initialize(); err != nil {
+		return err
+	}
+
+	defer shutdown()
+
+	rt := lambdaRuntime{
+		baseURL: "http://" + api + "/" + lambdaRuntimeAPIVersion + "/runtime",
+		// The next invocation request blocks until there is an event, so no timeout here
+		client: &http.Client{},
+	}
+
+	handler := buildRouter()
+
+	log.Info("Starting AWS Lambda runtime")
+
+	for {
+		if err := rt.invokeNext(handler); err != nil {
+			return err
+		}
+	}
+}
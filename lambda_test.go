@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var lambdaTestHandler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "image/png")
+	rw.Header().Add("Set-Cookie", "a=1")
+	rw.WriteHeader(201)
+	fmt.Fprintf(rw, "%s %s %s %s", r.Method, r.RequestURI, r.Header.Get("Accept"), r.RemoteAddr)
+})
+
+func TestLambdaAPIGatewayV1(t *testing.T) {
+	payload := `{
+		"httpMethod": "GET",
+		"path": "/unsafe/rs:fill:4:4/plain/local:///test1.png",
+		"queryStringParameters": {"a": "b"},
+		"headers": {"Accept": "image/webp"},
+		"requestContext": {"identity": {"sourceIp": "1.2.3.4"}}
+	}`
+
+	data, err := handleLambdaEvent(context.Background(), lambdaTestHandler, []byte(payload))
+	require.Nil(t, err)
+
+	var res lambdaAPIGatewayResponse
+	require.Nil(t, json.Unmarshal(data, &res))
+
+	body, err := base64.StdEncoding.DecodeString(res.Body)
+	require.Nil(t, err)
+
+	assert.Equal(t, 201, res.StatusCode)
+	assert.True(t, res.IsBase64Encoded)
+	assert.Equal(t, []string{"image/png"}, res.MultiValueHeaders["Content-Type"])
+	assert.Equal(t, "GET /unsafe/rs:fill:4:4/plain/local:///test1.png?a=b image/webp 1.2.3.4:80", string(body))
+}
+
+func TestLambdaAPIGatewayV2(t *testing.T) {
+	payload := `{
+		"version": "2.0",
+		"rawPath": "/unsafe/plain/local:///test1.png",
+		"rawQueryString": "a=b",
+		"headers": {"accept": "image/avif"},
+		"requestContext": {"http": {"method": "GET", "sourceIp": "1.2.3.4"}}
+	}`
+
+	data, err := handleLambdaEvent(context.Background(), lambdaTestHandler, []byte(payload))
+	require.Nil(t, err)
+
+	var res lambdaAPIGatewayResponse
+	require.Nil(t, json.Unmarshal(data, &res))
+
+	body, err := base64.StdEncoding.DecodeString(res.Body)
+	require.Nil(t, err)
+
+	assert.Equal(t, 201, res.StatusCode)
+	assert.Equal(t, "image/png", res.Headers["Content-Type"])
+	assert.Equal(t, []string{"a=1"}, res.Cookies)
+	assert.Equal(t, "GET /unsafe/plain/local:///test1.png?a=b image/avif 1.2.3.4:80", string(body))
+}
+
+func TestLambdaInvalidEvent(t *testing.T) {
+	_, err := handleLambdaEvent(context.Background(), lambdaTestHandler, []byte("invalid"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package listener
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+)
+
+// Certificate holds the TLS certificate that can be reloaded
+// without restarting the server
+type Certificate struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func LoadCertificate(certFile, keyFile string) (*Certificate, error) {
+	c := Certificate{certFile: certFile, keyFile: keyFile}
+
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Reload loads the certificate from the files. The previous certificate
+// is kept if the new one can't be loaded
+func (c *Certificate) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("Can't load TLS certificate: %s", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cert = &cert
+
+	return nil
+}
+
+// Files returns the certificate and key file paths
+func (c *Certificate) Files() []string {
+	return []string{c.certFile, c.keyFile}
+}
+
+// GetCertificate is meant to be used as tls.Config.GetCertificate
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
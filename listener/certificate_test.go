@@ -0,0 +1,67 @@
+package listener
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"time"
+)
+
+func (s *ListenerTestSuite) writeCertificate(certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().Nil(err)
+
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	s.Require().Nil(err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	s.Require().Nil(err)
+
+	s.Require().Nil(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	s.Require().Nil(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func (s *ListenerTestSuite) certificateCommonName(c *Certificate) string {
+	cert, err := c.GetCertificate(nil)
+	s.Require().Nil(err)
+
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	s.Require().Nil(err)
+
+	return parsed.Subject.CommonName
+}
+
+func (s *ListenerTestSuite) TestCertificateReload() {
+	certFile := filepath.Join(s.tmpDir, "cert.pem")
+	keyFile := filepath.Join(s.tmpDir, "key.pem")
+
+	s.writeCertificate(certFile, keyFile, "old")
+
+	c, err := LoadCertificate(certFile, keyFile)
+	s.Require().Nil(err)
+	s.Require().Equal("old", s.certificateCommonName(c))
+
+	s.writeCertificate(certFile, keyFile, "new")
+
+	s.Require().Nil(c.Reload())
+	s.Require().Equal("new", s.certificateCommonName(c))
+
+	// Broken certificate doesn't replace the loaded one
+	s.Require().Nil(ioutil.WriteFile(keyFile, []byte("invalid"), 0600))
+
+	s.Require().NotNil(c.Reload())
+	s.Require().Equal("new", s.certificateCommonName(c))
+}
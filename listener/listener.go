@@ -0,0 +1,159 @@
+package listener
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/reuseport"
+)
+
+var knownNetworks = []string{"tcp", "tcp4", "tcp6", "unix"}
+
+// Listen creates listeners for the comma-divided list of addresses.
+// An address can be one of the following:
+//   - host:port or a Unix socket path; the provided network is used
+//   - network:address, where network is one of tcp, tcp4, tcp6, or unix
+//   - systemd; all the unused sockets passed by systemd
+//   - systemd:name; the sockets passed by systemd with the FileDescriptorName
+func Listen(network, addresses string) ([]net.Listener, error) {
+	var listeners []net.Listener
+
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+
+	for _, addr := range strings.Split(addresses, ",") {
+		addr = strings.TrimSpace(addr)
+		if len(addr) == 0 {
+			continue
+		}
+
+		ls, err := listenAddr(network, addr)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+
+		listeners = append(listeners, ls...)
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("No listeners for %s", addresses)
+	}
+
+	return listeners, nil
+}
+
+func isSystemdAddr(addr string) bool {
+	return addr == "systemd" || strings.HasPrefix(addr, "systemd:")
+}
+
+// splitNetwork splits the network prefix from the address.
+// The provided network is returned if the address has no prefix
+func splitNetwork(network, addr string) (string, string) {
+	for _, n := range knownNetworks {
+		if strings.HasPrefix(addr, n+":") {
+			return n, strings.TrimPrefix(addr, n+":")
+		}
+	}
+
+	return network, addr
+}
+
+// DialAddress returns the network and the address to connect to the server
+// listening on the addresses. The first address that is not a systemd socket is used
+func DialAddress(network, addresses string) (string, string, error) {
+	for _, addr := range strings.Split(addresses, ",") {
+		addr = strings.TrimSpace(addr)
+		if len(addr) == 0 || isSystemdAddr(addr) {
+			continue
+		}
+
+		network, addr = splitNetwork(network, addr)
+
+		// Connect to the local host when the server listens on all interfaces
+		if strings.HasPrefix(network, "tcp") && strings.HasPrefix(addr, ":") {
+			addr = "localhost" + addr
+		}
+
+		return network, addr, nil
+	}
+
+	return "", "", fmt.Errorf("Can't find the address to connect to in %s", addresses)
+}
+
+func listenAddr(network, addr string) ([]net.Listener, error) {
+	if isSystemdAddr(addr) {
+		return systemdListeners(strings.TrimPrefix(strings.TrimPrefix(addr, "systemd"), ":"))
+	}
+
+	network, addr = splitNetwork(network, addr)
+
+	if network == "unix" {
+		l, err := listenUnix(addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	}
+
+	l, err := reuseport.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return []net.Listener{l}, nil
+}
+
+// removeStaleUnixSocket removes the socket file left after an unclean shutdown.
+// It fails if the file is not a socket or another process listens on it
+func removeStaleUnixSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is already in use", path)
+	}
+
+	return os.Remove(path)
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	// Abstract sockets don't have files
+	if strings.HasPrefix(path, "@") {
+		return reuseport.Listen("unix", path)
+	}
+
+	if err := removeStaleUnixSocket(path); err != nil {
+		return nil, err
+	}
+
+	l, err := reuseport.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.UnixSocketMode != 0 {
+		if err := os.Chmod(path, config.UnixSocketMode); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("Can't set unix socket mode: %s", err)
+		}
+	}
+
+	return l, nil
+}
@@ -0,0 +1,156 @@
+package listener
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type ListenerTestSuite struct {
+	suite.Suite
+
+	tmpDir string
+}
+
+func (s *ListenerTestSuite) SetupTest() {
+	config.Reset()
+
+	s.tmpDir = s.T().TempDir()
+}
+
+func (s *ListenerTestSuite) closeAll(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+func (s *ListenerTestSuite) TestMultipleAddresses() {
+	sock := filepath.Join(s.tmpDir, "imgproxy.sock")
+
+	listeners, err := Listen("tcp", "127.0.0.1:0, unix:"+sock)
+	s.Require().Nil(err)
+	defer s.closeAll(listeners)
+
+	s.Require().Len(listeners, 2)
+	s.Require().Equal("tcp", listeners[0].Addr().Network())
+	s.Require().Equal("unix", listeners[1].Addr().Network())
+	s.Require().Equal(sock, listeners[1].Addr().String())
+}
+
+func (s *ListenerTestSuite) TestUnixSocketMode() {
+	sock := filepath.Join(s.tmpDir, "imgproxy.sock")
+
+	config.UnixSocketMode = 0600
+
+	listeners, err := Listen("unix", sock)
+	s.Require().Nil(err)
+	defer s.closeAll(listeners)
+
+	fi, err := os.Stat(sock)
+	s.Require().Nil(err)
+	s.Require().Equal(os.FileMode(0600), fi.Mode().Perm())
+}
+
+func (s *ListenerTestSuite) TestStaleUnixSocket() {
+	sock := filepath.Join(s.tmpDir, "imgproxy.sock")
+
+	l, err := net.Listen("unix", sock)
+	s.Require().Nil(err)
+
+	// Socket is in use
+	_, err = Listen("unix", sock)
+	s.Require().NotNil(err)
+
+	// Emulate unclean shutdown
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	listeners, err := Listen("unix", sock)
+	s.Require().Nil(err)
+	s.closeAll(listeners)
+}
+
+func (s *ListenerTestSuite) TestNotSocket() {
+	path := filepath.Join(s.tmpDir, "file")
+	s.Require().Nil(ioutil.WriteFile(path, nil, 0644))
+
+	_, err := Listen("unix", path)
+	s.Require().NotNil(err)
+}
+
+func (s *ListenerTestSuite) TestSystemd() {
+	web, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().Nil(err)
+	defer web.Close()
+
+	metrics, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().Nil(err)
+	defer metrics.Close()
+
+	webFile, err := web.(*net.TCPListener).File()
+	s.Require().Nil(err)
+	defer webFile.Close()
+
+	metricsFile, err := metrics.(*net.TCPListener).File()
+	s.Require().Nil(err)
+	defer metricsFile.Close()
+
+	// systemd passes the sockets as consecutive file descriptors
+	if metricsFile.Fd() != webFile.Fd()+1 {
+		s.T().Skip("Can't get consecutive file descriptors")
+	}
+
+	listenFdsStart = int(webFile.Fd())
+	systemdSockets, systemdSocketsErr, systemdSocketsOnce = nil, nil, sync.Once{}
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "2")
+	os.Setenv("LISTEN_FDNAMES", "web:metrics")
+
+	metricsListeners, err := Listen("tcp", "systemd:metrics")
+	s.Require().Nil(err)
+	defer s.closeAll(metricsListeners)
+
+	s.Require().Len(metricsListeners, 1)
+	s.Require().Equal(metrics.Addr().String(), metricsListeners[0].Addr().String())
+
+	webListeners, err := Listen("tcp", "systemd")
+	s.Require().Nil(err)
+	defer s.closeAll(webListeners)
+
+	s.Require().Len(webListeners, 1)
+	s.Require().Equal(web.Addr().String(), webListeners[0].Addr().String())
+
+	// All the sockets are used
+	_, err = Listen("tcp", "systemd")
+	s.Require().NotNil(err)
+
+	s.Require().Empty(os.Getenv("LISTEN_FDS"))
+}
+
+func (s *ListenerTestSuite) TestDialAddress() {
+	network, addr, err := DialAddress("tcp", "systemd:web, unix:/run/imgproxy.sock, :8080")
+	s.Require().Nil(err)
+	s.Require().Equal("unix", network)
+	s.Require().Equal("/run/imgproxy.sock", addr)
+
+	network, addr, err = DialAddress("tcp", ":8080")
+	s.Require().Nil(err)
+	s.Require().Equal("tcp", network)
+	s.Require().Equal("localhost:8080", addr)
+
+	_, _, err = DialAddress("tcp", "systemd")
+	s.Require().NotNil(err)
+}
+
+func TestListener(t *testing.T) {
+	suite.Run(t, new(ListenerTestSuite))
+}
@@ -0,0 +1,105 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd
+var listenFdsStart = 3
+
+type systemdSocket struct {
+	name     string
+	listener net.Listener
+	used     bool
+}
+
+var (
+	systemdSockets     []*systemdSocket
+	systemdSocketsErr  error
+	systemdSocketsOnce sync.Once
+	systemdSocketsMu   sync.Mutex
+)
+
+// loadSystemdSockets creates listeners from the file descriptors passed
+// by systemd socket activation. See sd_listen_fds(3)
+func loadSystemdSockets() {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		systemdSocketsErr = errors.New("No sockets were passed by systemd")
+		return
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		systemdSocketsErr = errors.New("No sockets were passed by systemd")
+		return
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// The sockets shouldn't be passed to the child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	for i := 0; i < nfds; i++ {
+		fd := listenFdsStart + i
+
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(fd), name)
+
+		l, err := net.FileListener(f)
+		// net.FileListener duplicates the file descriptor, so we can close the file
+		f.Close()
+
+		if err != nil {
+			systemdSocketsErr = fmt.Errorf("Can't use the socket %d passed by systemd: %s", fd, err)
+			return
+		}
+
+		systemdSockets = append(systemdSockets, &systemdSocket{name: name, listener: l})
+	}
+}
+
+// systemdListeners returns the unused listeners passed by systemd.
+// If the name is not empty, only the listeners with this name are returned
+func systemdListeners(name string) ([]net.Listener, error) {
+	systemdSocketsOnce.Do(loadSystemdSockets)
+
+	if systemdSocketsErr != nil {
+		return nil, systemdSocketsErr
+	}
+
+	systemdSocketsMu.Lock()
+	defer systemdSocketsMu.Unlock()
+
+	var listeners []net.Listener
+
+	for _, s := range systemdSockets {
+		if s.used || (len(name) > 0 && s.name != name) {
+			continue
+		}
+
+		s.used = true
+		listeners = append(listeners, s.listener)
+	}
+
+	if len(listeners) == 0 {
+		if len(name) > 0 {
+			return nil, fmt.Errorf("No unused sockets named %s were passed by systemd", name)
+		}
+		return nil, errors.New("No unused sockets were passed by systemd")
+	}
+
+	return listeners, nil
+}
@@ -0,0 +1,201 @@
+package lut
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	// Register the decoders of the HALD CLUT image formats
+	_ "image/png"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+const maxLUTSize = 256
+
+// LUT is a 3D color lookup table. Data contains Size^3 RGB triplets
+// in the 0..1 range. The red index changes fastest, then green, then blue
+type LUT struct {
+	Size int
+	Data []float32
+}
+
+var (
+	luts map[string]*LUT
+
+	errInvalidLUTSize = errors.New("Invalid LUT size")
+)
+
+func Init() error {
+	luts = make(map[string]*LUT, len(config.LUTs))
+
+	for name, path := range config.LUTs {
+		l, err := load(path)
+		if err != nil {
+			return fmt.Errorf("Can't load LUT %s: %s", name, err)
+		}
+
+		luts[name] = l
+	}
+
+	return nil
+}
+
+// Get returns the loaded LUT with the provided name
+func Get(name string) (*LUT, bool) {
+	l, ok := luts[name]
+	return l, ok
+}
+
+func load(path string) (*LUT, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".cube") {
+		return parseCube(data)
+	}
+
+	return parseHald(data)
+}
+
+// parseCube parses the LUT in the Adobe/Resolve .cube format
+func parseCube(data []byte) (*LUT, error) {
+	l := new(LUT)
+
+	domainMin := [3]float32{0, 0, 0}
+	domainMax := [3]float32{1, 1, 1}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		switch fields[0] {
+		case "TITLE":
+			continue
+		case "LUT_1D_SIZE":
+			return nil, errors.New("1D LUTs are not supported")
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, errInvalidLUTSize
+			}
+
+			size, err := strconv.Atoi(fields[1])
+			if err != nil || size < 2 || size > maxLUTSize {
+				return nil, errInvalidLUTSize
+			}
+
+			l.Size = size
+			l.Data = make([]float32, 0, size*size*size*3)
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			values, err := parseTriplet(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s: %s", fields[0], line)
+			}
+
+			if fields[0] == "DOMAIN_MIN" {
+				domainMin = values
+			} else {
+				domainMax = values
+			}
+		default:
+			if l.Size == 0 {
+				return nil, errors.New("LUT_3D_SIZE should be defined before the table data")
+			}
+
+			values, err := parseTriplet(fields)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid table data: %s", line)
+			}
+
+			if len(l.Data) == cap(l.Data) {
+				return nil, errors.New("Too many table data lines")
+			}
+
+			for i, v := range values {
+				l.Data = append(l.Data, (v-domainMin[i])/(domainMax[i]-domainMin[i]))
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if l.Size == 0 || len(l.Data) != cap(l.Data) {
+		return nil, errors.New("Incomplete table data")
+	}
+
+	return l, nil
+}
+
+func parseTriplet(fields []string) ([3]float32, error) {
+	var res [3]float32
+
+	if len(fields) != 3 {
+		return res, errors.New("Invalid triplet")
+	}
+
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 32)
+		if err != nil {
+			return res, err
+		}
+		res[i] = float32(v)
+	}
+
+	return res, nil
+}
+
+// parseHald parses the LUT in the HALD CLUT image format. The image of the level L
+// is a square of L^3 pixels side containing the LUT of L^2 size
+func parseHald(data []byte) (*LUT, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	side := bounds.Dx()
+
+	if side != bounds.Dy() {
+		return nil, errors.New("HALD CLUT image should be square")
+	}
+
+	level := 2
+	for level*level*level < side {
+		level++
+	}
+
+	if level*level*level != side || level*level > maxLUTSize {
+		return nil, errInvalidLUTSize
+	}
+
+	l := &LUT{
+		Size: level * level,
+		Data: make([]float32, 0, side*side*3),
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			l.Data = append(l.Data, float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff)
+		}
+	}
+
+	return l, nil
+}
@@ -0,0 +1,120 @@
+package lut
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type LUTTestSuite struct {
+	suite.Suite
+}
+
+func (s *LUTTestSuite) SetupTest() {
+	config.Reset()
+}
+
+func (s *LUTTestSuite) writeFile(name string, data []byte) string {
+	path := filepath.Join(s.T().TempDir(), name)
+	s.Require().Nil(ioutil.WriteFile(path, data, 0644))
+	return path
+}
+
+// identityCube builds the identity LUT in the .cube format
+func (s *LUTTestSuite) identityCube(size int) []byte {
+	var sb strings.Builder
+
+	sb.WriteString("# Identity\nTITLE \"identity\"\n")
+	fmt.Fprintf(&sb, "LUT_3D_SIZE %d\n\n", size)
+
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				fmt.Fprintf(
+					&sb, "%f %f %f\n",
+					float32(r)/float32(size-1), float32(g)/float32(size-1), float32(b)/float32(size-1),
+				)
+			}
+		}
+	}
+
+	return []byte(sb.String())
+}
+
+// identityHald builds the identity HALD CLUT of level 2
+func (s *LUTTestSuite) identityHald() []byte {
+	const level = 2
+	const size = level * level
+	const side = level * level * level
+
+	img := image.NewRGBA(image.Rect(0, 0, side, side))
+
+	for i := 0; i < side*side; i++ {
+		r, g, b := i%size, (i/size)%size, i/(size*size)
+		img.Set(i%side, i/side, color.RGBA{
+			R: uint8(r * 255 / (size - 1)),
+			G: uint8(g * 255 / (size - 1)),
+			B: uint8(b * 255 / (size - 1)),
+			A: 255,
+		})
+	}
+
+	var buf bytes.Buffer
+	s.Require().Nil(png.Encode(&buf, img))
+
+	return buf.Bytes()
+}
+
+func (s *LUTTestSuite) TestLoad() {
+	config.LUTs = map[string]string{
+		"cube": s.writeFile("identity.cube", s.identityCube(3)),
+		"hald": s.writeFile("identity.png", s.identityHald()),
+	}
+
+	s.Require().Nil(Init())
+
+	cube, ok := Get("cube")
+	s.Require().True(ok)
+	s.Require().Equal(3, cube.Size)
+	s.Require().Len(cube.Data, 3*3*3*3)
+	// The second entry has red = 0.5
+	s.Require().InDelta(0.5, cube.Data[3], 0.001)
+
+	hald, ok := Get("hald")
+	s.Require().True(ok)
+	s.Require().Equal(4, hald.Size)
+	s.Require().Len(hald.Data, 4*4*4*3)
+	// The last entry is white
+	s.Require().InDelta(1, hald.Data[len(hald.Data)-1], 0.001)
+
+	_, ok = Get("unknown")
+	s.Require().False(ok)
+}
+
+func (s *LUTTestSuite) TestInvalidCube() {
+	data := s.identityCube(3)
+
+	// Incomplete table data
+	config.LUTs = map[string]string{"cube": s.writeFile("broken.cube", data[:len(data)-20])}
+	s.Require().NotNil(Init())
+
+	config.LUTs = map[string]string{"cube": s.writeFile("broken.cube", []byte("LUT_3D_SIZE 1\n0 0 0\n"))}
+	s.Require().NotNil(Init())
+
+	config.LUTs = map[string]string{"cube": s.writeFile("broken.cube", []byte("0 0 0\n"))}
+	s.Require().NotNil(Init())
+}
+
+func TestLUT(t *testing.T) {
+	suite.Run(t, new(LUTTestSuite))
+}
@@ -12,15 +12,20 @@ import (
 	log "github.com/sirupsen/logrus"
 	"go.uber.org/automaxprocs/maxprocs"
 
+	"github.com/imgproxy/imgproxy/v3/barcode"
 	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/detection"
 	"github.com/imgproxy/imgproxy/v3/errorreport"
 	"github.com/imgproxy/imgproxy/v3/imagedata"
 	"github.com/imgproxy/imgproxy/v3/logger"
+	"github.com/imgproxy/imgproxy/v3/lut"
 	"github.com/imgproxy/imgproxy/v3/memory"
 	"github.com/imgproxy/imgproxy/v3/metrics"
 	"github.com/imgproxy/imgproxy/v3/metrics/prometheus"
 	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/resultcache"
 	"github.com/imgproxy/imgproxy/v3/version"
+	"github.com/imgproxy/imgproxy/v3/video"
 	"github.com/imgproxy/imgproxy/v3/vips"
 )
 
@@ -35,6 +40,8 @@ func initialize() error {
 		return err
 	}
 
+	memory.Tune()
+
 	if err := metrics.Init(); err != nil {
 		return err
 	}
@@ -43,14 +50,39 @@ func initialize() error {
 		return err
 	}
 
+	if err := resultcache.Init(); err != nil {
+		return err
+	}
+
 	initProcessingHandler()
 
+	if err := detection.Init(); err != nil {
+		return err
+	}
+
+	if err := lut.Init(); err != nil {
+		return err
+	}
+
+	if err := video.Init(); err != nil {
+		return err
+	}
+
+	if err := barcode.Init(); err != nil {
+		return err
+	}
+
 	errorreport.Init()
 
 	if err := vips.Init(); err != nil {
 		return err
 	}
 
+	if err := options.ParseFilters(config.Filters); err != nil {
+		vips.Shutdown()
+		return err
+	}
+
 	if err := options.ParsePresets(config.Presets); err != nil {
 		vips.Shutdown()
 		return err
@@ -61,6 +93,18 @@ func initialize() error {
 		return err
 	}
 
+	if err := options.ParseSourceHostOptions(config.SourceHostOptions); err != nil {
+		vips.Shutdown()
+		return err
+	}
+
+	for prefix, presets := range config.PathPrefixPresets {
+		if err := options.CheckPresetsExist(presets); err != nil {
+			vips.Shutdown()
+			return fmt.Errorf("Invalid presets for path prefix %s: %s", prefix, err)
+		}
+	}
+
 	return nil
 }
 
@@ -90,6 +134,7 @@ func run() error {
 	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	if err := prometheus.StartServer(cancel); err != nil {
 		return err
@@ -101,6 +146,8 @@ func run() error {
 	}
 	defer shutdownServer(s)
 
+	startReloader(ctx)
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
@@ -118,6 +165,15 @@ func main() {
 	switch flag.Arg(0) {
 	case "health":
 		os.Exit(healthcheck())
+	case "validate":
+		os.Exit(validateConfig(os.Stdout))
+	case "url":
+		os.Exit(urlCLI(flag.Args()[1:], os.Stdout, os.Stderr))
+	case "lambda":
+		if err := runLambda(); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
 	case "version":
 		fmt.Println(version.Version())
 		os.Exit(0)
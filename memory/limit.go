@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+const softLimitCheckInterval = 50 * time.Millisecond
+
+// Usage returns the sum of the vips tracked memory and the Go heap size in bytes
+func Usage() int {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return int(vips.GetMem()) + int(m.HeapAlloc)
+}
+
+// WaitForSoftLimit waits until the memory usage is below the soft limit.
+// Returns false if the memory usage is still above the limit after the timeout
+// or if the context is done
+func WaitForSoftLimit(ctx context.Context, timeout time.Duration) bool {
+	if config.MemorySoftLimit <= 0 || Usage() < config.MemorySoftLimit {
+		return true
+	}
+
+	if timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(softLimitCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return false
+		case <-ticker.C:
+			if Usage() < config.MemorySoftLimit {
+				return true
+			}
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package memory
+
+import (
+	"runtime/debug"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// ballast is a large allocation that is never used.
+// It increases the heap size, so GC runs less often on small heaps
+var ballast []byte
+
+// Tune applies the GC and memory ballast settings
+func Tune() {
+	if config.GCPercent > 0 {
+		debug.SetGCPercent(config.GCPercent)
+	}
+
+	if config.MemoryBallastSize > 0 {
+		ballast = make([]byte, config.MemoryBallastSize)
+	}
+}
@@ -3,10 +3,13 @@ package datadog
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/DataDog/datadog-go/statsd"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -17,7 +20,18 @@ import (
 
 type spanCtxKey struct{}
 
-var enabled bool
+type gaugeFunc func() float64
+
+var (
+	enabled        bool
+	enabledMetrics bool
+
+	statsdClient     *statsd.Client
+	statsdClientStop chan struct{}
+
+	gaugeFuncs      = make(map[string]gaugeFunc)
+	gaugeFuncsMutex sync.RWMutex
+)
 
 func Init() {
 	if !config.DataDogEnable {
@@ -36,9 +50,50 @@ func Init() {
 	)
 
 	enabled = true
+
+	if config.DataDogEnableMetrics {
+		initStatsd(name)
+	}
+}
+
+func initStatsd(name string) {
+	host := os.Getenv("DD_AGENT_HOST")
+	if len(host) == 0 {
+		host = "localhost"
+	}
+
+	port := os.Getenv("DD_DOGSTATSD_PORT")
+	if len(port) == 0 {
+		port = "8125"
+	}
+
+	var err error
+
+	statsdClient, err = statsd.New(
+		net.JoinHostPort(host, port),
+		statsd.WithNamespace("imgproxy."),
+		statsd.WithTags([]string{
+			"service:" + name,
+			"version:" + version.Version(),
+		}),
+	)
+	if err != nil {
+		log.Warningf("Can't initialize DogStatsD client: %s", err)
+		return
+	}
+
+	statsdClientStop = make(chan struct{})
+	go runMetricsCollector()
+
+	enabledMetrics = true
 }
 
 func Stop() {
+	if enabledMetrics {
+		close(statsdClientStop)
+		statsdClient.Close()
+	}
+
 	if enabled {
 		tracer.Stop()
 	}
@@ -48,6 +103,10 @@ func Enabled() bool {
 	return enabled
 }
 
+func MetricsEnabled() bool {
+	return enabledMetrics
+}
+
 func StartRootSpan(ctx context.Context, rw http.ResponseWriter, r *http.Request) (context.Context, context.CancelFunc, http.ResponseWriter) {
 	if !enabled {
 		return ctx, func() {}, rw
@@ -100,6 +159,83 @@ func SendTimeout(ctx context.Context, d time.Duration) {
 	}
 }
 
+// AddGaugeFunc registers the function that provides the gauge value
+// that will be sent to DogStatsD periodically
+func AddGaugeFunc(name string, f func() float64) {
+	gaugeFuncsMutex.Lock()
+	defer gaugeFuncsMutex.Unlock()
+
+	gaugeFuncs[name] = f
+}
+
+func runMetricsCollector() {
+	tick := time.NewTicker(10 * time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			func() {
+				gaugeFuncsMutex.RLock()
+				defer gaugeFuncsMutex.RUnlock()
+
+				for name, f := range gaugeFuncs {
+					statsdClient.Gauge(name, f(), nil, 1)
+				}
+			}()
+		case <-statsdClientStop:
+			return
+		}
+	}
+}
+
+func IncrementRequestsTotal() {
+	if enabledMetrics {
+		statsdClient.Incr("requests_total", nil, 1)
+	}
+}
+
+func ObserveRequestDuration(d time.Duration) {
+	if enabledMetrics {
+		statsdClient.Timing("request_duration", d, nil, 1)
+	}
+}
+
+func ObserveStageDuration(stage, sourceFormat, targetFormat, status string, d time.Duration) {
+	if enabledMetrics {
+		statsdClient.Timing("stage_duration", d, []string{
+			"stage:" + stage,
+			"source_format:" + sourceFormat,
+			"target_format:" + targetFormat,
+			"status:" + status,
+		}, 1)
+	}
+}
+
+func IncrementErrorsTotal(t string) {
+	if enabledMetrics {
+		statsdClient.Incr("errors_total", []string{"type:" + t}, 1)
+	}
+}
+
+func IncrementOptionUsage(option string) {
+	if enabledMetrics {
+		statsdClient.Incr("processing_option_usage_total", []string{"option:" + option}, 1)
+	}
+}
+
+func IncrementPresetUsage(preset string) {
+	if enabledMetrics {
+		statsdClient.Incr("preset_usage_total", []string{"preset:" + preset}, 1)
+	}
+}
+
+func IncrementResultFormat(format string) {
+	if enabledMetrics {
+		statsdClient.Incr("result_format_total", []string{"format:" + format}, 1)
+	}
+}
+
 type dataDogLogger struct {
 }
 
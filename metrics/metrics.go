@@ -5,8 +5,11 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/imgproxy/imgproxy/v3/accesslog"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
 	"github.com/imgproxy/imgproxy/v3/metrics/datadog"
 	"github.com/imgproxy/imgproxy/v3/metrics/newrelic"
+	"github.com/imgproxy/imgproxy/v3/metrics/otel"
 	"github.com/imgproxy/imgproxy/v3/metrics/prometheus"
 )
 
@@ -19,28 +22,38 @@ func Init() error {
 
 	datadog.Init()
 
+	otel.Init()
+
 	return nil
 }
 
 func Stop() {
 	datadog.Stop()
+	otel.Stop()
 }
 
 func Enabled() bool {
 	return prometheus.Enabled() ||
 		newrelic.Enabled() ||
-		datadog.Enabled()
+		datadog.Enabled() ||
+		otel.Enabled()
 }
 
 func StartRequest(ctx context.Context, rw http.ResponseWriter, r *http.Request) (context.Context, context.CancelFunc, http.ResponseWriter) {
 	promCancel := prometheus.StartRequest()
 	ctx, nrCancel, rw := newrelic.StartTransaction(ctx, rw, r)
 	ctx, ddCancel, rw := datadog.StartRootSpan(ctx, rw, r)
+	ctx, otelCancel, rw := otel.StartRootSpan(ctx, rw, r)
+
+	datadog.IncrementRequestsTotal()
+	t := time.Now()
 
 	cancel := func() {
 		promCancel()
 		nrCancel()
 		ddCancel()
+		otelCancel()
+		datadog.ObserveRequestDuration(time.Since(t))
 	}
 
 	return ctx, cancel, rw
@@ -50,11 +63,13 @@ func StartDownloadingSegment(ctx context.Context) context.CancelFunc {
 	promCancel := prometheus.StartDownloadingSegment()
 	nrCancel := newrelic.StartSegment(ctx, "Downloading image")
 	ddCancel := datadog.StartSpan(ctx, "downloading_image")
+	otelCancel := otel.StartSpan(ctx, "downloading_image")
 
 	cancel := func() {
 		promCancel()
 		nrCancel()
 		ddCancel()
+		otelCancel()
 	}
 
 	return cancel
@@ -64,24 +79,106 @@ func StartProcessingSegment(ctx context.Context) context.CancelFunc {
 	promCancel := prometheus.StartProcessingSegment()
 	nrCancel := newrelic.StartSegment(ctx, "Processing image")
 	ddCancel := datadog.StartSpan(ctx, "processing_image")
+	otelCancel := otel.StartSpan(ctx, "processing_image")
 
 	cancel := func() {
 		promCancel()
 		nrCancel()
 		ddCancel()
+		otelCancel()
+	}
+
+	return cancel
+}
+
+func StartParsingSegment(ctx context.Context) context.CancelFunc {
+	nrCancel := newrelic.StartSegment(ctx, "Parsing URL")
+	ddCancel := datadog.StartSpan(ctx, "parsing_url")
+	otelCancel := otel.StartSpan(ctx, "parsing_url")
+
+	cancel := func() {
+		nrCancel()
+		ddCancel()
+		otelCancel()
 	}
 
 	return cancel
 }
 
+// StartStage starts measuring the duration of the image handling stage
+// (download, decode, transform, encode). The returned function should be called
+// when the stage is finished
+func StartStage(ctx context.Context, stage string) func(sourceFormat, targetFormat imagetype.Type, err error) {
+	if !prometheus.Enabled() && !datadog.MetricsEnabled() && !otel.Enabled() && !accesslog.RecordsEnabled() {
+		return func(imagetype.Type, imagetype.Type, error) {}
+	}
+
+	t := time.Now()
+	otelFinish := otel.StartSpanWithResult(ctx, stage)
+
+	return func(sourceFormat, targetFormat imagetype.Type, err error) {
+		status := "success"
+		if err != nil {
+			status = "error"
+		}
+
+		d := time.Since(t)
+
+		prometheus.ObserveStageDuration(stage, sourceFormat.String(), targetFormat.String(), status, d)
+		datadog.ObserveStageDuration(stage, sourceFormat.String(), targetFormat.String(), status, d)
+		accesslog.ObserveStage(ctx, stage, d)
+		otelFinish(err)
+	}
+}
+
+// ObserveOptionsUsage counts the processing options and presets used in the request.
+// Each option is counted once per request
+func ObserveOptionsUsage(options, presets []string) {
+	if !prometheus.Enabled() && !datadog.MetricsEnabled() {
+		return
+	}
+
+	seen := make(map[string]struct{}, len(options))
+
+	for _, o := range options {
+		if _, ok := seen[o]; ok {
+			continue
+		}
+
+		seen[o] = struct{}{}
+		prometheus.IncrementOptionUsage(o)
+		datadog.IncrementOptionUsage(o)
+	}
+
+	for _, p := range presets {
+		prometheus.IncrementPresetUsage(p)
+		datadog.IncrementPresetUsage(p)
+	}
+}
+
+func ObserveResultFormat(format imagetype.Type) {
+	prometheus.IncrementResultFormat(format.String())
+	datadog.IncrementResultFormat(format.String())
+}
+
+// AddGaugeFunc registers the function that provides the gauge value
+func AddGaugeFunc(name, help string, f func() float64) {
+	prometheus.AddGaugeFunc(name, help, f)
+	datadog.AddGaugeFunc(name, f)
+}
+
 func SendError(ctx context.Context, errType string, err error) {
 	prometheus.IncrementErrorsTotal(errType)
+	datadog.IncrementErrorsTotal(errType)
 	newrelic.SendError(ctx, err)
 	datadog.SendError(ctx, err)
+	otel.SendError(ctx, err)
 }
 
 func SendTimeout(ctx context.Context, d time.Duration) {
 	prometheus.IncrementErrorsTotal("timeout")
+	datadog.IncrementErrorsTotal("timeout")
 	newrelic.SendTimeout(ctx, d)
 	datadog.SendTimeout(ctx, d)
+	otel.SendTimeout(ctx, d)
 }
@@ -0,0 +1,221 @@
+package otel
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/version"
+)
+
+const (
+	exportBatchSize = 512
+	exportInterval  = 5 * time.Second
+)
+
+var (
+	spansCh      chan otlpSpan
+	spansChMu    sync.RWMutex
+	spansChOpen  bool
+	exporterDone sync.WaitGroup
+	exportClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// OTLP/HTTP JSON representation of the traces.
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/main/docs/specification.md#json-protobuf-encoding
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpValue(v interface{}) otlpAnyValue {
+	switch vv := v.(type) {
+	case int:
+		s := strconv.Itoa(vv)
+		return otlpAnyValue{IntValue: &s}
+	case string:
+		return otlpAnyValue{StringValue: &vv}
+	default:
+		s := fmt.Sprint(vv)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
+
+func (s *span) toOTLP() otlpSpan {
+	res := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+
+	if s.parentSpanID != [8]byte{} {
+		res.ParentSpanID = hex.EncodeToString(s.parentSpanID[:])
+	}
+
+	for _, a := range s.attributes {
+		res.Attributes = append(res.Attributes, otlpKeyValue{Key: a.Key, Value: otlpValue(a.Value)})
+	}
+
+	if s.failed {
+		res.Status = otlpStatus{Code: statusCodeError, Message: s.statusMessage}
+	}
+
+	return res
+}
+
+func startExporter() {
+	spansCh = make(chan otlpSpan, exportBatchSize*4)
+	spansChOpen = true
+
+	exporterDone.Add(1)
+
+	go func() {
+		defer exporterDone.Done()
+
+		ticker := time.NewTicker(exportInterval)
+		defer ticker.Stop()
+
+		batch := make([]otlpSpan, 0, exportBatchSize)
+
+		for {
+			select {
+			case s, ok := <-spansCh:
+				if !ok {
+					sendSpans(batch)
+					return
+				}
+
+				batch = append(batch, s)
+				if len(batch) >= exportBatchSize {
+					sendSpans(batch)
+					batch = batch[:0]
+				}
+			case <-ticker.C:
+				sendSpans(batch)
+				batch = batch[:0]
+			}
+		}
+	}()
+}
+
+func stopExporter() {
+	spansChMu.Lock()
+	spansChOpen = false
+	close(spansCh)
+	spansChMu.Unlock()
+
+	exporterDone.Wait()
+}
+
+// export should be called with the span locked
+func export(s *span) {
+	spansChMu.RLock()
+	defer spansChMu.RUnlock()
+
+	// The spans of the requests that finished after the shutdown are dropped
+	if !spansChOpen {
+		return
+	}
+
+	select {
+	case spansCh <- s.toOTLP():
+	default:
+		log.Warning("OpenTelemetry spans queue is full, dropping the span")
+	}
+}
+
+func sendSpans(spans []otlpSpan) {
+	if len(spans) == 0 {
+		return
+	}
+
+	serviceName := config.OpenTelemetryServiceName
+
+	traces := otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{
+					{Key: "service.name", Value: otlpValue(serviceName)},
+					{Key: "service.version", Value: otlpValue(version.Version())},
+				},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "imgproxy", Version: version.Version()},
+				Spans: spans,
+			}},
+		}},
+	}
+
+	body, err := json.Marshal(traces)
+	if err != nil {
+		log.Warningf("Can't encode OpenTelemetry spans: %s", err)
+		return
+	}
+
+	res, err := exportClient.Post(config.OpenTelemetryEndpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Warningf("Can't send OpenTelemetry spans: %s", err)
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		log.Warningf("Can't send OpenTelemetry spans: collector responded with %s", res.Status)
+	}
+}
@@ -0,0 +1,240 @@
+package otel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+
+	statusCodeError = 2
+)
+
+type spanCtxKey struct{}
+
+var enabled bool
+
+type attribute struct {
+	Key   string
+	Value interface{}
+}
+
+type span struct {
+	traceID      [16]byte
+	spanID       [8]byte
+	parentSpanID [8]byte
+
+	name  string
+	kind  int
+	start time.Time
+	end   time.Time
+
+	mu            sync.Mutex
+	attributes    []attribute
+	statusMessage string
+	failed        bool
+	finished      bool
+}
+
+func Init() {
+	if len(config.OpenTelemetryEndpoint) == 0 {
+		return
+	}
+
+	startExporter()
+
+	enabled = true
+}
+
+func Stop() {
+	if enabled {
+		stopExporter()
+	}
+}
+
+func Enabled() bool {
+	return enabled
+}
+
+func newSpan(name string, kind int) *span {
+	s := &span{
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+	}
+
+	rand.Read(s.spanID[:])
+
+	return s
+}
+
+func (s *span) setAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attributes = append(s.attributes, attribute{Key: key, Value: value})
+}
+
+func (s *span) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = true
+	s.statusMessage = err.Error()
+}
+
+func (s *span) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.finished {
+		return
+	}
+
+	s.finished = true
+	s.end = time.Now()
+
+	export(s)
+}
+
+// parseTraceparent parses the W3C traceparent header.
+// See https://www.w3.org/TR/trace-context/#traceparent-header
+func parseTraceparent(header string) (traceID [16]byte, parentID [8]byte, sampled bool, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return
+	}
+
+	// Version 00 has exactly 4 parts, future versions may have more
+	if parts[0] == "00" && len(parts) != 4 {
+		return
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return
+	}
+
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return
+	}
+
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == [8]byte{} {
+		return
+	}
+
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return
+	}
+
+	return traceID, parentID, flags[0]&1 == 1, true
+}
+
+func StartRootSpan(ctx context.Context, rw http.ResponseWriter, r *http.Request) (context.Context, context.CancelFunc, http.ResponseWriter) {
+	if !enabled {
+		return ctx, func() {}, rw
+	}
+
+	s := newSpan("request", spanKindServer)
+
+	if traceID, parentID, sampled, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+		// The caller doesn't want this trace to be recorded
+		if !sampled {
+			return ctx, func() {}, rw
+		}
+
+		s.traceID = traceID
+		s.parentSpanID = parentID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+
+	s.setAttribute("http.method", r.Method)
+	s.setAttribute("http.target", r.RequestURI)
+	s.setAttribute("http.user_agent", r.UserAgent())
+
+	cancel := func() { s.finish() }
+	newRw := otelResponseWriter{rw, s}
+
+	return context.WithValue(ctx, spanCtxKey{}, s), cancel, newRw
+}
+
+func StartSpan(ctx context.Context, name string) context.CancelFunc {
+	finish := StartSpanWithResult(ctx, name)
+	return func() { finish(nil) }
+}
+
+// StartSpanWithResult starts a child span of the request span.
+// The returned function finishes the span and marks it as failed when err is not nil
+func StartSpanWithResult(ctx context.Context, name string, attrs ...string) func(err error) {
+	if !enabled {
+		return func(error) {}
+	}
+
+	rootSpan, ok := ctx.Value(spanCtxKey{}).(*span)
+	if !ok {
+		return func(error) {}
+	}
+
+	s := newSpan(name, spanKindInternal)
+	s.traceID = rootSpan.traceID
+	s.parentSpanID = rootSpan.spanID
+
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.setAttribute(attrs[i], attrs[i+1])
+	}
+
+	return func(err error) {
+		if err != nil {
+			s.setError(err)
+		}
+		s.finish()
+	}
+}
+
+func SendError(ctx context.Context, err error) {
+	if !enabled {
+		return
+	}
+
+	if rootSpan, ok := ctx.Value(spanCtxKey{}).(*span); ok {
+		rootSpan.setError(err)
+	}
+}
+
+func SendTimeout(ctx context.Context, d time.Duration) {
+	if !enabled {
+		return
+	}
+
+	if rootSpan, ok := ctx.Value(spanCtxKey{}).(*span); ok {
+		rootSpan.setAttribute("timeout_duration", d.String())
+		rootSpan.setError(errors.New("Timeout"))
+	}
+}
+
+type otelResponseWriter struct {
+	rw   http.ResponseWriter
+	span *span
+}
+
+func (orw otelResponseWriter) Header() http.Header {
+	return orw.rw.Header()
+}
+func (orw otelResponseWriter) Write(data []byte) (int, error) {
+	return orw.rw.Write(data)
+}
+func (orw otelResponseWriter) WriteHeader(statusCode int) {
+	orw.span.setAttribute("http.status_code", statusCode)
+	orw.rw.WriteHeader(statusCode)
+}
@@ -0,0 +1,100 @@
+package otel
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type OtelTestSuite struct {
+	suite.Suite
+}
+
+func (s *OtelTestSuite) SetupTest() {
+	config.Reset()
+}
+
+func (s *OtelTestSuite) TestParseTraceparent() {
+	traceID, parentID, sampled, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	require.True(s.T(), ok)
+	assert.Equal(s.T(), "4bf92f3577b34da6a3ce929d0e0e4736", hex.EncodeToString(traceID[:]))
+	assert.Equal(s.T(), "00f067aa0ba902b7", hex.EncodeToString(parentID[:]))
+	assert.True(s.T(), sampled)
+
+	_, _, sampled, ok = parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+
+	require.True(s.T(), ok)
+	assert.False(s.T(), sampled)
+}
+
+func (s *OtelTestSuite) TestParseTraceparentInvalid() {
+	for _, h := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	} {
+		_, _, _, ok := parseTraceparent(h)
+		assert.False(s.T(), ok, h)
+	}
+}
+
+func (s *OtelTestSuite) TestExport() {
+	var traces otlpTraces
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Equal(s.T(), "application/json", r.Header.Get("Content-Type"))
+		assert.Nil(s.T(), json.NewDecoder(r.Body).Decode(&traces))
+	}))
+	defer ts.Close()
+
+	config.OpenTelemetryEndpoint = ts.URL
+
+	Init()
+
+	req := httptest.NewRequest(http.MethodGet, "/unsafe/plain/local:///test1.png", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, cancel, rw := StartRootSpan(context.Background(), httptest.NewRecorder(), req)
+	StartSpanWithResult(ctx, "download")(errors.New("Not found"))
+	rw.WriteHeader(404)
+	cancel()
+
+	Stop()
+	enabled = false
+
+	require.Len(s.T(), traces.ResourceSpans, 1)
+	require.Len(s.T(), traces.ResourceSpans[0].ScopeSpans, 1)
+
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(s.T(), spans, 2)
+
+	download, root := spans[0], spans[1]
+
+	assert.Equal(s.T(), "4bf92f3577b34da6a3ce929d0e0e4736", root.TraceID)
+	assert.Equal(s.T(), "00f067aa0ba902b7", root.ParentSpanID)
+	assert.Equal(s.T(), spanKindServer, root.Kind)
+
+	assert.Equal(s.T(), root.TraceID, download.TraceID)
+	assert.Equal(s.T(), root.SpanID, download.ParentSpanID)
+	assert.Equal(s.T(), statusCodeError, download.Status.Code)
+	assert.Equal(s.T(), "Not found", download.Status.Message)
+}
+
+func TestOtel(t *testing.T) {
+	suite.Run(t, new(OtelTestSuite))
+}
@@ -3,6 +3,7 @@ package prometheus
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -11,7 +12,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/imgproxy/imgproxy/v3/config"
-	"github.com/imgproxy/imgproxy/v3/reuseport"
+	"github.com/imgproxy/imgproxy/v3/listener"
 )
 
 var (
@@ -22,9 +23,15 @@ var (
 	requestDuration    prometheus.Histogram
 	downloadDuration   prometheus.Histogram
 	processingDuration prometheus.Histogram
+	stageDuration      *prometheus.HistogramVec
+	optionUsageTotal   *prometheus.CounterVec
+	presetUsageTotal   *prometheus.CounterVec
+	resultFormatTotal  *prometheus.CounterVec
 	bufferSize         *prometheus.HistogramVec
 	bufferDefaultSize  *prometheus.GaugeVec
 	bufferMaxSize      *prometheus.GaugeVec
+	sourceConnsTotal   prometheus.Counter
+	sourceConnsOpen    prometheus.Gauge
 )
 
 func Init() {
@@ -62,6 +69,30 @@ func Init() {
 		Help:      "A histogram of the image processing latency.",
 	})
 
+	stageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: config.PrometheusNamespace,
+		Name:      "stage_duration_seconds",
+		Help:      "A histogram of the image handling stages latency.",
+	}, []string{"stage", "source_format", "target_format", "status"})
+
+	optionUsageTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.PrometheusNamespace,
+		Name:      "processing_option_usage_total",
+		Help:      "A counter of the processing options usage in URLs.",
+	}, []string{"option"})
+
+	presetUsageTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.PrometheusNamespace,
+		Name:      "preset_usage_total",
+		Help:      "A counter of the presets usage.",
+	}, []string{"preset"})
+
+	resultFormatTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.PrometheusNamespace,
+		Name:      "result_format_total",
+		Help:      "A counter of the served images separated by format.",
+	}, []string{"format"})
+
 	bufferSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: config.PrometheusNamespace,
 		Name:      "buffer_size_bytes",
@@ -81,15 +112,33 @@ func Init() {
 		Help:      "A gauge of the buffer max size in bytes.",
 	}, []string{"type"})
 
+	sourceConnsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: config.PrometheusNamespace,
+		Name:      "source_connections_total",
+		Help:      "A counter of the total number of connections opened to the source image servers.",
+	})
+
+	sourceConnsOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: config.PrometheusNamespace,
+		Name:      "source_connections",
+		Help:      "A gauge of the number of open connections to the source image servers.",
+	})
+
 	prometheus.MustRegister(
 		requestsTotal,
 		errorsTotal,
 		requestDuration,
 		downloadDuration,
 		processingDuration,
+		stageDuration,
+		optionUsageTotal,
+		presetUsageTotal,
+		resultFormatTotal,
 		bufferSize,
 		bufferDefaultSize,
 		bufferMaxSize,
+		sourceConnsTotal,
+		sourceConnsOpen,
 	)
 
 	enabled = true
@@ -104,20 +153,30 @@ func StartServer(cancel context.CancelFunc) error {
 		return nil
 	}
 
-	s := http.Server{Handler: promhttp.Handler()}
+	var handler http.Handler = promhttp.Handler()
+
+	if len(config.PrometheusPath) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle(config.PrometheusPath, handler)
+		handler = mux
+	}
+
+	s := http.Server{Handler: handler}
 
-	l, err := reuseport.Listen("tcp", config.PrometheusBind)
+	listeners, err := listener.Listen("tcp", config.PrometheusBind)
 	if err != nil {
 		return fmt.Errorf("Can't start Prometheus metrics server: %s", err)
 	}
 
-	go func() {
-		log.Infof("Starting Prometheus server at %s", config.PrometheusBind)
-		if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
-			log.Error(err)
-		}
-		cancel()
-	}()
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			log.Infof("Starting Prometheus server at %s", l.Addr())
+			if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+				log.Error(err)
+			}
+			cancel()
+		}(l)
+	}
 
 	return nil
 }
@@ -150,6 +209,35 @@ func startDuration(m prometheus.Histogram) context.CancelFunc {
 	}
 }
 
+func ObserveStageDuration(stage, sourceFormat, targetFormat, status string, d time.Duration) {
+	if enabled {
+		stageDuration.With(prometheus.Labels{
+			"stage":         stage,
+			"source_format": sourceFormat,
+			"target_format": targetFormat,
+			"status":        status,
+		}).Observe(d.Seconds())
+	}
+}
+
+func IncrementOptionUsage(option string) {
+	if enabled {
+		optionUsageTotal.With(prometheus.Labels{"option": option}).Inc()
+	}
+}
+
+func IncrementPresetUsage(preset string) {
+	if enabled {
+		presetUsageTotal.With(prometheus.Labels{"preset": preset}).Inc()
+	}
+}
+
+func IncrementResultFormat(format string) {
+	if enabled {
+		resultFormatTotal.With(prometheus.Labels{"format": format}).Inc()
+	}
+}
+
 func IncrementErrorsTotal(t string) {
 	if enabled {
 		errorsTotal.With(prometheus.Labels{"type": t}).Inc()
@@ -174,6 +262,19 @@ func SetBufferMaxSize(t string, size int) {
 	}
 }
 
+func IncrementSourceConnections() {
+	if enabled {
+		sourceConnsTotal.Inc()
+		sourceConnsOpen.Inc()
+	}
+}
+
+func DecrementSourceConnections() {
+	if enabled {
+		sourceConnsOpen.Dec()
+	}
+}
+
 func AddGaugeFunc(name, help string, f func() float64) {
 	if !enabled {
 		return
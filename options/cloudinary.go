@@ -0,0 +1,312 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	cloudinaryParamRe   = regexp.MustCompile(`^([a-z]+)_(.+)$`)
+	cloudinaryVersionRe = regexp.MustCompile(`^v\d+$`)
+)
+
+// cloudinaryParams are the transformation parameters Cloudinary supports.
+// They are used to tell the transformations from the public ID
+var cloudinaryParams = map[string]struct{}{
+	"a": {}, "ac": {}, "af": {}, "b": {}, "bo": {}, "br": {}, "c": {}, "co": {},
+	"cs": {}, "d": {}, "dl": {}, "dn": {}, "dpr": {}, "du": {}, "e": {}, "eo": {},
+	"f": {}, "fl": {}, "fn": {}, "fps": {}, "g": {}, "h": {}, "if": {}, "ki": {},
+	"l": {}, "o": {}, "p": {}, "pg": {}, "q": {}, "r": {}, "so": {}, "sp": {},
+	"t": {}, "u": {}, "vc": {}, "vs": {}, "w": {}, "x": {}, "y": {}, "z": {},
+}
+
+var cloudinaryGravityTypes = map[string]string{
+	"center":     "ce",
+	"north":      "no",
+	"south":      "so",
+	"east":       "ea",
+	"west":       "we",
+	"north_east": "noea",
+	"north_west": "nowe",
+	"south_east": "soea",
+	"south_west": "sowe",
+	"auto":       "sm",
+	"face":       "face",
+	"faces":      "face",
+}
+
+// cloudinaryTransformation collects the parameters of a single
+// Cloudinary transformation component
+type cloudinaryTransformation struct {
+	crop    string
+	width   string
+	height  string
+	gravity string
+	x, y    string
+	opts    urlOptions
+}
+
+func isCloudinaryTransformation(component string) bool {
+	for _, param := range strings.Split(component, ",") {
+		m := cloudinaryParamRe.FindStringSubmatch(param)
+		if m == nil {
+			return false
+		}
+
+		if _, ok := cloudinaryParams[m[1]]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseCloudinaryDimension(name, value string) (string, error) {
+	if v, err := strconv.Atoi(value); err == nil && v >= 0 {
+		return value, nil
+	}
+
+	return "", fmt.Errorf("Unsupported Cloudinary %s: %s", name, value)
+}
+
+func parseCloudinaryColor(value string) (string, error) {
+	if strings.HasPrefix(value, "rgb:") {
+		return strings.TrimPrefix(value, "rgb:"), nil
+	}
+
+	return "", fmt.Errorf("Unsupported Cloudinary color: %s", value)
+}
+
+// parseCloudinaryStrength converts Cloudinary effect strength
+// which is 100 by default into sigma
+func parseCloudinaryStrength(effect string, args []string) (string, error) {
+	if len(args) == 0 {
+		return "1", nil
+	}
+
+	s, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || s <= 0 {
+		return "", fmt.Errorf("Invalid Cloudinary %s strength: %s", effect, args[0])
+	}
+
+	return strconv.FormatFloat(s/100, 'f', -1, 64), nil
+}
+
+func parseCloudinaryEffect(t *cloudinaryTransformation, value string) error {
+	args := strings.Split(value, ":")
+	effect, args := args[0], args[1:]
+
+	switch effect {
+	case "blur":
+		sigma, err := parseCloudinaryStrength(effect, args)
+		if err != nil {
+			return err
+		}
+		t.opts = append(t.opts, urlOption{Name: "blur", Args: []string{sigma}})
+	case "sharpen":
+		sigma, err := parseCloudinaryStrength(effect, args)
+		if err != nil {
+			return err
+		}
+		t.opts = append(t.opts, urlOption{Name: "sharpen", Args: []string{sigma}})
+	case "pixelate":
+		size := "5"
+		if len(args) > 0 {
+			size = args[0]
+		}
+		t.opts = append(t.opts, urlOption{Name: "pixelate", Args: []string{size}})
+	case "trim":
+		threshold := "10"
+		if len(args) > 0 {
+			threshold = args[0]
+		}
+		t.opts = append(t.opts, urlOption{Name: "trim", Args: []string{threshold}})
+	default:
+		return fmt.Errorf("Unsupported Cloudinary effect: %s", effect)
+	}
+
+	return nil
+}
+
+func parseCloudinaryParam(t *cloudinaryTransformation, name, value string) (err error) {
+	switch name {
+	case "c":
+		t.crop = value
+	case "w":
+		t.width, err = parseCloudinaryDimension("width", value)
+	case "h":
+		t.height, err = parseCloudinaryDimension("height", value)
+	case "g":
+		g, ok := cloudinaryGravityTypes[value]
+		if !ok {
+			return fmt.Errorf("Unsupported Cloudinary gravity: %s", value)
+		}
+		t.gravity = g
+	case "x":
+		t.x, err = parseCloudinaryDimension("x", value)
+	case "y":
+		t.y, err = parseCloudinaryDimension("y", value)
+	case "q":
+		// imgproxy uses the configured quality for q_auto
+		if !strings.HasPrefix(value, "auto") {
+			t.opts = append(t.opts, urlOption{Name: "quality", Args: []string{value}})
+		}
+	case "f":
+		// imgproxy uses AVIF/WebP detection for f_auto
+		if value != "auto" {
+			t.opts = append(t.opts, urlOption{Name: "format", Args: []string{value}})
+		}
+	case "dpr":
+		if value != "auto" {
+			t.opts = append(t.opts, urlOption{Name: "dpr", Args: []string{value}})
+		}
+	case "a":
+		t.opts = append(t.opts, urlOption{Name: "rotate", Args: []string{value}})
+	case "b":
+		var color string
+		if color, err = parseCloudinaryColor(value); err == nil {
+			t.opts = append(t.opts, urlOption{Name: "background", Args: []string{color}})
+		}
+	case "e":
+		err = parseCloudinaryEffect(t, value)
+	default:
+		err = fmt.Errorf("Unsupported Cloudinary parameter: %s", name)
+	}
+
+	return
+}
+
+// toURLOptions translates the collected transformation parameters
+// into the processing options
+func (t *cloudinaryTransformation) toURLOptions() (urlOptions, error) {
+	var opts urlOptions
+
+	width, height := t.width, t.height
+	if len(width) == 0 {
+		width = "0"
+	}
+	if len(height) == 0 {
+		height = "0"
+	}
+
+	gravity := t.gravity
+
+	switch t.crop {
+	case "", "scale":
+		resizingType := "fit"
+		if len(t.width) > 0 && len(t.height) > 0 {
+			resizingType = "force"
+		}
+		opts = append(opts, urlOption{Name: "resize", Args: []string{resizingType, width, height, "1"}})
+	case "fit", "mfit":
+		opts = append(opts, urlOption{Name: "resize", Args: []string{"fit", width, height, "1"}})
+	case "limit":
+		opts = append(opts, urlOption{Name: "resize", Args: []string{"fit", width, height, "0"}})
+	case "fill", "thumb":
+		opts = append(opts, urlOption{Name: "resize", Args: []string{"fill", width, height, "1"}})
+	case "lfill":
+		opts = append(opts, urlOption{Name: "resize", Args: []string{"fill", width, height, "0"}})
+	case "pad":
+		opts = append(opts, urlOption{Name: "resize", Args: []string{"fit", width, height, "1", "1"}})
+	case "lpad":
+		opts = append(opts, urlOption{Name: "resize", Args: []string{"fit", width, height, "0", "1"}})
+	case "crop":
+		// Cloudinary uses the top-left corner as the origin of the offsets
+		if len(gravity) == 0 && (len(t.x) > 0 || len(t.y) > 0) {
+			gravity = "nowe"
+		}
+		if len(gravity) == 0 {
+			gravity = "ce"
+		}
+
+		args := []string{width, height, gravity}
+		if len(t.x) > 0 || len(t.y) > 0 {
+			if gravity == "sm" {
+				return nil, errors.New("Cloudinary crop offsets can't be used with automatic gravity")
+			}
+
+			x, y := t.x, t.y
+			if len(x) == 0 {
+				x = "0"
+			}
+			if len(y) == 0 {
+				y = "0"
+			}
+			args = append(args, x, y)
+		}
+
+		opts = append(opts, urlOption{Name: "crop", Args: args})
+		gravity = ""
+	default:
+		return nil, fmt.Errorf("Unsupported Cloudinary crop mode: %s", t.crop)
+	}
+
+	if len(t.width) == 0 && len(t.height) == 0 && t.crop != "crop" {
+		// No resizing is requested
+		opts = opts[:0]
+	}
+
+	if len(gravity) > 0 {
+		opts = append(opts, urlOption{Name: "gravity", Args: []string{gravity}})
+	}
+
+	return append(opts, t.opts...), nil
+}
+
+func parseCloudinaryTransformation(component string) (urlOptions, error) {
+	var t cloudinaryTransformation
+
+	for _, param := range strings.Split(component, ",") {
+		m := cloudinaryParamRe.FindStringSubmatch(param)
+
+		if err := parseCloudinaryParam(&t, m[1], m[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.toURLOptions()
+}
+
+// parseCloudinaryOptions translates the Cloudinary path into the processing options:
+// /%transformation/%transformation/v%version/%public_id
+// Chained transformations are merged into a single set of the processing options
+func parseCloudinaryOptions(parts []string) (urlOptions, string, error) {
+	var opts urlOptions
+
+	i := 0
+
+	for ; i < len(parts) && isCloudinaryTransformation(parts[i]); i++ {
+		tOpts, err := parseCloudinaryTransformation(parts[i])
+		if err != nil {
+			return nil, "", err
+		}
+
+		opts = append(opts, tOpts...)
+	}
+
+	if i < len(parts) && cloudinaryVersionRe.MatchString(parts[i]) {
+		i++
+	}
+
+	if i >= len(parts) || len(parts[i]) == 0 {
+		return nil, "", errors.New("Image URL is empty")
+	}
+
+	imageURL, err := url.PathUnescape(strings.Join(parts[i:], "/"))
+	if err != nil {
+		return nil, "", fmt.Errorf("Invalid url encoding: %s", strings.Join(parts[i:], "/"))
+	}
+
+	return opts, addBaseURL(imageURL), nil
+}
+
+// ParseCloudinaryPath parses the Cloudinary-compatible path without the signature
+// and translates it into the processing options
+func ParseCloudinaryPath(path string, headers http.Header) (*ProcessingOptions, string, error) {
+	return parseTranslatedPath(path, headers, parseCloudinaryOptions)
+}
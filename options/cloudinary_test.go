@@ -0,0 +1,91 @@
+package options
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type CloudinaryTestSuite struct{ suite.Suite }
+
+func (s *CloudinaryTestSuite) SetupTest() {
+	config.Reset()
+	// Reset presets
+	presets = make(map[string]urlOptions)
+	hostOptions = nil
+}
+
+func (s *CloudinaryTestSuite) TestParseCloudinaryOptions() {
+	opts, imageURL, err := parseCloudinaryOptions([]string{
+		"c_fill,w_300,h_200,g_face,q_auto", "e_blur:300,f_webp", "v1234", "lorem", "ipsum.jpg",
+	})
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), "lorem/ipsum.jpg", imageURL)
+	assert.Equal(s.T(), urlOptions{
+		urlOption{Name: "resize", Args: []string{"fill", "300", "200", "1"}},
+		urlOption{Name: "gravity", Args: []string{"face"}},
+		urlOption{Name: "blur", Args: []string{"3"}},
+		urlOption{Name: "format", Args: []string{"webp"}},
+	}, opts)
+}
+
+func (s *CloudinaryTestSuite) TestParseCloudinaryOptionsCrop() {
+	opts, _, err := parseCloudinaryOptions([]string{"c_crop,w_100,h_50,x_10,y_20", "ipsum.jpg"})
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), urlOptions{
+		urlOption{Name: "crop", Args: []string{"100", "50", "nowe", "10", "20"}},
+	}, opts)
+}
+
+func (s *CloudinaryTestSuite) TestParseCloudinaryPath() {
+	config.BaseURL = "http://images.dev/"
+
+	po, imageURL, err := ParseCloudinaryPath("/c_limit,w_300,b_rgb:ff0000/lorem/ipsum.jpg", make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), "http://images.dev/lorem/ipsum.jpg", imageURL)
+	assert.Equal(s.T(), ResizeFit, po.ResizingType)
+	assert.Equal(s.T(), 300, po.Width)
+	assert.False(s.T(), po.Enlarge)
+	assert.True(s.T(), po.Flatten)
+	assert.Equal(s.T(), uint8(255), po.Background.R)
+	assert.Equal(s.T(), imagetype.Unknown, po.Format)
+	assert.Equal(s.T(), []string{"resize", "background"}, po.UsedURLOptions())
+}
+
+func (s *CloudinaryTestSuite) TestParseCloudinaryPathFetch() {
+	_, imageURL, err := ParseCloudinaryPath("/w_300/http:%2F%2Fimages.dev%2Florem%2Fipsum.jpg", make(http.Header))
+
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "http://images.dev/lorem/ipsum.jpg", imageURL)
+}
+
+func (s *CloudinaryTestSuite) TestParseCloudinaryPathUnsupported() {
+	paths := []string{
+		"/c_imagga_crop,w_300/ipsum.jpg",
+		"/w_0.5/ipsum.jpg",
+		"/e_grayscale/ipsum.jpg",
+		"/g_ocr_text,c_fill,w_100,h_100/ipsum.jpg",
+		"/b_white/ipsum.jpg",
+		"/w_300/",
+	}
+
+	for _, path := range paths {
+		_, _, err := ParseCloudinaryPath(path, make(http.Header))
+		assert.Error(s.T(), err, path)
+	}
+}
+
+func TestCloudinary(t *testing.T) {
+	suite.Run(t, new(CloudinaryTestSuite))
+}
@@ -0,0 +1,119 @@
+package options
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter is a color transformation defined by a 3x3 matrix applied
+// to RGB values and the offsets added after the matrix is applied
+type Filter struct {
+	Matrix [9]float64
+	Offset [3]float64
+}
+
+// bwHighContrast converts the image to grayscale and boosts contrast by 1.5x
+// around the middle gray
+var bwHighContrast = Filter{
+	Matrix: [9]float64{
+		0.319, 1.073, 0.108,
+		0.319, 1.073, 0.108,
+		0.319, 1.073, 0.108,
+	},
+	Offset: [3]float64{-64, -64, -64},
+}
+
+var builtinFilters = map[string]Filter{
+	"sepia": {
+		Matrix: [9]float64{
+			0.393, 0.769, 0.189,
+			0.349, 0.686, 0.168,
+			0.272, 0.534, 0.131,
+		},
+	},
+	"warm": {
+		Matrix: [9]float64{
+			1.1, 0, 0,
+			0, 1.0, 0,
+			0, 0, 0.85,
+		},
+		Offset: [3]float64{5, 0, 0},
+	},
+	"cool": {
+		Matrix: [9]float64{
+			0.9, 0, 0,
+			0, 1.0, 0,
+			0, 0, 1.1,
+		},
+		Offset: [3]float64{0, 0, 5},
+	},
+	"bw-high-contrast": bwHighContrast,
+}
+
+var filters = builtinFilters
+
+// LookupFilter returns the filter with the provided name
+func LookupFilter(name string) (Filter, bool) {
+	f, ok := filters[name]
+	return f, ok
+}
+
+// ParseFilters parses the custom filters and adds them to the built-in ones.
+// Custom filters can override the built-in ones
+func ParseFilters(filterStrs []string) error {
+	newFilters := make(map[string]Filter, len(builtinFilters)+len(filterStrs))
+
+	for name, f := range builtinFilters {
+		newFilters[name] = f
+	}
+
+	for _, filterStr := range filterStrs {
+		name, f, err := parseFilter(filterStr)
+		if err != nil {
+			return err
+		}
+
+		newFilters[name] = f
+	}
+
+	filters = newFilters
+
+	return nil
+}
+
+// parseFilter parses the filter string in the name=matrix[ offsets] format,
+// where matrix is 9 space-separated numbers and offsets are 3 space-separated numbers
+func parseFilter(filterStr string) (string, Filter, error) {
+	var f Filter
+
+	parts := strings.Split(filterStr, "=")
+	if len(parts) != 2 {
+		return "", f, fmt.Errorf("Invalid filter string: %s", filterStr)
+	}
+
+	name := strings.TrimSpace(parts[0])
+	if len(name) == 0 {
+		return "", f, fmt.Errorf("Empty filter name: %s", filterStr)
+	}
+
+	values := strings.Fields(parts[1])
+	if len(values) != 9 && len(values) != 12 {
+		return "", f, fmt.Errorf("Filter should have 9 or 12 values: %s", filterStr)
+	}
+
+	for i, v := range values {
+		num, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "", f, fmt.Errorf("Invalid filter value %s: %s", v, filterStr)
+		}
+
+		if i < 9 {
+			f.Matrix[i] = num
+		} else {
+			f.Offset[i-9] = num
+		}
+	}
+
+	return name, f, nil
+}
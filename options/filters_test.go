@@ -0,0 +1,45 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type FiltersTestSuite struct{ suite.Suite }
+
+func (s *FiltersTestSuite) TearDownTest() {
+	filters = builtinFilters
+}
+
+func (s *FiltersTestSuite) TestParseFilters() {
+	err := ParseFilters([]string{
+		"vintage=0.9 0.1 0 0.05 0.85 0.1 0 0.1 0.8 10 5 -5",
+		"sepia=1 0 0 0 1 0 0 0 1",
+	})
+	s.Require().Nil(err)
+
+	f, ok := LookupFilter("vintage")
+	s.Require().True(ok)
+	s.Require().Equal([9]float64{0.9, 0.1, 0, 0.05, 0.85, 0.1, 0, 0.1, 0.8}, f.Matrix)
+	s.Require().Equal([3]float64{10, 5, -5}, f.Offset)
+
+	// Built-in filters can be overridden
+	f, ok = LookupFilter("sepia")
+	s.Require().True(ok)
+	s.Require().Equal([9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}, f.Matrix)
+
+	_, ok = LookupFilter("cool")
+	s.Require().True(ok)
+}
+
+func (s *FiltersTestSuite) TestParseInvalidFilters() {
+	s.Require().NotNil(ParseFilters([]string{"vintage"}))
+	s.Require().NotNil(ParseFilters([]string{"=1 0 0 0 1 0 0 0 1"}))
+	s.Require().NotNil(ParseFilters([]string{"vintage=1 0 0 0 1 0 0 0"}))
+	s.Require().NotNil(ParseFilters([]string{"vintage=1 0 0 0 1 0 0 0 x"}))
+}
+
+func TestFilters(t *testing.T) {
+	suite.Run(t, new(FiltersTestSuite))
+}
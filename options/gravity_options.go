@@ -19,6 +19,8 @@ const (
 	GravitySouthEast
 	GravitySmart
 	GravityFocusPoint
+	GravityFace
+	GravityObject
 )
 
 var gravityTypes = map[string]GravityType{
@@ -33,6 +35,8 @@ var gravityTypes = map[string]GravityType{
 	"soea": GravitySouthEast,
 	"sm":   GravitySmart,
 	"fp":   GravityFocusPoint,
+	"face": GravityFace,
+	"obj":  GravityObject,
 }
 
 var gravityTypesRotationMap = map[int]map[GravityType]GravityType{
@@ -98,6 +102,9 @@ func (gt GravityType) MarshalJSON() ([]byte, error) {
 type GravityOptions struct {
 	Type GravityType
 	X, Y float64
+
+	// Classes of the objects for the object gravity
+	Classes []string
 }
 
 func (g *GravityOptions) RotateAndFlip(angle int, flip bool) {
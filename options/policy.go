@@ -0,0 +1,217 @@
+package options
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// urlOptionAliases maps the short names of the processing options to the full ones.
+// Both applyURLOption and the option policies resolve the aliases with it
+var urlOptionAliases = map[string]string{
+	"rs":  "resize",
+	"s":   "size",
+	"rt":  "resizing_type",
+	"w":   "width",
+	"h":   "height",
+	"mw":  "min-width",
+	"mh":  "min-height",
+	"z":   "zoom",
+	"el":  "enlarge",
+	"up":  "upscale",
+	"ex":  "extend",
+	"g":   "gravity",
+	"c":   "crop",
+	"t":   "trim",
+	"pd":  "padding",
+	"ar":  "auto_rotate",
+	"rot": "rotate",
+	"bg":  "background",
+	"bl":  "blur",
+	"sh":  "sharpen",
+	"pix": "pixelate",
+	"wm":  "watermark",
+	"ov":  "overlay",
+	"sm":  "strip_metadata",
+	"scp": "strip_color_profile",
+	"as":  "animation_speed",
+	"fs":  "frame_step",
+	"ss":  "sprite_sheet",
+	"q":   "quality",
+	"fq":  "format_quality",
+	"adq": "adaptive_quality",
+	"mb":  "max_bytes",
+	"f":   "format",
+	"ext": "format",
+	"skp": "skip_processing",
+	"cb":  "cachebuster",
+	"exp": "expires",
+	"fn":  "filename",
+	"att": "return_attachment",
+	"cc":  "cache_control",
+	"pr":  "preset",
+
+	"vseg": "video_segment",
+	"wmff": "watermark_first_frame",
+	"sgps": "strip_gps",
+
+	"msr":  "max_src_resolution",
+	"msfs": "max_src_file_size",
+	"maf":  "max_animation_frames",
+	"mar":  "max_animation_resolution",
+	"mrd":  "max_result_dimension",
+	"mard": "max_animation_result_dimension",
+	"rh":   "response_header",
+	"attr": "attribution",
+}
+
+// presetOnlyOptions are the options that override the config values.
+// They can be used only in presets since presets are defined by the admin
+var presetOnlyOptions = []string{
+	"max_src_resolution",
+	"max_src_file_size",
+	"max_animation_frames",
+	"max_animation_resolution",
+	"max_result_dimension",
+	"max_animation_result_dimension",
+	"response_header",
+	"attribution",
+	"cache_control",
+}
+
+func isDisabledURLOptionAlias(name string) bool {
+	for _, n := range config.DisabledURLOptionAliases {
+		if n == name {
+			_, ok := urlOptionAliases[name]
+			return ok
+		}
+	}
+	return false
+}
+
+func fullURLOptionName(name string) string {
+	if isDisabledURLOptionAlias(name) {
+		return name
+	}
+	if full, ok := urlOptionAliases[name]; ok {
+		return full
+	}
+	return name
+}
+
+func urlOptionInList(name string, list []string) bool {
+	for _, n := range list {
+		if fullURLOptionName(n) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isAllowedURLResponseHeader checks if the response header can be set in the URL.
+// Since the URL defines the response headers, it should be signed
+func isAllowedURLResponseHeader(args []string) bool {
+	if len(config.Keys) == 0 || len(args) == 0 {
+		return false
+	}
+
+	name := http.CanonicalHeaderKey(args[0])
+
+	for _, h := range config.AllowedURLResponseHeaders {
+		if http.CanonicalHeaderKey(h) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// signedOnlyOptions are the options that are too resource-intensive
+// to be used in unsigned URLs
+var signedOnlyOptions = []string{
+	"upscale",
+}
+
+// checkURLOptionsPolicy checks if the processing options provided in the URL
+// are allowed. Presets are not checked as they are defined by the admin
+func checkURLOptionsPolicy(options urlOptions) error {
+	for _, opt := range options {
+		if fullURLOptionName(opt.Name) == "response_header" && isAllowedURLResponseHeader(opt.Args) {
+			continue
+		}
+
+		if urlOptionInList(opt.Name, presetOnlyOptions) {
+			return fmt.Errorf("Processing option can be used only in presets: %s", opt.Name)
+		}
+
+		if len(config.Keys) == 0 && urlOptionInList(fullURLOptionName(opt.Name), signedOnlyOptions) {
+			return fmt.Errorf("Processing option can be used only in signed URLs: %s", opt.Name)
+		}
+	}
+
+	if len(config.AllowedProcessingOptions) == 0 && len(config.ForbiddenProcessingOptions) == 0 {
+		return nil
+	}
+
+	for _, opt := range options {
+		name := fullURLOptionName(opt.Name)
+
+		if len(config.AllowedProcessingOptions) > 0 && !urlOptionInList(name, config.AllowedProcessingOptions) {
+			return fmt.Errorf("Processing option is not allowed: %s", opt.Name)
+		}
+
+		if urlOptionInList(name, config.ForbiddenProcessingOptions) {
+			return fmt.Errorf("Processing option is not allowed: %s", opt.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkOnlyPresetsExtraOptions checks if the processing options provided
+// in the URL along with presets in presets-only mode are allowed
+func checkOnlyPresetsExtraOptions(options urlOptions) error {
+	for _, opt := range options {
+		if !urlOptionInList(fullURLOptionName(opt.Name), config.OnlyPresetsExtraOptions) {
+			return fmt.Errorf("Processing option is not allowed in presets-only mode: %s", opt.Name)
+		}
+	}
+
+	return checkURLOptionsPolicy(options)
+}
+
+// UsedURLOptions returns the full names of the processing options used in the URL
+func (po *ProcessingOptions) UsedURLOptions() []string {
+	return po.usedURLOptions
+}
+
+// CheckAllowedURLOptions checks that only the allowed processing options
+// were used in the URL
+func (po *ProcessingOptions) CheckAllowedURLOptions(allowed []string) error {
+	for _, name := range po.usedURLOptions {
+		if !urlOptionInList(name, allowed) {
+			return fmt.Errorf("Processing option is not allowed: %s", name)
+		}
+	}
+
+	return nil
+}
+
+func checkResultDimensions(po *ProcessingOptions) error {
+	maxDim := po.SecurityOptions.MaxResultDimension
+
+	if maxDim <= 0 {
+		return nil
+	}
+
+	if float64(po.Width)*po.Dpr > float64(maxDim) ||
+		float64(po.Height)*po.Dpr > float64(maxDim) {
+		return fmt.Errorf(
+			"Resulting image dimensions are too big: %dx%d@%g, max %d",
+			po.Width, po.Height, po.Dpr, maxDim,
+		)
+	}
+
+	return nil
+}
@@ -2,15 +2,51 @@ package options
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+var (
+	presets         map[string]urlOptions
+	rejectedPresets []RejectedPreset
+
+	// presetsMu guards presets and rejectedPresets during the reload
+	presetsMu sync.RWMutex
 )
 
-var presets map[string]urlOptions
+// PresetInfo describes the loaded preset
+type PresetInfo struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Options are the processing options that differ from the defaults
+	// when only this preset is applied
+	Options *ProcessingOptions `json:"options"`
+}
+
+// RejectedPreset describes the preset that was skipped because of an error
+type RejectedPreset struct {
+	Preset string `json:"preset"`
+	Reason string `json:"reason"`
+}
+
+func rejectPreset(presetStr string, err error) {
+	log.Warningf("Preset is skipped: %s", err)
+	rejectedPresets = append(rejectedPresets, RejectedPreset{Preset: presetStr, Reason: err.Error()})
+}
 
 func ParsePresets(presetStrs []string) error {
 	for _, presetStr := range presetStrs {
 		if err := parsePreset(presetStr); err != nil {
-			return err
+			if !config.SkipInvalidPresets {
+				return err
+			}
+
+			rejectPreset(presetStr, err)
 		}
 	}
 
@@ -56,14 +92,133 @@ func parsePreset(presetStr string) error {
 	return nil
 }
 
+// IsPresetsOnlyPath checks if the path contains no processing options
+// except presets
+func IsPresetsOnlyPath(path string) bool {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	if config.OnlyPresets {
+		// The first part contains presets, the rest may contain the extra options
+		options, _ := parseURLOptions(parts[1:])
+		return len(options) == 0
+	}
+
+	options, _ := parseURLOptions(parts)
+
+	for _, opt := range options {
+		if fullURLOptionName(opt.Name) != "preset" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ReloadPresets parses and validates the presets and replaces the loaded ones
+// with them. If the new presets are invalid or don't contain the presets
+// used by the path prefixes, the loaded ones are kept
+func ReloadPresets(presetStrs []string) error {
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+
+	oldPresets, oldRejected := presets, rejectedPresets
+
+	presets = make(map[string]urlOptions)
+	rejectedPresets = nil
+
+	err := ParsePresets(presetStrs)
+	if err == nil {
+		err = ValidatePresets()
+	}
+
+	if err == nil {
+		for prefix, names := range config.PathPrefixPresets {
+			if err = checkPresetsExist(names); err != nil {
+				err = fmt.Errorf("Invalid presets for path prefix %s: %s", prefix, err)
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		presets, rejectedPresets = oldPresets, oldRejected
+	}
+
+	return err
+}
+
 func ValidatePresets() error {
 	var po ProcessingOptions
 
 	for name, opts := range presets {
 		if err := applyURLOptions(&po, opts); err != nil {
-			return fmt.Errorf("Error in preset `%s`: %s", name, err)
+			err = fmt.Errorf("Error in preset `%s`: %s", name, err)
+
+			if !config.SkipInvalidPresets {
+				return err
+			}
+
+			rejectPreset(name+"="+opts.String(), err)
+			delete(presets, name)
+		}
+	}
+
+	return nil
+}
+
+// CheckPresetsExist checks that all the presets with the provided names are loaded
+func CheckPresetsExist(names []string) error {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+
+	return checkPresetsExist(names)
+}
+
+func checkPresetsExist(names []string) error {
+	for _, name := range names {
+		if _, ok := presets[name]; !ok {
+			return fmt.Errorf("Unknown preset: %s", name)
 		}
 	}
 
 	return nil
 }
+
+// LoadedPresets returns the loaded presets sorted by name
+func LoadedPresets() []PresetInfo {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	infos := make([]PresetInfo, 0, len(names))
+
+	for _, name := range names {
+		po := NewProcessingOptions()
+
+		// The presets are already validated, so the error is not expected here
+		if err := applyPresetOption(po, []string{name}); err != nil {
+			log.Warningf("Can't apply preset `%s`: %s", name, err)
+		}
+
+		infos = append(infos, PresetInfo{
+			Name:    name,
+			Value:   presets[name].String(),
+			Options: po,
+		})
+	}
+
+	return infos
+}
+
+// RejectedPresets returns the presets that were skipped because of errors
+func RejectedPresets() []RejectedPreset {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+
+	return rejectedPresets
+}
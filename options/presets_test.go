@@ -16,6 +16,7 @@ func (s *PresetsTestSuite) SetupTest() {
 	config.Reset()
 	// Reset presets
 	presets = make(map[string]urlOptions)
+	rejectedPresets = nil
 }
 
 func (s *PresetsTestSuite) TestParsePreset() {
@@ -101,6 +102,96 @@ func (s *PresetsTestSuite) TestValidatePresetsInvalid() {
 	assert.Error(s.T(), err)
 }
 
+func (s *PresetsTestSuite) TestParsePresetsSkipInvalid() {
+	config.SkipInvalidPresets = true
+
+	err := ParsePresets([]string{"test=resize:fit:100:200", "invalid=resize:fit:100:200/blur"})
+
+	require.Nil(s.T(), err)
+
+	assert.Contains(s.T(), presets, "test")
+	assert.NotContains(s.T(), presets, "invalid")
+	assert.Equal(s.T(), []RejectedPreset{
+		{
+			Preset: "invalid=resize:fit:100:200/blur",
+			Reason: "Invalid preset value: invalid=resize:fit:100:200/blur",
+		},
+	}, RejectedPresets())
+}
+
+func (s *PresetsTestSuite) TestValidatePresetsSkipInvalid() {
+	config.SkipInvalidPresets = true
+
+	presets = map[string]urlOptions{
+		"test": urlOptions{
+			urlOption{Name: "resize", Args: []string{"fit", "100", "200"}},
+		},
+		"invalid": urlOptions{
+			urlOption{Name: "resize", Args: []string{"fit", "-1", "-2"}},
+		},
+	}
+
+	err := ValidatePresets()
+
+	require.Nil(s.T(), err)
+
+	assert.Contains(s.T(), presets, "test")
+	assert.NotContains(s.T(), presets, "invalid")
+
+	rejected := RejectedPresets()
+	require.Len(s.T(), rejected, 1)
+	assert.Equal(s.T(), "invalid=resize:fit:-1:-2", rejected[0].Preset)
+}
+
+func (s *PresetsTestSuite) TestLoadedPresets() {
+	require.Nil(s.T(), ParsePresets([]string{"test=resize:fit:100:200/sharpen:2", "another=q:50"}))
+
+	loaded := LoadedPresets()
+	require.Len(s.T(), loaded, 2)
+
+	assert.Equal(s.T(), "another", loaded[0].Name)
+	assert.Equal(s.T(), "q:50", loaded[0].Value)
+	assert.Equal(s.T(), 50, loaded[0].Options.Quality)
+
+	assert.Equal(s.T(), "test", loaded[1].Name)
+	assert.Equal(s.T(), "resize:fit:100:200/sharpen:2", loaded[1].Value)
+	assert.Equal(s.T(), ResizeFit, loaded[1].Options.ResizingType)
+	assert.Equal(s.T(), 100, loaded[1].Options.Width)
+	assert.Equal(s.T(), 200, loaded[1].Options.Height)
+	assert.Equal(s.T(), []string{"test"}, loaded[1].Options.UsedPresets)
+}
+
+func (s *PresetsTestSuite) TestReloadPresets() {
+	require.Nil(s.T(), ParsePresets([]string{"test=resize:fit:100:200"}))
+
+	require.Nil(s.T(), ReloadPresets([]string{"another=q:50"}))
+
+	assert.NotContains(s.T(), presets, "test")
+	assert.Contains(s.T(), presets, "another")
+}
+
+func (s *PresetsTestSuite) TestReloadPresetsInvalid() {
+	require.Nil(s.T(), ParsePresets([]string{"test=resize:fit:100:200"}))
+
+	assert.Error(s.T(), ReloadPresets([]string{"another=q:50", "invalid=resize:fit:-1:-2"}))
+
+	assert.Contains(s.T(), presets, "test")
+	assert.NotContains(s.T(), presets, "another")
+}
+
+func (s *PresetsTestSuite) TestReloadPresetsMissingPathPrefixPreset() {
+	require.Nil(s.T(), ParsePresets([]string{"test=resize:fit:100:200"}))
+
+	config.PathPrefixPresets = map[string][]string{"/avatars": {"test"}}
+
+	assert.Error(s.T(), ReloadPresets([]string{"another=q:50"}))
+
+	assert.Contains(s.T(), presets, "test")
+	assert.NotContains(s.T(), presets, "another")
+
+	require.Nil(s.T(), ReloadPresets([]string{"test=q:50"}))
+}
+
 func TestPresets(t *testing.T) {
 	suite.Run(t, new(PresetsTestSuite))
 }
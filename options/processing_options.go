@@ -1,8 +1,10 @@
 package options
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,9 +14,12 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/detection"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
 	"github.com/imgproxy/imgproxy/v3/imath"
+	"github.com/imgproxy/imgproxy/v3/lut"
+	"github.com/imgproxy/imgproxy/v3/security"
 	"github.com/imgproxy/imgproxy/v3/structdiff"
 	"github.com/imgproxy/imgproxy/v3/vips"
 )
@@ -51,12 +56,62 @@ type TrimOptions struct {
 	EqualVer  bool
 }
 
+type SpriteSheetOptions struct {
+	Columns   int
+	MaxFrames int
+}
+
+type VideoSegmentOptions struct {
+	Start    float64
+	Duration float64
+}
+
+type AttributionOptions struct {
+	Copyright string
+	Creator   string
+}
+
+type StillFrameOptions struct {
+	Position StillFramePosition
+	Index    int
+}
+
+type NegateOptions struct {
+	Enabled bool
+	Alpha   bool
+}
+
+type SkewOptions struct {
+	X float64
+	Y float64
+}
+
+type CLAHEOptions struct {
+	Enabled  bool
+	Size     int
+	MaxSlope int
+}
+
 type WatermarkOptions struct {
-	Enabled   bool
-	Opacity   float64
-	Replicate bool
+	Enabled        bool
+	Opacity        float64
+	Replicate      bool
+	Gravity        GravityOptions
+	Scale          float64
+	FirstFrameOnly bool
+}
+
+type OverlayOptions struct {
+	URL       string
 	Gravity   GravityOptions
 	Scale     float64
+	BlendMode vips.BlendMode
+}
+
+type CacheControlOptions struct {
+	TTL       int
+	Private   bool
+	Immutable bool
 }
 
 type ProcessingOptions struct {
@@ -70,40 +125,73 @@ type ProcessingOptions struct {
 	Dpr               float64
 	Gravity           GravityOptions
 	Enlarge           bool
+	Upscale           int
 	Extend            ExtendOptions
 	Crop              CropOptions
 	Padding           PaddingOptions
 	Trim              TrimOptions
 	Rotate            int
+	RotateFine        float64
+	Skew              SkewOptions
 	Format            imagetype.Type
 	Quality           int
 	FormatQuality     map[imagetype.Type]int
+	AdaptiveQuality   int
 	MaxBytes          int
 	Flatten           bool
 	Background        vips.Color
 	Blur              float32
 	Sharpen           float32
 	Pixelate          int
+	Enhance           bool
+	Equalize          bool
+	CLAHE             CLAHEOptions
+	WhiteBalance      WhiteBalanceMode
+	Filter            string
+	LUT               string
+	Negate            NegateOptions
 	StripMetadata     bool
+	StripGPS          bool
 	StripColorProfile bool
 	AutoRotate        bool
+	AnimationSpeed    float64
+	FrameStep         int
+	StillFrame        StillFrameOptions
+	SpriteSheet       SpriteSheetOptions
+	VideoSegment      VideoSegmentOptions
 
 	SkipProcessingFormats []imagetype.Type
 
 	CacheBuster string
 
 	Watermark WatermarkOptions
+	Overlays  []OverlayOptions
+	MaskURL   string
 
 	PreferWebP  bool
 	EnforceWebP bool
 	PreferAvif  bool
 	EnforceAvif bool
 
-	Filename string
+	Filename         string
+	ReturnAttachment bool
+
+	CacheControl CacheControlOptions
+
+	Raw bool
+
+	// SecurityOptions and Attribution can be set only in presets. ResponseHeaders
+	// can be set only in presets or, for the allowed headers, in signed URLs
+	SecurityOptions security.Options
+	ResponseHeaders map[string]string
+	Attribution     AttributionOptions
 
 	UsedPresets []string
 
 	defaultQuality int
+
+	// Full names of the processing options used in the URL
+	usedURLOptions []string
 }
 
 var (
@@ -124,18 +212,23 @@ func NewProcessingOptions() *ProcessingOptions {
 			Extend:            ExtendOptions{Enabled: false, Gravity: GravityOptions{Type: GravityCenter}},
 			Padding:           PaddingOptions{Enabled: false},
 			Trim:              TrimOptions{Enabled: false, Threshold: 10, Smart: true},
+			CLAHE:             CLAHEOptions{Enabled: false, Size: 64, MaxSlope: 3},
 			Rotate:            0,
 			Quality:           0,
+			AdaptiveQuality:   config.AdaptiveQualityDelta,
 			MaxBytes:          0,
 			Format:            imagetype.Unknown,
 			Background:        vips.Color{R: 255, G: 255, B: 255},
 			Blur:              0,
 			Sharpen:           0,
 			Dpr:               1,
-			Watermark:         WatermarkOptions{Opacity: 1, Replicate: false, Gravity: GravityOptions{Type: GravityCenter}},
+			Watermark:         WatermarkOptions{Opacity: 1, Replicate: false, Gravity: GravityOptions{Type: GravityCenter}, FirstFrameOnly: config.WatermarkFirstFrameOnly},
 			StripMetadata:     config.StripMetadata,
+			StripGPS:          config.StripGPS,
 			StripColorProfile: config.StripColorProfile,
 			AutoRotate:        config.AutoRotate,
+			AnimationSpeed:    1,
+			FrameStep:         1,
 
 			// Basically, we need this to update ETag when `IMGPROXY_QUALITY` is changed
 			defaultQuality: config.Quality,
@@ -144,6 +237,11 @@ func NewProcessingOptions() *ProcessingOptions {
 
 	po := _newProcessingOptions
 	po.SkipProcessingFormats = append([]imagetype.Type(nil), config.SkipProcessingFormats...)
+	po.SecurityOptions = security.DefaultOptions()
+	po.Attribution = AttributionOptions{
+		Copyright: config.AttributionCopyright,
+		Creator:   config.AttributionCreator,
+	}
 	po.UsedPresets = make([]string, 0, len(config.Presets))
 
 	po.FormatQuality = make(map[imagetype.Type]int)
@@ -216,6 +314,26 @@ func isGravityOffcetValid(gravity GravityType, offset float64) bool {
 func parseGravity(g *GravityOptions, args []string) error {
 	nArgs := len(args)
 
+	if args[0] == "obj" {
+		g.Type = GravityObject
+		g.Classes = nil
+
+		for _, class := range args[1:] {
+			if len(class) > 0 {
+				if !detection.Enabled(class) {
+					return fmt.Errorf("Unknown object class: %s", class)
+				}
+				g.Classes = append(g.Classes, class)
+			}
+		}
+
+		if len(g.Classes) == 0 && !detection.Enabled("") {
+			return errors.New("Object gravity requires object detection cascades")
+		}
+
+		return nil
+	}
+
 	if nArgs > 3 {
 		return fmt.Errorf("Invalid gravity arguments: %v", args)
 	}
@@ -226,7 +344,11 @@ func parseGravity(g *GravityOptions, args []string) error {
 		return fmt.Errorf("Invalid gravity: %s", args[0])
 	}
 
-	if g.Type == GravitySmart && nArgs > 1 {
+	if g.Type == GravityFace && !detection.Enabled(detection.FaceClass) {
+		return errors.New("Face gravity requires a face detection cascade")
+	}
+
+	if (g.Type == GravitySmart || g.Type == GravityFace) && nArgs > 1 {
 		return fmt.Errorf("Invalid gravity arguments: %v", args)
 	} else if g.Type == GravityFocusPoint && nArgs != 3 {
 		return fmt.Errorf("Invalid gravity arguments: %v", args)
@@ -293,6 +415,29 @@ func applyEnlargeOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyUpscaleOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid upscale arguments: %v", args)
+	}
+
+	if !config.EnableUpscale {
+		return errors.New("Upscaling is disabled")
+	}
+
+	switch args[0] {
+	case "", "0", "1":
+		po.Upscale = 0
+	case "2":
+		po.Upscale = 2
+	case "4":
+		po.Upscale = 4
+	default:
+		return fmt.Errorf("Invalid upscale factor: %s", args[0])
+	}
+
+	return nil
+}
+
 func applyExtendOption(po *ProcessingOptions, args []string) error {
 	if len(args) > 4 {
 		return fmt.Errorf("Invalid extend arguments: %v", args)
@@ -305,8 +450,9 @@ func applyExtendOption(po *ProcessingOptions, args []string) error {
 			return err
 		}
 
-		if po.Extend.Gravity.Type == GravitySmart {
-			return errors.New("extend doesn't support smart gravity")
+		switch po.Extend.Gravity.Type {
+		case GravitySmart, GravityFace, GravityObject:
+			return errors.New("extend doesn't support smart, face, and object gravities")
 		}
 	}
 
@@ -531,12 +677,20 @@ func applyRotateOption(po *ProcessingOptions, args []string) error {
 		return fmt.Errorf("Invalid rotate arguments: %v", args)
 	}
 
-	if r, err := strconv.Atoi(args[0]); err == nil && r%90 == 0 {
-		po.Rotate = r
-	} else {
+	r, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || math.IsNaN(r) || math.IsInf(r, 0) {
 		return fmt.Errorf("Invalid rotation angle: %s", args[0])
 	}
 
+	// The multiple of 90 part of the angle is applied with the lossless rotation.
+	// The rest is applied with the arbitrary rotation
+	r = math.Mod(r, 360)
+	quarters := int(math.Round(r / 90))
+	po.RotateFine = r - float64(quarters*90)
+
+	// Normalize the lossless rotation to 0, 90, 180, or 270 degrees
+	po.Rotate = ((quarters % 4) + 4) % 4 * 90
+
 	return nil
 }
 
@@ -554,6 +708,20 @@ func applyQualityOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyAdaptiveQualityOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid adaptive quality arguments: %v", args)
+	}
+
+	if d, err := strconv.Atoi(args[0]); err == nil && d >= 0 && d <= 100 {
+		po.AdaptiveQuality = d
+	} else {
+		return fmt.Errorf("Invalid adaptive quality delta: %s", args[0])
+	}
+
+	return nil
+}
+
 func applyFormatQualityOption(po *ProcessingOptions, args []string) error {
 	argsLen := len(args)
 	if len(args)%2 != 0 {
@@ -590,6 +758,38 @@ func applyMaxBytesOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func parseSkewAngle(angle *float64, name, arg string) error {
+	if a, err := strconv.ParseFloat(arg, 64); err == nil && math.Abs(a) <= 60 {
+		*angle = a
+	} else {
+		return fmt.Errorf("Invalid skew %s: %s", name, arg)
+	}
+
+	return nil
+}
+
+func applySkewOption(po *ProcessingOptions, args []string) error {
+	nArgs := len(args)
+
+	if nArgs > 2 {
+		return fmt.Errorf("Invalid skew arguments: %v", args)
+	}
+
+	if len(args[0]) > 0 {
+		if err := parseSkewAngle(&po.Skew.X, "x", args[0]); err != nil {
+			return err
+		}
+	}
+
+	if nArgs > 1 && len(args[1]) > 0 {
+		if err := parseSkewAngle(&po.Skew.Y, "y", args[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func applyBackgroundOption(po *ProcessingOptions, args []string) error {
 	switch len(args) {
 	case 1:
@@ -672,6 +872,121 @@ func applyPixelateOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyEnhanceOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid enhance arguments: %v", args)
+	}
+
+	po.Enhance = parseBoolOption(args[0])
+
+	return nil
+}
+
+func applyEqualizeOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid equalize arguments: %v", args)
+	}
+
+	po.Equalize = parseBoolOption(args[0])
+
+	return nil
+}
+
+func applyCLAHEOption(po *ProcessingOptions, args []string) error {
+	nArgs := len(args)
+
+	if nArgs > 2 {
+		return fmt.Errorf("Invalid clahe arguments: %v", args)
+	}
+
+	if s, err := strconv.Atoi(args[0]); err == nil && s >= 0 {
+		po.CLAHE.Enabled = s > 0
+		if s > 0 {
+			po.CLAHE.Size = s
+		}
+	} else {
+		return fmt.Errorf("Invalid clahe size: %s", args[0])
+	}
+
+	if nArgs > 1 && len(args[1]) > 0 {
+		if ms, err := strconv.Atoi(args[1]); err == nil && ms >= 0 {
+			po.CLAHE.MaxSlope = ms
+		} else {
+			return fmt.Errorf("Invalid clahe max slope: %s", args[1])
+		}
+	}
+
+	return nil
+}
+
+func applyWhiteBalanceOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid white balance arguments: %v", args)
+	}
+
+	if wb, ok := whiteBalanceModes[args[0]]; ok {
+		po.WhiteBalance = wb
+	} else {
+		return fmt.Errorf("Invalid white balance mode: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyFilterOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid filter arguments: %v", args)
+	}
+
+	if len(args[0]) == 0 || args[0] == "none" {
+		po.Filter = ""
+		return nil
+	}
+
+	if _, ok := LookupFilter(args[0]); !ok {
+		return fmt.Errorf("Unknown filter: %s", args[0])
+	}
+
+	po.Filter = args[0]
+
+	return nil
+}
+
+func applyLUTOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid lut arguments: %v", args)
+	}
+
+	if len(args[0]) == 0 || args[0] == "none" {
+		po.LUT = ""
+		return nil
+	}
+
+	if _, ok := lut.Get(args[0]); !ok {
+		return fmt.Errorf("Unknown LUT: %s", args[0])
+	}
+
+	po.LUT = args[0]
+
+	return nil
+}
+
+func applyNegateOption(po *ProcessingOptions, args []string) error {
+	nArgs := len(args)
+
+	if nArgs > 2 {
+		return fmt.Errorf("Invalid negate arguments: %v", args)
+	}
+
+	po.Negate.Enabled = parseBoolOption(args[0])
+
+	if nArgs > 1 && len(args[1]) > 0 {
+		po.Negate.Alpha = parseBoolOption(args[1])
+	}
+
+	return nil
+}
+
 func applyPresetOption(po *ProcessingOptions, args []string) error {
 	for _, preset := range args {
 		if p, ok := presets[preset]; ok {
@@ -708,7 +1023,7 @@ func applyWatermarkOption(po *ProcessingOptions, args []string) error {
 	if len(args) > 1 && len(args[1]) > 0 {
 		if args[1] == "re" {
 			po.Watermark.Replicate = true
-		} else if g, ok := gravityTypes[args[1]]; ok && g != GravityFocusPoint && g != GravitySmart {
+		} else if g, ok := gravityTypes[args[1]]; ok && g != GravityFocusPoint && g != GravitySmart && g != GravityFace && g != GravityObject {
 			po.Watermark.Gravity.Type = g
 		} else {
 			return fmt.Errorf("Invalid watermark position: %s", args[1])
@@ -742,6 +1057,106 @@ func applyWatermarkOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyWatermarkFirstFrameOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid watermark first frame arguments: %v", args)
+	}
+
+	po.Watermark.FirstFrameOnly = parseBoolOption(args[0])
+
+	return nil
+}
+
+func applyOverlayOption(po *ProcessingOptions, args []string) error {
+	nArgs := len(args)
+
+	if nArgs > 6 {
+		return fmt.Errorf("Invalid overlay arguments: %v", args)
+	}
+
+	if len(po.Overlays) >= config.MaxOverlays {
+		return fmt.Errorf("Too many overlays, max %d", config.MaxOverlays)
+	}
+
+	ov := OverlayOptions{
+		Gravity:   GravityOptions{Type: GravityCenter},
+		BlendMode: vips.BlendOver,
+	}
+
+	if len(args[0]) == 0 {
+		return errors.New("Overlay URL is empty")
+	}
+
+	if u, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(args[0], "=")); err == nil {
+		ov.URL = addBaseURL(string(u))
+	} else {
+		return fmt.Errorf("Invalid overlay URL encoding: %s", args[0])
+	}
+
+	if nArgs > 1 && len(args[1]) > 0 {
+		if g, ok := gravityTypes[args[1]]; ok && g != GravityFocusPoint && g != GravitySmart && g != GravityFace && g != GravityObject {
+			ov.Gravity.Type = g
+		} else {
+			return fmt.Errorf("Invalid overlay position: %s", args[1])
+		}
+	}
+
+	if nArgs > 2 && len(args[2]) > 0 {
+		if x, err := strconv.Atoi(args[2]); err == nil {
+			ov.Gravity.X = float64(x)
+		} else {
+			return fmt.Errorf("Invalid overlay X offset: %s", args[2])
+		}
+	}
+
+	if nArgs > 3 && len(args[3]) > 0 {
+		if y, err := strconv.Atoi(args[3]); err == nil {
+			ov.Gravity.Y = float64(y)
+		} else {
+			return fmt.Errorf("Invalid overlay Y offset: %s", args[3])
+		}
+	}
+
+	if nArgs > 4 && len(args[4]) > 0 {
+		if s, err := strconv.ParseFloat(args[4], 64); err == nil && s >= 0 {
+			ov.Scale = s
+		} else {
+			return fmt.Errorf("Invalid overlay scale: %s", args[4])
+		}
+	}
+
+	if nArgs > 5 && len(args[5]) > 0 {
+		if bm, ok := vips.BlendModes[args[5]]; ok {
+			ov.BlendMode = bm
+		} else {
+			return fmt.Errorf("Invalid overlay blend mode: %s", args[5])
+		}
+	}
+
+	po.Overlays = append(po.Overlays, ov)
+
+	return nil
+}
+
+func applyMaskOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid mask arguments: %v", args)
+	}
+
+	if len(args[0]) == 0 {
+		po.MaskURL = ""
+		return nil
+	}
+
+	if u, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(args[0], "=")); err == nil {
+		po.MaskURL = addBaseURL(string(u))
+	} else {
+		return fmt.Errorf("Invalid mask URL encoding: %s", args[0])
+	}
+
+	return nil
+}
+
 func applyFormatOption(po *ProcessingOptions, args []string) error {
 	if len(args) > 1 {
 		return fmt.Errorf("Invalid format arguments: %v", args)
@@ -788,6 +1203,50 @@ func applyFilenameOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyReturnAttachmentOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid return attachment arguments: %v", args)
+	}
+
+	po.ReturnAttachment = parseBoolOption(args[0])
+
+	return nil
+}
+
+func applyCacheControlOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 3 {
+		return fmt.Errorf("Invalid cache control arguments: %v", args)
+	}
+
+	if len(args[0]) > 0 {
+		if ttl, err := strconv.Atoi(args[0]); err == nil && ttl >= 0 {
+			po.CacheControl.TTL = ttl
+		} else {
+			return fmt.Errorf("Invalid cache control TTL: %s", args[0])
+		}
+	}
+
+	if len(args) > 1 && len(args[1]) > 0 {
+		po.CacheControl.Private = parseBoolOption(args[1])
+	}
+
+	if len(args) > 2 && len(args[2]) > 0 {
+		po.CacheControl.Immutable = parseBoolOption(args[2])
+	}
+
+	return nil
+}
+
+func applyRawOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid raw arguments: %v", args)
+	}
+
+	po.Raw = parseBoolOption(args[0])
+
+	return nil
+}
+
 func applyExpiresOption(po *ProcessingOptions, args []string) error {
 	if len(args) > 1 {
 		return fmt.Errorf("Invalid expires arguments: %v", args)
@@ -815,6 +1274,16 @@ func applyStripMetadataOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyStripGPSOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid strip GPS arguments: %v", args)
+	}
+
+	po.StripGPS = parseBoolOption(args[0])
+
+	return nil
+}
+
 func applyStripColorProfileOption(po *ProcessingOptions, args []string) error {
 	if len(args) > 1 {
 		return fmt.Errorf("Invalid strip color profile arguments: %v", args)
@@ -825,6 +1294,98 @@ func applyStripColorProfileOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyAnimationSpeedOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid animation speed arguments: %v", args)
+	}
+
+	if s, err := strconv.ParseFloat(args[0], 64); err == nil && s > 0 {
+		po.AnimationSpeed = s
+	} else {
+		return fmt.Errorf("Invalid animation speed: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyFrameStepOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid frame step arguments: %v", args)
+	}
+
+	if s, err := strconv.Atoi(args[0]); err == nil && s > 0 {
+		po.FrameStep = s
+	} else {
+		return fmt.Errorf("Invalid frame step: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyStillFrameOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid frame arguments: %v", args)
+	}
+
+	if pos, ok := stillFramePositions[args[0]]; ok {
+		po.StillFrame = StillFrameOptions{Position: pos}
+	} else if i, err := strconv.Atoi(args[0]); err == nil && i >= 0 {
+		po.StillFrame = StillFrameOptions{Position: StillFrameIndex, Index: i}
+	} else {
+		return fmt.Errorf("Invalid frame: %s", args[0])
+	}
+
+	return nil
+}
+
+func applySpriteSheetOption(po *ProcessingOptions, args []string) error {
+	nArgs := len(args)
+
+	if nArgs > 2 {
+		return fmt.Errorf("Invalid sprite sheet arguments: %v", args)
+	}
+
+	if c, err := strconv.Atoi(args[0]); err == nil && c >= 0 {
+		po.SpriteSheet.Columns = c
+	} else {
+		return fmt.Errorf("Invalid sprite sheet columns: %s", args[0])
+	}
+
+	if nArgs > 1 && len(args[1]) > 0 {
+		if m, err := strconv.Atoi(args[1]); err == nil && m >= 0 {
+			po.SpriteSheet.MaxFrames = m
+		} else {
+			return fmt.Errorf("Invalid sprite sheet max frames: %s", args[1])
+		}
+	}
+
+	return nil
+}
+
+func applyVideoSegmentOption(po *ProcessingOptions, args []string) error {
+	nArgs := len(args)
+
+	if nArgs > 2 {
+		return fmt.Errorf("Invalid video segment arguments: %v", args)
+	}
+
+	if s, err := strconv.ParseFloat(args[0], 64); err == nil && s >= 0 {
+		po.VideoSegment.Start = s
+	} else {
+		return fmt.Errorf("Invalid video segment start: %s", args[0])
+	}
+
+	if nArgs > 1 && len(args[1]) > 0 {
+		if d, err := strconv.ParseFloat(args[1], 64); err == nil && d >= 0 {
+			po.VideoSegment.Duration = d
+		} else {
+			return fmt.Errorf("Invalid video segment duration: %s", args[1])
+		}
+	}
+
+	return nil
+}
+
 func applyAutoRotateOption(po *ProcessingOptions, args []string) error {
 	if len(args) > 1 {
 		return fmt.Errorf("Invalid auto rotate arguments: %v", args)
@@ -835,77 +1396,287 @@ func applyAutoRotateOption(po *ProcessingOptions, args []string) error {
 	return nil
 }
 
+func applyMaxSrcResolutionOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid max src resolution arguments: %v", args)
+	}
+
+	if x, err := strconv.ParseFloat(args[0], 64); err == nil && x > 0 {
+		po.SecurityOptions.MaxSrcResolution = int(x * 1000000)
+	} else {
+		return fmt.Errorf("Invalid max src resolution: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyMaxSrcFileSizeOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid max src file size arguments: %v", args)
+	}
+
+	if x, err := strconv.Atoi(args[0]); err == nil && x >= 0 {
+		po.SecurityOptions.MaxSrcFileSize = x
+	} else {
+		return fmt.Errorf("Invalid max src file size: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyMaxAnimationFramesOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid max animation frames arguments: %v", args)
+	}
+
+	if x, err := strconv.Atoi(args[0]); err == nil && x > 0 {
+		po.SecurityOptions.MaxAnimationFrames = x
+	} else {
+		return fmt.Errorf("Invalid max animation frames: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyMaxAnimationResolutionOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid max animation resolution arguments: %v", args)
+	}
+
+	if x, err := strconv.ParseFloat(args[0], 64); err == nil && x >= 0 {
+		po.SecurityOptions.MaxAnimationResolution = int(x * 1000000)
+	} else {
+		return fmt.Errorf("Invalid max animation resolution: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyMaxResultDimensionOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid max result dimension arguments: %v", args)
+	}
+
+	if x, err := strconv.Atoi(args[0]); err == nil && x >= 0 {
+		po.SecurityOptions.MaxResultDimension = x
+	} else {
+		return fmt.Errorf("Invalid max result dimension: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyMaxAnimationResultDimensionOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Invalid max animation result dimension arguments: %v", args)
+	}
+
+	if x, err := strconv.Atoi(args[0]); err == nil && x >= 0 {
+		po.SecurityOptions.MaxAnimationResultDimension = x
+	} else {
+		return fmt.Errorf("Invalid max animation result dimension: %s", args[0])
+	}
+
+	return nil
+}
+
+func applyResponseHeaderOption(po *ProcessingOptions, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("Invalid response header arguments: %v", args)
+	}
+
+	name := http.CanonicalHeaderKey(args[0])
+	if len(name) == 0 || strings.ContainsAny(name, " \t\r\n") {
+		return fmt.Errorf("Invalid response header name: %s", args[0])
+	}
+
+	// Header value may contain colons
+	value := strings.Join(args[1:], ":")
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("Invalid response header value: %s", value)
+	}
+
+	if po.ResponseHeaders == nil {
+		po.ResponseHeaders = make(map[string]string)
+	}
+	po.ResponseHeaders[name] = value
+
+	return nil
+}
+
+func decodeAttributionValue(arg, name string) (string, error) {
+	value, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(arg, "="))
+	if err != nil {
+		return "", fmt.Errorf("Invalid attribution %s encoding: %s", name, arg)
+	}
+
+	if strings.ContainsAny(string(value), "\x00\r\n") {
+		return "", fmt.Errorf("Invalid attribution %s: %q", name, value)
+	}
+
+	return string(value), nil
+}
+
+func applyAttributionOption(po *ProcessingOptions, args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("Invalid attribution arguments: %v", args)
+	}
+
+	copyright, err := decodeAttributionValue(args[0], "copyright")
+	if err != nil {
+		return err
+	}
+	po.Attribution.Copyright = copyright
+
+	if len(args) > 1 {
+		creator, err := decodeAttributionValue(args[1], "creator")
+		if err != nil {
+			return err
+		}
+		po.Attribution.Creator = creator
+	}
+
+	return nil
+}
+
 func applyURLOption(po *ProcessingOptions, name string, args []string) error {
-	switch name {
-	case "resize", "rs":
+	if isDisabledURLOptionAlias(name) {
+		return fmt.Errorf("Unknown processing option: %s", name)
+	}
+
+	// The aliases are resolved with urlOptionAliases,
+	// so only the full option names are listed here
+	switch fullURLOptionName(name) {
+	case "resize":
 		return applyResizeOption(po, args)
-	case "size", "s":
+	case "size":
 		return applySizeOption(po, args)
-	case "resizing_type", "rt":
+	case "resizing_type":
 		return applyResizingTypeOption(po, args)
-	case "width", "w":
+	case "width":
 		return applyWidthOption(po, args)
-	case "height", "h":
+	case "height":
 		return applyHeightOption(po, args)
-	case "min-width", "mw":
+	case "min-width":
 		return applyMinWidthOption(po, args)
-	case "min-height", "mh":
+	case "min-height":
 		return applyMinHeightOption(po, args)
-	case "zoom", "z":
+	case "zoom":
 		return applyZoomOption(po, args)
 	case "dpr":
 		return applyDprOption(po, args)
-	case "enlarge", "el":
+	case "enlarge":
 		return applyEnlargeOption(po, args)
-	case "extend", "ex":
+	case "upscale":
+		return applyUpscaleOption(po, args)
+	case "extend":
 		return applyExtendOption(po, args)
-	case "gravity", "g":
+	case "gravity":
 		return applyGravityOption(po, args)
-	case "crop", "c":
+	case "crop":
 		return applyCropOption(po, args)
-	case "trim", "t":
+	case "trim":
 		return applyTrimOption(po, args)
-	case "padding", "pd":
+	case "padding":
 		return applyPaddingOption(po, args)
-	case "auto_rotate", "ar":
+	case "auto_rotate":
 		return applyAutoRotateOption(po, args)
-	case "rotate", "rot":
+	case "rotate":
 		return applyRotateOption(po, args)
-	case "background", "bg":
+	case "skew":
+		return applySkewOption(po, args)
+	case "background":
 		return applyBackgroundOption(po, args)
-	case "blur", "bl":
+	case "blur":
 		return applyBlurOption(po, args)
-	case "sharpen", "sh":
+	case "sharpen":
 		return applySharpenOption(po, args)
-	case "pixelate", "pix":
+	case "pixelate":
 		return applyPixelateOption(po, args)
-	case "watermark", "wm":
+	case "enhance":
+		return applyEnhanceOption(po, args)
+	case "equalize":
+		return applyEqualizeOption(po, args)
+	case "clahe":
+		return applyCLAHEOption(po, args)
+	case "awb":
+		return applyWhiteBalanceOption(po, args)
+	case "filter":
+		return applyFilterOption(po, args)
+	case "lut":
+		return applyLUTOption(po, args)
+	case "negate":
+		return applyNegateOption(po, args)
+	case "watermark":
 		return applyWatermarkOption(po, args)
-	case "strip_metadata", "sm":
+	case "watermark_first_frame":
+		return applyWatermarkFirstFrameOption(po, args)
+	case "overlay":
+		return applyOverlayOption(po, args)
+	case "mask":
+		return applyMaskOption(po, args)
+	case "strip_metadata":
 		return applyStripMetadataOption(po, args)
-	case "strip_color_profile", "scp":
+	case "strip_gps":
+		return applyStripGPSOption(po, args)
+	case "strip_color_profile":
 		return applyStripColorProfileOption(po, args)
+	case "animation_speed":
+		return applyAnimationSpeedOption(po, args)
+	case "frame_step":
+		return applyFrameStepOption(po, args)
+	case "frame":
+		return applyStillFrameOption(po, args)
+	case "sprite_sheet":
+		return applySpriteSheetOption(po, args)
+	case "video_segment":
+		return applyVideoSegmentOption(po, args)
 	// Saving options
-	case "quality", "q":
+	case "quality":
 		return applyQualityOption(po, args)
-	case "format_quality", "fq":
+	case "format_quality":
 		return applyFormatQualityOption(po, args)
-	case "max_bytes", "mb":
+	case "adaptive_quality":
+		return applyAdaptiveQualityOption(po, args)
+	case "max_bytes":
 		return applyMaxBytesOption(po, args)
-	case "format", "f", "ext":
+	case "format":
 		return applyFormatOption(po, args)
 	// Handling options
-	case "skip_processing", "skp":
+	case "skip_processing":
 		return applySkipProcessingFormatsOption(po, args)
-	case "cachebuster", "cb":
+	case "cachebuster":
 		return applyCacheBusterOption(po, args)
-	case "expires", "exp":
+	case "expires":
 		return applyExpiresOption(po, args)
-	case "filename", "fn":
+	case "filename":
 		return applyFilenameOption(po, args)
+	case "return_attachment":
+		return applyReturnAttachmentOption(po, args)
+	case "cache_control":
+		return applyCacheControlOption(po, args)
+	case "raw":
+		return applyRawOption(po, args)
 	// Presets
-	case "preset", "pr":
+	case "preset":
 		return applyPresetOption(po, args)
+	// Preset-only options
+	case "max_src_resolution":
+		return applyMaxSrcResolutionOption(po, args)
+	case "max_src_file_size":
+		return applyMaxSrcFileSizeOption(po, args)
+	case "max_animation_frames":
+		return applyMaxAnimationFramesOption(po, args)
+	case "max_animation_resolution":
+		return applyMaxAnimationResolutionOption(po, args)
+	case "max_result_dimension":
+		return applyMaxResultDimensionOption(po, args)
+	case "max_animation_result_dimension":
+		return applyMaxAnimationResultDimensionOption(po, args)
+	case "attribution":
+		return applyAttributionOption(po, args)
+	case "response_header":
+		return applyResponseHeaderOption(po, args)
 	}
 
 	return fmt.Errorf("Unknown processing option: %s", name)
@@ -921,7 +1692,7 @@ func applyURLOptions(po *ProcessingOptions, options urlOptions) error {
 	return nil
 }
 
-func defaultProcessingOptions(headers http.Header) (*ProcessingOptions, error) {
+func defaultProcessingOptions(headers http.Header, imageURL string, defaultPresets []string) (*ProcessingOptions, error) {
 	po := NewProcessingOptions()
 
 	headerAccept := headers.Get("Accept")
@@ -954,16 +1725,26 @@ func defaultProcessingOptions(headers http.Header) (*ProcessingOptions, error) {
 		}
 	}
 
-	if _, ok := presets["default"]; ok {
+	if len(defaultPresets) > 0 {
+		if err := applyPresetOption(po, defaultPresets); err != nil {
+			return po, err
+		}
+	} else if _, ok := presets["default"]; ok {
 		if err := applyPresetOption(po, []string{"default"}); err != nil {
 			return po, err
 		}
 	}
 
+	if opts := sourceHostURLOptions(imageURL); len(opts) > 0 {
+		if err := applyURLOptions(po, opts); err != nil {
+			return po, err
+		}
+	}
+
 	return po, nil
 }
 
-func parsePathOptions(parts []string, headers http.Header) (*ProcessingOptions, string, error) {
+func parsePathOptions(parts []string, headers http.Header, defaultPresets []string) (*ProcessingOptions, string, error) {
 	if _, ok := resizeTypes[parts[0]]; ok {
 		return nil, "", ierrors.New(
 			404,
@@ -972,20 +1753,29 @@ func parsePathOptions(parts []string, headers http.Header) (*ProcessingOptions,
 		)
 	}
 
-	po, err := defaultProcessingOptions(headers)
+	options, urlParts := parseURLOptions(parts)
+
+	url, extension, err := DecodeURL(urlParts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	po, err := defaultProcessingOptions(headers, url, defaultPresets)
 	if err != nil {
 		return nil, "", err
 	}
 
-	options, urlParts := parseURLOptions(parts)
+	if err = checkURLOptionsPolicy(options); err != nil {
+		return nil, "", err
+	}
 
 	if err = applyURLOptions(po, options); err != nil {
 		return nil, "", err
 	}
 
-	url, extension, err := DecodeURL(urlParts)
-	if err != nil {
-		return nil, "", err
+	po.usedURLOptions = make([]string, len(options))
+	for i, opt := range options {
+		po.usedURLOptions[i] = fullURLOptionName(opt.Name)
 	}
 
 	if len(extension) > 0 {
@@ -997,22 +1787,43 @@ func parsePathOptions(parts []string, headers http.Header) (*ProcessingOptions,
 	return po, url, nil
 }
 
-func parsePathPresets(parts []string, headers http.Header) (*ProcessingOptions, string, error) {
-	po, err := defaultProcessingOptions(headers)
+func parsePathPresets(parts []string, headers http.Header, defaultPresets []string) (*ProcessingOptions, string, error) {
+	presets := strings.Split(parts[0], ":")
+	urlParts := parts[1:]
+
+	var options urlOptions
+
+	if len(config.OnlyPresetsExtraOptions) > 0 {
+		options, urlParts = parseURLOptions(urlParts)
+	}
+
+	url, extension, err := DecodeURL(urlParts)
 	if err != nil {
 		return nil, "", err
 	}
 
-	presets := strings.Split(parts[0], ":")
-	urlParts := parts[1:]
+	po, err := defaultProcessingOptions(headers, url, defaultPresets)
+	if err != nil {
+		return nil, "", err
+	}
 
 	if err = applyPresetOption(po, presets); err != nil {
 		return nil, "", err
 	}
 
-	url, extension, err := DecodeURL(urlParts)
-	if err != nil {
-		return nil, "", err
+	if len(config.OnlyPresetsExtraOptions) > 0 {
+		if err = checkOnlyPresetsExtraOptions(options); err != nil {
+			return nil, "", err
+		}
+
+		if err = applyURLOptions(po, options); err != nil {
+			return nil, "", err
+		}
+
+		po.usedURLOptions = make([]string, len(options))
+		for i, opt := range options {
+			po.usedURLOptions[i] = fullURLOptionName(opt.Name)
+		}
 	}
 
 	if len(extension) > 0 {
@@ -1024,7 +1835,74 @@ func parsePathPresets(parts []string, headers http.Header) (*ProcessingOptions,
 	return po, url, nil
 }
 
+// parseTranslatedPath parses the path of a third-party URL format.
+// translate converts the path parts into the processing options and the source URL
+func parseTranslatedPath(path string, headers http.Header, translate func([]string) (urlOptions, string, error)) (*ProcessingOptions, string, error) {
+	if path == "" || path == "/" {
+		return nil, "", ierrors.New(404, fmt.Sprintf("Invalid path: %s", path), "Invalid URL")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	po, imageURL, err := func() (*ProcessingOptions, string, error) {
+		options, imageURL, err := translate(parts)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// Presets can be reloaded, so we need to lock them while parsing
+		presetsMu.RLock()
+		defer presetsMu.RUnlock()
+
+		po, err := defaultProcessingOptions(headers, imageURL, nil)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if err = checkURLOptionsPolicy(options); err != nil {
+			return nil, "", err
+		}
+
+		if err = applyURLOptions(po, options); err != nil {
+			return nil, "", err
+		}
+
+		po.usedURLOptions = make([]string, len(options))
+		for i, opt := range options {
+			po.usedURLOptions[i] = fullURLOptionName(opt.Name)
+		}
+
+		return po, imageURL, checkResultDimensions(po)
+	}()
+
+	if err != nil {
+		return nil, "", ierrors.New(404, err.Error(), "Invalid URL")
+	}
+
+	return po, imageURL, nil
+}
+
+// SourceSecurityOptions returns the security options of the default preset
+// and the source host options for the endpoints that don't accept processing options
+func SourceSecurityOptions(imageURL string) (security.Options, error) {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+
+	po, err := defaultProcessingOptions(make(http.Header), imageURL, nil)
+	if err != nil {
+		return security.Options{}, err
+	}
+
+	return po.SecurityOptions, nil
+}
+
 func ParsePath(path string, headers http.Header) (*ProcessingOptions, string, error) {
+	return ParsePathWithDefaultPresets(path, headers, nil)
+}
+
+// ParsePathWithDefaultPresets parses the path the same way ParsePath does
+// but applies the provided presets instead of the `default` one
+func ParsePathWithDefaultPresets(path string, headers http.Header, defaultPresets []string) (*ProcessingOptions, string, error) {
 	if path == "" || path == "/" {
 		return nil, "", ierrors.New(404, fmt.Sprintf("Invalid path: %s", path), "Invalid URL")
 	}
@@ -1037,10 +1915,19 @@ func ParsePath(path string, headers http.Header) (*ProcessingOptions, string, er
 		err      error
 	)
 
+	// Presets can be reloaded, so we need to lock them while parsing
+	presetsMu.RLock()
+
 	if config.OnlyPresets {
-		po, imageURL, err = parsePathPresets(parts, headers)
+		po, imageURL, err = parsePathPresets(parts, headers, defaultPresets)
 	} else {
-		po, imageURL, err = parsePathOptions(parts, headers)
+		po, imageURL, err = parsePathOptions(parts, headers, defaultPresets)
+	}
+
+	presetsMu.RUnlock()
+
+	if err == nil {
+		err = checkResultDimensions(po)
 	}
 
 	if err != nil {
@@ -3,8 +3,10 @@ package options
 import (
 	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,7 +14,10 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/detection"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/lut"
+	"github.com/imgproxy/imgproxy/v3/vips"
 )
 
 type ProcessingOptionsTestSuite struct{ suite.Suite }
@@ -21,6 +26,7 @@ func (s *ProcessingOptionsTestSuite) SetupTest() {
 	config.Reset()
 	// Reset presets
 	presets = make(map[string]urlOptions)
+	hostOptions = nil
 }
 
 func (s *ProcessingOptionsTestSuite) TestParseBase64URL() {
@@ -227,6 +233,86 @@ func (s *ProcessingOptionsTestSuite) TestParsePathGravityFocuspoint() {
 	assert.Equal(s.T(), 0.75, po.Gravity.Y)
 }
 
+// initDetection loads a single-node cascade for the face detection
+// and for each of the object classes
+func (s *ProcessingOptionsTestSuite) initDetection(face bool, classes ...string) {
+	cascade := make([]byte, 8, 32)
+	cascade = append(cascade, 1, 0, 0, 0, 1, 0, 0, 0)
+	cascade = append(cascade, 0, 0, 0, 100)
+	cascade = append(cascade, 0x00, 0x00, 0x80, 0x3f, 0x00, 0x00, 0x80, 0xbf, 0, 0, 0, 0)
+
+	cascadePath := filepath.Join(s.T().TempDir(), "cascade")
+	require.Nil(s.T(), ioutil.WriteFile(cascadePath, cascade, 0644))
+
+	if face {
+		config.FaceDetectionCascadePath = cascadePath
+	}
+
+	for _, class := range classes {
+		config.ObjectDetectionCascades[class] = cascadePath
+	}
+
+	require.Nil(s.T(), detection.Init())
+
+	s.T().Cleanup(func() {
+		config.Reset()
+		require.Nil(s.T(), detection.Init())
+	})
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathGravityFace() {
+	s.initDetection(true)
+
+	path := "/gravity:face/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), GravityFace, po.Gravity.Type)
+
+	_, _, err = ParsePath("/gravity:face:10:10/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathGravityFaceWithoutCascade() {
+	_, _, err := ParsePath("/gravity:face/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	_, _, err = ParsePath("/crop:100:100:face/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathGravityObject() {
+	s.initDetection(false, "car", "pet")
+
+	path := "/gravity:obj:car:pet/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), GravityObject, po.Gravity.Type)
+	assert.Equal(s.T(), []string{"car", "pet"}, po.Gravity.Classes)
+
+	path = "/gravity:obj/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err = ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), GravityObject, po.Gravity.Type)
+	assert.Empty(s.T(), po.Gravity.Classes)
+
+	_, _, err = ParsePath("/gravity:obj:car:dog/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathGravityObjectWithoutCascades() {
+	_, _, err := ParsePath("/gravity:obj/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	_, _, err = ParsePath("/gravity:obj:car/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
 func (s *ProcessingOptionsTestSuite) TestParsePathQuality() {
 	path := "/quality:55/plain/http://images.dev/lorem/ipsum.jpg"
 	po, _, err := ParsePath(path, make(http.Header))
@@ -236,6 +322,22 @@ func (s *ProcessingOptionsTestSuite) TestParsePathQuality() {
 	assert.Equal(s.T(), 55, po.Quality)
 }
 
+func (s *ProcessingOptionsTestSuite) TestParsePathAdaptiveQuality() {
+	path := "/adaptive_quality:15/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), 15, po.AdaptiveQuality)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathAdaptiveQualityInvalid() {
+	path := "/adq:101/plain/http://images.dev/lorem/ipsum.jpg"
+	_, _, err := ParsePath(path, make(http.Header))
+
+	require.Error(s.T(), err)
+}
+
 func (s *ProcessingOptionsTestSuite) TestParsePathBackground() {
 	path := "/background:128:129:130/plain/http://images.dev/lorem/ipsum.jpg"
 	po, _, err := ParsePath(path, make(http.Header))
@@ -286,6 +388,264 @@ func (s *ProcessingOptionsTestSuite) TestParsePathSharpen() {
 
 	assert.Equal(s.T(), float32(0.2), po.Sharpen)
 }
+
+func (s *ProcessingOptionsTestSuite) TestParsePathEnhance() {
+	path := "/enhance:1/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.True(s.T(), po.Enhance)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathEqualize() {
+	path := "/equalize:1/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.True(s.T(), po.Equalize)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathCLAHE() {
+	path := "/clahe:32:4/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.True(s.T(), po.CLAHE.Enabled)
+	assert.Equal(s.T(), 32, po.CLAHE.Size)
+	assert.Equal(s.T(), 4, po.CLAHE.MaxSlope)
+
+	po, _, err = ParsePath("/clahe:0/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.False(s.T(), po.CLAHE.Enabled)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathWhiteBalance() {
+	path := "/awb:retinex/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), WhiteBalanceRetinex, po.WhiteBalance)
+
+	_, _, err = ParsePath("/awb:auto/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathRotate() {
+	path := "/rotate:92.5/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), 90, po.Rotate)
+	assert.InDelta(s.T(), 2.5, po.RotateFine, 0.0001)
+
+	po, _, err = ParsePath("/rotate:180/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), 180, po.Rotate)
+	assert.Zero(s.T(), po.RotateFine)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathRotateNormalization() {
+	tt := []struct {
+		arg    string
+		rotate int
+		fine   float64
+	}{
+		{"-90", 270, 0},
+		{"-180", 180, 0},
+		{"-270", 90, 0},
+		{"-92.5", 270, -2.5},
+		{"360", 0, 0},
+		{"450", 90, 0},
+		{"-810.5", 270, -0.5},
+	}
+
+	for _, tc := range tt {
+		po, _, err := ParsePath("/rotate:"+tc.arg+"/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+		require.Nil(s.T(), err, tc.arg)
+
+		assert.Equal(s.T(), tc.rotate, po.Rotate, tc.arg)
+		assert.InDelta(s.T(), tc.fine, po.RotateFine, 0.0001, tc.arg)
+	}
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathSkew() {
+	path := "/skew:15:-10/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), SkewOptions{X: 15, Y: -10}, po.Skew)
+
+	_, _, err = ParsePath("/skew:75/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathOverlay() {
+	badgeURL := base64.RawURLEncoding.EncodeToString([]byte("http://images.dev/badge.png"))
+	frameURL := base64.RawURLEncoding.EncodeToString([]byte("http://images.dev/frame.png"))
+
+	path := fmt.Sprintf(
+		"/overlay:%s:soea:10:20:0.2:multiply/ov:%s/plain/http://images.dev/lorem/ipsum.jpg",
+		badgeURL, frameURL,
+	)
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	require.Len(s.T(), po.Overlays, 2)
+
+	assert.Equal(s.T(), "http://images.dev/badge.png", po.Overlays[0].URL)
+	assert.Equal(s.T(), GravitySouthEast, po.Overlays[0].Gravity.Type)
+	assert.Equal(s.T(), 10.0, po.Overlays[0].Gravity.X)
+	assert.Equal(s.T(), 20.0, po.Overlays[0].Gravity.Y)
+	assert.Equal(s.T(), 0.2, po.Overlays[0].Scale)
+	assert.Equal(s.T(), vips.BlendMultiply, po.Overlays[0].BlendMode)
+
+	assert.Equal(s.T(), "http://images.dev/frame.png", po.Overlays[1].URL)
+	assert.Equal(s.T(), GravityCenter, po.Overlays[1].Gravity.Type)
+	assert.Equal(s.T(), vips.BlendOver, po.Overlays[1].BlendMode)
+
+	config.MaxOverlays = 1
+
+	_, _, err = ParsePath(path, make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathMask() {
+	maskURL := base64.RawURLEncoding.EncodeToString([]byte("http://images.dev/hexagon.png"))
+
+	path := fmt.Sprintf("/mask:%s/plain/http://images.dev/lorem/ipsum.jpg", maskURL)
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), "http://images.dev/hexagon.png", po.MaskURL)
+
+	_, _, err = ParsePath("/mask:!!!/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathFilter() {
+	path := "/filter:sepia/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), "sepia", po.Filter)
+
+	_, _, err = ParsePath("/filter:unknown/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathLUT() {
+	cube := "LUT_3D_SIZE 2\n" +
+		"0 0 0\n1 0 0\n0 1 0\n1 1 0\n" +
+		"0 0 1\n1 0 1\n0 1 1\n1 1 1\n"
+
+	lutPath := filepath.Join(s.T().TempDir(), "identity.cube")
+	require.Nil(s.T(), ioutil.WriteFile(lutPath, []byte(cube), 0644))
+
+	config.LUTs = map[string]string{"identity": lutPath}
+	require.Nil(s.T(), lut.Init())
+
+	path := "/lut:identity/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), "identity", po.LUT)
+
+	_, _, err = ParsePath("/lut:unknown/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathNegate() {
+	path := "/negate:1/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.True(s.T(), po.Negate.Enabled)
+	assert.False(s.T(), po.Negate.Alpha)
+
+	po, _, err = ParsePath("/negate:1:1/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.True(s.T(), po.Negate.Alpha)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathAnimationSpeed() {
+	path := "/as:1.5/fs:2/plain/http://images.dev/lorem/ipsum.gif"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), 1.5, po.AnimationSpeed)
+	assert.Equal(s.T(), 2, po.FrameStep)
+
+	_, _, err = ParsePath("/animation_speed:0/plain/http://images.dev/lorem/ipsum.gif", make(http.Header))
+	require.Error(s.T(), err)
+
+	_, _, err = ParsePath("/frame_step:0/plain/http://images.dev/lorem/ipsum.gif", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathStillFrame() {
+	path := "/frame:middle/plain/http://images.dev/lorem/ipsum.gif"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), StillFrameMiddle, po.StillFrame.Position)
+
+	po, _, err = ParsePath("/frame:5/plain/http://images.dev/lorem/ipsum.gif", make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), StillFrameIndex, po.StillFrame.Position)
+	assert.Equal(s.T(), 5, po.StillFrame.Index)
+
+	_, _, err = ParsePath("/frame:-1/plain/http://images.dev/lorem/ipsum.gif", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathSpriteSheet() {
+	path := "/sprite_sheet:4:16/plain/http://images.dev/lorem/ipsum.gif"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), 4, po.SpriteSheet.Columns)
+	assert.Equal(s.T(), 16, po.SpriteSheet.MaxFrames)
+
+	_, _, err = ParsePath("/ss:-1/plain/http://images.dev/lorem/ipsum.gif", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathVideoSegment() {
+	path := "/video_segment:2.5:3/plain/video:http://images.dev/lorem/ipsum.mp4"
+	po, imageURL, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), "video:http://images.dev/lorem/ipsum.mp4", imageURL)
+	assert.Equal(s.T(), 2.5, po.VideoSegment.Start)
+	assert.Equal(s.T(), 3.0, po.VideoSegment.Duration)
+
+	_, _, err = ParsePath("/vseg:-1/plain/video:http://images.dev/lorem/ipsum.mp4", make(http.Header))
+	require.Error(s.T(), err)
+}
+
 func (s *ProcessingOptionsTestSuite) TestParsePathDpr() {
 	path := "/dpr:2/plain/http://images.dev/lorem/ipsum.jpg"
 	po, _, err := ParsePath(path, make(http.Header))
@@ -307,6 +667,15 @@ func (s *ProcessingOptionsTestSuite) TestParsePathWatermark() {
 	assert.Equal(s.T(), 0.6, po.Watermark.Scale)
 }
 
+func (s *ProcessingOptionsTestSuite) TestParsePathWatermarkFirstFrame() {
+	path := "/watermark_first_frame:1/plain/http://images.dev/lorem/ipsum.gif"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.True(s.T(), po.Watermark.FirstFrameOnly)
+}
+
 func (s *ProcessingOptionsTestSuite) TestParsePathPreset() {
 	presets["test1"] = urlOptions{
 		urlOption{Name: "resizing_type", Args: []string{"fill"}},
@@ -380,6 +749,16 @@ func (s *ProcessingOptionsTestSuite) TestParsePathStripMetadata() {
 	assert.True(s.T(), po.StripMetadata)
 }
 
+func (s *ProcessingOptionsTestSuite) TestParsePathStripGPS() {
+	path := "/strip_metadata:false/strip_gps:true/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.False(s.T(), po.StripMetadata)
+	assert.True(s.T(), po.StripGPS)
+}
+
 func (s *ProcessingOptionsTestSuite) TestParsePathWebpDetection() {
 	config.EnableWebpDetection = true
 
@@ -517,6 +896,274 @@ func (s *ProcessingOptionsTestSuite) TestParsePathDprHeaderDisabled() {
 // 	assert.Equal(s.T(), signature.ErrInvalidSignature.Error(), err.Error())
 // }
 
+func (s *ProcessingOptionsTestSuite) TestParsePathAllowedOptions() {
+	config.AllowedProcessingOptions = []string{"resize", "q"}
+
+	_, _, err := ParsePath("/rs:fill:100:100/quality:50/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	_, _, err = ParsePath("/rs:fill:100:100/bl:10/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathForbiddenOptions() {
+	config.ForbiddenProcessingOptions = []string{"blur"}
+
+	presets["test1"] = urlOptions{
+		urlOption{Name: "blur", Args: []string{"0.2"}},
+	}
+
+	_, _, err := ParsePath("/rs:fill:100:100/pr:test1/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	_, _, err = ParsePath("/rs:fill:100:100/bl:10/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathForbiddenOptionsShortNames() {
+	config.ForbiddenProcessingOptions = []string{"video_segment"}
+
+	_, _, err := ParsePath("/vseg:1:2/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	config.ForbiddenProcessingOptions = []string{"vseg"}
+
+	_, _, err = ParsePath("/video_segment:1:2/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	config.ForbiddenProcessingOptions = []string{"watermark_first_frame"}
+
+	_, _, err = ParsePath("/wmff:1/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	config.AllowedProcessingOptions = []string{"strip_gps"}
+	config.ForbiddenProcessingOptions = nil
+
+	_, _, err = ParsePath("/sgps:1/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathURLOptionAliases() {
+	config.URLOptionAliases = map[string]string{
+		"thumb": "rs:fill:100:100",
+		"big":   "pr:test1",
+		"s":     "sharpen",
+	}
+	config.ForbiddenProcessingOptions = []string{"quality"}
+
+	presets["test1"] = urlOptions{
+		urlOption{Name: "width", Args: []string{"500"}},
+	}
+
+	po, _, err := ParsePath("/thumb:0:1/s:0.5/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), ResizeFill, po.ResizingType)
+	assert.Equal(s.T(), 100, po.Width)
+	assert.Equal(s.T(), 100, po.Height)
+	assert.True(s.T(), po.Enlarge)
+	assert.Equal(s.T(), float32(0.5), po.Sharpen)
+	assert.Equal(s.T(), []string{"resize", "sharpen"}, po.UsedURLOptions())
+
+	po, _, err = ParsePath("/big:/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), 500, po.Width)
+
+	config.URLOptionAliases["quality"] = "q"
+
+	_, _, err = ParsePath("/quality:50/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathDisabledURLOptionAliases() {
+	config.DisabledURLOptionAliases = []string{"w", "dpr"}
+
+	po, _, err := ParsePath("/width:100/dpr:2/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), 100, po.Width)
+	assert.Equal(s.T(), 2.0, po.Dpr)
+
+	_, _, err = ParsePath("/w:100/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathSourceHostOptions() {
+	presets["ugc"] = urlOptions{
+		urlOption{Name: "blur", Args: []string{"2"}},
+	}
+
+	err := ParseSourceHostOptions([]string{
+		"*.ugc.dev=pr:ugc/mrd:1000",
+		"images.dev=q:50",
+	})
+	require.Nil(s.T(), err)
+
+	po, _, err := ParsePath("/q:80/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), 80, po.Quality)
+
+	po, _, err = ParsePath("/rs:fit:100:100/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), 50, po.Quality)
+
+	po, _, err = ParsePath("/w:500/plain/http://cdn.ugc.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), float32(2), po.Blur)
+	assert.Equal(s.T(), 0, po.Quality)
+
+	_, _, err = ParsePath("/w:1500/plain/http://cdn.ugc.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	po, _, err = ParsePath("/w:1500/plain/http://ugc.dev.evil.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), float32(0), po.Blur)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParseSourceHostOptionsInvalid() {
+	require.Error(s.T(), ParseSourceHostOptions([]string{"images.dev"}))
+	require.Error(s.T(), ParseSourceHostOptions([]string{"images.dev=pr:unknown"}))
+	require.Error(s.T(), ParseSourceHostOptions([]string{"images.dev=q:invalid"}))
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathMaxResultDimension() {
+	config.MaxResultDimension = 4000
+
+	_, _, err := ParsePath("/rs:fill:4000:100/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	_, _, err = ParsePath("/rs:fill:4001:100/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	_, _, err = ParsePath("/rs:fill:4000:100/dpr:2/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathPresetOnlyOptions() {
+	presets["print"] = urlOptions{
+		urlOption{Name: "max_src_resolution", Args: []string{"100"}},
+		urlOption{Name: "msfs", Args: []string{"1000"}},
+		urlOption{Name: "max_animation_frames", Args: []string{"5"}},
+		urlOption{Name: "mrd", Args: []string{"8000"}},
+		urlOption{Name: "mard", Args: []string{"2000"}},
+		urlOption{Name: "response_header", Args: []string{"x-print", "yes"}},
+		urlOption{Name: "rh", Args: []string{"Link", "<https://example.com>; rel=\"canonical\""}},
+		urlOption{Name: "attribution", Args: []string{
+			base64.RawURLEncoding.EncodeToString([]byte("© 2024 Foo (Bar), Inc.")),
+			base64.RawURLEncoding.EncodeToString([]byte("Jane Doe")),
+		}},
+	}
+
+	po, _, err := ParsePath("/pr:print/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), 100000000, po.SecurityOptions.MaxSrcResolution)
+	assert.Equal(s.T(), 1000, po.SecurityOptions.MaxSrcFileSize)
+	assert.Equal(s.T(), 5, po.SecurityOptions.MaxAnimationFrames)
+	assert.Equal(s.T(), 8000, po.SecurityOptions.MaxResultDimension)
+	assert.Equal(s.T(), 2000, po.SecurityOptions.MaxAnimationResultDimension)
+	assert.Equal(s.T(), map[string]string{
+		"X-Print": "yes",
+		"Link":    "<https://example.com>; rel=\"canonical\"",
+	}, po.ResponseHeaders)
+	assert.Equal(s.T(), AttributionOptions{Copyright: "© 2024 Foo (Bar), Inc.", Creator: "Jane Doe"}, po.Attribution)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathAttributionConfig() {
+	config.AttributionCopyright = "Example"
+
+	po, _, err := ParsePath("/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), "Example", po.Attribution.Copyright)
+	assert.Empty(s.T(), po.Attribution.Creator)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathPresetOnlyOptionsInURL() {
+	_, _, err := ParsePath("/max_src_resolution:100/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	_, _, err = ParsePath("/rh:X-Test:1/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	_, _, err = ParsePath("/attr:RXhhbXBsZQ/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	_, _, err = ParsePath("/cc:600:true/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathAllowedURLResponseHeader() {
+	config.AllowedURLResponseHeaders = []string{"content-disposition"}
+
+	path := "/rh:Content-Disposition:attachment; filename=\"photo.jpg\"/plain/http://images.dev/lorem/ipsum.jpg"
+
+	// Signature checking is disabled
+	_, _, err := ParsePath(path, make(http.Header))
+	require.Error(s.T(), err)
+
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+
+	po, _, err := ParsePath(path, make(http.Header))
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), map[string]string{
+		"Content-Disposition": "attachment; filename=\"photo.jpg\"",
+	}, po.ResponseHeaders)
+
+	_, _, err = ParsePath("/rh:X-Test:1/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathUpscale() {
+	path := "/upscale:2/plain/http://images.dev/lorem/ipsum.jpg"
+
+	// Upscaling is disabled
+	_, _, err := ParsePath(path, make(http.Header))
+	require.Error(s.T(), err)
+
+	config.EnableUpscale = true
+
+	// Signature checking is disabled
+	_, _, err = ParsePath(path, make(http.Header))
+	require.Error(s.T(), err)
+
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+
+	po, _, err := ParsePath(path, make(http.Header))
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, po.Upscale)
+
+	_, _, err = ParsePath("/up:3/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathReturnAttachment() {
+	po, _, err := ParsePath("/att:1/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	assert.True(s.T(), po.ReturnAttachment)
+}
+
+func (s *ProcessingOptionsTestSuite) TestParsePathPresetMaxResultDimension() {
+	config.MaxResultDimension = 4000
+	presets["print"] = urlOptions{
+		urlOption{Name: "max_result_dimension", Args: []string{"8000"}},
+	}
+
+	_, _, err := ParsePath("/pr:print/rs:fill:6000:100/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Nil(s.T(), err)
+
+	_, _, err = ParsePath("/rs:fill:6000:100/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
 func (s *ProcessingOptionsTestSuite) TestParsePathOnlyPresets() {
 	config.OnlyPresets = true
 	presets["test1"] = urlOptions{
@@ -536,6 +1183,34 @@ func (s *ProcessingOptionsTestSuite) TestParsePathOnlyPresets() {
 	assert.Equal(s.T(), 50, po.Quality)
 }
 
+func (s *ProcessingOptionsTestSuite) TestParsePathOnlyPresetsExtraOptions() {
+	config.OnlyPresets = true
+	config.OnlyPresetsExtraOptions = []string{"width", "dpr"}
+	config.MaxResultDimension = 2000
+	presets["test1"] = urlOptions{
+		urlOption{Name: "resizing_type", Args: []string{"fill"}},
+	}
+
+	po, imageURL, err := ParsePath("/test1/w:300/dpr:2/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), "http://images.dev/lorem/ipsum.jpg", imageURL)
+	assert.Equal(s.T(), ResizeFill, po.ResizingType)
+	assert.Equal(s.T(), 300, po.Width)
+	assert.Equal(s.T(), 2.0, po.Dpr)
+	assert.Equal(s.T(), []string{"width", "dpr"}, po.UsedURLOptions())
+
+	_, _, err = ParsePath("/test1/h:300/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	_, _, err = ParsePath("/test1/w:1500/dpr:2/plain/http://images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+
+	assert.True(s.T(), IsPresetsOnlyPath("/test1/plain/http://images.dev/lorem/ipsum.jpg"))
+	assert.False(s.T(), IsPresetsOnlyPath("/test1/w:300/plain/http://images.dev/lorem/ipsum.jpg"))
+}
+
 func (s *ProcessingOptionsTestSuite) TestParseSkipProcessing() {
 	path := "/skp:jpg:png/plain/http://images.dev/lorem/ipsum.jpg"
 
@@ -591,6 +1266,15 @@ func (s *ProcessingOptionsTestSuite) TestParseBase64URLOnlyPresets() {
 	assert.Equal(s.T(), originURL, imageURL)
 }
 
+func (s *ProcessingOptionsTestSuite) TestParsePathUsedURLOptions() {
+	path := "/rs:fill:300:200/bl:2/q:50/plain/http://images.dev/lorem/ipsum.jpg"
+	po, _, err := ParsePath(path, make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), []string{"resize", "blur", "quality"}, po.UsedURLOptions())
+}
+
 func TestProcessingOptions(t *testing.T) {
 	suite.Run(t, new(ProcessingOptionsTestSuite))
 }
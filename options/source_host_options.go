@@ -0,0 +1,107 @@
+package options
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type sourceHostOptions struct {
+	pattern *regexp.Regexp
+	options urlOptions
+}
+
+var hostOptions []sourceHostOptions
+
+// sourceHostPattern converts the host pattern to a regexp.
+// * matches any sequence of characters
+func sourceHostPattern(pattern string) *regexp.Regexp {
+	parts := strings.Split(strings.ToLower(pattern), "*")
+
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+
+	// It is safe to use regexp.MustCompile since the expression is always valid
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+func parseSourceHostOptions(str string) (sourceHostOptions, error) {
+	i := strings.Index(str, "=")
+	if i < 0 {
+		return sourceHostOptions{}, fmt.Errorf("Invalid source host options string: %s", str)
+	}
+
+	pattern := strings.TrimSpace(str[:i])
+	if len(pattern) == 0 {
+		return sourceHostOptions{}, fmt.Errorf("Empty source host pattern: %s", str)
+	}
+
+	value := strings.TrimSpace(str[i+1:])
+	if len(value) == 0 {
+		return sourceHostOptions{}, fmt.Errorf("Empty source host options: %s", str)
+	}
+
+	opts, rest := parseURLOptions(strings.Split(value, "/"))
+	if len(rest) > 0 {
+		return sourceHostOptions{}, fmt.Errorf("Invalid source host options: %s", str)
+	}
+
+	// Check that the options are valid. Presets should be parsed at this point
+	var po ProcessingOptions
+	if err := applyURLOptions(&po, opts); err != nil {
+		return sourceHostOptions{}, fmt.Errorf("Error in source host options `%s`: %s", pattern, err)
+	}
+
+	return sourceHostOptions{
+		pattern: sourceHostPattern(pattern),
+		options: opts,
+	}, nil
+}
+
+// ParseSourceHostOptions parses the default processing options
+// for the source hosts. Presets should be parsed before this
+func ParseSourceHostOptions(strs []string) error {
+	parsed := make([]sourceHostOptions, 0, len(strs))
+
+	for _, str := range strs {
+		if len(strings.TrimSpace(str)) == 0 {
+			continue
+		}
+
+		ho, err := parseSourceHostOptions(str)
+		if err != nil {
+			return err
+		}
+
+		parsed = append(parsed, ho)
+	}
+
+	hostOptions = parsed
+
+	return nil
+}
+
+// sourceHostURLOptions returns the default processing options
+// for the host of the source URL. The first matching pattern wins
+func sourceHostURLOptions(imageURL string) urlOptions {
+	if len(hostOptions) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return nil
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	for _, ho := range hostOptions {
+		if ho.pattern.MatchString(host) {
+			return ho.options
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package options
+
+import "fmt"
+
+type StillFramePosition int
+
+const (
+	StillFrameNone StillFramePosition = iota
+	StillFrameFirst
+	StillFrameMiddle
+	StillFrameLast
+	StillFrameIndex
+)
+
+var stillFramePositions = map[string]StillFramePosition{
+	"none":   StillFrameNone,
+	"first":  StillFrameFirst,
+	"middle": StillFrameMiddle,
+	"last":   StillFrameLast,
+}
+
+func (p StillFramePosition) String() string {
+	for k, v := range stillFramePositions {
+		if v == p {
+			return k
+		}
+	}
+	return ""
+}
+
+func (p StillFramePosition) MarshalJSON() ([]byte, error) {
+	for k, v := range stillFramePositions {
+		if v == p {
+			return []byte(fmt.Sprintf("%q", k)), nil
+		}
+	}
+	return []byte("null"), nil
+}
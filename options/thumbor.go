@@ -0,0 +1,300 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+var (
+	thumborTrimRe    = regexp.MustCompile(`^trim(:(top-left|bottom-right))?(:(\d+))?$`)
+	thumborCropRe    = regexp.MustCompile(`^(\d+)x(\d+):(\d+)x(\d+)$`)
+	thumborFitInRe   = regexp.MustCompile(`^(adaptive-)?(full-)?fit-in$`)
+	thumborSizeRe    = regexp.MustCompile(`^(-)?(\d+|orig)?x(-)?(\d+|orig)?$`)
+	thumborHAlignRe  = regexp.MustCompile(`^(left|right|center)$`)
+	thumborVAlignRe  = regexp.MustCompile(`^(top|bottom|middle)$`)
+	thumborFiltersRe = regexp.MustCompile(`^filters:(.+)$`)
+	thumborFilterRe  = regexp.MustCompile(`^([a-z_]+)\((.*)\)$`)
+)
+
+var thumborNoArgsFilters = map[string]struct{}{
+	"strip_exif": {},
+	"strip_icc":  {},
+	"upscale":    {},
+	"no_upscale": {},
+}
+
+var thumborGravityTypes = map[string]string{
+	"left:top":      "nowe",
+	"center:top":    "no",
+	"right:top":     "noea",
+	"left:middle":   "we",
+	"center:middle": "ce",
+	"right:middle":  "ea",
+	"left:bottom":   "sowe",
+	"center:bottom": "so",
+	"right:bottom":  "soea",
+}
+
+// splitThumborFilters splits the filters string by colons
+// that are not enclosed in parentheses
+func splitThumborFilters(str string) []string {
+	var (
+		filters []string
+		depth   int
+		start   int
+	)
+
+	for i, c := range str {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ':':
+			if depth == 0 {
+				filters = append(filters, str[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(filters, str[start:])
+}
+
+func parseThumborFilters(str string, fitIn bool) (urlOptions, error) {
+	var opts urlOptions
+
+	for _, filter := range splitThumborFilters(str) {
+		m := thumborFilterRe.FindStringSubmatch(filter)
+		if m == nil {
+			return nil, fmt.Errorf("Invalid Thumbor filter: %s", filter)
+		}
+
+		name := m[1]
+
+		var args []string
+		if len(m[2]) > 0 {
+			args = strings.Split(m[2], ",")
+		}
+
+		if _, ok := thumborNoArgsFilters[name]; !ok && len(args) == 0 {
+			return nil, fmt.Errorf("Invalid Thumbor filter arguments: %s", filter)
+		}
+
+		switch name {
+		case "quality":
+			opts = append(opts, urlOption{Name: "quality", Args: args})
+		case "format":
+			opts = append(opts, urlOption{Name: "format", Args: args})
+		case "blur":
+			// Thumbor uses the radius as sigma when sigma is not set
+			opts = append(opts, urlOption{Name: "blur", Args: args[len(args)-1:]})
+		case "sharpen":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("Invalid Thumbor filter arguments: %s", filter)
+			}
+			opts = append(opts, urlOption{Name: "sharpen", Args: args[1:2]})
+		case "strip_exif":
+			opts = append(opts, urlOption{Name: "strip_metadata", Args: []string{"1"}})
+		case "strip_icc":
+			opts = append(opts, urlOption{Name: "strip_color_profile", Args: []string{"1"}})
+		case "upscale":
+			opts = append(opts, urlOption{Name: "enlarge", Args: []string{"1"}})
+		case "no_upscale":
+			opts = append(opts, urlOption{Name: "enlarge", Args: []string{"0"}})
+		case "fill":
+			opts = append(opts, urlOption{Name: "background", Args: []string{strings.TrimPrefix(args[0], "#")}})
+			if fitIn {
+				opts = append(opts, urlOption{Name: "extend", Args: []string{"1"}})
+			}
+		case "background_color":
+			opts = append(opts, urlOption{Name: "background", Args: []string{strings.TrimPrefix(args[0], "#")}})
+		case "max_bytes":
+			opts = append(opts, urlOption{Name: "max_bytes", Args: args})
+		case "rotate":
+			opts = append(opts, urlOption{Name: "rotate", Args: args})
+		default:
+			return nil, fmt.Errorf("Unsupported Thumbor filter: %s", name)
+		}
+	}
+
+	return opts, nil
+}
+
+func decodeThumborImageURL(parts []string) (string, error) {
+	if len(parts) == 0 || len(parts[0]) == 0 {
+		return "", errors.New("Image URL is empty")
+	}
+
+	imageURL, err := url.PathUnescape(strings.Join(parts, "/"))
+	if err != nil {
+		return "", fmt.Errorf("Invalid url encoding: %s", strings.Join(parts, "/"))
+	}
+
+	if strings.Contains(imageURL, "://") {
+		return imageURL, nil
+	}
+
+	if len(config.BaseURL) > 0 {
+		return addBaseURL(imageURL), nil
+	}
+
+	// Thumbor's HTTP loader treats the URLs without a scheme as HTTP ones
+	return "http://" + imageURL, nil
+}
+
+// parseThumborOptions translates the Thumbor path into the processing options:
+// /trim/AxB:CxD/fit-in/-Ex-F/HALIGN/VALIGN/smart/filters:NAME(ARGS):NAME(ARGS)/IMAGE
+func parseThumborOptions(parts []string) (urlOptions, string, error) {
+	var (
+		opts    urlOptions
+		fitIn   bool
+		size    []string
+		halign  = "center"
+		valign  = "middle"
+		aligned bool
+		smart   bool
+		filters string
+	)
+
+	i := 0
+
+	if i < len(parts) && parts[i] == "meta" {
+		return nil, "", errors.New("Thumbor metadata endpoint is not supported")
+	}
+
+	if i < len(parts) {
+		if m := thumborTrimRe.FindStringSubmatch(parts[i]); m != nil {
+			threshold := "0"
+			if len(m[4]) > 0 {
+				threshold = m[4]
+			}
+			opts = append(opts, urlOption{Name: "trim", Args: []string{threshold}})
+			i++
+		}
+	}
+
+	if i < len(parts) {
+		if m := thumborCropRe.FindStringSubmatch(parts[i]); m != nil {
+			left, _ := strconv.Atoi(m[1])
+			top, _ := strconv.Atoi(m[2])
+			right, _ := strconv.Atoi(m[3])
+			bottom, _ := strconv.Atoi(m[4])
+
+			if right <= left || bottom <= top {
+				return nil, "", fmt.Errorf("Invalid Thumbor crop: %s", parts[i])
+			}
+
+			opts = append(opts, urlOption{Name: "crop", Args: []string{
+				strconv.Itoa(right - left), strconv.Itoa(bottom - top),
+				"nowe", m[1], m[2],
+			}})
+			i++
+		}
+	}
+
+	if i < len(parts) {
+		if m := thumborFitInRe.FindStringSubmatch(parts[i]); m != nil {
+			if len(m[1]) > 0 || len(m[2]) > 0 {
+				return nil, "", fmt.Errorf("Unsupported Thumbor fit-in mode: %s", parts[i])
+			}
+			fitIn = true
+			i++
+		}
+	}
+
+	if i < len(parts) {
+		if m := thumborSizeRe.FindStringSubmatch(parts[i]); m != nil {
+			if len(m[1]) > 0 || len(m[3]) > 0 {
+				return nil, "", fmt.Errorf("Thumbor flipping is not supported: %s", parts[i])
+			}
+			if m[2] == "orig" || m[4] == "orig" {
+				return nil, "", fmt.Errorf("Thumbor orig size is not supported: %s", parts[i])
+			}
+
+			size = []string{m[2], m[4]}
+			i++
+		}
+	}
+
+	if i < len(parts) && thumborHAlignRe.MatchString(parts[i]) {
+		halign = parts[i]
+		aligned = true
+		i++
+	}
+
+	if i < len(parts) && thumborVAlignRe.MatchString(parts[i]) {
+		valign = parts[i]
+		aligned = true
+		i++
+	}
+
+	if i < len(parts) && parts[i] == "smart" {
+		smart = true
+		i++
+	}
+
+	if i < len(parts) {
+		if m := thumborFiltersRe.FindStringSubmatch(parts[i]); m != nil {
+			filters = m[1]
+			i++
+		}
+	}
+
+	if size != nil || fitIn {
+		resizingType := "fill"
+		enlarge := "1"
+
+		// Thumbor doesn't upscale images in the fit-in mode
+		if fitIn {
+			resizingType = "fit"
+			enlarge = "0"
+		}
+
+		args := []string{resizingType, "0", "0", enlarge}
+		if size != nil {
+			if len(size[0]) > 0 {
+				args[1] = size[0]
+			}
+			if len(size[1]) > 0 {
+				args[2] = size[1]
+			}
+		}
+
+		opts = append(opts, urlOption{Name: "resize", Args: args})
+	}
+
+	if smart {
+		opts = append(opts, urlOption{Name: "gravity", Args: []string{"sm"}})
+	} else if aligned {
+		opts = append(opts, urlOption{Name: "gravity", Args: []string{thumborGravityTypes[halign+":"+valign]}})
+	}
+
+	if len(filters) > 0 {
+		filterOpts, err := parseThumborFilters(filters, fitIn)
+		if err != nil {
+			return nil, "", err
+		}
+		opts = append(opts, filterOpts...)
+	}
+
+	imageURL, err := decodeThumborImageURL(parts[i:])
+	if err != nil {
+		return nil, "", err
+	}
+
+	return opts, imageURL, nil
+}
+
+// ParseThumborPath parses the Thumbor-compatible path without the signature
+// and translates it into the processing options
+func ParseThumborPath(path string, headers http.Header) (*ProcessingOptions, string, error) {
+	return parseTranslatedPath(path, headers, parseThumborOptions)
+}
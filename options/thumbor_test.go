@@ -0,0 +1,93 @@
+package options
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ThumborTestSuite struct{ suite.Suite }
+
+func (s *ThumborTestSuite) SetupTest() {
+	config.Reset()
+	// Reset presets
+	presets = make(map[string]urlOptions)
+	hostOptions = nil
+}
+
+func (s *ThumborTestSuite) TestParseThumborOptions() {
+	opts, imageURL, err := parseThumborOptions([]string{
+		"trim:top-left:10", "10x20:110x220", "fit-in", "300x200", "left", "top",
+		"filters:quality(80):format(webp):fill(fff)", "images.dev", "lorem", "ipsum.jpg",
+	})
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), "http://images.dev/lorem/ipsum.jpg", imageURL)
+	assert.Equal(s.T(), urlOptions{
+		urlOption{Name: "trim", Args: []string{"10"}},
+		urlOption{Name: "crop", Args: []string{"100", "200", "nowe", "10", "20"}},
+		urlOption{Name: "resize", Args: []string{"fit", "300", "200", "0"}},
+		urlOption{Name: "gravity", Args: []string{"nowe"}},
+		urlOption{Name: "quality", Args: []string{"80"}},
+		urlOption{Name: "format", Args: []string{"webp"}},
+		urlOption{Name: "background", Args: []string{"fff"}},
+		urlOption{Name: "extend", Args: []string{"1"}},
+	}, opts)
+}
+
+func (s *ThumborTestSuite) TestParseThumborPath() {
+	po, imageURL, err := ParseThumborPath("/300x/smart/http%3A%2F%2Fimages.dev%2Florem%2Fipsum.jpg", make(http.Header))
+
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), "http://images.dev/lorem/ipsum.jpg", imageURL)
+	assert.Equal(s.T(), ResizeFill, po.ResizingType)
+	assert.Equal(s.T(), 300, po.Width)
+	assert.Equal(s.T(), 0, po.Height)
+	assert.True(s.T(), po.Enlarge)
+	assert.Equal(s.T(), GravitySmart, po.Gravity.Type)
+	assert.Equal(s.T(), imagetype.Unknown, po.Format)
+	assert.Equal(s.T(), []string{"resize", "gravity"}, po.UsedURLOptions())
+}
+
+func (s *ThumborTestSuite) TestParseThumborPathBaseURL() {
+	config.BaseURL = "s3://bucket/"
+
+	_, imageURL, err := ParseThumborPath("/filters:blur(5,2)/lorem/ipsum.jpg", make(http.Header))
+
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "s3://bucket/lorem/ipsum.jpg", imageURL)
+}
+
+func (s *ThumborTestSuite) TestParseThumborPathPolicy() {
+	config.ForbiddenProcessingOptions = []string{"blur"}
+
+	_, _, err := ParseThumborPath("/filters:blur(5)/images.dev/lorem/ipsum.jpg", make(http.Header))
+	require.Error(s.T(), err)
+}
+
+func (s *ThumborTestSuite) TestParseThumborPathUnsupported() {
+	paths := []string{
+		"/-300x200/images.dev/lorem/ipsum.jpg",
+		"/adaptive-fit-in/300x200/images.dev/lorem/ipsum.jpg",
+		"/origx200/images.dev/lorem/ipsum.jpg",
+		"/filters:grayscale()/images.dev/lorem/ipsum.jpg",
+		"/110x220:10x20/images.dev/lorem/ipsum.jpg",
+		"/300x200/",
+	}
+
+	for _, path := range paths {
+		_, _, err := ParseThumborPath(path, make(http.Header))
+		assert.Error(s.T(), err, path)
+	}
+}
+
+func TestThumbor(t *testing.T) {
+	suite.Run(t, new(ThumborTestSuite))
+}
@@ -8,16 +8,24 @@ import (
 	"strings"
 
 	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/video"
 )
 
 const urlTokenPlain = "plain"
 
 func addBaseURL(u string) string {
-	if len(config.BaseURL) == 0 || strings.HasPrefix(u, config.BaseURL) {
-		return u
+	// The video tag should stay in front of the URL
+	u, isVideo := video.ParseSourceURL(u)
+
+	if len(config.BaseURL) > 0 && !strings.HasPrefix(u, config.BaseURL) {
+		u = fmt.Sprintf("%s%s", config.BaseURL, u)
+	}
+
+	if isVideo {
+		return video.SourcePrefix + u
 	}
 
-	return fmt.Sprintf("%s%s", config.BaseURL, u)
+	return u
 }
 
 func decodeBase64URL(parts []string) (string, string, error) {
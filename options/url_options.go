@@ -1,6 +1,10 @@
 package options
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
 
 type urlOption struct {
 	Name string
@@ -9,6 +13,48 @@ type urlOption struct {
 
 type urlOptions []urlOption
 
+func (uo urlOptions) String() string {
+	var sb strings.Builder
+
+	for i, opt := range uo {
+		if i > 0 {
+			sb.WriteByte('/')
+		}
+
+		sb.WriteString(opt.Name)
+
+		for _, arg := range opt.Args {
+			sb.WriteByte(':')
+			sb.WriteString(arg)
+		}
+	}
+
+	return sb.String()
+}
+
+// resolveURLOptionAlias replaces the custom alias with the option it's
+// defined for. The arguments defined in the alias go before the ones
+// provided in the URL
+func resolveURLOptionAlias(opt urlOption) urlOption {
+	target, ok := config.URLOptionAliases[opt.Name]
+	if !ok {
+		return opt
+	}
+
+	targetArgs := strings.Split(target, ":")
+
+	// Allow using aliases without arguments like "alias:"
+	args := opt.Args
+	if len(args) == 1 && len(args[0]) == 0 {
+		args = nil
+	}
+
+	return urlOption{
+		Name: targetArgs[0],
+		Args: append(targetArgs[1:], args...),
+	}
+}
+
 func parseURLOptions(opts []string) (urlOptions, []string) {
 	parsed := make(urlOptions, 0, len(opts))
 	urlStart := len(opts) + 1
@@ -21,7 +67,7 @@ func parseURLOptions(opts []string) (urlOptions, []string) {
 			break
 		}
 
-		parsed = append(parsed, urlOption{Name: args[0], Args: args[1:]})
+		parsed = append(parsed, resolveURLOptionAlias(urlOption{Name: args[0], Args: args[1:]}))
 	}
 
 	var rest []string
@@ -0,0 +1,35 @@
+package options
+
+import "fmt"
+
+type WhiteBalanceMode int
+
+const (
+	WhiteBalanceNone WhiteBalanceMode = iota
+	WhiteBalanceGrayWorld
+	WhiteBalanceRetinex
+)
+
+var whiteBalanceModes = map[string]WhiteBalanceMode{
+	"none":       WhiteBalanceNone,
+	"gray_world": WhiteBalanceGrayWorld,
+	"retinex":    WhiteBalanceRetinex,
+}
+
+func (wb WhiteBalanceMode) String() string {
+	for k, v := range whiteBalanceModes {
+		if v == wb {
+			return k
+		}
+	}
+	return ""
+}
+
+func (wb WhiteBalanceMode) MarshalJSON() ([]byte, error) {
+	for k, v := range whiteBalanceModes {
+		if v == wb {
+			return []byte(fmt.Sprintf("%q", k)), nil
+		}
+	}
+	return []byte("null"), nil
+}
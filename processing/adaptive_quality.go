@@ -0,0 +1,17 @@
+package processing
+
+import (
+	"github.com/imgproxy/imgproxy/v3/complexity"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// adaptiveQuality adjusts the quality according to the entropy of the image,
+// so more complex images are saved with higher quality
+func adaptiveQuality(img *vips.Image, quality, delta int) (int, error) {
+	pixels, _, _, err := img.GrayscalePixels(complexity.SampleSize)
+	if err != nil {
+		return 0, err
+	}
+
+	return complexity.AdaptQuality(quality, delta, complexity.Entropy(pixels)), nil
+}
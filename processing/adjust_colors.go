@@ -0,0 +1,75 @@
+package processing
+
+import (
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imath"
+	"github.com/imgproxy/imgproxy/v3/lut"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+func adjustColors(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+	if po.WhiteBalance == options.WhiteBalanceNone && !po.Enhance && !po.Equalize && !po.CLAHE.Enabled && len(po.Filter) == 0 && len(po.LUT) == 0 && !po.Negate.Enabled {
+		return nil
+	}
+
+	if err := copyMemoryAndCheckTimeout(pctx.ctx, img); err != nil {
+		return err
+	}
+
+	if err := img.RgbColourspace(); err != nil {
+		return err
+	}
+
+	// White balance goes first since the other adjustments
+	// work better with the corrected colors
+	if po.WhiteBalance != options.WhiteBalanceNone {
+		if err := img.WhiteBalance(po.WhiteBalance == options.WhiteBalanceRetinex); err != nil {
+			return err
+		}
+	}
+
+	if po.Enhance {
+		if err := img.Enhance(); err != nil {
+			return err
+		}
+	}
+
+	if po.Equalize {
+		if err := img.Equalize(); err != nil {
+			return err
+		}
+	}
+
+	if po.CLAHE.Enabled {
+		size := imath.Min(po.CLAHE.Size, imath.Min(img.Width(), img.Height()))
+		if err := img.CLAHE(size, po.CLAHE.MaxSlope); err != nil {
+			return err
+		}
+	}
+
+	// Filter and LUT go last since they define the final look of the image
+	if f, ok := options.LookupFilter(po.Filter); ok {
+		if err := img.Recomb(f.Matrix, f.Offset); err != nil {
+			return err
+		}
+	}
+
+	if l, ok := lut.Get(po.LUT); ok {
+		if err := img.ApplyLUT3D(l.Size, l.Data); err != nil {
+			return err
+		}
+	}
+
+	if po.Negate.Enabled {
+		if err := img.Negate(po.Negate.Alpha); err != nil {
+			return err
+		}
+	}
+
+	if err := img.CastUchar(); err != nil {
+		return err
+	}
+
+	return copyMemoryAndCheckTimeout(pctx.ctx, img)
+}
@@ -0,0 +1,74 @@
+package processing
+
+import (
+	"math"
+
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/imath"
+)
+
+// Browsers slow down animations with shorter delays,
+// so there's no point in speeding frames up more than this
+const minFrameDelay = 20
+
+// Browsers play GIF frames with this or shorter delays with 100ms delay
+const gifMinFrameDelay = 10
+
+// normalizeAnimationDelays keeps the animation timing when it's converted
+// from or to GIF. Browsers have a special treatment for short GIF delays,
+// and GIF stores delays in centiseconds
+func normalizeAnimationDelays(delay []int, src, dst imagetype.Type) {
+	switch {
+	case src == imagetype.GIF && dst != imagetype.GIF:
+		for i, d := range delay {
+			if d <= gifMinFrameDelay {
+				delay[i] = 100
+			}
+		}
+	case src != imagetype.GIF && dst == imagetype.GIF:
+		for i, d := range delay {
+			if d > 0 && d < minFrameDelay {
+				delay[i] = minFrameDelay
+			}
+		}
+	}
+}
+
+// selectAnimationFrames returns the indices of the frames that should be kept
+// and their delays. Only every frameStep-th frame is kept. The delays of the dropped
+// frames are added to the kept ones so the animation duration stays the same.
+// Then all the delays are divided by speed
+func selectAnimationFrames(delay []int, framesCount, frameStep int, speed float64) ([]int, []int) {
+	frameStep = imath.Max(frameStep, 1)
+
+	indices := make([]int, 0, (framesCount+frameStep-1)/frameStep)
+	for i := 0; i < framesCount; i += frameStep {
+		indices = append(indices, i)
+	}
+
+	if frameStep == 1 && speed == 1 {
+		return indices, delay
+	}
+
+	newDelay := make([]int, 0, len(indices))
+
+	for _, i := range indices {
+		if i >= len(delay) {
+			break
+		}
+
+		sum := 0
+		for j := i; j < imath.Min(i+frameStep, len(delay)); j++ {
+			sum += delay[j]
+		}
+
+		d := int(math.Round(float64(sum) / speed))
+		if sum > 0 {
+			d = imath.Max(d, minFrameDelay)
+		}
+
+		newDelay = append(newDelay, d)
+	}
+
+	return indices, newDelay
+}
@@ -0,0 +1,37 @@
+package processing
+
+import (
+	"fmt"
+
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// exifASCIIValue formats the value the way libvips formats ASCII EXIF fields.
+// libvips drops the parenthesized tail when it writes the field back to EXIF,
+// so without the tail it would cut the value itself if it has parentheses
+func exifASCIIValue(value string) string {
+	size := len(value) + 1
+	return fmt.Sprintf("%s (%s, ASCII, %d components, %d bytes)", value, value, size, size)
+}
+
+// stampAttribution writes the copyright and the creator to the image EXIF.
+// If the image has no XMP, it also adds the XMP packet with them
+func stampAttribution(img *vips.Image, attr options.AttributionOptions) {
+	if len(attr.Copyright) == 0 && len(attr.Creator) == 0 {
+		return
+	}
+
+	if len(attr.Copyright) > 0 {
+		img.SetString("exif-ifd0-Copyright", exifASCIIValue(attr.Copyright))
+	}
+
+	if len(attr.Creator) > 0 {
+		img.SetString("exif-ifd0-Artist", exifASCIIValue(attr.Creator))
+	}
+
+	if !img.HasField("xmp-data") {
+		img.SetBlob("xmp-data", imagemeta.AttributionXMP(attr.Copyright, attr.Creator))
+	}
+}
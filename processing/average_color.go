@@ -0,0 +1,22 @@
+package processing
+
+import (
+	"fmt"
+
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// averageColorHex returns the average color of the image as a CSS hex color.
+// The opacity is added only if the image has an alpha channel
+func averageColorHex(img *vips.Image) (string, error) {
+	color, alpha, err := img.AverageColor()
+	if err != nil {
+		return "", err
+	}
+
+	if img.HasAlpha() {
+		return fmt.Sprintf("#%02x%02x%02x%02x", color.R, color.G, color.B, alpha), nil
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x", color.R, color.G, color.B), nil
+}
@@ -1,13 +1,14 @@
 package processing
 
 import (
+	"github.com/imgproxy/imgproxy/v3/detection"
 	"github.com/imgproxy/imgproxy/v3/imagedata"
 	"github.com/imgproxy/imgproxy/v3/imath"
 	"github.com/imgproxy/imgproxy/v3/options"
 	"github.com/imgproxy/imgproxy/v3/vips"
 )
 
-func cropImage(img *vips.Image, cropWidth, cropHeight int, gravity *options.GravityOptions) error {
+func cropImage(img *vips.Image, cropWidth, cropHeight int, gravity *options.GravityOptions, smartCropKey string) error {
 	if cropWidth == 0 && cropHeight == 0 {
 		return nil
 	}
@@ -21,22 +22,90 @@ func cropImage(img *vips.Image, cropWidth, cropHeight int, gravity *options.Grav
 		return nil
 	}
 
-	if gravity.Type == options.GravitySmart {
-		if err := img.CopyMemory(); err != nil {
-			return err
+	if gravity.Type == options.GravityFace || gravity.Type == options.GravityObject {
+		classes := gravity.Classes
+		if gravity.Type == options.GravityFace {
+			classes = []string{detection.FaceClass}
 		}
-		if err := img.SmartCrop(cropWidth, cropHeight); err != nil {
+
+		if x, y, ok := getSmartCropPoint(smartCropKey); ok {
+			gravity = &options.GravityOptions{Type: options.GravityFocusPoint, X: x, Y: y}
+		} else if x, y, ok, err := objectsCenter(img, classes); err != nil {
 			return err
+		} else if ok {
+			setSmartCropPoint(smartCropKey, x, y)
+			gravity = &options.GravityOptions{Type: options.GravityFocusPoint, X: x, Y: y}
+		} else {
+			// No objects found, so we let libvips find the most interesting area
+			gravity = &options.GravityOptions{Type: options.GravitySmart}
+		}
+	}
+
+	if gravity.Type == options.GravitySmart {
+		// If we already know where the attention center is,
+		// we can crop the image around it without analysis
+		if x, y, ok := getSmartCropPoint(smartCropKey); ok {
+			gravity = &options.GravityOptions{Type: options.GravityFocusPoint, X: x, Y: y}
+		} else {
+			if err := img.CopyMemory(); err != nil {
+				return err
+			}
+			attX, attY, err := img.SmartCrop(cropWidth, cropHeight)
+			if err != nil {
+				return err
+			}
+			setSmartCropPoint(
+				smartCropKey,
+				float64(attX)/float64(imgWidth),
+				float64(attY)/float64(imgHeight),
+			)
+			// Applying additional modifications after smart crop causes SIGSEGV on Alpine
+			// so we have to copy memory after it
+			return img.CopyMemory()
 		}
-		// Applying additional modifications after smart crop causes SIGSEGV on Alpine
-		// so we have to copy memory after it
-		return img.CopyMemory()
 	}
 
 	left, top := calcPosition(imgWidth, imgHeight, cropWidth, cropHeight, gravity, false)
 	return img.Crop(left, top, cropWidth, cropHeight)
 }
 
+// objectsCenter detects objects of the classes on the image and returns
+// the relative coordinates of the center of the area containing them
+func objectsCenter(img *vips.Image, classes []string) (float64, float64, bool, error) {
+	enabled := len(classes) == 0 && detection.Enabled("")
+	for _, class := range classes {
+		enabled = enabled || detection.Enabled(class)
+	}
+
+	if !enabled {
+		return 0, 0, false, nil
+	}
+
+	pixels, width, height, err := img.GrayscalePixels(detection.MaxImageSize)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	objects := detection.Detect(pixels, width, height, classes)
+	if len(objects) == 0 {
+		return 0, 0, false, nil
+	}
+
+	left, top, right, bottom := width, height, 0, 0
+
+	for _, f := range objects {
+		left = imath.Min(left, f.X-f.Size/2)
+		top = imath.Min(top, f.Y-f.Size/2)
+		right = imath.Max(right, f.X+f.Size/2)
+		bottom = imath.Max(bottom, f.Y+f.Size/2)
+	}
+
+	x := float64(left+right) / 2 / float64(width)
+	y := float64(top+bottom) / 2 / float64(height)
+
+	return x, y, true, nil
+}
+
 func crop(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
 	width, height := pctx.cropWidth, pctx.cropHeight
 
@@ -48,7 +117,7 @@ func crop(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions,
 		width, height = height, width
 	}
 
-	return cropImage(img, width, height, &opts)
+	return cropImage(img, width, height, &opts, smartCropCacheKey(pctx, po, imgdata, "crop"))
 }
 
 func cropToResult(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
@@ -67,5 +136,5 @@ func cropToResult(pctx *pipelineContext, img *vips.Image, po *options.Processing
 		}
 	}
 
-	return cropImage(img, resultWidth, resultHeight, &po.Gravity)
+	return cropImage(img, resultWidth, resultHeight, &po.Gravity, smartCropCacheKey(pctx, po, imgdata, "result"))
 }
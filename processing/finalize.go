@@ -11,7 +11,13 @@ func finalize(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOpti
 		if err := img.Strip(); err != nil {
 			return err
 		}
+	} else if po.StripGPS {
+		if err := img.StripGPS(); err != nil {
+			return err
+		}
 	}
 
+	stampAttribution(img, po.Attribution)
+
 	return copyMemoryAndCheckTimeout(pctx.ctx, img)
 }
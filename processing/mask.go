@@ -0,0 +1,36 @@
+package processing
+
+import (
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+func mask(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+	maskData := pctx.secondary.mask()
+
+	if len(po.MaskURL) == 0 || maskData == nil {
+		return nil
+	}
+
+	if err := img.RgbColourspace(); err != nil {
+		return err
+	}
+
+	if err := img.CopyMemory(); err != nil {
+		return err
+	}
+
+	m := new(vips.Image)
+	defer m.Clear()
+
+	if err := m.Load(maskData, 1, 1.0, 1); err != nil {
+		return err
+	}
+
+	if err := img.ApplyMask(m); err != nil {
+		return err
+	}
+
+	return copyMemoryAndCheckTimeout(pctx.ctx, img)
+}
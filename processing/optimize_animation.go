@@ -0,0 +1,60 @@
+package processing
+
+import (
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// deduplicateAnimationFrames merges identical consecutive frames of the animation
+// summing up their delays, so the encoder doesn't store the same frame several times.
+// img should be already copied to memory since the frames are read twice.
+// It returns the delays of the remaining frames
+func deduplicateAnimationFrames(img *vips.Image, frameHeight int, delay []int) ([]int, error) {
+	framesCount := len(delay)
+	if framesCount < 2 {
+		return delay, nil
+	}
+
+	frames := make([]*vips.Image, 0, framesCount)
+	defer func() {
+		for _, frame := range frames {
+			frame.Clear()
+		}
+	}()
+
+	newDelay := make([]int, 0, framesCount)
+
+	for i := 0; i < framesCount; i++ {
+		frame := new(vips.Image)
+
+		if err := img.Extract(frame, 0, i*frameHeight, img.Width(), frameHeight); err != nil {
+			return nil, err
+		}
+
+		if len(frames) > 0 {
+			equal, err := frame.IsEqual(frames[len(frames)-1])
+			if err != nil {
+				frame.Clear()
+				return nil, err
+			}
+
+			if equal {
+				newDelay[len(newDelay)-1] += delay[i]
+				frame.Clear()
+				continue
+			}
+		}
+
+		frames = append(frames, frame)
+		newDelay = append(newDelay, delay[i])
+	}
+
+	if len(frames) == framesCount {
+		return delay, nil
+	}
+
+	if err := img.Arrayjoin(frames); err != nil {
+		return nil, err
+	}
+
+	return newDelay, nil
+}
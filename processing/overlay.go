@@ -0,0 +1,64 @@
+package processing
+
+import (
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+func applyOverlay(img *vips.Image, ovData *imagedata.ImageData, opts *options.OverlayOptions, framesCount int) error {
+	ov := new(vips.Image)
+	defer ov.Clear()
+
+	width := img.Width()
+	height := img.Height()
+
+	// Overlays are placed the same way watermarks are
+	wmOpts := options.WatermarkOptions{
+		Enabled: true,
+		Gravity: opts.Gravity,
+		Scale:   opts.Scale,
+	}
+
+	if err := prepareWatermark(ov, ovData, &wmOpts, width, height/framesCount); err != nil {
+		return err
+	}
+
+	if framesCount > 1 {
+		if err := ov.Replicate(width, height); err != nil {
+			return err
+		}
+	}
+
+	return img.Composite(ov, opts.BlendMode)
+}
+
+func applyOverlays(img *vips.Image, ovData []*imagedata.ImageData, opts []options.OverlayOptions, framesCount int) error {
+	if len(ovData) == 0 {
+		return nil
+	}
+
+	if err := img.RgbColourspace(); err != nil {
+		return err
+	}
+
+	if err := img.CopyMemory(); err != nil {
+		return err
+	}
+
+	for i := range opts {
+		if i >= len(ovData) || ovData[i] == nil {
+			break
+		}
+
+		if err := applyOverlay(img, ovData[i], &opts[i], framesCount); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func overlay(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+	return applyOverlays(img, pctx.secondary.overlays(), po.Overlays, 1)
+}
@@ -0,0 +1,31 @@
+package processing
+
+import (
+	"github.com/imgproxy/imgproxy/v3/imagehash"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// perceptualHashes calculates the pHash and the dHash of the image.
+// For animations, the hashes are calculated for the first frame
+func perceptualHashes(img *vips.Image, frameHeight int) (string, string, error) {
+	frame := img
+
+	if frameHeight < img.Height() {
+		frame = new(vips.Image)
+		defer frame.Clear()
+
+		if err := img.Extract(frame, 0, 0, img.Width(), frameHeight); err != nil {
+			return "", "", err
+		}
+	}
+
+	pixels, width, height, err := frame.GrayscalePixels(imagehash.SampleSize)
+	if err != nil {
+		return "", "", err
+	}
+
+	phash := imagehash.String(imagehash.PHash(pixels, width, height))
+	dhash := imagehash.String(imagehash.DHash(pixels, width, height))
+
+	return phash, dhash, nil
+}
@@ -29,15 +29,23 @@ type pipelineContext struct {
 	hscale float64
 
 	iccImported bool
+
+	secondary *SecondaryImages
+
+	// sourceHash is the hex-encoded SHA256 of the source image data.
+	// It's calculated lazily, use getSourceHash to get it
+	sourceHash string
 }
 
 type pipelineStep func(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error
 type pipeline []pipelineStep
 
-func (p pipeline) Run(ctx context.Context, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+func (p pipeline) Run(ctx context.Context, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData, secondary *SecondaryImages) error {
 	pctx := pipelineContext{
 		ctx: ctx,
 
+		secondary: secondary,
+
 		wscale: 1.0,
 		hscale: 1.0,
 
@@ -102,13 +102,19 @@ func calcScale(width, height int, po *options.ProcessingOptions, imgtype imagety
 	hshrink /= po.ZoomHeight
 
 	if !po.Enlarge && imgtype != imagetype.SVG {
-		if wshrink < 1 {
-			hshrink /= wshrink
-			wshrink = 1
+		// Upscaling allows enlarging the image up to the upscale factor
+		minShrink := 1.0
+		if po.Upscale > 1 {
+			minShrink /= float64(po.Upscale)
 		}
-		if hshrink < 1 {
-			wshrink /= hshrink
-			hshrink = 1
+
+		if wshrink < minShrink {
+			hshrink *= minShrink / wshrink
+			wshrink = minShrink
+		}
+		if hshrink < minShrink {
+			wshrink *= minShrink / hshrink
+			hshrink = minShrink
 		}
 	}
 
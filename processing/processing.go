@@ -10,8 +10,9 @@ import (
 
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
-	"github.com/imgproxy/imgproxy/v3/imath"
+	"github.com/imgproxy/imgproxy/v3/metrics"
 	"github.com/imgproxy/imgproxy/v3/options"
 	"github.com/imgproxy/imgproxy/v3/router"
 	"github.com/imgproxy/imgproxy/v3/security"
@@ -27,12 +28,16 @@ var mainPipeline = pipeline{
 	scale,
 	rotateAndFlip,
 	cropToResult,
+	transform,
 	fixWebpSize,
+	adjustColors,
 	applyFilters,
 	extend,
 	padding,
+	mask,
 	flatten,
 	watermark,
+	overlay,
 	exportColorProfile,
 	finalize,
 }
@@ -42,14 +47,24 @@ func imageTypeGoodForWeb(imgtype imagetype.Type) bool {
 		imgtype != imagetype.BMP
 }
 
-// src  - the source image format
+// sourceMayBeAnimated returns false if the source image is definitely not animated.
+// Most of the PNG images are not animated, so we check for the APNG frames
+func sourceMayBeAnimated(imgdata *imagedata.ImageData) bool {
+	if imgdata.Type == imagetype.PNG {
+		return imagemeta.CountFrames(imagetype.PNG, imgdata.Data) > 1
+	}
+
+	return imgdata.Type.SupportsAnimation()
+}
+
+// src  - the source image
 // dst  - what the user specified
 // want - what we want switch to
-func canSwitchFormat(src, dst, want imagetype.Type) bool {
+func canSwitchFormat(src *imagedata.ImageData, dst, want imagetype.Type) bool {
 	// If the format we want is not supported, we can't switch to it anyway
 	return vips.SupportsSave(want) &&
-		// if src format does't support animation, we can switch to whatever we want
-		(!src.SupportsAnimation() ||
+		// if src doesn't support animation, we can switch to whatever we want
+		(!sourceMayBeAnimated(src) ||
 			// if user specified the format and it doesn't support animation, we can switch to whatever we want
 			(dst != imagetype.Unknown && !dst.SupportsAnimation()) ||
 			// if the format we want supports animation, we can switch in any case
@@ -75,7 +90,7 @@ func getImageSize(img *vips.Image) (int, int) {
 	return width, height
 }
 
-func transformAnimated(ctx context.Context, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+func transformAnimated(ctx context.Context, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData, secondary *SecondaryImages) error {
 	if po.Trim.Enabled {
 		log.Warning("Trim is not supported for animated images")
 		po.Trim.Enabled = false
@@ -88,19 +103,45 @@ func transformAnimated(ctx context.Context, img *vips.Image, po *options.Process
 		return err
 	}
 
-	framesCount := imath.Min(img.Height()/frameHeight, config.MaxAnimationFrames)
+	framesCount, err := security.CheckAnimationFrames(imgWidth, frameHeight, img.Height()/frameHeight, po.SecurityOptions)
+	if err != nil {
+		return err
+	}
 
 	// Double check dimensions because animated image has many frames
-	if err = security.CheckDimensions(imgWidth, frameHeight*framesCount); err != nil {
+	if err = security.CheckDimensions(imgWidth, frameHeight*framesCount, po.SecurityOptions); err != nil {
 		return err
 	}
 
+	prescale := calcAnimationPrescale(img, frameHeight, po, imgdata.Type)
+
 	// Vips 8.8+ supports n-pages and doesn't load the whole animated image on header access
-	if nPages, _ := img.GetIntDefault("n-pages", 0); nPages > framesCount {
-		// Load only the needed frames
-		if err = img.Load(imgdata, 1, 1.0, framesCount); err != nil {
+	if nPages, _ := img.GetIntDefault("n-pages", 0); nPages > framesCount || prescale < 1.0 {
+		srcWidth, srcFrameHeight := imgWidth, frameHeight
+
+		// Load only the needed frames. Animated WebP frames can be also downscaled on load
+		if err = img.Load(imgdata, 1, prescale, framesCount); err != nil {
+			return err
+		}
+
+		imgWidth = img.Width()
+
+		if frameHeight, err = img.GetInt("page-height"); err != nil {
 			return err
 		}
+
+		if imgWidth != srcWidth || frameHeight != srcFrameHeight {
+			// Frames are processed without the source image data,
+			// so the crop should be adjusted to the prescaled frames
+			wpreshrink := float64(srcWidth) / float64(imgWidth)
+			hpreshrink := float64(srcFrameHeight) / float64(frameHeight)
+
+			if animationRotated(img, po) {
+				wpreshrink, hpreshrink = hpreshrink, wpreshrink
+			}
+
+			defer scaleAnimationCrop(po, wpreshrink, hpreshrink)()
+		}
 	}
 
 	delay, err := img.GetIntSliceDefault("delay", nil)
@@ -113,11 +154,36 @@ func transformAnimated(ctx context.Context, img *vips.Image, po *options.Process
 		return err
 	}
 
+	if len(delay) == 0 {
+		delay = make([]int, framesCount)
+		for i := range delay {
+			delay[i] = 40
+		}
+	} else if len(delay) > framesCount {
+		delay = delay[:framesCount]
+	}
+
+	normalizeAnimationDelays(delay, imgdata.Type, po.Format)
+
+	frameIndices, delay := selectAnimationFrames(delay, framesCount, po.FrameStep, po.AnimationSpeed)
+
+	spriteSheet := po.SpriteSheet.Columns > 0
+	if spriteSheet && po.SpriteSheet.MaxFrames > 0 && len(frameIndices) > po.SpriteSheet.MaxFrames {
+		frameIndices = frameIndices[:po.SpriteSheet.MaxFrames]
+	}
+
+	// Sprite sheet frames are processed as separate still images
+	frameSecondary := secondary
 	watermarkEnabled := po.Watermark.Enabled
-	po.Watermark.Enabled = false
-	defer func() { po.Watermark.Enabled = watermarkEnabled }()
 
-	frames := make([]*vips.Image, framesCount)
+	if !spriteSheet {
+		frameSecondary = &SecondaryImages{Mask: secondary.mask()}
+
+		po.Watermark.Enabled = false
+		defer func() { po.Watermark.Enabled = watermarkEnabled }()
+	}
+
+	frames := make([]*vips.Image, len(frameIndices))
 	defer func() {
 		for _, frame := range frames {
 			if frame != nil {
@@ -126,30 +192,48 @@ func transformAnimated(ctx context.Context, img *vips.Image, po *options.Process
 		}
 	}()
 
-	for i := 0; i < framesCount; i++ {
+	for i, frameIndex := range frameIndices {
 		frame := new(vips.Image)
 
-		if err = img.Extract(frame, 0, i*frameHeight, imgWidth, frameHeight); err != nil {
+		if err = img.Extract(frame, 0, frameIndex*frameHeight, imgWidth, frameHeight); err != nil {
 			return err
 		}
 
 		frames[i] = frame
 
-		if err = mainPipeline.Run(ctx, frame, po, nil); err != nil {
+		// Overlays are applied to all the frames at once unless we create a sprite sheet
+		if err = mainPipeline.Run(ctx, frame, po, nil, frameSecondary); err != nil {
 			return err
 		}
+
+		// All the frames have the same size, so it's enough to check the first one
+		if i == 0 {
+			if err = security.CheckAnimationResultDimensions(frame.Width(), frame.Height(), po.SecurityOptions); err != nil {
+				return err
+			}
+		}
+	}
+
+	if spriteSheet {
+		return joinSpriteSheet(ctx, img, frames, po)
 	}
 
 	if err = img.Arrayjoin(frames); err != nil {
 		return err
 	}
 
-	if watermarkEnabled && imagedata.Watermark != nil {
-		if err = applyWatermark(img, imagedata.Watermark, &po.Watermark, framesCount); err != nil {
+	framesCount = len(frames)
+
+	if wmData := imagedata.Watermark(); watermarkEnabled && wmData != nil {
+		if err = applyWatermark(img, wmData, &po.Watermark, framesCount); err != nil {
 			return err
 		}
 	}
 
+	if err = applyOverlays(img, secondary.overlays(), po.Overlays, framesCount); err != nil {
+		return err
+	}
+
 	if err = img.CastUchar(); err != nil {
 		return err
 	}
@@ -158,13 +242,12 @@ func transformAnimated(ctx context.Context, img *vips.Image, po *options.Process
 		return err
 	}
 
-	if len(delay) == 0 {
-		delay = make([]int, framesCount)
-		for i := range delay {
-			delay[i] = 40
+	if po.Format == imagetype.GIF && config.GifOptimizeFrames {
+		if delay, err = deduplicateAnimationFrames(img, frames[0].Height(), delay); err != nil {
+			return err
 		}
-	} else if len(delay) > framesCount {
-		delay = delay[:framesCount]
+
+		framesCount = len(delay)
 	}
 
 	img.SetInt("page-height", frames[0].Height())
@@ -175,9 +258,8 @@ func transformAnimated(ctx context.Context, img *vips.Image, po *options.Process
 	return nil
 }
 
-func saveImageToFitBytes(ctx context.Context, po *options.ProcessingOptions, img *vips.Image) (*imagedata.ImageData, error) {
+func saveImageToFitBytes(ctx context.Context, po *options.ProcessingOptions, img *vips.Image, quality int) (*imagedata.ImageData, error) {
 	var diff float64
-	quality := po.GetQuality()
 
 	for {
 		imgdata, err := img.Save(po.Format, quality)
@@ -201,7 +283,9 @@ func saveImageToFitBytes(ctx context.Context, po *options.ProcessingOptions, img
 	}
 }
 
-func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options.ProcessingOptions) (*imagedata.ImageData, error) {
+// ProcessImage processes the image according to the processing options.
+// secondary are the overlays and mask images required by the processing options
+func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options.ProcessingOptions, secondary *SecondaryImages) (*imagedata.ImageData, error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
@@ -210,18 +294,23 @@ func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options
 	switch {
 	case po.Format == imagetype.Unknown:
 		switch {
-		case po.PreferAvif && canSwitchFormat(imgdata.Type, imagetype.Unknown, imagetype.AVIF):
+		case po.PreferAvif && canSwitchFormat(imgdata, imagetype.Unknown, imagetype.AVIF):
 			po.Format = imagetype.AVIF
-		case po.PreferWebP && canSwitchFormat(imgdata.Type, imagetype.Unknown, imagetype.WEBP):
+		case po.PreferWebP && canSwitchFormat(imgdata, imagetype.Unknown, imagetype.WEBP):
 			po.Format = imagetype.WEBP
 		case vips.SupportsSave(imgdata.Type) && imageTypeGoodForWeb(imgdata.Type):
 			po.Format = imgdata.Type
 		default:
 			po.Format = imagetype.JPEG
 		}
-	case po.EnforceAvif && canSwitchFormat(imgdata.Type, po.Format, imagetype.AVIF):
+
+		// Masked images need transparency
+		if len(po.MaskURL) > 0 && !po.Format.SupportsAlpha() {
+			po.Format = imagetype.PNG
+		}
+	case po.EnforceAvif && canSwitchFormat(imgdata, po.Format, imagetype.AVIF):
 		po.Format = imagetype.AVIF
-	case po.EnforceWebP && canSwitchFormat(imgdata.Type, po.Format, imagetype.WEBP):
+	case po.EnforceWebP && canSwitchFormat(imgdata, po.Format, imagetype.WEBP):
 		po.Format = imagetype.WEBP
 	}
 
@@ -229,46 +318,96 @@ func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options
 		return nil, fmt.Errorf("Can't save %s, probably not supported by your libvips", po.Format)
 	}
 
-	animationSupport := config.MaxAnimationFrames > 1 && imgdata.Type.SupportsAnimation() && po.Format.SupportsAnimation()
+	mayBeAnimated := sourceMayBeAnimated(imgdata)
+	stillFrame := po.StillFrame.Position != options.StillFrameNone && mayBeAnimated
+	animationSupport := !stillFrame && po.SecurityOptions.MaxAnimationFrames > 1 && mayBeAnimated &&
+		(po.Format.SupportsAnimation() || po.SpriteSheet.Columns > 0)
 
 	pages := 1
-	if animationSupport {
+	stillFrameIndex := 0
+
+	switch {
+	case animationSupport:
 		pages = -1
+	case stillFrame:
+		// Don't decode the frames following the selected one
+		stillFrameIndex = calcStillFrameIndex(po, imgdata)
+		pages = stillFrameIndex + 1
 	}
 
 	img := new(vips.Image)
 	defer img.Clear()
 
-	if err := img.Load(imgdata, 1, 1.0, pages); err != nil {
+	finishDecode := metrics.StartStage(ctx, "decode")
+	err := img.Load(imgdata, 1, 1.0, pages)
+	finishDecode(imgdata.Type, po.Format, err)
+	if err != nil {
 		return nil, err
 	}
 
 	originWidth, originHeight := getImageSize(img)
 
-	if animationSupport && img.IsAnimated() {
-		if err := transformAnimated(ctx, img, po, imgdata); err != nil {
+	// libvips is lazy, so the most of the decoding happens here too
+	finishTransform := metrics.StartStage(ctx, "transform")
+	switch {
+	case animationSupport && img.IsAnimated():
+		err = transformAnimated(ctx, img, po, imgdata, secondary)
+	case stillFrame && img.IsAnimated():
+		if err = extractStillFrame(img, po, stillFrameIndex); err == nil {
+			// The frame can't be reloaded from the source data, so we don't pass it
+			err = mainPipeline.Run(ctx, img, po, nil, secondary)
+		}
+	default:
+		err = mainPipeline.Run(ctx, img, po, imgdata, secondary)
+	}
+	if err == nil {
+		err = copyMemoryAndCheckTimeout(ctx, img)
+	}
+	finishTransform(imgdata.Type, po.Format, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Animations are stored as tall strips of frames
+	resultWidth := img.Width()
+	resultHeight, err := img.GetIntDefault("page-height", img.Height())
+	if err != nil {
+		return nil, err
+	}
+
+	var phash, dhash string
+
+	if config.EnablePerceptualHashHeaders {
+		if phash, dhash, err = perceptualHashes(img, resultHeight); err != nil {
 			return nil, err
 		}
-	} else {
-		if err := mainPipeline.Run(ctx, img, po, imgdata); err != nil {
+	}
+
+	var averageColor string
+
+	if config.EnableAverageColorHeader {
+		if averageColor, err = averageColorHex(img); err != nil {
 			return nil, err
 		}
 	}
 
-	if err := copyMemoryAndCheckTimeout(ctx, img); err != nil {
-		return nil, err
+	quality := po.GetQuality()
+
+	if po.AdaptiveQuality > 0 {
+		if quality, err = adaptiveQuality(img, quality, po.AdaptiveQuality); err != nil {
+			return nil, err
+		}
 	}
 
-	var (
-		outData *imagedata.ImageData
-		err     error
-	)
+	var outData *imagedata.ImageData
 
+	finishEncode := metrics.StartStage(ctx, "encode")
 	if po.MaxBytes > 0 && canFitToBytes(po.Format) {
-		outData, err = saveImageToFitBytes(ctx, po, img)
+		outData, err = saveImageToFitBytes(ctx, po, img, quality)
 	} else {
-		outData, err = img.Save(po.Format, po.GetQuality())
+		outData, err = img.Save(po.Format, quality)
 	}
+	finishEncode(imgdata.Type, po.Format, err)
 
 	if err == nil {
 		if outData.Headers == nil {
@@ -276,6 +415,18 @@ func ProcessImage(ctx context.Context, imgdata *imagedata.ImageData, po *options
 		}
 		outData.Headers["X-Origin-Width"] = strconv.Itoa(originWidth)
 		outData.Headers["X-Origin-Height"] = strconv.Itoa(originHeight)
+		outData.Headers["X-Origin-Content-Length"] = strconv.Itoa(len(imgdata.Data))
+		outData.Headers["X-Result-Width"] = strconv.Itoa(resultWidth)
+		outData.Headers["X-Result-Height"] = strconv.Itoa(resultHeight)
+
+		if len(phash) > 0 {
+			outData.Headers["X-Result-PHash"] = phash
+			outData.Headers["X-Result-DHash"] = dhash
+		}
+
+		if len(averageColor) > 0 {
+			outData.Headers["X-Image-Average-Color"] = averageColor
+		}
 	}
 
 	return outData, err
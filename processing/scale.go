@@ -13,7 +13,11 @@ func scale(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions
 			wscale, hscale = hscale, wscale
 		}
 
-		if err := img.Resize(wscale, hscale); err != nil {
+		if po.Upscale > 1 && wscale > 1 && hscale > 1 {
+			if err := img.Upscale(wscale, hscale); err != nil {
+				return err
+			}
+		} else if err := img.Resize(wscale, hscale); err != nil {
 			return err
 		}
 	}
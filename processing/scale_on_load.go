@@ -38,6 +38,58 @@ func calcJpegShink(scale float64, imgtype imagetype.Type) int {
 	return 1
 }
 
+// calcAnimationPrescale calculates the scale the animation frames can be loaded with
+// from the final geometry including crop, dpr, and rotation.
+// Only animated WebP supports scale-on-load; GIF frames are always loaded in full size
+func calcAnimationPrescale(img *vips.Image, frameHeight int, po *options.ProcessingOptions, imgtype imagetype.Type) float64 {
+	if imgtype != imagetype.WEBP {
+		return 1
+	}
+
+	width, height := img.Width(), frameHeight
+
+	if animationRotated(img, po) {
+		width, height = height, width
+	}
+
+	widthToScale := imath.MinNonZero(calcCropSize(width, po.Crop.Width), width)
+	heightToScale := imath.MinNonZero(calcCropSize(height, po.Crop.Height), height)
+
+	wscale, hscale := calcScale(widthToScale, heightToScale, po, imgtype)
+
+	prescale := math.Max(wscale, hscale)
+	if !canScaleOnLoad(imgtype, prescale) {
+		return 1
+	}
+
+	return prescale
+}
+
+func animationRotated(img *vips.Image, po *options.ProcessingOptions) bool {
+	_, _, angle, _ := extractMeta(img, po.Rotate, po.AutoRotate)
+	return (angle+po.Rotate)%180 != 0
+}
+
+// scaleAnimationCrop adjusts the absolute crop size and gravity offsets
+// to the animation frames prescaled on load. It returns the function
+// that restores the original crop options
+func scaleAnimationCrop(po *options.ProcessingOptions, wpreshrink, hpreshrink float64) func() {
+	crop := po.Crop
+
+	if crop.Width >= 1 {
+		po.Crop.Width = float64(imath.Max(1, imath.Shrink(int(crop.Width), wpreshrink)))
+	}
+	if crop.Height >= 1 {
+		po.Crop.Height = float64(imath.Max(1, imath.Shrink(int(crop.Height), hpreshrink)))
+	}
+	if crop.Gravity.Type != options.GravityFocusPoint {
+		po.Crop.Gravity.X /= wpreshrink
+		po.Crop.Gravity.Y /= hpreshrink
+	}
+
+	return func() { po.Crop = crop }
+}
+
 func scaleOnLoad(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
 	prescale := math.Max(pctx.wscale, pctx.hscale)
 
@@ -0,0 +1,39 @@
+package processing
+
+import "github.com/imgproxy/imgproxy/v3/imagedata"
+
+// SecondaryImages are the images used for processing besides the source one
+type SecondaryImages struct {
+	// Overlays are the images of the processing options overlays in the same order
+	Overlays []*imagedata.ImageData
+	// Mask is the image of the processing options mask
+	Mask *imagedata.ImageData
+}
+
+func (si *SecondaryImages) Close() {
+	if si == nil {
+		return
+	}
+
+	for _, d := range si.Overlays {
+		d.Close()
+	}
+
+	if si.Mask != nil {
+		si.Mask.Close()
+	}
+}
+
+func (si *SecondaryImages) overlays() []*imagedata.ImageData {
+	if si == nil {
+		return nil
+	}
+	return si.Overlays
+}
+
+func (si *SecondaryImages) mask() *imagedata.ImageData {
+	if si == nil {
+		return nil
+	}
+	return si.Mask
+}
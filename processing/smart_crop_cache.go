@@ -0,0 +1,110 @@
+package processing
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+)
+
+// Smart crop analysis is expensive, so we cache the found attention centers.
+// The centers are stored relative to the image size, so they can be reused
+// for any size of the same source image
+
+type smartCropCacheEntry struct {
+	key  string
+	x, y float64
+}
+
+var smartCropCache = struct {
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List
+}{
+	items: make(map[string]*list.Element),
+	lru:   list.New(),
+}
+
+func getSourceHash(pctx *pipelineContext, imgdata *imagedata.ImageData) string {
+	if len(pctx.sourceHash) == 0 {
+		sum := sha256.Sum256(imgdata.Data)
+		pctx.sourceHash = hex.EncodeToString(sum[:])
+	}
+
+	return pctx.sourceHash
+}
+
+// smartCropCacheKey returns the key of the smart crop cache entry.
+// Returns an empty string when the cache shouldn't be used
+func smartCropCacheKey(pctx *pipelineContext, po *options.ProcessingOptions, imgdata *imagedata.ImageData, stage string) string {
+	if config.SmartCropCacheSize <= 0 || imgdata == nil {
+		return ""
+	}
+
+	gravity := &po.Gravity
+	if stage == "crop" {
+		gravity = &pctx.cropGravity
+	}
+
+	switch gravity.Type {
+	case options.GravitySmart, options.GravityFace, options.GravityObject:
+	default:
+		return ""
+	}
+
+	// The image we analyze depends on the options that change its geometry
+	// before cropping, so they should be a part of the key
+	return fmt.Sprintf(
+		"%s:%s:%s:%v:%d:%t:%+v:%+v",
+		getSourceHash(pctx, imgdata), stage, gravity.Type, gravity.Classes, po.Rotate, po.AutoRotate, po.Trim, po.Crop,
+	)
+}
+
+func getSmartCropPoint(key string) (float64, float64, bool) {
+	if len(key) == 0 {
+		return 0, 0, false
+	}
+
+	smartCropCache.mu.Lock()
+	defer smartCropCache.mu.Unlock()
+
+	elem, ok := smartCropCache.items[key]
+	if !ok {
+		return 0, 0, false
+	}
+
+	smartCropCache.lru.MoveToFront(elem)
+
+	entry := elem.Value.(*smartCropCacheEntry)
+
+	return entry.x, entry.y, true
+}
+
+func setSmartCropPoint(key string, x, y float64) {
+	if len(key) == 0 {
+		return
+	}
+
+	smartCropCache.mu.Lock()
+	defer smartCropCache.mu.Unlock()
+
+	if elem, ok := smartCropCache.items[key]; ok {
+		entry := elem.Value.(*smartCropCacheEntry)
+		entry.x, entry.y = x, y
+		smartCropCache.lru.MoveToFront(elem)
+		return
+	}
+
+	smartCropCache.items[key] = smartCropCache.lru.PushFront(&smartCropCacheEntry{key: key, x: x, y: y})
+
+	for smartCropCache.lru.Len() > config.SmartCropCacheSize {
+		oldest := smartCropCache.lru.Back()
+		smartCropCache.lru.Remove(oldest)
+		delete(smartCropCache.items, oldest.Value.(*smartCropCacheEntry).key)
+	}
+}
@@ -0,0 +1,48 @@
+package processing
+
+import (
+	"context"
+
+	"github.com/imgproxy/imgproxy/v3/imath"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/security"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// joinSpriteSheet lays the processed animation frames out into a grid.
+// The result is a still image
+func joinSpriteSheet(ctx context.Context, img *vips.Image, frames []*vips.Image, po *options.ProcessingOptions) error {
+	columns := imath.Min(po.SpriteSheet.Columns, len(frames))
+	rows := (len(frames) + columns - 1) / columns
+
+	// The sprite sheet may be much larger than the frames,
+	// so we check its size before allocating it
+	width, height := frames[0].Width()*columns, frames[0].Height()*rows
+
+	if err := security.CheckResultDimensions(width, height, po.SecurityOptions); err != nil {
+		return err
+	}
+
+	if err := security.CheckAnimationResultDimensions(width, height, po.SecurityOptions); err != nil {
+		return err
+	}
+
+	if err := img.ArrayjoinGrid(frames, columns, po.Background); err != nil {
+		return err
+	}
+
+	if err := img.CastUchar(); err != nil {
+		return err
+	}
+
+	if err := copyMemoryAndCheckTimeout(ctx, img); err != nil {
+		return err
+	}
+
+	// The frames metadata is copied to the result, so we need to reset it
+	// to prevent the result from being saved as an animation
+	img.SetInt("page-height", img.Height())
+	img.SetInt("n-pages", 1)
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package processing
+
+import (
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
+	"github.com/imgproxy/imgproxy/v3/imath"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/security"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// calcStillFrameIndex returns the index of the frame selected by po.StillFrame.
+// Frames are counted without decoding the image
+func calcStillFrameIndex(po *options.ProcessingOptions, imgdata *imagedata.ImageData) int {
+	framesCount := imath.Max(imagemeta.CountFrames(imgdata.Type, imgdata.Data), 1)
+
+	switch po.StillFrame.Position {
+	case options.StillFrameMiddle:
+		return framesCount / 2
+	case options.StillFrameLast:
+		return framesCount - 1
+	case options.StillFrameIndex:
+		return imath.Min(po.StillFrame.Index, framesCount-1)
+	}
+
+	return 0
+}
+
+// extractStillFrame replaces the animated image with the single frame.
+// If the image has fewer frames than expected, the last one is used
+func extractStillFrame(img *vips.Image, po *options.ProcessingOptions, index int) error {
+	frameHeight, err := img.GetInt("page-height")
+	if err != nil {
+		return err
+	}
+
+	// All the frames preceding the selected one are decoded too
+	if err = security.CheckDimensions(img.Width(), img.Height(), po.SecurityOptions); err != nil {
+		return err
+	}
+
+	index = imath.Min(index, img.Height()/frameHeight-1)
+
+	if err = img.Crop(0, index*frameHeight, img.Width(), frameHeight); err != nil {
+		return err
+	}
+
+	img.SetInt("page-height", frameHeight)
+	img.SetInt("n-pages", 1)
+
+	return nil
+}
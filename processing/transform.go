@@ -0,0 +1,41 @@
+package processing
+
+import (
+	"math"
+
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// transform applies the arbitrary rotation and the skew to the resulting image.
+// The canvas is expanded to fit the transformed image
+func transform(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
+	if po.RotateFine == 0 && po.Skew.X == 0 && po.Skew.Y == 0 {
+		return nil
+	}
+
+	if err := copyMemoryAndCheckTimeout(pctx.ctx, img); err != nil {
+		return err
+	}
+
+	a, b, c, d := 1.0, 0.0, 0.0, 1.0
+
+	if po.Skew.X != 0 || po.Skew.Y != 0 {
+		b = math.Tan(po.Skew.X * math.Pi / 180)
+		c = math.Tan(po.Skew.Y * math.Pi / 180)
+	}
+
+	if po.RotateFine != 0 {
+		sin, cos := math.Sincos(po.RotateFine * math.Pi / 180)
+
+		// Rotation is applied after the skew
+		a, b, c, d = cos*a-sin*c, cos*b-sin*d, sin*a+cos*c, sin*b+cos*d
+	}
+
+	if err := img.Affine(a, b, c, d, po.Background, !po.Flatten); err != nil {
+		return err
+	}
+
+	return copyMemoryAndCheckTimeout(pctx.ctx, img)
+}
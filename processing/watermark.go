@@ -44,7 +44,7 @@ func prepareWatermark(wm *vips.Image, wmData *imagedata.ImageData, opts *options
 		po.Padding.Bottom = int(opts.Gravity.Y) - po.Padding.Top
 	}
 
-	if err := watermarkPipeline.Run(context.Background(), wm, po, wmData); err != nil {
+	if err := watermarkPipeline.Run(context.Background(), wm, po, wmData, nil); err != nil {
 		return err
 	}
 
@@ -57,7 +57,49 @@ func prepareWatermark(wm *vips.Image, wmData *imagedata.ImageData, opts *options
 	return wm.Embed(imgWidth, imgHeight, left, top)
 }
 
+// applyWatermarkToFirstFrame puts the watermark only on the first frame
+// of the animation, so the rest of the frames don't need compositing
+func applyWatermarkToFirstFrame(img *vips.Image, wmData *imagedata.ImageData, opts *options.WatermarkOptions, framesCount int) error {
+	if err := img.RgbColourspace(); err != nil {
+		return err
+	}
+
+	width := img.Width()
+	frameHeight := img.Height() / framesCount
+
+	first := new(vips.Image)
+	defer first.Clear()
+
+	rest := new(vips.Image)
+	defer rest.Clear()
+
+	if err := img.Extract(first, 0, 0, width, frameHeight); err != nil {
+		return err
+	}
+
+	if err := img.Extract(rest, 0, frameHeight, width, img.Height()-frameHeight); err != nil {
+		return err
+	}
+
+	if err := applyWatermark(first, wmData, opts, 1); err != nil {
+		return err
+	}
+
+	// Compositing may add the alpha channel to the first frame
+	if first.HasAlpha() && !rest.HasAlpha() {
+		if err := rest.EnsureAlpha(); err != nil {
+			return err
+		}
+	}
+
+	return img.Arrayjoin([]*vips.Image{first, rest})
+}
+
 func applyWatermark(img *vips.Image, wmData *imagedata.ImageData, opts *options.WatermarkOptions, framesCount int) error {
+	if framesCount > 1 && opts.FirstFrameOnly {
+		return applyWatermarkToFirstFrame(img, wmData, opts, framesCount)
+	}
+
 	if err := img.RgbColourspace(); err != nil {
 		return err
 	}
@@ -88,9 +130,11 @@ func applyWatermark(img *vips.Image, wmData *imagedata.ImageData, opts *options.
 }
 
 func watermark(pctx *pipelineContext, img *vips.Image, po *options.ProcessingOptions, imgdata *imagedata.ImageData) error {
-	if !po.Watermark.Enabled || imagedata.Watermark == nil {
+	wmData := imagedata.Watermark()
+
+	if !po.Watermark.Enabled || wmData == nil {
 		return nil
 	}
 
-	return applyWatermark(img, imagedata.Watermark, &po.Watermark, 1)
+	return applyWatermark(img, wmData, &po.Watermark, 1)
 }
@@ -1,39 +1,76 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/imgproxy/imgproxy/v3/accesslog"
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/cookies"
 	"github.com/imgproxy/imgproxy/v3/errorreport"
 	"github.com/imgproxy/imgproxy/v3/etag"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
 	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/memory"
 	"github.com/imgproxy/imgproxy/v3/metrics"
 	"github.com/imgproxy/imgproxy/v3/options"
 	"github.com/imgproxy/imgproxy/v3/processing"
+	"github.com/imgproxy/imgproxy/v3/resultcache"
 	"github.com/imgproxy/imgproxy/v3/router"
 	"github.com/imgproxy/imgproxy/v3/security"
+	"github.com/imgproxy/imgproxy/v3/video"
 	"github.com/imgproxy/imgproxy/v3/vips"
 )
 
 var (
+	queueSem      chan struct{}
 	processingSem chan struct{}
 
 	headerVaryValue string
+
+	errRequestsQueueFull   = ierrors.New(429, "Requests queue is full", "Too many requests")
+	errMemoryLimitExceeded = ierrors.New(503, "Memory soft limit exceeded", "Service temporarily unavailable")
+
+	cloudinarySignatureRe = regexp.MustCompile(`^s--([A-Za-z0-9_-]{8})--$`)
 )
 
 func initProcessingHandler() {
+	if config.RequestsQueueSize > 0 {
+		queueSem = make(chan struct{}, config.Concurrency+config.RequestsQueueSize)
+
+		metrics.AddGaugeFunc(
+			"requests_in_progress",
+			"A gauge of the number of requests currently being processed or waiting in the queue.",
+			func() float64 { return float64(len(queueSem)) },
+		)
+	}
+
 	processingSem = make(chan struct{}, config.Concurrency)
 
+	metrics.AddGaugeFunc(
+		"images_in_progress",
+		"A gauge of the number of images currently being processed.",
+		func() float64 { return float64(len(processingSem)) },
+	)
+
+	headerVaryValue = buildHeaderVaryValue()
+}
+
+func buildHeaderVaryValue() string {
 	vary := make([]string, 0)
 
 	if config.EnableWebpDetection || config.EnforceWebp {
@@ -44,13 +81,20 @@ func initProcessingHandler() {
 		vary = append(vary, "DPR", "Viewport-Width", "Width")
 	}
 
-	headerVaryValue = strings.Join(vary, ", ")
+	// In the watermark mode, the same URL responds with different images
+	// depending on the Referer (or Origin when Referer is missing)
+	if config.RefererBlockMode == "watermark" && len(config.AllowedReferers) > 0 {
+		vary = append(vary, "Referer", "Origin")
+	}
+
+	return strings.Join(vary, ", ")
 }
 
-func setCacheControl(rw http.ResponseWriter, originHeaders map[string]string) {
+func setCacheControl(rw http.ResponseWriter, po *options.ProcessingOptions, originHeaders map[string]string) {
 	var cacheControl, expires string
 
-	if config.CacheControlPassthrough && originHeaders != nil {
+	// Cache control set with the processing options overrides the source's cache control headers
+	if config.CacheControlPassthrough && originHeaders != nil && po.CacheControl == (options.CacheControlOptions{}) {
 		if val, ok := originHeaders["Cache-Control"]; ok {
 			cacheControl = val
 		}
@@ -60,8 +104,28 @@ func setCacheControl(rw http.ResponseWriter, originHeaders map[string]string) {
 	}
 
 	if len(cacheControl) == 0 && len(expires) == 0 {
-		cacheControl = fmt.Sprintf("max-age=%d, public", config.TTL)
-		expires = time.Now().Add(time.Second * time.Duration(config.TTL)).Format(http.TimeFormat)
+		ttl := config.TTL
+		if po.CacheControl.TTL > 0 {
+			ttl = po.CacheControl.TTL
+		}
+
+		visibility := "public"
+		if po.CacheControl.Private {
+			visibility = "private"
+		}
+
+		cacheControl = fmt.Sprintf("max-age=%d, %s", ttl, visibility)
+		if po.CacheControl.Immutable {
+			cacheControl += ", immutable"
+		}
+		if config.StaleWhileRevalidate > 0 {
+			cacheControl += fmt.Sprintf(", stale-while-revalidate=%d", config.StaleWhileRevalidate)
+		}
+		if config.StaleIfError > 0 {
+			cacheControl += fmt.Sprintf(", stale-if-error=%d", config.StaleIfError)
+		}
+
+		expires = time.Now().Add(time.Second * time.Duration(ttl)).Format(http.TimeFormat)
 	}
 
 	if len(cacheControl) > 0 {
@@ -72,21 +136,75 @@ func setCacheControl(rw http.ResponseWriter, originHeaders map[string]string) {
 	}
 }
 
+func setLastModified(rw http.ResponseWriter, originHeaders map[string]string) {
+	if config.LastModifiedEnabled {
+		if val, ok := originHeaders["Last-Modified"]; ok && len(val) != 0 {
+			rw.Header().Set("Last-Modified", val)
+		}
+	}
+}
+
 func setVary(rw http.ResponseWriter) {
 	if len(headerVaryValue) > 0 {
-		rw.Header().Set("Vary", headerVaryValue)
+		rw.Header().Add("Vary", headerVaryValue)
 	}
 }
 
-func respondWithImage(reqID string, r *http.Request, rw http.ResponseWriter, statusCode int, resultData *imagedata.ImageData, po *options.ProcessingOptions, originURL string, originData *imagedata.ImageData) {
+// setSurrogateKey sets the header that CDNs use to purge all the variants
+// of the image at once
+func setSurrogateKey(rw http.ResponseWriter, po *options.ProcessingOptions, originURL string) {
+	if len(config.SurrogateKeyHeader) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(config.SurrogateKeySources)+len(po.UsedPresets))
+
+	for _, src := range config.SurrogateKeySources {
+		switch src {
+		case "url":
+			urlHash := sha256.Sum256([]byte(originURL))
+			keys = append(keys, "url-"+hex.EncodeToString(urlHash[:16]))
+		case "host":
+			if u, err := url.Parse(originURL); err == nil && len(u.Host) > 0 {
+				keys = append(keys, "host-"+u.Host)
+			}
+		case "preset":
+			for _, name := range po.UsedPresets {
+				keys = append(keys, "preset-"+name)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	// Fastly uses space-separated keys while Cloudflare uses comma-separated tags
+	sep := " "
+	if strings.EqualFold(config.SurrogateKeyHeader, "Cache-Tag") {
+		sep = ","
+	}
+
+	rw.Header().Set(config.SurrogateKeyHeader, strings.Join(keys, sep))
+}
+
+// setPresetResponseHeaders sets the response headers defined in presets.
+// They are set last so they can override the headers set by imgproxy
+func setPresetResponseHeaders(rw http.ResponseWriter, po *options.ProcessingOptions) {
+	for name, value := range po.ResponseHeaders {
+		rw.Header().Set(name, value)
+	}
+}
+
+func setImageResponseHeaders(rw http.ResponseWriter, imgtype imagetype.Type, po *options.ProcessingOptions, originURL string, originHeaders map[string]string) {
 	var contentDisposition string
 	if len(po.Filename) > 0 {
-		contentDisposition = resultData.Type.ContentDisposition(po.Filename)
+		contentDisposition = imgtype.ContentDisposition(po.Filename, po.ReturnAttachment)
 	} else {
-		contentDisposition = resultData.Type.ContentDispositionFromURL(originURL)
+		contentDisposition = imgtype.ContentDispositionFromURL(originURL, po.ReturnAttachment)
 	}
 
-	rw.Header().Set("Content-Type", resultData.Type.Mime())
+	rw.Header().Set("Content-Type", imgtype.Mime())
 	rw.Header().Set("Content-Disposition", contentDisposition)
 
 	if po.Dpr != 1 {
@@ -100,18 +218,122 @@ func respondWithImage(reqID string, r *http.Request, rw http.ResponseWriter, sta
 		}
 	}
 
-	setCacheControl(rw, originData.Headers)
+	setCacheControl(rw, po, originHeaders)
+	setLastModified(rw, originHeaders)
 	setVary(rw)
+	setSurrogateKey(rw, po, originURL)
+	setPresetResponseHeaders(rw, po)
+}
+
+// setImageSizeHeaders sets the headers with the source and the resulting image sizes.
+// The sizes are taken from the result headers, so they are available for cached results too
+func setImageSizeHeaders(rw http.ResponseWriter, resultData, originData *imagedata.ImageData) {
+	originContentLength := resultData.Headers["X-Origin-Content-Length"]
+	if len(originContentLength) == 0 {
+		originContentLength = strconv.Itoa(len(originData.Data))
+	}
 
-	if config.EnableDebugHeaders {
-		rw.Header().Set("X-Origin-Content-Length", strconv.Itoa(len(originData.Data)))
-		rw.Header().Set("X-Origin-Width", resultData.Headers["X-Origin-Width"])
-		rw.Header().Set("X-Origin-Height", resultData.Headers["X-Origin-Height"])
+	rw.Header().Set("X-Origin-Content-Length", originContentLength)
+	rw.Header().Set("X-Origin-Width", resultData.Headers["X-Origin-Width"])
+	rw.Header().Set("X-Origin-Height", resultData.Headers["X-Origin-Height"])
+
+	if !config.EnableImageSizeHeaders {
+		return
+	}
+
+	for _, name := range []string{"X-Result-Width", "X-Result-Height"} {
+		if value, ok := resultData.Headers[name]; ok {
+			rw.Header().Set(name, value)
+		}
+	}
+}
+
+func setPerceptualHashHeaders(rw http.ResponseWriter, resultData *imagedata.ImageData) {
+	for _, name := range []string{"X-Result-PHash", "X-Result-DHash"} {
+		if value, ok := resultData.Headers[name]; ok {
+			rw.Header().Set(name, value)
+		}
+	}
+}
+
+func respondWithImage(reqID string, r *http.Request, rw http.ResponseWriter, statusCode int, resultData *imagedata.ImageData, po *options.ProcessingOptions, originURL string, originData *imagedata.ImageData) {
+	setImageResponseHeaders(rw, resultData.Type, po, originURL, originData.Headers)
+
+	if config.EnableDebugHeaders || config.EnableImageSizeHeaders {
+		setImageSizeHeaders(rw, resultData, originData)
+	}
+
+	if config.EnablePerceptualHashHeaders {
+		setPerceptualHashHeaders(rw, resultData)
+	}
+
+	if averageColor, ok := resultData.Headers["X-Image-Average-Color"]; ok && config.EnableAverageColorHeader {
+		rw.Header().Set("X-Image-Average-Color", averageColor)
 	}
 
 	rw.Header().Set("Content-Length", strconv.Itoa(len(resultData.Data)))
 	rw.WriteHeader(statusCode)
+
+	stopWriteTimer := router.StartWriteTimer(r)
 	rw.Write(resultData.Data)
+	stopWriteTimer()
+
+	accesslog.Set(r.Context(), "result_format", resultData.Type.String())
+	metrics.ObserveResultFormat(resultData.Type)
+
+	router.LogResponse(
+		reqID, r, statusCode, nil,
+		log.Fields{
+			"image_url":          originURL,
+			"processing_options": po,
+		},
+	)
+}
+
+func respondWithStream(reqID string, r *http.Request, rw http.ResponseWriter, statusCode int, stream *imagedata.Stream, po *options.ProcessingOptions, originURL string) {
+	setImageResponseHeaders(rw, stream.Type, po, originURL, stream.Headers)
+
+	if stream.ContentLength >= 0 {
+		contentLength := stream.ContentLength
+
+		if config.EnableDebugHeaders || config.EnableImageSizeHeaders {
+			rw.Header().Set("X-Origin-Content-Length", strconv.Itoa(stream.ContentLength))
+		}
+
+		rw.Header().Set("Accept-Ranges", "bytes")
+
+		if rangeHeader := r.Header.Get("Range"); len(rangeHeader) > 0 && statusCode == http.StatusOK && ifRangeMatches(r, rw.Header()) {
+			start, length, err := parseRange(rangeHeader, stream.ContentLength)
+
+			switch err {
+			case nil:
+				if err = stream.SetRange(start, length); err != nil {
+					panic(err)
+				}
+
+				rw.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, stream.ContentLength))
+				contentLength = length
+				statusCode = http.StatusPartialContent
+			case errRangeNotSatisfiable:
+				rw.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", stream.ContentLength))
+				rw.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				router.LogResponse(reqID, r, http.StatusRequestedRangeNotSatisfiable, nil)
+				return
+			}
+			// Invalid ranges are ignored
+		}
+
+		rw.Header().Set("Content-Length", strconv.Itoa(contentLength))
+	}
+
+	rw.WriteHeader(statusCode)
+
+	stopWriteTimer := router.StartWriteTimer(r)
+	_, copyErr := stream.WriteTo(rw)
+	stopWriteTimer()
+
+	accesslog.Set(r.Context(), "result_format", stream.Type.String())
+	metrics.ObserveResultFormat(stream.Type)
 
 	router.LogResponse(
 		reqID, r, statusCode, nil,
@@ -120,11 +342,20 @@ func respondWithImage(reqID string, r *http.Request, rw http.ResponseWriter, sta
 			"processing_options": po,
 		},
 	)
+
+	if copyErr != nil {
+		// The response is already partially sent, so the only thing we can do
+		// is to abort it
+		log.Warningf("Could not stream image %s: %s", originURL, copyErr)
+		panic(http.ErrAbortHandler)
+	}
 }
 
 func respondWithNotModified(reqID string, r *http.Request, rw http.ResponseWriter, po *options.ProcessingOptions, originURL string, originHeaders map[string]string) {
-	setCacheControl(rw, originHeaders)
+	setCacheControl(rw, po, originHeaders)
+	setLastModified(rw, originHeaders)
 	setVary(rw)
+	setPresetResponseHeaders(rw, po)
 
 	rw.WriteHeader(304)
 	router.LogResponse(
@@ -136,18 +367,112 @@ func respondWithNotModified(reqID string, r *http.Request, rw http.ResponseWrite
 	)
 }
 
-func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+// isNotModifiedSince checks if the source image wasn't modified since the time
+// provided in the If-Modified-Since request header.
+// If-Modified-Since is ignored when If-None-Match is present
+func isNotModifiedSince(r *http.Request, originHeaders map[string]string) bool {
+	if !config.LastModifiedEnabled || len(r.Header.Get("If-None-Match")) > 0 {
+		return false
+	}
 
-	path := r.RequestURI
-	if queryStart := strings.IndexByte(path, '?'); queryStart >= 0 {
-		path = path[:queryStart]
+	modifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
 	}
 
-	if len(config.PathPrefix) > 0 {
-		path = strings.TrimPrefix(path, config.PathPrefix)
+	lastModified, err := http.ParseTime(originHeaders["Last-Modified"])
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.After(modifiedSince)
+}
+
+// noopOptions are the names of the processing options fields
+// that don't affect the resulting image
+var noopOptions = map[string]struct{}{
+	"Format":                {},
+	"SkipProcessingFormats": {},
+	"CacheBuster":           {},
+	"Filename":              {},
+	"ReturnAttachment":      {},
+	"CacheControl":          {},
+	"Raw":                   {},
+	"SecurityOptions":       {},
+	"ResponseHeaders":       {},
+	"UsedPresets":           {},
+}
+
+// isNoopProcessing checks if processing of the image with the provided options
+// will result in the same image
+func isNoopProcessing(po *options.ProcessingOptions) bool {
+	for _, e := range po.Diff() {
+		if _, ok := noopOptions[e.Name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func shouldSkipProcessing(po *options.ProcessingOptions, imgtype imagetype.Type) bool {
+	if imgtype != po.Format && po.Format != imagetype.Unknown {
+		return false
 	}
 
+	// Don't process SVG
+	if imgtype == imagetype.SVG {
+		return true
+	}
+
+	for _, f := range po.SkipProcessingFormats {
+		if f == imgtype {
+			return true
+		}
+	}
+
+	return config.SkipNoopProcessing && isNoopProcessing(po)
+}
+
+// splitPathPrefixPresets finds the longest path prefix that has
+// the default presets configured and trims it from the path.
+// It returns the trimmed path, the matched prefix, and its presets
+func splitPathPrefixPresets(path string) (string, string, []string) {
+	var matched string
+
+	for prefix := range config.PathPrefixPresets {
+		if len(prefix) > len(matched) && strings.HasPrefix(path, prefix+"/") {
+			matched = prefix
+		}
+	}
+
+	if len(matched) == 0 {
+		return path, "", nil
+	}
+
+	return strings.TrimPrefix(path, matched), matched, config.PathPrefixPresets[matched]
+}
+
+// trimCompatPathPrefix checks if the path should be parsed as a third-party
+// compatible one and trims the path prefix from it.
+// When the prefix is empty, all the paths are considered compatible
+func trimCompatPathPrefix(path string, enabled bool, prefix string) (string, bool) {
+	if !enabled {
+		return path, false
+	}
+
+	if len(prefix) == 0 {
+		return path, true
+	}
+
+	if strings.HasPrefix(path, prefix+"/") {
+		return strings.TrimPrefix(path, prefix), true
+	}
+
+	return path, false
+}
+
+func parseThumborProcessingPath(ctx context.Context, path string, header http.Header) (*options.ProcessingOptions, string) {
 	path = strings.TrimPrefix(path, "/")
 	signature := ""
 
@@ -158,19 +483,140 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 		panic(ierrors.New(404, fmt.Sprintf("Invalid path: %s", path), "Invalid URL"))
 	}
 
-	if err := security.VerifySignature(signature, path); err != nil {
+	if err := security.VerifyThumborSignature(signature, path); err != nil {
 		panic(ierrors.New(403, err.Error(), "Forbidden"))
 	}
 
-	po, imageURL, err := options.ParsePath(path, r.Header)
+	po, imageURL, err := func() (*options.ProcessingOptions, string, error) {
+		defer metrics.StartParsingSegment(ctx)()
+		return options.ParseThumborPath(path, header)
+	}()
+	if err != nil {
+		panic(err)
+	}
+
+	return po, imageURL
+}
+
+func parseCloudinaryProcessingPath(ctx context.Context, path string, header http.Header) (*options.ProcessingOptions, string) {
+	path = strings.TrimPrefix(path, "/")
+	signature := ""
+
+	// The signature is optional and looks like s--XXXXXXXX--
+	if signatureEnd := strings.IndexByte(path, '/'); signatureEnd > 0 {
+		if m := cloudinarySignatureRe.FindStringSubmatch(path[:signatureEnd]); m != nil {
+			signature = m[1]
+			path = path[signatureEnd+1:]
+		}
+	}
+
+	if err := security.VerifyCloudinarySignature(signature, path); err != nil {
+		panic(ierrors.New(403, err.Error(), "Forbidden"))
+	}
+
+	po, imageURL, err := func() (*options.ProcessingOptions, string, error) {
+		defer metrics.StartParsingSegment(ctx)()
+		return options.ParseCloudinaryPath(path, header)
+	}()
+	if err != nil {
+		panic(err)
+	}
+
+	return po, imageURL
+}
+
+// parseProcessingPath verifies the signature of the path and parses it
+// to the processing options and the source image URL.
+// The path should not include the path prefix
+func parseProcessingPath(ctx context.Context, path string, header http.Header) (*options.ProcessingOptions, string) {
+	if thumborPath, ok := trimCompatPathPrefix(path, config.EnableThumborCompat, config.ThumborPathPrefix); ok {
+		return parseThumborProcessingPath(ctx, thumborPath, header)
+	}
+
+	if cloudinaryPath, ok := trimCompatPathPrefix(path, config.EnableCloudinaryCompat, config.CloudinaryPathPrefix); ok {
+		return parseCloudinaryProcessingPath(ctx, cloudinaryPath, header)
+	}
+
+	path, presetsPrefix, defaultPresets := splitPathPrefixPresets(path)
+
+	path = strings.TrimPrefix(path, "/")
+	signature := ""
+
+	if signatureEnd := strings.IndexByte(path, '/'); signatureEnd > 0 {
+		signature = path[:signatureEnd]
+		path = path[signatureEnd:]
+	} else {
+		panic(ierrors.New(404, fmt.Sprintf("Invalid path: %s", path), "Invalid URL"))
+	}
+
+	var claims *security.Claims
+
+	// The presets path prefix is a part of the signed path,
+	// so the signed URL can't be moved to another prefix with weaker presets
+	if security.IsSignatureV2(signature) {
+		var err error
+		if claims, path, err = security.VerifySignatureV2(signature, presetsPrefix, path); err != nil {
+			panic(ierrors.New(403, err.Error(), "Forbidden"))
+		}
+	} else if err := security.VerifySignature(signature, presetsPrefix+path); err != nil {
+		// Presets are defined by the admin so they are safe to use unsigned
+		if !config.AllowUnsignedPresets || !options.IsPresetsOnlyPath(path) {
+			panic(ierrors.New(403, err.Error(), "Forbidden"))
+		}
+	}
+
+	po, imageURL, err := func() (*options.ProcessingOptions, string, error) {
+		defer metrics.StartParsingSegment(ctx)()
+		return options.ParsePathWithDefaultPresets(path, header, defaultPresets)
+	}()
 	if err != nil {
 		panic(err)
 	}
 
+	if claims != nil {
+		if len(claims.Options) > 0 {
+			if err := po.CheckAllowedURLOptions(claims.Options); err != nil {
+				panic(ierrors.New(403, err.Error(), "Forbidden"))
+			}
+		}
+
+		if err := claims.VerifySourceURL(imageURL); err != nil {
+			panic(ierrors.New(403, err.Error(), "Forbidden"))
+		}
+
+		for _, ov := range po.Overlays {
+			if err := claims.VerifySourceURL(ov.URL); err != nil {
+				panic(ierrors.New(403, err.Error(), "Forbidden"))
+			}
+		}
+
+		if len(po.MaskURL) > 0 {
+			if err := claims.VerifySourceURL(po.MaskURL); err != nil {
+				panic(ierrors.New(403, err.Error(), "Forbidden"))
+			}
+		}
+	}
+
+	return po, imageURL
+}
+
+// checkProcessingRequest checks that the source URL is allowed
+// and the resulting format is supported
+func checkProcessingRequest(po *options.ProcessingOptions, imageURL string) {
 	if !security.VerifySourceURL(imageURL) {
 		panic(ierrors.New(404, fmt.Sprintf("Source URL is not allowed: %s", imageURL), "Invalid source"))
 	}
 
+	for _, ov := range po.Overlays {
+		if !security.VerifySourceURL(ov.URL) {
+			panic(ierrors.New(404, fmt.Sprintf("Overlay URL is not allowed: %s", ov.URL), "Invalid source"))
+		}
+	}
+
+	if len(po.MaskURL) > 0 && !security.VerifySourceURL(po.MaskURL) {
+		panic(ierrors.New(404, fmt.Sprintf("Mask URL is not allowed: %s", po.MaskURL), "Invalid source"))
+	}
+
 	// SVG is a special case. Though saving to svg is not supported, SVG->SVG is.
 	if !vips.SupportsSave(po.Format) && po.Format != imagetype.Unknown && po.Format != imagetype.SVG {
 		panic(ierrors.New(
@@ -179,9 +625,116 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 			"Invalid URL",
 		))
 	}
+}
+
+func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	path := r.RequestURI
+	if queryStart := strings.IndexByte(path, '?'); queryStart >= 0 {
+		path = path[:queryStart]
+	}
+
+	if len(config.PathPrefix) > 0 {
+		path = strings.TrimPrefix(path, config.PathPrefix)
+	}
+
+	po, imageURL := parseProcessingPath(ctx, path, r.Header)
+
+	accesslog.Set(ctx, "source_url", imageURL)
+	accesslog.Set(ctx, "processing_options", po)
+
+	errorreport.SetMetadata(ctx, "source_url", imageURL)
+	errorreport.SetMetadata(ctx, "processing_options", po)
+
+	metrics.ObserveOptionsUsage(po.UsedURLOptions(), po.UsedPresets)
+
+	sourceURL, isVideo := video.ParseSourceURL(imageURL)
+
+	checkProcessingRequest(po, sourceURL)
+
+	if !security.VerifyReferer(r.Header) {
+		if config.RefererBlockMode != "watermark" {
+			panic(ierrors.New(403, fmt.Sprintf("Referer is not allowed: %s", r.Header.Get("Referer")), "Forbidden"))
+		}
+
+		// Hotlinked images get the watermark no matter what options are requested
+		po.Watermark.Enabled = true
+		po.Watermark.Opacity = 1
+		po.Watermark.FirstFrameOnly = false
+		po.Raw = false
+		po.SkipProcessingFormats = nil
+	}
+
+	if isVideo && !config.EnableVideoSources {
+		panic(video.ErrVideoSourcesDisabled)
+	}
+
+	if po.Raw {
+		if !config.AllowRaw {
+			panic(ierrors.New(403, "Raw mode is not allowed", "Forbidden"))
+		}
+
+		if isVideo {
+			panic(ierrors.New(422, "Raw mode is not supported for video sources", "Invalid URL"))
+		}
+
+		streamOriginImage(reqID, r, rw, po, imageURL)
+		return
+	}
+
+	var (
+		cacheKey    string
+		staleResult *resultcache.Entry
+	)
+
+	if resultcache.Enabled() {
+		cacheKey = resultcache.Key(imageURL, po)
+
+		if !isResultCacheRefresh(ctx) {
+			if entry := getCachedResult(ctx, cacheKey); entry != nil {
+				switch {
+				case entry.Fresh():
+					accesslog.Set(ctx, "cache_status", "hit")
+					respondWithCachedResult(reqID, r, rw, entry, po, imageURL)
+					return
+				case entry.CanServeStale(config.StaleWhileRevalidate):
+					accesslog.Set(ctx, "cache_status", "stale")
+					refreshCachedResult(reqID, r, cacheKey)
+					respondWithCachedResult(reqID, r, rw, entry, po, imageURL)
+					return
+				case entry.CanServeStale(config.StaleIfError):
+					staleResult = entry
+				}
+			}
+		}
+
+		accesslog.Set(ctx, "cache_status", "miss")
+	}
+
+	if staleResult != nil {
+		defer func() {
+			rerr := recover()
+			if rerr == nil {
+				return
+			}
+
+			if rerr == http.ErrAbortHandler {
+				panic(rerr)
+			}
+
+			log.Warningf("Could not process image %s. Using stale cached result. %v", imageURL, rerr)
+			accesslog.Set(ctx, "cache_status", "stale")
+			respondWithCachedResult(reqID, r, rw, staleResult, po, imageURL)
+		}()
+	}
 
 	imgRequestHeader := make(http.Header)
 
+	if config.ForwardRequestID {
+		imgRequestHeader.Set(router.RequestIDHeader, reqID)
+	}
+
 	var etagHandler etag.Handler
 
 	if config.ETagEnabled {
@@ -194,37 +747,80 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// The heavy part start here, so we need to restrict concurrency
-	select {
-	case processingSem <- struct{}{}:
-	case <-ctx.Done():
-		// We don't actually need to check timeout here,
-		// but it's an easy way to check if this is an actual timeout
-		// or the request was cancelled
-		router.CheckTimeout(ctx)
+	if config.LastModifiedEnabled && len(r.Header.Get("If-None-Match")) == 0 {
+		if modifiedSince := r.Header.Get("If-Modified-Since"); len(modifiedSince) != 0 {
+			imgRequestHeader.Set("If-Modified-Since", modifiedSince)
+		}
 	}
-	defer func() { <-processingSem }()
+
+	// The heavy part start here, so we need to restrict concurrency
+	defer acquireProcessingSlot(ctx, rw)()
 
 	statusCode := http.StatusOK
 
-	originData, err := func() (*imagedata.ImageData, error) {
+	// Images that don't need processing are streamed to the client
+	// without reading them into memory
+	canStream := func(imgtype imagetype.Type) bool {
+		return shouldSkipProcessing(po, imgtype)
+	}
+
+	originData, originStream, err := func() (*imagedata.ImageData, *imagedata.Stream, error) {
 		defer metrics.StartDownloadingSegment(ctx)()
 
 		var cookieJar *cookiejar.Jar
 
 		if config.CookiePassthrough {
+			var err error
 			if cookieJar, err = cookies.JarFromRequest(r); err != nil {
 				panic(err)
 			}
 		}
 
-		return imagedata.Download(imageURL, "source image", imgRequestHeader, cookieJar)
+		finishDownload := metrics.StartStage(ctx, "download")
+
+		var (
+			imgdata *imagedata.ImageData
+			stream  *imagedata.Stream
+			err     error
+		)
+
+		if isVideo {
+			imgdata, err = video.Extract(ctx, sourceURL, imgRequestHeader, cookieJar, po.SecurityOptions, po.VideoSegment.Start, po.VideoSegment.Duration)
+		} else {
+			imgdata, stream, err = imagedata.DownloadOrStream(imageURL, "source image", imgRequestHeader, cookieJar, po.SecurityOptions, canStream)
+		}
+
+		sourceFormat := imagetype.Unknown
+		switch {
+		case imgdata != nil:
+			sourceFormat = imgdata.Type
+			accesslog.Set(ctx, "bytes_in", len(imgdata.Data))
+		case stream != nil:
+			sourceFormat = stream.Type
+			if stream.ContentLength >= 0 {
+				accesslog.Set(ctx, "bytes_in", stream.ContentLength)
+			}
+		}
+
+		if sourceFormat != imagetype.Unknown {
+			accesslog.Set(ctx, "source_format", sourceFormat.String())
+		}
+
+		finishDownload(sourceFormat, po.Format, err)
+
+		return imgdata, stream, err
 	}()
 
 	if err == nil {
-		defer originData.Close()
-	} else if nmErr, ok := err.(*imagedata.ErrorNotModified); ok && config.ETagEnabled {
-		rw.Header().Set("ETag", etagHandler.GenerateExpectedETag())
+		if originStream != nil {
+			defer originStream.Close()
+		} else {
+			defer originData.Close()
+		}
+	} else if nmErr, ok := err.(*imagedata.ErrorNotModified); ok && (config.ETagEnabled || config.LastModifiedEnabled) {
+		if config.ETagEnabled && len(etagHandler.ImageEtagExpected()) != 0 {
+			rw.Header().Set("ETag", etagHandler.GenerateExpectedETag())
+		}
 		respondWithNotModified(reqID, r, rw, po, imageURL, nmErr.Headers)
 		return
 	} else {
@@ -233,11 +829,18 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 			statusCode = ierr.StatusCode
 		}
 		if config.ReportDownloadingErrors && (!ierrok || ierr.Unexpected) {
-			errorreport.Report(err, r)
+			errorreport.Report(err, reqID, r)
 		}
 
 		metrics.SendError(ctx, "download", err)
 
+		if staleResult != nil {
+			log.Warningf("Could not load image %s. Using stale cached result. %s", imageURL, err.Error())
+			accesslog.Set(ctx, "cache_status", "stale")
+			respondWithCachedResult(reqID, r, rw, staleResult, po, imageURL)
+			return
+		}
+
 		if imagedata.FallbackImage == nil {
 			panic(err)
 		}
@@ -251,6 +854,31 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 
 	router.CheckTimeout(ctx)
 
+	if originStream != nil {
+		if config.ETagEnabled {
+			// We can't calculate the hash of the streamed image data,
+			// so the ETag is sent only when the source image has one
+			if imgEtag := originStream.Headers["ETag"]; len(imgEtag) > 0 {
+				imgEtagMatch := etagHandler.SetActualImageETag(imgEtag)
+
+				rw.Header().Set("ETag", etagHandler.GenerateActualETag())
+
+				if imgEtagMatch && etagHandler.ProcessingOptionsMatch() {
+					respondWithNotModified(reqID, r, rw, po, imageURL, originStream.Headers)
+					return
+				}
+			}
+		}
+
+		if isNotModifiedSince(r, originStream.Headers) {
+			respondWithNotModified(reqID, r, rw, po, imageURL, originStream.Headers)
+			return
+		}
+
+		respondWithStream(reqID, r, rw, statusCode, originStream, po, imageURL)
+		return
+	}
+
 	if config.ETagEnabled && statusCode == http.StatusOK {
 		imgDataMatch := etagHandler.SetActualImageData(originData)
 
@@ -262,23 +890,17 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	router.CheckTimeout(ctx)
+	if statusCode == http.StatusOK && isNotModifiedSince(r, originData.Headers) {
+		respondWithNotModified(reqID, r, rw, po, imageURL, originData.Headers)
+		return
+	}
 
-	if originData.Type == po.Format || po.Format == imagetype.Unknown {
-		// Don't process SVG
-		if originData.Type == imagetype.SVG {
-			respondWithImage(reqID, r, rw, statusCode, originData, po, imageURL, originData)
-			return
-		}
+	router.CheckTimeout(ctx)
 
-		if len(po.SkipProcessingFormats) > 0 {
-			for _, f := range po.SkipProcessingFormats {
-				if f == originData.Type {
-					respondWithImage(reqID, r, rw, statusCode, originData, po, imageURL, originData)
-					return
-				}
-			}
-		}
+	// Fallback image may not require processing too
+	if shouldSkipProcessing(po, originData.Type) {
+		respondWithImage(reqID, r, rw, statusCode, originData, po, imageURL, originData)
+		return
 	}
 
 	if !vips.SupportsLoad(originData.Type) {
@@ -294,9 +916,24 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 		panic(ierrors.New(422, "Resulting image format is not supported: svg", "Invalid URL"))
 	}
 
+	checkMemorySoftLimit(ctx, rw, originData)
+
+	secondaryImages, err := downloadSecondaryImages(ctx, po, reqID)
+	if err != nil {
+		metrics.SendError(ctx, "download", err)
+		panic(err)
+	}
+	defer secondaryImages.Close()
+
+	router.CheckTimeout(ctx)
+
 	resultData, err := func() (*imagedata.ImageData, error) {
 		defer metrics.StartProcessingSegment(ctx)()
-		return processing.ProcessImage(ctx, originData, po)
+
+		ctx, cancel := router.WithStageTimeout(ctx, config.ProcessingTimeout)
+		defer cancel()
+
+		return processing.ProcessImage(ctx, originData, po, secondaryImages)
 	}()
 	if err != nil {
 		metrics.SendError(ctx, "processing", err)
@@ -306,5 +943,120 @@ func handleProcessing(reqID string, rw http.ResponseWriter, r *http.Request) {
 
 	router.CheckTimeout(ctx)
 
+	if len(cacheKey) > 0 && statusCode == http.StatusOK {
+		storeCachedResult(cacheKey, resultData, originData.Headers, rw.Header().Get("ETag"))
+	}
+
 	respondWithImage(reqID, r, rw, statusCode, resultData, po, imageURL, originData)
 }
+
+// downloadSecondaryImages downloads the overlays and the mask images
+// required by the processing options.
+// The conditional headers of the source image request are not sent
+// with these requests, as the overlays and the mask have their own ETags
+func downloadSecondaryImages(ctx context.Context, po *options.ProcessingOptions, reqID string) (*processing.SecondaryImages, error) {
+	if len(po.Overlays) == 0 && len(po.MaskURL) == 0 {
+		return nil, nil
+	}
+
+	defer metrics.StartDownloadingSegment(ctx)()
+
+	header := make(http.Header)
+
+	if config.ForwardRequestID {
+		header.Set(router.RequestIDHeader, reqID)
+	}
+
+	si := &processing.SecondaryImages{
+		Overlays: make([]*imagedata.ImageData, 0, len(po.Overlays)),
+	}
+
+	for _, ov := range po.Overlays {
+		data, _, err := imagedata.DownloadOrStream(ov.URL, "overlay image", header, nil, po.SecurityOptions, nil)
+		if err != nil {
+			si.Close()
+			return nil, err
+		}
+
+		si.Overlays = append(si.Overlays, data)
+	}
+
+	if len(po.MaskURL) > 0 {
+		data, _, err := imagedata.DownloadOrStream(po.MaskURL, "mask image", header, nil, po.SecurityOptions, nil)
+		if err != nil {
+			si.Close()
+			return nil, err
+		}
+
+		si.Mask = data
+	}
+
+	return si, nil
+}
+
+// acquireProcessingSlot puts the request to the requests queue and waits
+// for the processing slot. It returns the function that releases both
+func acquireProcessingSlot(ctx context.Context, rw http.ResponseWriter) func() {
+	// When the queue is full, we reject the request right away
+	// instead of letting latency and memory usage grow
+	if queueSem != nil {
+		select {
+		case queueSem <- struct{}{}:
+		default:
+			rw.Header().Set("Retry-After", strconv.Itoa(config.RequestsQueueRetryAfter))
+			metrics.SendError(ctx, "queue", errRequestsQueueFull)
+			panic(errRequestsQueueFull)
+		}
+	}
+
+	select {
+	case processingSem <- struct{}{}:
+	case <-ctx.Done():
+		if queueSem != nil {
+			<-queueSem
+		}
+		// We don't actually need to check timeout here,
+		// but it's an easy way to check if this is an actual timeout
+		// or the request was cancelled
+		router.CheckTimeout(ctx)
+	}
+
+	return func() {
+		<-processingSem
+		if queueSem != nil {
+			<-queueSem
+		}
+	}
+}
+
+// checkMemorySoftLimit waits until the memory usage drops below the soft limit
+// before processing the large image and rejects the request on timeout
+func checkMemorySoftLimit(ctx context.Context, rw http.ResponseWriter, imgdata *imagedata.ImageData) {
+	if config.MemorySoftLimit <= 0 || !isLargeImage(imgdata) {
+		return
+	}
+
+	if !memory.WaitForSoftLimit(ctx, time.Duration(config.MemorySoftLimitWait)*time.Second) {
+		router.CheckTimeout(ctx)
+
+		rw.Header().Set("Retry-After", strconv.Itoa(config.RequestsQueueRetryAfter))
+		metrics.SendError(ctx, "memory_limit", errMemoryLimitExceeded)
+		panic(errMemoryLimitExceeded)
+	}
+}
+
+// isLargeImage checks if the image resolution is high enough to be a subject
+// of the memory soft limit
+func isLargeImage(imgdata *imagedata.ImageData) bool {
+	if config.MemorySoftLimitMinResolution <= 0 {
+		return true
+	}
+
+	meta, err := imagemeta.DecodeMeta(bytes.NewReader(imgdata.Data))
+	if err != nil {
+		// We can't say for sure, so consider the image large
+		return true
+	}
+
+	return meta.Width()*meta.Height() >= config.MemorySoftLimitMinResolution
+}
@@ -2,16 +2,23 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/imgproxy/imgproxy/v3/accesslog"
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/config/configurators"
 	"github.com/imgproxy/imgproxy/v3/etag"
@@ -19,10 +26,14 @@ import (
 	"github.com/imgproxy/imgproxy/v3/imagemeta"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
 	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/resultcache"
 	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
 	"github.com/imgproxy/imgproxy/v3/vips"
 	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -44,6 +55,8 @@ func (s *ProcessingHandlerTestSuite) SetupSuite() {
 
 	initialize()
 
+	config.EnableInfoEndpoint = true
+	config.EnableValidateEndpoint = true
 	s.router = buildRouter()
 }
 
@@ -56,6 +69,7 @@ func (s *ProcessingHandlerTestSuite) SetupTest() {
 	// We don't need config.LocalFileSystemRoot anymore as it is used
 	// only during initialization
 	config.Reset()
+	config.AllowLoopbackSourceAddresses = true
 }
 
 func (s *ProcessingHandlerTestSuite) send(path string, header ...http.Header) *httptest.ResponseRecorder {
@@ -126,6 +140,71 @@ func (s *ProcessingHandlerTestSuite) TestRequest() {
 	assert.Equal(s.T(), 4, meta.Height())
 }
 
+func (s *ProcessingHandlerTestSuite) TestRotateNegativeAngle() {
+	rw := s.send("/unsafe/rs:fill:4:6/rot:270/plain/local:///test1.png")
+	res := rw.Result()
+
+	require.Equal(s.T(), 200, res.StatusCode)
+
+	expected, err := imagemeta.DecodeMeta(res.Body)
+	require.Nil(s.T(), err)
+
+	rw = s.send("/unsafe/rs:fill:4:6/rot:-90/plain/local:///test1.png")
+	res = rw.Result()
+
+	require.Equal(s.T(), 200, res.StatusCode)
+
+	meta, err := imagemeta.DecodeMeta(res.Body)
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), expected.Width(), meta.Width())
+	assert.Equal(s.T(), expected.Height(), meta.Height())
+}
+
+func (s *ProcessingHandlerTestSuite) TestImageSizeHeaders() {
+	config.EnableImageSizeHeaders = true
+
+	rw := s.send("/unsafe/rs:fill:4:6/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), "10", res.Header.Get("X-Origin-Width"))
+	assert.Equal(s.T(), "10", res.Header.Get("X-Origin-Height"))
+	assert.Equal(s.T(), strconv.Itoa(len(s.readTestFile("test1.png"))), res.Header.Get("X-Origin-Content-Length"))
+	assert.Equal(s.T(), "4", res.Header.Get("X-Result-Width"))
+	assert.Equal(s.T(), "6", res.Header.Get("X-Result-Height"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestImageSizeHeadersDisabled() {
+	rw := s.send("/unsafe/rs:fill:4:6/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Empty(s.T(), res.Header.Get("X-Origin-Width"))
+	assert.Empty(s.T(), res.Header.Get("X-Result-Width"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestPerceptualHashHeaders() {
+	config.EnablePerceptualHashHeaders = true
+
+	rw := s.send("/unsafe/rs:fill:4:6/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Regexp(s.T(), "^[0-9a-f]{16}$", res.Header.Get("X-Result-PHash"))
+	assert.Regexp(s.T(), "^[0-9a-f]{16}$", res.Header.Get("X-Result-DHash"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestAverageColorHeader() {
+	config.EnableAverageColorHeader = true
+
+	rw := s.send("/unsafe/rs:fill:4:6/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Regexp(s.T(), "^#[0-9a-f]{6}$", res.Header.Get("X-Image-Average-Color"))
+}
+
 func (s *ProcessingHandlerTestSuite) TestSignatureValidationFailure() {
 	config.Keys = [][]byte{[]byte("test-key")}
 	config.Salts = [][]byte{[]byte("test-salt")}
@@ -136,6 +215,24 @@ func (s *ProcessingHandlerTestSuite) TestSignatureValidationFailure() {
 	assert.Equal(s.T(), 403, res.StatusCode)
 }
 
+func (s *ProcessingHandlerTestSuite) TestSignatureValidationUnsignedPresets() {
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+	config.AllowUnsignedPresets = true
+
+	require.Nil(s.T(), options.ParsePresets([]string{"test_unsigned=rs:fill:4:4"}))
+
+	rw := s.send("/unsafe/pr:test_unsigned/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+
+	rw = s.send("/unsafe/pr:test_unsigned/q:50/plain/local:///test1.png")
+	res = rw.Result()
+
+	assert.Equal(s.T(), 403, res.StatusCode)
+}
+
 func (s *ProcessingHandlerTestSuite) TestSignatureValidationSuccess() {
 	config.Keys = [][]byte{[]byte("test-key")}
 	config.Salts = [][]byte{[]byte("test-salt")}
@@ -254,6 +351,101 @@ func (s *ProcessingHandlerTestSuite) TestSkipProcessingPO() {
 	assert.True(s.T(), bytes.Equal(expected, actual))
 }
 
+func (s *ProcessingHandlerTestSuite) TestSkipNoopProcessing() {
+	config.SkipNoopProcessing = true
+
+	rw := s.send("/unsafe/cb:123/plain/local:///test1.png@png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+
+	actual := s.readBody(res)
+	expected := s.readTestFile("test1.png")
+
+	assert.True(s.T(), bytes.Equal(expected, actual))
+
+	rw = s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png")
+	res = rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+
+	actual = s.readBody(res)
+
+	assert.False(s.T(), bytes.Equal(expected, actual))
+}
+
+func (s *ProcessingHandlerTestSuite) TestSkipProcessingContentLength() {
+	rw := s.send("/unsafe/rs:fill:4:4/skp:png/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+
+	expected := s.readTestFile("test1.png")
+
+	assert.Equal(s.T(), strconv.Itoa(len(expected)), res.Header.Get("Content-Length"))
+	assert.Equal(s.T(), "image/png", res.Header.Get("Content-Type"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestSkipProcessingRange() {
+	header := make(http.Header)
+	header.Set("Range", "bytes=10-19")
+
+	rw := s.send("/unsafe/rs:fill:4:4/skp:png/plain/local:///test1.png", header)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 206, res.StatusCode)
+
+	expected := s.readTestFile("test1.png")
+
+	assert.Equal(s.T(), fmt.Sprintf("bytes 10-19/%d", len(expected)), res.Header.Get("Content-Range"))
+	assert.True(s.T(), bytes.Equal(expected[10:20], s.readBody(res)))
+}
+
+func (s *ProcessingHandlerTestSuite) TestSkipProcessingIfRange() {
+	config.ETagEnabled = true
+
+	rw := s.send("/unsafe/rs:fill:4:4/skp:png/plain/local:///test1.png")
+	res := rw.Result()
+
+	require.Equal(s.T(), 200, res.StatusCode)
+
+	etag := res.Header.Get("ETag")
+	require.NotEmpty(s.T(), etag)
+
+	expected := s.readTestFile("test1.png")
+
+	header := make(http.Header)
+	header.Set("Range", "bytes=10-19")
+	header.Set("If-Range", etag)
+
+	rw = s.send("/unsafe/rs:fill:4:4/skp:png/plain/local:///test1.png", header)
+	res = rw.Result()
+
+	assert.Equal(s.T(), 206, res.StatusCode)
+	assert.True(s.T(), bytes.Equal(expected[10:20], s.readBody(res)))
+
+	for _, ifRange := range []string{`"mismatch"`, "W/" + etag, "Wed, 21 Oct 2015 07:28:00 GMT"} {
+		header.Set("If-Range", ifRange)
+
+		rw = s.send("/unsafe/rs:fill:4:4/skp:png/plain/local:///test1.png", header)
+		res = rw.Result()
+
+		assert.Equal(s.T(), 200, res.StatusCode, ifRange)
+		assert.Empty(s.T(), res.Header.Get("Content-Range"), ifRange)
+		assert.True(s.T(), bytes.Equal(expected, s.readBody(res)), ifRange)
+	}
+}
+
+func (s *ProcessingHandlerTestSuite) TestSkipProcessingRangeNotSatisfiable() {
+	header := make(http.Header)
+	header.Set("Range", "bytes=100000000-")
+
+	rw := s.send("/unsafe/rs:fill:4:4/skp:png/plain/local:///test1.png", header)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 416, res.StatusCode)
+}
+
 func (s *ProcessingHandlerTestSuite) TestSkipProcessingSameFormat() {
 	config.SkipProcessingFormats = []imagetype.Type{imagetype.PNG}
 
@@ -313,6 +505,91 @@ func (s *ProcessingHandlerTestSuite) TestErrorSavingToSVG() {
 	assert.Equal(s.T(), 422, res.StatusCode)
 }
 
+func (s *ProcessingHandlerTestSuite) TestDownloadErrorCache() {
+	config.DownloadErrorCacheTTL = 60
+
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+		rw.WriteHeader(404)
+	}))
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		rw := s.send("/unsafe/rs:fill:4:4/plain/" + ts.URL)
+		res := rw.Result()
+
+		assert.Equal(s.T(), 404, res.StatusCode)
+	}
+
+	assert.Equal(s.T(), 1, requests)
+}
+
+func (s *ProcessingHandlerTestSuite) TestDownloadErrorCacheWithCookies() {
+	config.DownloadErrorCacheTTL = 60
+	config.CookiePassthrough = true
+
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+		rw.WriteHeader(404)
+	}))
+	defer ts.Close()
+
+	config.CookieBaseURL = ts.URL
+
+	header := make(http.Header)
+	header.Set("Cookie", "session=secret")
+
+	for i := 0; i < 2; i++ {
+		rw := s.send("/unsafe/rs:fill:4:4/plain/"+ts.URL, header)
+		res := rw.Result()
+
+		assert.Equal(s.T(), 404, res.StatusCode)
+	}
+
+	assert.Equal(s.T(), 2, requests)
+}
+
+func (s *ProcessingHandlerTestSuite) TestDownloadErrorCacheRaw() {
+	config.DownloadErrorCacheTTL = 60
+	config.AllowRaw = true
+
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+		rw.WriteHeader(404)
+	}))
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		rw := s.send("/unsafe/raw:1/plain/" + ts.URL)
+		res := rw.Result()
+
+		assert.Equal(s.T(), 404, res.StatusCode)
+	}
+
+	assert.Equal(s.T(), 1, requests)
+}
+
+func (s *ProcessingHandlerTestSuite) TestSourceAddressNotAllowed() {
+	config.AllowLoopbackSourceAddresses = false
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/" + ts.URL)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 404, res.StatusCode)
+}
+
 func (s *ProcessingHandlerTestSuite) TestCacheControlPassthrough() {
 	config.CacheControlPassthrough = true
 
@@ -349,6 +626,91 @@ func (s *ProcessingHandlerTestSuite) TestCacheControlPassthroughDisabled() {
 	assert.NotEqual(s.T(), "fake-expires", res.Header.Get("Expires"))
 }
 
+func (s *ProcessingHandlerTestSuite) TestCacheControlOption() {
+	config.CacheControlPassthrough = true
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Cache-Control", "fake-cache-control")
+		rw.Header().Set("Expires", "fake-expires")
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	require.Nil(s.T(), options.ParsePresets([]string{"test_cc=cc:600:true:true"}))
+	defer options.ReloadPresets(nil)
+
+	rw := s.send("/unsafe/rs:fill:4:4/pr:test_cc/plain/" + ts.URL)
+	res := rw.Result()
+
+	assert.Equal(s.T(), "max-age=600, private, immutable", res.Header.Get("Cache-Control"))
+	assert.NotEqual(s.T(), "fake-expires", res.Header.Get("Expires"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestCacheControlPassthroughPrivatePreset() {
+	config.CacheControlPassthrough = true
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Cache-Control", "max-age=3600, public")
+		rw.Header().Set("Expires", "fake-expires")
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	require.Nil(s.T(), options.ParsePresets([]string{"test_private=cc:0:true"}))
+	defer options.ReloadPresets(nil)
+
+	rw := s.send("/unsafe/rs:fill:4:4/pr:test_private/plain/" + ts.URL)
+	res := rw.Result()
+
+	assert.Equal(s.T(), fmt.Sprintf("max-age=%d, private", config.TTL), res.Header.Get("Cache-Control"))
+	assert.NotEqual(s.T(), "fake-expires", res.Header.Get("Expires"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestCacheControlOptionInURL() {
+	rw := s.send("/unsafe/rs:fill:4:4/cc:600:true:true/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 404, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestCacheControlStaleDirectives() {
+	config.StaleWhileRevalidate = 60
+	config.StaleIfError = 86400
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), "max-age=3600, public, stale-while-revalidate=60, stale-if-error=86400", res.Header.Get("Cache-Control"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestSurrogateKey() {
+	config.SurrogateKeyHeader = "Cache-Tag"
+	config.SurrogateKeySources = []string{"host", "preset"}
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Empty(s.T(), res.Header.Get("Cache-Tag"))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	require.Nil(s.T(), err)
+
+	rw = s.send("/unsafe/rs:fill:4:4/plain/" + ts.URL)
+	res = rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), "host-"+u.Host, res.Header.Get("Cache-Tag"))
+}
+
 func (s *ProcessingHandlerTestSuite) TestETagDisabled() {
 	config.ETagEnabled = false
 
@@ -521,6 +883,996 @@ func (s *ProcessingHandlerTestSuite) TestETagProcessingOptionsNotMatch() {
 	assert.Equal(s.T(), actualETag, res.Header.Get("ETag"))
 }
 
-func TestProcessingHandler(t *testing.T) {
-	suite.Run(t, new(ProcessingHandlerTestSuite))
+func (s *ProcessingHandlerTestSuite) TestLastModifiedEnabled() {
+	config.LastModifiedEnabled = true
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/" + ts.URL)
+	res := rw.Result()
+
+	assert.Equal(s.T(), "Wed, 21 Oct 2015 07:28:00 GMT", res.Header.Get("Last-Modified"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestLastModifiedDisabled() {
+	config.LastModifiedEnabled = false
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/" + ts.URL)
+	res := rw.Result()
+
+	assert.Empty(s.T(), res.Header.Get("Last-Modified"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestModifiedSinceReqNotModified() {
+	config.LastModifiedEnabled = true
+
+	modifiedSince := "Wed, 21 Oct 2015 07:28:00 GMT"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Equal(s.T(), modifiedSince, r.Header.Get("If-Modified-Since"))
+
+		rw.WriteHeader(304)
+	}))
+	defer ts.Close()
+
+	header := make(http.Header)
+	header.Set("If-Modified-Since", modifiedSince)
+
+	rw := s.send(fmt.Sprintf("/unsafe/rs:fill:4:4/plain/%s", ts.URL), header)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 304, res.StatusCode)
+	assert.Empty(s.T(), res.Header.Get("ETag"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestOverlayRequestHeaders() {
+	config.LastModifiedEnabled = true
+	config.ForwardRequestID = true
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	overlayRequests := 0
+
+	ovts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		overlayRequests++
+
+		// The conditional headers are meant for the source image only
+		assert.Empty(s.T(), r.Header.Get("If-Modified-Since"))
+		assert.Empty(s.T(), r.Header.Get("If-None-Match"))
+		assert.NotEmpty(s.T(), r.Header.Get(router.RequestIDHeader))
+
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ovts.Close()
+
+	header := make(http.Header)
+	header.Set("If-Modified-Since", "Tue, 21 Oct 2014 07:28:00 GMT")
+
+	ov := base64.RawURLEncoding.EncodeToString([]byte(ovts.URL))
+
+	rw := s.send(fmt.Sprintf("/unsafe/rs:fill:4:4/ov:%s/plain/%s", ov, ts.URL), header)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), 1, overlayRequests)
+}
+
+func (s *ProcessingHandlerTestSuite) TestOverlaySignatureClaims() {
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+
+	signV2 := func(claims, path string) string {
+		path = "/" + base64.RawURLEncoding.EncodeToString([]byte(claims)) + path
+		return "/v2." + security.Sign("v2"+path) + path
+	}
+
+	ov := base64.RawURLEncoding.EncodeToString([]byte("local:///test2.png"))
+	path := fmt.Sprintf("/ov:%s/plain/local:///test1.png", ov)
+
+	rw := s.send("/validate" + signV2(`{"src":["local:///"]}`, path))
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+
+	// The overlay URL should be allowed by the claims too
+	rw = s.send("/validate" + signV2(`{"src":["local:///test1.png"]}`, path))
+	assert.Equal(s.T(), 403, rw.Result().StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestMaskRequestHeaders() {
+	config.LastModifiedEnabled = true
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	maskRequests := 0
+
+	maskts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		maskRequests++
+
+		// The conditional headers are meant for the source image only
+		assert.Empty(s.T(), r.Header.Get("If-Modified-Since"))
+		assert.Empty(s.T(), r.Header.Get("If-None-Match"))
+
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer maskts.Close()
+
+	header := make(http.Header)
+	header.Set("If-Modified-Since", "Tue, 21 Oct 2014 07:28:00 GMT")
+
+	mask := base64.RawURLEncoding.EncodeToString([]byte(maskts.URL))
+
+	rw := s.send(fmt.Sprintf("/unsafe/rs:fill:4:4/mask:%s/plain/%s", mask, ts.URL), header)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), 1, maskRequests)
+}
+
+func (s *ProcessingHandlerTestSuite) TestMaskSignatureClaims() {
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+
+	signV2 := func(claims, path string) string {
+		path = "/" + base64.RawURLEncoding.EncodeToString([]byte(claims)) + path
+		return "/v2." + security.Sign("v2"+path) + path
+	}
+
+	mask := base64.RawURLEncoding.EncodeToString([]byte("local:///test2.png"))
+	path := fmt.Sprintf("/mask:%s/plain/local:///test1.png", mask)
+
+	rw := s.send("/validate" + signV2(`{"src":["local:///"]}`, path))
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+
+	// The mask URL should be allowed by the claims too
+	rw = s.send("/validate" + signV2(`{"src":["local:///test1.png"]}`, path))
+	assert.Equal(s.T(), 403, rw.Result().StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestModifiedSinceDataNotModified() {
+	config.LastModifiedEnabled = true
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	header := make(http.Header)
+	header.Set("If-Modified-Since", "Thu, 22 Oct 2015 07:28:00 GMT")
+
+	rw := s.send(fmt.Sprintf("/unsafe/rs:fill:4:4/plain/%s", ts.URL), header)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 304, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestModifiedSinceDataModified() {
+	config.LastModifiedEnabled = true
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Last-Modified", "Fri, 23 Oct 2015 07:28:00 GMT")
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	header := make(http.Header)
+	header.Set("If-Modified-Since", "Thu, 22 Oct 2015 07:28:00 GMT")
+
+	rw := s.send(fmt.Sprintf("/unsafe/rs:fill:4:4/plain/%s", ts.URL), header)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestResultCacheDisk() {
+	config.ResultCache = "disk"
+	config.ResultCacheTTL = 3600
+	config.ResultCacheDiskPath = s.T().TempDir()
+
+	require.Nil(s.T(), resultcache.Init())
+	defer func() {
+		config.ResultCache = ""
+		resultcache.Init()
+	}()
+
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/" + ts.URL)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), 1, requests)
+
+	// Results are stored asynchronously
+	require.Eventually(s.T(), func() bool {
+		files, _ := filepath.Glob(filepath.Join(config.ResultCacheDiskPath, "*", "*"))
+		return len(files) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	rw2 := s.send("/unsafe/rs:fill:4:4/plain/" + ts.URL)
+	res2 := rw2.Result()
+
+	assert.Equal(s.T(), 200, res2.StatusCode)
+	assert.Equal(s.T(), 1, requests)
+	assert.Equal(s.T(), rw.Body.Bytes(), rw2.Body.Bytes())
+	assert.Equal(s.T(), res.Header.Get("Content-Type"), res2.Header.Get("Content-Type"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestCORSPreflight() {
+	config.AllowOrigins = []string{"https://*.example.com"}
+	config.CORSAllowHeaders = "Authorization"
+	config.CORSMaxAge = 3600
+
+	req := httptest.NewRequest(http.MethodOptions, "/unsafe/rs:fill:4:4/plain/local:///test1.png", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	rw := httptest.NewRecorder()
+
+	s.router.ServeHTTP(rw, req)
+
+	res := rw.Result()
+
+	assert.Equal(s.T(), 204, res.StatusCode)
+	assert.Equal(s.T(), "https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(s.T(), "GET, OPTIONS", res.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(s.T(), "Authorization", res.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(s.T(), "3600", res.Header.Get("Access-Control-Max-Age"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestCORSOriginNotAllowed() {
+	config.AllowOrigins = []string{"https://example.com"}
+
+	header := make(http.Header)
+	header.Set("Origin", "https://evil.com")
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png", header)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Empty(s.T(), res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(s.T(), res.Header.Values("Vary"), "Origin")
+}
+
+func (s *ProcessingHandlerTestSuite) TestVaryRefererWatermarkMode() {
+	config.AllowedReferers = []*regexp.Regexp{configurators.RegexpFromPattern("https://example.com/")}
+
+	assert.NotContains(s.T(), buildHeaderVaryValue(), "Referer")
+
+	config.RefererBlockMode = "watermark"
+
+	assert.Equal(s.T(), "Referer, Origin", buildHeaderVaryValue())
+}
+
+func (s *ProcessingHandlerTestSuite) TestRefererNotAllowed() {
+	config.AllowedReferers = []*regexp.Regexp{configurators.RegexpFromPattern("https://example.com/")}
+
+	header := make(http.Header)
+	header.Set("Referer", "https://evil.com/")
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png", header)
+	assert.Equal(s.T(), 403, rw.Result().StatusCode)
+
+	header.Set("Referer", "https://example.com/page")
+
+	rw = s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png", header)
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestRequestsQueueFull() {
+	config.RequestsQueueRetryAfter = 5
+
+	queueSem = make(chan struct{}, 1)
+	queueSem <- struct{}{}
+	defer func() { queueSem = nil }()
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 429, res.StatusCode)
+	assert.Equal(s.T(), "5", res.Header.Get("Retry-After"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestMemorySoftLimit() {
+	config.MemorySoftLimit = 1
+	config.MemorySoftLimitWait = 0
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 503, res.StatusCode)
+	assert.Equal(s.T(), "1", res.Header.Get("Retry-After"))
+
+	config.MemorySoftLimitMinResolution = 1000000
+
+	rw = s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png")
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestRequestIDForwarding() {
+	var requestID string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requestID = r.Header.Get("X-Request-ID")
+
+		rw.WriteHeader(200)
+		rw.Write(s.readTestFile("test1.png"))
+	}))
+	defer ts.Close()
+
+	header := make(http.Header)
+	header.Set("X-Request-ID", "test-request-id")
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/"+ts.URL, header)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), "test-request-id", res.Header.Get("X-Request-ID"))
+	assert.Equal(s.T(), "test-request-id", requestID)
+
+	config.ForwardRequestID = false
+
+	s.send("/unsafe/rs:fill:4:4/plain/"+ts.URL, header)
+	assert.Empty(s.T(), requestID)
+}
+
+func (s *ProcessingHandlerTestSuite) TestAccessLog() {
+	config.AccessLogFormat = "json"
+	config.AccessLogFields = []string{"request_id", "status", "source_url", "source_format", "result_format", "bytes_out", "stages"}
+
+	var buf bytes.Buffer
+	accesslog.SetOutput(&buf)
+	defer accesslog.SetOutput(os.Stdout)
+
+	header := make(http.Header)
+	header.Set("X-Request-ID", "test-request-id")
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png@jpg", header)
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+
+	var entry map[string]interface{}
+	require.Nil(s.T(), json.Unmarshal(buf.Bytes(), &entry))
+
+	assert.Equal(s.T(), "test-request-id", entry["request_id"])
+	assert.Equal(s.T(), float64(200), entry["status"])
+	assert.Equal(s.T(), "local:///test1.png", entry["source_url"])
+	assert.Equal(s.T(), "png", entry["source_format"])
+	assert.Equal(s.T(), "jpeg", entry["result_format"])
+	assert.Equal(s.T(), float64(rw.Body.Len()), entry["bytes_out"])
+	assert.Contains(s.T(), entry["stages"], "download")
+	assert.Contains(s.T(), entry["stages"], "encode")
+	assert.NotContains(s.T(), entry, "method")
+}
+
+func (s *ProcessingHandlerTestSuite) TestInfo() {
+	rw := s.send("/info/unsafe/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), "application/json", res.Header.Get("Content-Type"))
+
+	var info map[string]interface{}
+	require.Nil(s.T(), json.Unmarshal(s.readBody(res), &info))
+
+	assert.Equal(s.T(), "png", info["format"])
+	assert.Equal(s.T(), float64(10), info["width"])
+	assert.Equal(s.T(), float64(10), info["height"])
+	assert.Equal(s.T(), float64(1), info["frames"])
+	assert.Equal(s.T(), float64(len(s.readTestFile("test1.png"))), info["size"])
+	assert.Equal(s.T(), false, info["has_alpha"])
+	assert.Equal(s.T(), false, info["grayscale"])
+	assert.Equal(s.T(), float64(8), info["bit_depth"])
+}
+
+func (s *ProcessingHandlerTestSuite) TestInfoSignature() {
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+
+	path := "/plain/local:///test1.png"
+
+	// Processing URL signatures can't be used for the info URLs
+	rw := s.send("/info/" + security.Sign(path) + path)
+	res := rw.Result()
+
+	assert.Equal(s.T(), 403, res.StatusCode)
+
+	rw = s.send("/info/" + security.Sign("info"+path) + path)
+	res = rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+
+	claimsPath := "/" + base64.RawURLEncoding.EncodeToString([]byte(`{"src":["local:///"]}`)) + path
+
+	rw = s.send("/info/v2." + security.Sign("v2"+claimsPath) + claimsPath)
+	res = rw.Result()
+
+	assert.Equal(s.T(), 403, res.StatusCode)
+
+	rw = s.send("/info/v2." + security.Sign("v2info"+claimsPath) + claimsPath)
+	res = rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestInfoDisabled() {
+	r := buildRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/info/unsafe/plain/local:///test1.png", nil)
+	rw := httptest.NewRecorder()
+	r.ServeHTTP(rw, req)
+
+	res := rw.Result()
+
+	assert.NotEqual(s.T(), 200, res.StatusCode)
+	assert.NotEqual(s.T(), "application/json", res.Header.Get("Content-Type"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestInfoDefaultPresetSecurityOptions() {
+	require.Nil(s.T(), options.ParsePresets([]string{"default=max_src_file_size:10"}))
+	defer options.ReloadPresets(nil)
+
+	rw := s.send("/info/unsafe/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 422, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestInfoSVG() {
+	rw := s.send("/info/unsafe/plain/local:///test1.svg")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+
+	var info map[string]interface{}
+	require.Nil(s.T(), json.Unmarshal(s.readBody(res), &info))
+
+	assert.Equal(s.T(), "svg", info["format"])
+	assert.Equal(s.T(), float64(200), info["width"])
+	assert.Equal(s.T(), float64(100), info["height"])
+	assert.Equal(s.T(), true, info["has_alpha"])
+	assert.Equal(s.T(), map[string]interface{}{
+		"width":        "200",
+		"height":       "100",
+		"aspect_ratio": float64(2),
+	}, info["svg"])
+}
+
+func (s *ProcessingHandlerTestSuite) TestValidate() {
+	rw := s.send("/validate/unsafe/rs:fill:4:4/q:50/plain/local:///test1.png@png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), "application/json", res.Header.Get("Content-Type"))
+
+	var result struct {
+		SourceURL string                 `json:"source_url"`
+		Options   map[string]interface{} `json:"options"`
+	}
+	require.Nil(s.T(), json.Unmarshal(s.readBody(res), &result))
+
+	assert.Equal(s.T(), "local:///test1.png", result.SourceURL)
+	assert.Equal(s.T(), "fill", result.Options["ResizingType"])
+	assert.Equal(s.T(), float64(4), result.Options["Width"])
+	assert.Equal(s.T(), float64(50), result.Options["Quality"])
+	assert.Equal(s.T(), "png", result.Options["Format"])
+}
+
+func (s *ProcessingHandlerTestSuite) TestPathPrefixPresetsSignature() {
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+
+	require.Nil(s.T(), options.ParsePresets([]string{"test_avatar=rs:fill:4:4"}))
+
+	config.PathPrefixPresets = map[string][]string{"/avatars": {"test_avatar"}}
+
+	path := "/plain/local:///test1.png"
+
+	rw := s.send("/validate/avatars/" + security.Sign("/avatars"+path) + path)
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+
+	// The signature of the path without the prefix can't be used with the prefix
+	rw = s.send("/validate/avatars/" + security.Sign(path) + path)
+	assert.Equal(s.T(), 403, rw.Result().StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestValidateDisabled() {
+	r := buildRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/validate/unsafe/rs:fill:4:4/plain/local:///test1.png", nil)
+	rw := httptest.NewRecorder()
+	r.ServeHTTP(rw, req)
+
+	res := rw.Result()
+
+	assert.NotEqual(s.T(), 200, res.StatusCode)
+	assert.NotEqual(s.T(), "application/json", res.Header.Get("Content-Type"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestValidatePathPrefixPresets() {
+	require.Nil(s.T(), options.ParsePresets([]string{
+		"test_avatar=rs:fill:4:4",
+		"test_avatar_small=rs:fill:2:2/q:50",
+	}))
+
+	config.PathPrefixPresets = map[string][]string{
+		"/avatars":       {"test_avatar"},
+		"/avatars/small": {"test_avatar_small"},
+	}
+
+	var result struct {
+		Options map[string]interface{} `json:"options"`
+	}
+
+	rw := s.send("/validate/avatars/unsafe/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	require.Nil(s.T(), json.Unmarshal(s.readBody(res), &result))
+
+	assert.Equal(s.T(), "fill", result.Options["ResizingType"])
+	assert.Equal(s.T(), float64(4), result.Options["Width"])
+	assert.Equal(s.T(), []interface{}{"test_avatar"}, result.Options["UsedPresets"])
+
+	rw = s.send("/validate/avatars/small/unsafe/w:3/plain/local:///test1.png")
+	res = rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	require.Nil(s.T(), json.Unmarshal(s.readBody(res), &result))
+
+	assert.Equal(s.T(), float64(3), result.Options["Width"])
+	assert.Equal(s.T(), float64(2), result.Options["Height"])
+	assert.Equal(s.T(), float64(50), result.Options["Quality"])
+}
+
+func (s *ProcessingHandlerTestSuite) TestThumborUnsafeWithSignatureEnabled() {
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+	config.EnableThumborCompat = true
+	config.ThumborPathPrefix = "/thumbor"
+
+	rw := s.send("/thumbor/unsafe/4x4/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 403, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestValidateThumbor() {
+	config.EnableThumborCompat = true
+	config.ThumborPathPrefix = "/thumbor"
+	config.ThumborSecurityKey = "MY_SECURE_KEY"
+
+	var result struct {
+		SourceURL string                 `json:"source_url"`
+		Options   map[string]interface{} `json:"options"`
+	}
+
+	rw := s.send("/validate/thumbor/LJf0SE-nC_UfcIpJvgCq5_fy6q4=/300x200/smart/thumbor.org/img.jpg")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	require.Nil(s.T(), json.Unmarshal(s.readBody(res), &result))
+
+	assert.Equal(s.T(), "http://thumbor.org/img.jpg", result.SourceURL)
+	assert.Equal(s.T(), "fill", result.Options["ResizingType"])
+	assert.Equal(s.T(), float64(300), result.Options["Width"])
+	assert.Equal(s.T(), float64(200), result.Options["Height"])
+
+	rw = s.send("/validate/thumbor/unsafe/300x200/smart/thumbor.org/img.jpg")
+	res = rw.Result()
+
+	assert.Equal(s.T(), 403, res.StatusCode)
+
+	// The paths without the Thumbor path prefix are parsed as usual
+	rw = s.send("/validate/unsafe/rs:fill:4:4/plain/local:///test1.png")
+	res = rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestCloudinaryUnsignedWithSignatureEnabled() {
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+	config.EnableCloudinaryCompat = true
+	config.CloudinaryPathPrefix = "/demo/image/fetch"
+
+	rw := s.send("/demo/image/fetch/c_fill,w_4,h_4/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 403, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestValidateCloudinary() {
+	config.EnableCloudinaryCompat = true
+	config.CloudinaryPathPrefix = "/demo/image/fetch"
+	config.CloudinaryAPISecret = "abcd"
+
+	var result struct {
+		SourceURL string                 `json:"source_url"`
+		Options   map[string]interface{} `json:"options"`
+	}
+
+	rw := s.send("/validate/demo/image/fetch/s--sjZpNVyf--/c_fill,w_300,h_200/sample.jpg")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	require.Nil(s.T(), json.Unmarshal(s.readBody(res), &result))
+
+	assert.Equal(s.T(), "sample.jpg", result.SourceURL)
+	assert.Equal(s.T(), "fill", result.Options["ResizingType"])
+	assert.Equal(s.T(), float64(300), result.Options["Width"])
+	assert.Equal(s.T(), float64(200), result.Options["Height"])
+
+	rw = s.send("/validate/demo/image/fetch/c_fill,w_300,h_200/sample.jpg")
+	res = rw.Result()
+
+	assert.Equal(s.T(), 403, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestValidateFailure() {
+	rw := s.send("/validate/unsafe/rs:unknown:4:4/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 404, res.StatusCode)
+
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+
+	rw = s.send("/validate/unsafe/rs:fill:4:4/plain/local:///test1.png")
+	res = rw.Result()
+
+	assert.Equal(s.T(), 403, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestJSONAPI() {
+	config.EnableJSONAPI = true
+	r := buildRouter()
+
+	body := `{"url":"local:///test1.png","options":{"resize":["fill",4,4],"format":"png"}}`
+
+	req := httptest.NewRequest(http.MethodPost, "/process", strings.NewReader(body))
+	rw := httptest.NewRecorder()
+	r.ServeHTTP(rw, req)
+
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), "image/png", res.Header.Get("Content-Type"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestJSONAPIURLResponse() {
+	config.EnableJSONAPI = true
+	config.Keys = [][]byte{[]byte("test-key")}
+	config.Salts = [][]byte{[]byte("test-salt")}
+	r := buildRouter()
+
+	body := `{"url":"local:///test1.png","options":{"rs":["fill",4,4]},"response":"url"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/process", strings.NewReader(body))
+	rw := httptest.NewRecorder()
+	r.ServeHTTP(rw, req)
+
+	res := rw.Result()
+	require.Equal(s.T(), 200, res.StatusCode)
+
+	var resp struct{ URL string }
+	require.Nil(s.T(), json.Unmarshal(s.readBody(res), &resp))
+
+	assert.True(s.T(), strings.HasSuffix(resp.URL, "/rs:fill:4:4/bG9jYWw6Ly8vdGVzdDEucG5n"))
+
+	rw = s.send(resp.URL)
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestJSONAPIInvalidOptions() {
+	config.EnableJSONAPI = true
+	r := buildRouter()
+
+	body := `{"url":"local:///test1.png","options":{"resize":["fill","4/4"]}}`
+
+	req := httptest.NewRequest(http.MethodPost, "/process", strings.NewReader(body))
+	rw := httptest.NewRecorder()
+	r.ServeHTTP(rw, req)
+
+	assert.Equal(s.T(), 422, rw.Result().StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestDebugStats() {
+	config.DebugEndpointsSecret = "debug-secret"
+	r := buildRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/stats", nil)
+	rw := httptest.NewRecorder()
+	r.ServeHTTP(rw, req)
+
+	assert.Equal(s.T(), 403, rw.Result().StatusCode)
+
+	req.Header.Set("Authorization", "Bearer debug-secret")
+	rw = httptest.NewRecorder()
+	r.ServeHTTP(rw, req)
+
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+
+	var stats map[string]interface{}
+	require.Nil(s.T(), json.Unmarshal(rw.Body.Bytes(), &stats))
+
+	assert.Contains(s.T(), stats, "goroutines")
+	assert.Contains(s.T(), stats, "gc")
+	assert.Contains(s.T(), stats, "vips")
+}
+
+func (s *ProcessingHandlerTestSuite) TestDebugPresets() {
+	config.DebugEndpointsSecret = "debug-secret"
+	r := buildRouter()
+
+	require.Nil(s.T(), options.ParsePresets([]string{"test_debug=rs:fill:4:4"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/presets", nil)
+	req.Header.Set("Authorization", "Bearer debug-secret")
+	rw := httptest.NewRecorder()
+	r.ServeHTTP(rw, req)
+
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+
+	var presets struct {
+		Presets []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"presets"`
+		Rejected []interface{} `json:"rejected"`
+	}
+	require.Nil(s.T(), json.Unmarshal(rw.Body.Bytes(), &presets))
+
+	assert.Contains(s.T(), presets.Presets, struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}{"test_debug", "rs:fill:4:4"})
+	assert.NotNil(s.T(), presets.Rejected)
+}
+
+func (s *ProcessingHandlerTestSuite) TestSlowRequestLogging() {
+	config.SlowRequestThreshold = 0.000001
+
+	hook := logrustest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png")
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+
+	entry := hook.LastEntry()
+	require.NotNil(s.T(), entry)
+
+	assert.Equal(s.T(), logrus.WarnLevel, entry.Level)
+	assert.Equal(s.T(), true, entry.Data["slow"])
+	assert.Equal(s.T(), "local:///test1.png", entry.Data["image_url"])
+	assert.Contains(s.T(), entry.Data["stages"], "transform")
+}
+
+func (s *ProcessingHandlerTestSuite) TestPathPrefixHealthPath() {
+	config.PathPrefix = "/img"
+	config.HealthPath = "/healthz"
+
+	r := buildRouter()
+
+	for path, status := range map[string]int{
+		"/img/healthz": 200,
+		"/img":         200,
+		"/healthz":     404,
+	} {
+		rw := httptest.NewRecorder()
+		r.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+
+		assert.Equal(s.T(), status, rw.Result().StatusCode, path)
+	}
+}
+
+func (s *ProcessingHandlerTestSuite) TestLivenessAndReadiness() {
+	rw := s.send("/healthz")
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+
+	rw = s.send("/readyz")
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+
+	origQueueSem := queueSem
+	defer func() { queueSem = origQueueSem }()
+
+	queueSem = make(chan struct{}, 1)
+	queueSem <- struct{}{}
+
+	rw = s.send("/readyz")
+	assert.Equal(s.T(), 503, rw.Result().StatusCode)
+
+	// Liveness doesn't depend on the queue
+	rw = s.send("/healthz")
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+
+	config.ReadinessChecks = []string{"vips"}
+
+	rw = s.send("/readyz")
+	assert.Equal(s.T(), 200, rw.Result().StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestClientLimits() {
+	config.MaxOpenConnections = 1
+	config.MaxRequestsPerIP = 1
+
+	r := buildRouter()
+
+	send := func(remoteAddr string, forwardedFor ...string) int {
+		req := httptest.NewRequest(http.MethodGet, "/unsafe/rs:fill:4:4/plain/local:///test1.png", nil)
+		req.RemoteAddr = remoteAddr
+
+		if len(forwardedFor) > 0 {
+			req.Header.Set("X-Forwarded-For", forwardedFor[0])
+		}
+
+		rw := httptest.NewRecorder()
+		r.ServeHTTP(rw, req)
+
+		return rw.Result().StatusCode
+	}
+
+	assert.Equal(s.T(), 200, send("10.0.0.1:1234"))
+
+	clientRequests["10.0.0.1"] = 1
+	defer delete(clientRequests, "10.0.0.1")
+
+	assert.Equal(s.T(), 503, send("10.0.0.1:1234"))
+	assert.Equal(s.T(), 200, send("10.0.0.2:1234"))
+
+	// The client can't bypass the limit with the forwarded headers
+	assert.Equal(s.T(), 503, send("10.0.0.1:1234", "10.0.0.3"))
+
+	atomic.StoreInt64(&openConnections, 2)
+	defer atomic.StoreInt64(&openConnections, 0)
+
+	assert.Equal(s.T(), 503, send("10.0.0.2:1234"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestCustomResponseHeaders() {
+	config.CustomResponseHeaders = map[string]string{
+		"Timing-Allow-Origin": "*",
+		"Cache-Control":       "no-store",
+	}
+	config.SendServerHeader = false
+
+	rw := s.send("/unsafe/rs:fill:4:4/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), "*", res.Header.Get("Timing-Allow-Origin"))
+	assert.Empty(s.T(), res.Header.Get("Server"))
+	// imgproxy's own headers take precedence
+	assert.NotEqual(s.T(), "no-store", res.Header.Get("Cache-Control"))
+}
+
+func (s *ProcessingHandlerTestSuite) TestReturnAttachment() {
+	rw := s.send("/unsafe/rs:fill:4:4/fn:photo/att:1/plain/local:///test1.png")
+	res := rw.Result()
+
+	assert.Equal(s.T(), 200, res.StatusCode)
+	assert.Equal(s.T(), `attachment; filename="photo.png"`, res.Header.Get("Content-Disposition"))
+}
+
+func TestProcessingHandler(t *testing.T) {
+	suite.Run(t, new(ProcessingHandlerTestSuite))
+}
+
+func (s *ProcessingHandlerTestSuite) TestRawDisabled() {
+	data := s.readTestFile("test1.png")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "image/png")
+		rw.WriteHeader(200)
+		rw.Write(data)
+	}))
+	defer ts.Close()
+
+	rw := s.send("/unsafe/raw:1/plain/" + ts.URL)
+	res := rw.Result()
+
+	require.Equal(s.T(), 403, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestRaw() {
+	config.AllowRaw = true
+
+	data := s.readTestFile("test1.png")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "image/png")
+		rw.WriteHeader(200)
+		rw.Write(data)
+	}))
+	defer ts.Close()
+
+	rw := s.send("/unsafe/raw:1/plain/" + ts.URL)
+	res := rw.Result()
+
+	require.Equal(s.T(), 200, res.StatusCode)
+	require.Equal(s.T(), "nosniff", res.Header.Get("X-Content-Type-Options"))
+	require.Equal(s.T(), data, s.readBody(res))
+}
+
+func (s *ProcessingHandlerTestSuite) TestRawNotImageContentType() {
+	config.AllowRaw = true
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/html")
+		rw.WriteHeader(200)
+		rw.Write([]byte("<script>alert(1)</script>"))
+	}))
+	defer ts.Close()
+
+	rw := s.send("/unsafe/raw:1/plain/" + ts.URL)
+	res := rw.Result()
+
+	require.Equal(s.T(), 422, res.StatusCode)
+	require.NotContains(s.T(), string(s.readBody(res)), "<script>")
+}
+
+func (s *ProcessingHandlerTestSuite) TestRawSVGContentType() {
+	config.AllowRaw = true
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "image/svg+xml")
+		rw.WriteHeader(200)
+		rw.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+	}))
+	defer ts.Close()
+
+	rw := s.send("/unsafe/raw:1/plain/" + ts.URL)
+	res := rw.Result()
+
+	require.Equal(s.T(), 422, res.StatusCode)
+}
+
+func (s *ProcessingHandlerTestSuite) TestRawSourceFileTooBig() {
+	config.AllowRaw = true
+	config.MaxSrcFileSize = 10
+
+	data := s.readTestFile("test1.png")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "image/png")
+		rw.WriteHeader(200)
+		rw.Write(data)
+	}))
+	defer ts.Close()
+
+	rw := s.send("/unsafe/raw:1/plain/" + ts.URL)
+	res := rw.Result()
+
+	require.Equal(s.T(), 422, res.StatusCode)
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/resultcache"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+var (
+	imgproxyIsReadyMsg = []byte("imgproxy is ready")
+
+	errQueueSaturated = errors.New("Requests queue is full")
+)
+
+type readinessCheck func(ctx context.Context) error
+
+var readinessChecks = map[string]readinessCheck{
+	"queue":        checkQueue,
+	"vips":         checkVips,
+	"result_cache": checkResultCache,
+}
+
+// checkQueue fails when the new requests would be rejected because of the full queue.
+// Without the queue, requests just wait for the processing, so the check always passes
+func checkQueue(ctx context.Context) error {
+	if queueSem != nil && len(queueSem) >= cap(queueSem) {
+		return errQueueSaturated
+	}
+	return nil
+}
+
+func checkVips(ctx context.Context) error {
+	return vips.Check()
+}
+
+func checkResultCache(ctx context.Context) error {
+	return resultcache.Ping(ctx)
+}
+
+// checkReadiness runs the configured readiness checks and returns
+// the descriptions of the failed ones
+func checkReadiness(ctx context.Context) []string {
+	var failed []string
+
+	for _, name := range config.ReadinessChecks {
+		check, ok := readinessChecks[name]
+		if !ok {
+			continue
+		}
+
+		if err := check(ctx); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+
+	return failed
+}
+
+func handleReadiness(reqID string, rw http.ResponseWriter, r *http.Request) {
+	if failed := checkReadiness(r.Context()); len(failed) > 0 {
+		router.LogResponse(reqID, r, 503, nil)
+		rw.WriteHeader(503)
+		rw.Write([]byte(strings.Join(failed, "\n")))
+		return
+	}
+
+	router.LogResponse(reqID, r, 200, nil)
+	rw.WriteHeader(200)
+	rw.Write(imgproxyIsReadyMsg)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+)
+
+func reloadPresets() {
+	presets, err := config.ReloadPresets()
+	if err == nil {
+		err = options.ReloadPresets(presets)
+	}
+
+	if err != nil {
+		log.Errorf("Can't reload presets: %s", err)
+		return
+	}
+
+	log.Info("Presets are reloaded")
+}
+
+func reloadWatermark() {
+	if len(config.WatermarkData) == 0 && len(config.WatermarkPath) == 0 && len(config.WatermarkURL) == 0 {
+		return
+	}
+
+	if err := imagedata.ReloadWatermark(); err != nil {
+		log.Errorf("Can't reload watermark: %s", err)
+		return
+	}
+
+	log.Info("Watermark is reloaded")
+}
+
+func reloadTLSCertificate() {
+	if tlsCertificate == nil {
+		return
+	}
+
+	if err := tlsCertificate.Reload(); err != nil {
+		log.Errorf("Can't reload TLS certificate: %s", err)
+		return
+	}
+
+	log.Info("TLS certificate is reloaded")
+}
+
+// filesModTime returns the latest modification time of the files
+func filesModTime(files []string) time.Time {
+	var modTime time.Time
+
+	for _, f := range files {
+		if stat, err := os.Stat(f); err == nil && stat.ModTime().After(modTime) {
+			modTime = stat.ModTime()
+		}
+	}
+
+	return modTime
+}
+
+// startReloader reloads the presets, the watermark, and the TLS certificate on SIGHUP.
+// When IMGPROXY_RELOAD_CHECK_INTERVAL is set, it also checks the presets,
+// watermark, and TLS certificate files for changes and reloads them if they are changed.
+// It should be called after the server is started
+func startReloader(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var (
+		ticker         *time.Ticker
+		tick           <-chan time.Time
+		presetsFiles   []string
+		watermarkFiles []string
+		tlsFiles       []string
+	)
+
+	if config.ReloadCheckInterval > 0 {
+		ticker = time.NewTicker(time.Duration(config.ReloadCheckInterval) * time.Second)
+		tick = ticker.C
+
+		presetsFiles = config.PresetsFiles()
+
+		if len(config.WatermarkPath) > 0 {
+			watermarkFiles = []string{config.WatermarkPath}
+		}
+
+		if tlsCertificate != nil {
+			tlsFiles = tlsCertificate.Files()
+		}
+	}
+
+	presetsModTime := filesModTime(presetsFiles)
+	watermarkModTime := filesModTime(watermarkFiles)
+	tlsModTime := filesModTime(tlsFiles)
+
+	go func() {
+		defer signal.Stop(hup)
+
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				reloadPresets()
+				reloadWatermark()
+				reloadTLSCertificate()
+			case <-tick:
+				if modTime := filesModTime(presetsFiles); modTime.After(presetsModTime) {
+					presetsModTime = modTime
+					reloadPresets()
+				}
+
+				if modTime := filesModTime(watermarkFiles); modTime.After(watermarkModTime) {
+					watermarkModTime = modTime
+					reloadWatermark()
+				}
+
+				if modTime := filesModTime(tlsFiles); modTime.After(tlsModTime) {
+					tlsModTime = modTime
+					reloadTLSCertificate()
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/resultcache"
+)
+
+type resultCacheRefreshCtxKey struct{}
+
+// Keys of the cached results that are being refreshed right now
+var resultCacheRefreshing sync.Map
+
+// discardResponseWriter is used to refresh cached results in the background
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (rw *discardResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (rw *discardResponseWriter) WriteHeader(statusCode int) {}
+
+func isResultCacheRefresh(ctx context.Context) bool {
+	refresh, _ := ctx.Value(resultCacheRefreshCtxKey{}).(bool)
+	return refresh
+}
+
+func getCachedResult(ctx context.Context, key string) *resultcache.Entry {
+	entry, err := resultcache.Get(ctx, key)
+	if err != nil {
+		log.Warningf("Can't get the result from cache: %s", err)
+		return nil
+	}
+
+	return entry
+}
+
+func storeCachedResult(key string, resultData *imagedata.ImageData, originHeaders map[string]string, etag string) {
+	// resultData will be closed after the response is sent,
+	// so we need to copy the data
+	entry := &resultcache.Entry{
+		Data: &imagedata.ImageData{
+			Type:    resultData.Type,
+			Data:    append([]byte(nil), resultData.Data...),
+			Headers: resultData.Headers,
+		},
+		OriginHeaders: originHeaders,
+		ETag:          etag,
+		CreatedAt:     time.Now(),
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.WriteTimeout)*time.Second)
+		defer cancel()
+
+		if err := resultcache.Set(ctx, key, entry); err != nil {
+			log.Warningf("Can't store the result to cache: %s", err)
+		}
+	}()
+}
+
+// refreshCachedResult processes the image in the background to update the cached result
+func refreshCachedResult(reqID string, r *http.Request, key string) {
+	if _, loaded := resultCacheRefreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	ctx := context.WithValue(context.Background(), resultCacheRefreshCtxKey{}, true)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.WriteTimeout)*time.Second)
+
+	req := r.Clone(ctx)
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	req.Header.Del("Range")
+
+	go func() {
+		defer cancel()
+		defer resultCacheRefreshing.Delete(key)
+
+		defer func() {
+			if rerr := recover(); rerr != nil {
+				log.Warningf("Can't refresh the cached result: %v", rerr)
+			}
+		}()
+
+		handleProcessing(reqID, &discardResponseWriter{header: make(http.Header)}, req)
+	}()
+}
+
+func respondWithCachedResult(reqID string, r *http.Request, rw http.ResponseWriter, entry *resultcache.Entry, po *options.ProcessingOptions, originURL string) {
+	if config.ETagEnabled && len(entry.ETag) > 0 {
+		rw.Header().Set("ETag", entry.ETag)
+
+		if r.Header.Get("If-None-Match") == entry.ETag {
+			respondWithNotModified(reqID, r, rw, po, originURL, entry.OriginHeaders)
+			return
+		}
+	} else {
+		rw.Header().Del("ETag")
+	}
+
+	if isNotModifiedSince(r, entry.OriginHeaders) {
+		respondWithNotModified(reqID, r, rw, po, originURL, entry.OriginHeaders)
+		return
+	}
+
+	respondWithImage(reqID, r, rw, http.StatusOK, entry.Data, po, originURL, &imagedata.ImageData{Headers: entry.OriginHeaders})
+}
@@ -0,0 +1,202 @@
+package disk
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// Storage stores cache entries in the local filesystem.
+// The modification time of the entry file is set to the entry expiration time
+// so the sweeper can remove expired entries without reading them
+type Storage struct {
+	root    string
+	maxSize int64
+}
+
+type entryFile struct {
+	path    string
+	size    int64
+	expires time.Time
+}
+
+func New() (*Storage, error) {
+	root, err := filepath.Abs(config.ResultCacheDiskPath)
+	if err != nil {
+		return nil, fmt.Errorf("Can't use result cache path: %s", err)
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("Can't create result cache directory: %s", err)
+	}
+
+	s := &Storage{root: root, maxSize: int64(config.ResultCacheDiskMaxSize)}
+
+	if config.ResultCacheDiskSweepInterval > 0 {
+		go s.runSweeper(time.Duration(config.ResultCacheDiskSweepInterval) * time.Second)
+	}
+
+	return s, nil
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	// Write a temp file to make sure the directory is still writable
+	f, err := ioutil.TempFile(s.root, "ping.*.tmp")
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+func (s *Storage) path(key string) string {
+	return filepath.Join(s.root, key[:2], key)
+}
+
+func (s *Storage) Get(ctx context.Context, key string) ([]byte, error) {
+	path := s.path(key)
+
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stat.ModTime().Before(time.Now()) {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+func (s *Storage) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	path := s.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temp file first so readers never see a partially written entry
+	f, err := ioutil.TempFile(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+
+	if err == nil {
+		expires := time.Now().Add(ttl)
+		err = os.Chtimes(f.Name(), expires, expires)
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
+
+func (s *Storage) runSweeper(interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for range tick.C {
+		if err := s.Sweep(time.Now(), interval); err != nil {
+			log.Warningf("Can't sweep result cache: %s", err)
+		}
+	}
+}
+
+// Sweep removes expired entries and temp files older than tmpTTL.
+// When the total size of the remaining entries exceeds the max size,
+// the entries that expire first are removed until the size fits
+func (s *Storage) Sweep(now time.Time, tmpTTL time.Duration) error {
+	var (
+		files     []entryFile
+		totalSize int64
+	)
+
+	err := filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// The file may be removed by a concurrent Set
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if strings.HasSuffix(path, ".tmp") {
+			// Temp files are renamed right after they are written,
+			// so the old ones are leftovers of failed writes
+			if info.ModTime().Before(now.Add(-tmpTTL)) {
+				os.Remove(path)
+			}
+			return nil
+		}
+
+		if info.ModTime().Before(now) {
+			os.Remove(path)
+			return nil
+		}
+
+		files = append(files, entryFile{path: path, size: info.Size(), expires: info.ModTime()})
+		totalSize += info.Size()
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.maxSize <= 0 || totalSize <= s.maxSize {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].expires.Before(files[j].expires)
+	})
+
+	for _, f := range files {
+		if totalSize <= s.maxSize {
+			break
+		}
+
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		totalSize -= f.size
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package disk
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorage(t *testing.T, maxSize int64) *Storage {
+	root, err := ioutil.TempDir("", "imgproxy-result-cache")
+	require.Nil(t, err)
+
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	return &Storage{root: root, maxSize: maxSize}
+}
+
+func TestGetExpired(t *testing.T) {
+	s := newTestStorage(t, 0)
+	ctx := context.Background()
+
+	require.Nil(t, s.Set(ctx, "aaaa", []byte("fresh"), time.Hour))
+	require.Nil(t, s.Set(ctx, "bbbb", []byte("expired"), -time.Second))
+
+	data, err := s.Get(ctx, "aaaa")
+	require.Nil(t, err)
+	require.Equal(t, []byte("fresh"), data)
+
+	data, err = s.Get(ctx, "bbbb")
+	require.Nil(t, err)
+	require.Nil(t, data)
+}
+
+func TestSweepExpired(t *testing.T) {
+	s := newTestStorage(t, 0)
+	ctx := context.Background()
+
+	require.Nil(t, s.Set(ctx, "aaaa", []byte("fresh"), time.Hour))
+	require.Nil(t, s.Set(ctx, "bbbb", []byte("expired"), -time.Second))
+
+	require.Nil(t, s.Sweep(time.Now(), time.Hour))
+
+	_, err := os.Stat(s.path("aaaa"))
+	require.Nil(t, err)
+
+	_, err = os.Stat(s.path("bbbb"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestSweepStaleTempFiles(t *testing.T) {
+	s := newTestStorage(t, 0)
+
+	dir := filepath.Join(s.root, "aa")
+	require.Nil(t, os.MkdirAll(dir, 0755))
+
+	tmp := filepath.Join(dir, "aaaa.123.tmp")
+	require.Nil(t, ioutil.WriteFile(tmp, []byte("data"), 0644))
+
+	require.Nil(t, s.Sweep(time.Now(), time.Hour))
+
+	_, err := os.Stat(tmp)
+	require.Nil(t, err)
+
+	require.Nil(t, s.Sweep(time.Now().Add(2*time.Hour), time.Hour))
+
+	_, err = os.Stat(tmp)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestSweepMaxSize(t *testing.T) {
+	s := newTestStorage(t, 10)
+	ctx := context.Background()
+
+	require.Nil(t, s.Set(ctx, "aaaa", []byte("12345"), time.Hour))
+	require.Nil(t, s.Set(ctx, "bbbb", []byte("12345"), 2*time.Hour))
+	require.Nil(t, s.Set(ctx, "cccc", []byte("12345"), 3*time.Hour))
+
+	require.Nil(t, s.Sweep(time.Now(), time.Hour))
+
+	_, err := os.Stat(s.path("aaaa"))
+	require.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(s.path("bbbb"))
+	require.Nil(t, err)
+
+	_, err = os.Stat(s.path("cccc"))
+	require.Nil(t, err)
+}
@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// Storage stores cache entries in Redis.
+// It implements only the tiny subset of the Redis protocol we need
+// (AUTH, SELECT, GET, SET with PX, and PING) over a plain TCP connection.
+// TLS is not supported, so the Redis server should be reachable
+// only via a trusted network
+type Storage struct {
+	pool chan *conn
+}
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+func New() (*Storage, error) {
+	s := &Storage{pool: make(chan *conn, config.Concurrency)}
+
+	// Check that we can connect
+	c, err := s.dial(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("Can't connect to Redis: %s", err)
+	}
+	s.put(c)
+
+	return s, nil
+}
+
+func (s *Storage) dial(ctx context.Context) (*conn, error) {
+	var d net.Dialer
+
+	nc, err := d.DialContext(ctx, "tcp", config.ResultCacheRedisAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{nc: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	if len(config.ResultCacheRedisPassword) > 0 {
+		if _, err := c.do(ctx, "AUTH", []byte(config.ResultCacheRedisPassword)); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	if config.ResultCacheRedisDB > 0 {
+		if _, err := c.do(ctx, "SELECT", []byte(strconv.Itoa(config.ResultCacheRedisDB))); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (s *Storage) get(ctx context.Context) (*conn, error) {
+	select {
+	case c := <-s.pool:
+		return c, nil
+	default:
+		return s.dial(ctx)
+	}
+}
+
+func (s *Storage) put(c *conn) {
+	select {
+	case s.pool <- c:
+	default:
+		c.nc.Close()
+	}
+}
+
+func (s *Storage) do(ctx context.Context, cmd string, args ...[]byte) ([]byte, error) {
+	c, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(ctx, cmd, args...)
+
+	// Redis errors don't break the connection
+	if _, ok := err.(redisError); err == nil || ok {
+		s.put(c)
+	} else {
+		c.nc.Close()
+	}
+
+	return res, err
+}
+
+func (s *Storage) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, "GET", []byte(key))
+}
+
+func (s *Storage) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	_, err := s.do(
+		ctx, "SET", []byte(key), data,
+		[]byte("PX"), []byte(strconv.FormatInt(ttl.Milliseconds(), 10)),
+	)
+	return err
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	_, err := s.do(ctx, "PING")
+	return err
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return fmt.Sprintf("Redis error: %s", string(e))
+}
+
+var errUnexpectedReply = errors.New("Unexpected Redis reply")
+
+func (c *conn) do(ctx context.Context, cmd string, args ...[]byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.nc.SetDeadline(deadline)
+	} else {
+		c.nc.SetDeadline(time.Time{})
+	}
+
+	fmt.Fprintf(c.w, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(cmd), cmd)
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n", len(arg))
+		c.w.Write(arg)
+		c.w.WriteString("\r\n")
+	}
+
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+// readReply reads simple string, error, integer, and bulk string replies.
+// Nil bulk string is returned as nil
+func (c *conn) readReply() ([]byte, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 {
+		return nil, errUnexpectedReply
+	}
+
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errUnexpectedReply
+		}
+
+		if size < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+
+		return data[:size], nil
+	}
+
+	return nil, errUnexpectedReply
+}
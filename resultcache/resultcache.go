@@ -0,0 +1,215 @@
+package resultcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/bufpool"
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/resultcache/disk"
+	"github.com/imgproxy/imgproxy/v3/resultcache/redis"
+	"github.com/imgproxy/imgproxy/v3/resultcache/s3"
+)
+
+// storage stores encoded cache entries.
+// Get should return nil data and nil error when the entry is missing
+type storage interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, data []byte, ttl time.Duration) error
+	Ping(ctx context.Context) error
+}
+
+var (
+	store storage
+
+	errInvalidEntry = errors.New("Invalid result cache entry")
+)
+
+// Entry is a cached processing result
+type Entry struct {
+	Data          *imagedata.ImageData
+	OriginHeaders map[string]string
+	ETag          string
+	CreatedAt     time.Time
+}
+
+type entryMeta struct {
+	Type          string            `json:"type"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	OriginHeaders map[string]string `json:"origin_headers,omitempty"`
+	ETag          string            `json:"etag,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+func Init() (err error) {
+	switch config.ResultCache {
+	case "disk":
+		store, err = disk.New()
+	case "redis":
+		store, err = redis.New()
+	case "s3":
+		store, err = s3.New()
+	default:
+		store = nil
+	}
+
+	return
+}
+
+func Enabled() bool {
+	return store != nil
+}
+
+// Ping checks that the result cache storage is reachable
+func Ping(ctx context.Context) error {
+	if store == nil {
+		return nil
+	}
+
+	return store.Ping(ctx)
+}
+
+func ttl() time.Duration {
+	return time.Duration(config.ResultCacheTTL) * time.Second
+}
+
+// staleTTL is the time during which the expired entry can be served stale
+func staleTTL() time.Duration {
+	stale := config.StaleWhileRevalidate
+	if config.StaleIfError > stale {
+		stale = config.StaleIfError
+	}
+
+	return time.Duration(stale) * time.Second
+}
+
+// Key calculates the cache key from the source image URL, processing options,
+// and the resulting image format
+func Key(imageURL string, po *options.ProcessingOptions) string {
+	h := sha256.New()
+
+	h.Write([]byte(imageURL))
+	h.Write([]byte{0})
+
+	enc := json.NewEncoder(h)
+	enc.SetEscapeHTML(false)
+	enc.Encode(po.Diff())
+
+	h.Write([]byte{0})
+	h.Write([]byte(po.Format.String()))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the cached entry or nil when the entry is missing.
+// The returned entry may be expired but still can be served stale
+func Get(ctx context.Context, key string) (*Entry, error) {
+	data, err := store.Get(ctx, key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	entry, err := decodeEntry(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Age() >= ttl()+staleTTL() {
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+func Set(ctx context.Context, key string, entry *Entry) error {
+	buf, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+	// Storages don't retain the data, so we can reuse the buffer
+	defer bufpool.PutSized(buf)
+
+	return store.Set(ctx, key, buf.Bytes(), ttl()+staleTTL())
+}
+
+func (e *Entry) Age() time.Duration {
+	return time.Since(e.CreatedAt)
+}
+
+func (e *Entry) Fresh() bool {
+	return e.Age() < ttl()
+}
+
+// CanServeStale checks if the expired entry can be served
+// during the provided stale period (in seconds)
+func (e *Entry) CanServeStale(stale int) bool {
+	return e.Age() < ttl()+time.Duration(stale)*time.Second
+}
+
+// Entries are encoded as a 4-byte big-endian metadata length,
+// JSON-encoded metadata, and image data
+func encodeEntry(e *Entry) (*bytes.Buffer, error) {
+	meta, err := json.Marshal(entryMeta{
+		Type:          e.Data.Type.String(),
+		Headers:       e.Data.Headers,
+		OriginHeaders: e.OriginHeaders,
+		ETag:          e.ETag,
+		CreatedAt:     e.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bufpool.GetSized(4 + len(meta) + len(e.Data.Data))
+
+	var metaLen [4]byte
+	binary.BigEndian.PutUint32(metaLen[:], uint32(len(meta)))
+
+	buf.Write(metaLen[:])
+	buf.Write(meta)
+	buf.Write(e.Data.Data)
+
+	return buf, nil
+}
+
+func decodeEntry(data []byte) (*Entry, error) {
+	if len(data) < 4 {
+		return nil, errInvalidEntry
+	}
+
+	metaLen := int(binary.BigEndian.Uint32(data))
+	if len(data) < 4+metaLen {
+		return nil, errInvalidEntry
+	}
+
+	var meta entryMeta
+	if err := json.Unmarshal(data[4:4+metaLen], &meta); err != nil {
+		return nil, fmt.Errorf("%s: %s", errInvalidEntry, err)
+	}
+
+	imgtype, ok := imagetype.Types[meta.Type]
+	if !ok {
+		return nil, errInvalidEntry
+	}
+
+	return &Entry{
+		Data: &imagedata.ImageData{
+			Type:    imgtype,
+			Data:    data[4+metaLen:],
+			Headers: meta.Headers,
+		},
+		OriginHeaders: meta.OriginHeaders,
+		ETag:          meta.ETag,
+		CreatedAt:     meta.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	s3Transport "github.com/imgproxy/imgproxy/v3/transport/s3"
+)
+
+// Storage stores cache entries in an S3 bucket.
+// Use bucket lifecycle rules to remove expired entries
+type Storage struct {
+	svc    *s3.S3
+	bucket string
+	prefix string
+}
+
+func New() (*Storage, error) {
+	svc, err := s3Transport.NewService()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Storage{
+		svc:    svc,
+		bucket: config.ResultCacheS3Bucket,
+		prefix: config.ResultCacheS3Prefix,
+	}, nil
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	_, err := s.svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+	return err
+}
+
+func (s *Storage) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	if err != nil {
+		if s3err, ok := err.(awserr.RequestFailure); ok && s3err.StatusCode() == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	return ioutil.ReadAll(out.Body)
+}
+
+func (s *Storage) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	_, err := s.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     aws.String(s.prefix + key),
+		Body:    bytes.NewReader(data),
+		Expires: aws.Time(time.Now().Add(ttl)),
+	})
+
+	return err
+}
@@ -4,6 +4,8 @@ import (
 	"net"
 	"net/http"
 
+	"github.com/imgproxy/imgproxy/v3/accesslog"
+	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
 	log "github.com/sirupsen/logrus"
 )
@@ -55,8 +57,47 @@ func LogResponse(reqID string, r *http.Request, status int, err *ierrors.Error,
 		}
 	}
 
+	duration := ctxTime(r.Context())
+
+	if config.SlowRequestThreshold > 0 && duration.Seconds() > config.SlowRequestThreshold {
+		if level > log.WarnLevel {
+			level = log.WarnLevel
+		}
+
+		fields["slow"] = true
+
+		if _, ok := fields["image_url"]; !ok {
+			if v, ok := accesslog.Get(r.Context(), "source_url"); ok {
+				fields["image_url"] = v
+			}
+		}
+
+		if _, ok := fields["processing_options"]; !ok {
+			if v, ok := accesslog.Get(r.Context(), "processing_options"); ok {
+				fields["processing_options"] = v
+			}
+		}
+
+		if stages := accesslog.Stages(r.Context()); len(stages) > 0 {
+			fields["stages"] = stages
+		}
+	}
+
+	if accesslog.Enabled() {
+		alFields := map[string]interface{}{
+			"status":   status,
+			"duration": duration.Seconds(),
+		}
+
+		if err != nil {
+			alFields["error"] = err.Error()
+		}
+
+		accesslog.Write(r.Context(), alFields)
+	}
+
 	log.WithFields(fields).Logf(
 		level,
-		"Completed in %s %s", ctxTime(r.Context()), r.RequestURI,
+		"Completed in %s %s", duration, r.RequestURI,
 	)
 }
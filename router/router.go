@@ -1,17 +1,22 @@
 package router
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	nanoid "github.com/matoous/go-nanoid/v2"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/accesslog"
+	"github.com/imgproxy/imgproxy/v3/config"
 )
 
 const (
-	xRequestIDHeader = "X-Request-ID"
+	RequestIDHeader = "X-Request-ID"
 )
 
 var (
@@ -20,6 +25,8 @@ var (
 
 type RouteHandler func(string, http.ResponseWriter, *http.Request)
 
+type peerAddrCtxKey struct{}
+
 type route struct {
 	Method  string
 	Prefix  string
@@ -62,6 +69,10 @@ func (r *Router) GET(prefix string, handler RouteHandler, exact bool) {
 	r.Add(http.MethodGet, prefix, handler, exact)
 }
 
+func (r *Router) POST(prefix string, handler RouteHandler, exact bool) {
+	r.Add(http.MethodPost, prefix, handler, exact)
+}
+
 func (r *Router) OPTIONS(prefix string, handler RouteHandler, exact bool) {
 	r.Add(http.MethodOptions, prefix, handler, exact)
 }
@@ -74,14 +85,23 @@ func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	req, timeoutCancel := startRequestTimer(req)
 	defer timeoutCancel()
 
-	reqID := req.Header.Get(xRequestIDHeader)
+	reqID := req.Header.Get(RequestIDHeader)
 
 	if len(reqID) == 0 || !requestIDRe.MatchString(reqID) {
 		reqID, _ = nanoid.New()
 	}
 
-	rw.Header().Set("Server", "imgproxy")
-	rw.Header().Set(xRequestIDHeader, reqID)
+	if config.SendServerHeader {
+		rw.Header().Set("Server", "imgproxy")
+	}
+	for name, value := range config.CustomResponseHeaders {
+		rw.Header().Set(name, value)
+	}
+	rw.Header().Set(RequestIDHeader, reqID)
+
+	// RemoteAddr is replaced with the forwarded client IP below,
+	// so we keep the address of the actual peer for the client limits
+	req = req.WithContext(context.WithValue(req.Context(), peerAddrCtxKey{}, req.RemoteAddr))
 
 	if ip := req.Header.Get("CF-Connecting-IP"); len(ip) != 0 {
 		replaceRemoteAddr(req, ip)
@@ -96,6 +116,21 @@ func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 	LogRequest(reqID, req)
 
+	if accesslog.RecordsEnabled() {
+		req = req.WithContext(accesslog.WithRecord(req.Context()))
+		rw = accesslog.WrapResponseWriter(req.Context(), rw)
+
+		clientIP, _, _ := net.SplitHostPort(req.RemoteAddr)
+
+		accesslog.Set(req.Context(), "time", time.Now().Format(time.RFC3339Nano))
+		accesslog.Set(req.Context(), "request_id", reqID)
+		accesslog.Set(req.Context(), "method", req.Method)
+		accesslog.Set(req.Context(), "path", req.RequestURI)
+		accesslog.Set(req.Context(), "client_ip", clientIP)
+		accesslog.Set(req.Context(), "user_agent", req.UserAgent())
+		accesslog.Set(req.Context(), "referer", req.Referer())
+	}
+
 	for _, rr := range r.Routes {
 		if rr.isMatch(req) {
 			rr.Handler(reqID, rw, req)
@@ -108,6 +143,17 @@ func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	rw.WriteHeader(404)
 }
 
+// PeerAddr returns the address of the peer connected to imgproxy.
+// Unlike RemoteAddr, it is not affected by the CF-Connecting-IP,
+// X-Forwarded-For, and X-Real-IP headers that can be set by the client
+func PeerAddr(req *http.Request) string {
+	if addr, ok := req.Context().Value(peerAddrCtxKey{}).(string); ok {
+		return addr
+	}
+
+	return req.RemoteAddr
+}
+
 func replaceRemoteAddr(req *http.Request, ip string) {
 	_, port, err := net.SplitHostPort(req.RemoteAddr)
 	if err != nil {
@@ -0,0 +1,32 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+func TestPeerAddr(t *testing.T) {
+	config.Reset()
+
+	var remoteAddr, peerAddr string
+
+	r := New("")
+	r.GET("/", func(reqID string, rw http.ResponseWriter, req *http.Request) {
+		remoteAddr = req.RemoteAddr
+		peerAddr = PeerAddr(req)
+	}, true)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "10.0.0.2, 10.0.0.3")
+
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "10.0.0.2:1234", remoteAddr)
+	assert.Equal(t, "10.0.0.1:1234", peerAddr)
+}
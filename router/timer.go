@@ -3,6 +3,7 @@ package router
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -11,7 +12,8 @@ import (
 	"github.com/imgproxy/imgproxy/v3/metrics"
 )
 
-type timerSinceCtxKey = struct{}
+type timerSinceCtxKey struct{}
+type connCtxKey struct{}
 
 func startRequestTimer(r *http.Request) (*http.Request, context.CancelFunc) {
 	ctx := r.Context()
@@ -20,6 +22,39 @@ func startRequestTimer(r *http.Request) (*http.Request, context.CancelFunc) {
 	return r.WithContext(ctx), cancel
 }
 
+// WithStageTimeout limits the duration of a request processing stage.
+// The stage is still limited by the request timeout
+func WithStageTimeout(ctx context.Context, timeout int) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+}
+
+// ConnContext stores the connection in the request context,
+// so the response write deadline can be set per request
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connCtxKey{}, c)
+}
+
+// StartWriteTimer limits the duration of writing the response to the client.
+// The returned function resets the limit and should be called when the response is written.
+// HTTP/2 streams share the connection, so the limit is applied to HTTP/1 requests only
+func StartWriteTimer(r *http.Request) func() {
+	if config.WriteResponseTimeout <= 0 || r.ProtoMajor != 1 {
+		return func() {}
+	}
+
+	c, ok := r.Context().Value(connCtxKey{}).(net.Conn)
+	if !ok {
+		return func() {}
+	}
+
+	c.SetWriteDeadline(time.Now().Add(time.Duration(config.WriteResponseTimeout) * time.Second))
+
+	return func() { c.SetWriteDeadline(time.Time{}) }
+}
+
 func ctxTime(ctx context.Context) time.Duration {
 	if t, ok := ctx.Value(timerSinceCtxKey{}).(time.Time); ok {
 		return time.Since(t)
@@ -0,0 +1,71 @@
+package router
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type deadlineConn struct {
+	net.Conn
+
+	writeDeadline time.Time
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline = t
+	return nil
+}
+
+func TestStartWriteTimer(t *testing.T) {
+	config.Reset()
+	defer config.Reset()
+
+	config.WriteResponseTimeout = 10
+
+	conn := new(deadlineConn)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(ConnContext(r.Context(), conn))
+
+	// The request timer shouldn't overwrite the connection in the context
+	r, cancel := startRequestTimer(r)
+	defer cancel()
+
+	stop := StartWriteTimer(r)
+
+	require.False(t, conn.writeDeadline.IsZero())
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), conn.writeDeadline, time.Second)
+
+	stop()
+
+	assert.True(t, conn.writeDeadline.IsZero())
+}
+
+func TestStartWriteTimerDisabled(t *testing.T) {
+	config.Reset()
+	defer config.Reset()
+
+	conn := new(deadlineConn)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(ConnContext(r.Context(), conn))
+
+	StartWriteTimer(r)()
+
+	assert.True(t, conn.writeDeadline.IsZero())
+}
+
+func TestCtxTimeWithConn(t *testing.T) {
+	ctx := context.WithValue(context.Background(), timerSinceCtxKey{}, time.Now().Add(-time.Second))
+	ctx = ConnContext(ctx, new(deadlineConn))
+
+	assert.GreaterOrEqual(t, int64(ctxTime(ctx)), int64(time.Second))
+}
@@ -0,0 +1,83 @@
+package security
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const signatureV2Prefix = "v2."
+
+var (
+	ErrInvalidClaims     = errors.New("Invalid signature claims")
+	ErrExpiredClaims     = errors.New("Signature claims are expired")
+	ErrSourceNotClaimed  = errors.New("Source URL is not allowed by signature claims")
+	ErrOptionsNotClaimed = errors.New("Processing options are not allowed by signature claims")
+)
+
+// Claims are the restrictions embedded into the v2 signed URL
+type Claims struct {
+	// Expires is a unix timestamp after which the URL is not valid
+	Expires int64 `json:"exp,omitempty"`
+	// Options is a list of the processing options allowed in the URL
+	Options []string `json:"opts,omitempty"`
+	// Sources is a list of the allowed source URL prefixes
+	Sources []string `json:"src,omitempty"`
+}
+
+func IsSignatureV2(signature string) bool {
+	return strings.HasPrefix(signature, signatureV2Prefix)
+}
+
+// VerifySignatureV2 verifies the v2 signature and parses the claims
+// from the first path segment. signedPrefix is the part of the URL path
+// that precedes the signature but is still signed.
+// The path without the claims is returned
+func VerifySignatureV2(signature, signedPrefix, path string) (*Claims, string, error) {
+	signature = strings.TrimPrefix(signature, signatureV2Prefix)
+
+	// v2 signatures are calculated for the path with the "v2" prefix
+	// so v1 signatures can't be used as v2 ones
+	if err := VerifySignature(signature, "v2"+signedPrefix+path); err != nil {
+		return nil, "", err
+	}
+
+	path = strings.TrimPrefix(path, "/")
+
+	claimsEnd := strings.IndexByte(path, '/')
+	if claimsEnd <= 0 {
+		return nil, "", ErrInvalidClaims
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(path[:claimsEnd])
+	if err != nil {
+		return nil, "", ErrInvalidClaims
+	}
+
+	claims := new(Claims)
+	if err := json.Unmarshal(claimsJSON, claims); err != nil {
+		return nil, "", ErrInvalidClaims
+	}
+
+	if claims.Expires > 0 && claims.Expires < time.Now().Unix() {
+		return nil, "", ErrExpiredClaims
+	}
+
+	return claims, path[claimsEnd:], nil
+}
+
+func (c *Claims) VerifySourceURL(imageURL string) error {
+	if len(c.Sources) == 0 {
+		return nil
+	}
+
+	for _, src := range c.Sources {
+		if strings.HasPrefix(imageURL, src) {
+			return nil
+		}
+	}
+
+	return ErrSourceNotClaimed
+}
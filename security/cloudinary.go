@@ -0,0 +1,59 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+var cloudinaryVersionRe = regexp.MustCompile(`^v\d+$`)
+
+// VerifyCloudinarySignature checks the signature of the Cloudinary-compatible URL.
+// Cloudinary signs the transformations and the public ID without the version
+// with SHA1 and uses the first 8 characters of the URL-safe base64-encoded result
+func VerifyCloudinarySignature(signature, path string) error {
+	if len(config.CloudinaryAPISecret) == 0 {
+		// Unsigned Cloudinary URLs would bypass the imgproxy URL signature
+		if len(config.Keys) > 0 {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	if len(signature) == 0 {
+		return ErrInvalidSignature
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, p := range parts {
+		if cloudinaryVersionRe.MatchString(p) {
+			parts = append(parts[:i:i], parts[i+1:]...)
+			break
+		}
+	}
+
+	toSign := strings.Join(parts, "/")
+
+	if hmac.Equal([]byte(signature), cloudinarySignatureFor(toSign)) {
+		return nil
+	}
+
+	if unescaped, err := url.PathUnescape(toSign); err == nil && unescaped != toSign {
+		if hmac.Equal([]byte(signature), cloudinarySignatureFor(unescaped)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func cloudinarySignatureFor(str string) []byte {
+	sum := sha1.Sum([]byte(str + config.CloudinaryAPISecret))
+	return []byte(base64.URLEncoding.EncodeToString(sum[:])[:8])
+}
@@ -5,12 +5,62 @@ import (
 	"github.com/imgproxy/imgproxy/v3/ierrors"
 )
 
-var ErrSourceResolutionTooBig = ierrors.New(422, "Source image resolution is too big", "Invalid source image")
+var (
+	ErrSourceResolutionTooBig = ierrors.New(422, "Source image resolution is too big", "Invalid source image")
+	ErrAnimationTooBig        = ierrors.New(422, "Source animation is too big", "Invalid source image")
+	ErrAnimationResultTooBig  = ierrors.New(422, "Resulting animation dimensions are too big", "Invalid source image")
+	ErrResultTooBig           = ierrors.New(422, "Resulting image dimensions are too big", "Invalid source image")
+)
 
-func CheckDimensions(width, height int) error {
-	if width*height > config.MaxSrcResolution {
+func CheckDimensions(width, height int, opts Options) error {
+	if width*height > opts.MaxSrcResolution {
 		return ErrSourceResolutionTooBig
 	}
 
 	return nil
 }
+
+// CheckAnimationFrames returns the number of the animation frames to process
+// according to the animation limits
+func CheckAnimationFrames(width, frameHeight, framesCount int, opts Options) (int, error) {
+	maxFrames := opts.MaxAnimationFrames
+
+	if opts.MaxAnimationResolution > 0 && width*frameHeight > 0 {
+		if byRes := opts.MaxAnimationResolution / (width * frameHeight); byRes < maxFrames {
+			maxFrames = byRes
+		}
+	}
+
+	if framesCount <= maxFrames {
+		return framesCount, nil
+	}
+
+	if config.RejectOversizedAnimations || maxFrames < 1 {
+		return 0, ErrAnimationTooBig
+	}
+
+	return maxFrames, nil
+}
+
+// CheckResultDimensions checks the dimensions of the resulting image
+// that can't be calculated from the processing options
+func CheckResultDimensions(width, height int, opts Options) error {
+	maxDim := opts.MaxResultDimension
+
+	if maxDim > 0 && (width > maxDim || height > maxDim) {
+		return ErrResultTooBig
+	}
+
+	return nil
+}
+
+// CheckAnimationResultDimensions checks the dimensions of the processed animation frame
+func CheckAnimationResultDimensions(width, height int, opts Options) error {
+	maxDim := opts.MaxAnimationResultDimension
+
+	if maxDim > 0 && (width > maxDim || height > maxDim) {
+		return ErrAnimationResultTooBig
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package security
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type ImageSizeTestSuite struct {
+	suite.Suite
+}
+
+func (s *ImageSizeTestSuite) SetupTest() {
+	config.Reset()
+	config.MaxAnimationFrames = 10
+}
+
+func (s *ImageSizeTestSuite) TestCheckAnimationFramesTruncate() {
+	n, err := CheckAnimationFrames(100, 100, 20, DefaultOptions())
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 10, n)
+
+	config.MaxAnimationResolution = 50000
+
+	n, err = CheckAnimationFrames(100, 100, 20, DefaultOptions())
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 5, n)
+
+	n, err = CheckAnimationFrames(100, 100, 3, DefaultOptions())
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 3, n)
+}
+
+func (s *ImageSizeTestSuite) TestCheckAnimationFramesReject() {
+	config.RejectOversizedAnimations = true
+
+	_, err := CheckAnimationFrames(100, 100, 20, DefaultOptions())
+	assert.Equal(s.T(), ErrAnimationTooBig, err)
+
+	n, err := CheckAnimationFrames(100, 100, 10, DefaultOptions())
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), 10, n)
+}
+
+func (s *ImageSizeTestSuite) TestCheckAnimationFramesFrameTooBig() {
+	config.MaxAnimationResolution = 5000
+
+	_, err := CheckAnimationFrames(100, 100, 2, DefaultOptions())
+	assert.Equal(s.T(), ErrAnimationTooBig, err)
+}
+
+func (s *ImageSizeTestSuite) TestCheckAnimationResultDimensions() {
+	require.Nil(s.T(), CheckAnimationResultDimensions(5000, 5000, DefaultOptions()))
+
+	config.MaxAnimationResultDimension = 500
+
+	require.Nil(s.T(), CheckAnimationResultDimensions(500, 300, DefaultOptions()))
+	assert.Equal(s.T(), ErrAnimationResultTooBig, CheckAnimationResultDimensions(300, 501, DefaultOptions()))
+}
+
+func (s *ImageSizeTestSuite) TestCheckResultDimensions() {
+	require.Nil(s.T(), CheckResultDimensions(5000, 5000, DefaultOptions()))
+
+	config.MaxResultDimension = 500
+
+	require.Nil(s.T(), CheckResultDimensions(500, 300, DefaultOptions()))
+	assert.Equal(s.T(), ErrResultTooBig, CheckResultDimensions(501, 300, DefaultOptions()))
+}
+
+func TestImageSize(t *testing.T) {
+	suite.Run(t, new(ImageSizeTestSuite))
+}
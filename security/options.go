@@ -0,0 +1,26 @@
+package security
+
+import "github.com/imgproxy/imgproxy/v3/config"
+
+// Options are the limits applied to the source and the resulting images.
+// They are set from the config and can be overridden by presets
+type Options struct {
+	MaxSrcResolution            int
+	MaxSrcFileSize              int
+	MaxAnimationFrames          int
+	MaxAnimationResolution      int
+	MaxResultDimension          int
+	MaxAnimationResultDimension int
+}
+
+// DefaultOptions returns the limits set in the config
+func DefaultOptions() Options {
+	return Options{
+		MaxSrcResolution:            config.MaxSrcResolution,
+		MaxSrcFileSize:              config.MaxSrcFileSize,
+		MaxAnimationFrames:          config.MaxAnimationFrames,
+		MaxAnimationResolution:      config.MaxAnimationResolution,
+		MaxResultDimension:          config.MaxResultDimension,
+		MaxAnimationResultDimension: config.MaxAnimationResultDimension,
+	}
+}
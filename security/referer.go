@@ -0,0 +1,36 @@
+package security
+
+import (
+	"net/http"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// VerifyReferer checks if the Referer or, when it's missing, the Origin header
+// of the request is allowed
+func VerifyReferer(header http.Header) bool {
+	if len(config.AllowedReferers) == 0 {
+		return true
+	}
+
+	referer := header.Get("Referer")
+	if len(referer) == 0 {
+		// Origin doesn't contain a path, so we add a trailing slash
+		// to match the patterns like https://example.com/
+		if origin := header.Get("Origin"); len(origin) > 0 && origin != "null" {
+			referer = origin + "/"
+		}
+	}
+
+	if len(referer) == 0 {
+		return config.AllowEmptyReferer
+	}
+
+	for _, allowed := range config.AllowedReferers {
+		if allowed.MatchString(referer) {
+			return true
+		}
+	}
+
+	return false
+}
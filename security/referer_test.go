@@ -0,0 +1,63 @@
+package security
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/config/configurators"
+)
+
+type RefererTestSuite struct {
+	suite.Suite
+}
+
+func (s *RefererTestSuite) SetupTest() {
+	config.Reset()
+	config.AllowedReferers = []*regexp.Regexp{
+		configurators.RegexpFromPattern("https://example.com/"),
+		configurators.RegexpFromPattern("https://*.example.com/"),
+	}
+}
+
+func (s *RefererTestSuite) header(name, value string) http.Header {
+	h := make(http.Header)
+	if len(name) > 0 {
+		h.Set(name, value)
+	}
+	return h
+}
+
+func (s *RefererTestSuite) TestVerifyReferer() {
+	assert.True(s.T(), VerifyReferer(s.header("Referer", "https://example.com/page")))
+	assert.True(s.T(), VerifyReferer(s.header("Referer", "https://www.example.com/")))
+	assert.True(s.T(), VerifyReferer(s.header("Origin", "https://app.example.com")))
+
+	assert.False(s.T(), VerifyReferer(s.header("Referer", "https://example.com.evil.com/")))
+	assert.False(s.T(), VerifyReferer(s.header("Referer", "https://evil.com/https://example.com/")))
+	assert.False(s.T(), VerifyReferer(s.header("Origin", "https://evil.com")))
+}
+
+func (s *RefererTestSuite) TestVerifyEmptyReferer() {
+	assert.True(s.T(), VerifyReferer(s.header("", "")))
+	assert.True(s.T(), VerifyReferer(s.header("Origin", "null")))
+
+	config.AllowEmptyReferer = false
+
+	assert.False(s.T(), VerifyReferer(s.header("", "")))
+	assert.False(s.T(), VerifyReferer(s.header("Origin", "null")))
+}
+
+func (s *RefererTestSuite) TestVerifyRefererDisabled() {
+	config.AllowedReferers = nil
+
+	assert.True(s.T(), VerifyReferer(s.header("Referer", "https://evil.com/")))
+}
+
+func TestReferer(t *testing.T) {
+	suite.Run(t, new(RefererTestSuite))
+}
@@ -33,6 +33,18 @@ func VerifySignature(signature, path string) error {
 	return ErrInvalidSignature
 }
 
+// Sign returns the signature of the path made with the first key/salt pair.
+// Returns "unsafe" when the URL signature is disabled
+func Sign(path string) string {
+	if len(config.Keys) == 0 || len(config.Salts) == 0 {
+		return "unsafe"
+	}
+
+	return base64.RawURLEncoding.EncodeToString(
+		signatureFor(path, config.Keys[0], config.Salts[0], config.SignatureSize),
+	)
+}
+
 func signatureFor(str string, key, salt []byte, signatureSize int) []byte {
 	mac := hmac.New(sha256.New, key)
 	mac.Write(salt)
@@ -1,9 +1,13 @@
 package security
 
 import (
+	"encoding/base64"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/imgproxy/imgproxy/v3/config"
@@ -25,6 +29,17 @@ func (s *SignatureTestSuite) TestVerifySignature() {
 	assert.Nil(s.T(), err)
 }
 
+func (s *SignatureTestSuite) TestSign() {
+	assert.Equal(s.T(), "dtLwhdnPPiu_epMl1LrzheLpvHas-4mwvY6L3Z8WwlY", Sign("asd"))
+
+	config.SignatureSize = 8
+	assert.Equal(s.T(), "dtLwhdnPPis", Sign("asd"))
+
+	config.Keys = nil
+	config.Salts = nil
+	assert.Equal(s.T(), "unsafe", Sign("asd"))
+}
+
 func (s *SignatureTestSuite) TestVerifySignatureTruncated() {
 	config.SignatureSize = 8
 
@@ -32,6 +47,47 @@ func (s *SignatureTestSuite) TestVerifySignatureTruncated() {
 	assert.Nil(s.T(), err)
 }
 
+func (s *SignatureTestSuite) TestVerifyThumborSignature() {
+	config.ThumborSecurityKey = "MY_SECURE_KEY"
+
+	assert.Nil(s.T(), VerifyThumborSignature("LJf0SE-nC_UfcIpJvgCq5_fy6q4=", "/300x200/smart/thumbor.org/img.jpg"))
+	assert.Nil(s.T(), VerifyThumborSignature("LJf0SE-nC_UfcIpJvgCq5_fy6q4", "/300x200/smart/thumbor.org/img.jpg"))
+	assert.Nil(s.T(), VerifyThumborSignature("cZcvwiXD2W7lKDS6n6OyD7WRxvQ%3D", "/fit-in/300x200/http://images.dev/lorem%20ipsum.jpg"))
+
+	assert.Equal(s.T(), ErrInvalidSignature, VerifyThumborSignature("LJf0SE-nC_UfcIpJvgCq5_fy6q4=", "/300x200/thumbor.org/img.jpg"))
+	assert.Equal(s.T(), ErrInvalidSignature, VerifyThumborSignature("unsafe", "/300x200/smart/thumbor.org/img.jpg"))
+
+	config.ThumborSecurityKey = ""
+
+	// Unsigned Thumbor URLs can't bypass the URL signature
+	assert.Equal(s.T(), ErrInvalidSignature, VerifyThumborSignature("unsafe", "/300x200/smart/thumbor.org/img.jpg"))
+
+	config.Keys = nil
+	config.Salts = nil
+
+	assert.Nil(s.T(), VerifyThumborSignature("unsafe", "/300x200/smart/thumbor.org/img.jpg"))
+}
+
+func (s *SignatureTestSuite) TestVerifyCloudinarySignature() {
+	config.CloudinaryAPISecret = "abcd"
+
+	assert.Nil(s.T(), VerifyCloudinarySignature("sjZpNVyf", "/c_fill,w_300,h_200/sample.jpg"))
+	assert.Nil(s.T(), VerifyCloudinarySignature("sjZpNVyf", "/c_fill,w_300,h_200/v1234/sample.jpg"))
+
+	assert.Equal(s.T(), ErrInvalidSignature, VerifyCloudinarySignature("sjZpNVyf", "/c_fill,w_400,h_200/sample.jpg"))
+	assert.Equal(s.T(), ErrInvalidSignature, VerifyCloudinarySignature("", "/c_fill,w_300,h_200/sample.jpg"))
+
+	config.CloudinaryAPISecret = ""
+
+	// Unsigned Cloudinary URLs can't bypass the URL signature
+	assert.Equal(s.T(), ErrInvalidSignature, VerifyCloudinarySignature("", "/c_fill,w_300,h_200/sample.jpg"))
+
+	config.Keys = nil
+	config.Salts = nil
+
+	assert.Nil(s.T(), VerifyCloudinarySignature("", "/c_fill,w_300,h_200/sample.jpg"))
+}
+
 func (s *SignatureTestSuite) TestVerifySignatureInvalid() {
 	err := VerifySignature("dtLwhdnPPis", "asd")
 	assert.Error(s.T(), err)
@@ -51,6 +107,52 @@ func (s *SignatureTestSuite) TestVerifySignatureMultiplePairs() {
 	assert.Error(s.T(), err)
 }
 
+func (s *SignatureTestSuite) signV2(claims string, path string) (string, string) {
+	path = "/" + base64.RawURLEncoding.EncodeToString([]byte(claims)) + path
+	sig := signatureFor("v2"+path, config.Keys[0], config.Salts[0], 32)
+	return "v2." + base64.RawURLEncoding.EncodeToString(sig), path
+}
+
+func (s *SignatureTestSuite) TestVerifySignatureV2() {
+	sig, path := s.signV2(`{"src":["http://images.dev/"]}`, "/rs:fill:10:10/plain/http://images.dev/lorem.jpg")
+
+	claims, rest, err := VerifySignatureV2(sig, "", path)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "/rs:fill:10:10/plain/http://images.dev/lorem.jpg", rest)
+	assert.Nil(s.T(), claims.VerifySourceURL("http://images.dev/lorem.jpg"))
+	assert.Error(s.T(), claims.VerifySourceURL("http://images.dev.evil.com/lorem.jpg"))
+}
+
+func (s *SignatureTestSuite) TestVerifySignatureV2SignedPrefix() {
+	sig, path := s.signV2(`{}`, "/rs:fill:10:10/plain/http://images.dev/lorem.jpg")
+
+	_, _, err := VerifySignatureV2(sig, "/avatars", path)
+	assert.Equal(s.T(), ErrInvalidSignature, err)
+
+	sig = "v2." + base64.RawURLEncoding.EncodeToString(signatureFor("v2/avatars"+path, config.Keys[0], config.Salts[0], 32))
+
+	_, rest, err := VerifySignatureV2(sig, "/avatars", path)
+	require.Nil(s.T(), err)
+	assert.Equal(s.T(), "/rs:fill:10:10/plain/http://images.dev/lorem.jpg", rest)
+}
+
+func (s *SignatureTestSuite) TestVerifySignatureV2Expired() {
+	claims := fmt.Sprintf(`{"exp":%d}`, time.Now().Add(-time.Minute).Unix())
+	sig, path := s.signV2(claims, "/rs:fill:10:10/plain/http://images.dev/lorem.jpg")
+
+	_, _, err := VerifySignatureV2(sig, "", path)
+	assert.Equal(s.T(), ErrExpiredClaims, err)
+}
+
+func (s *SignatureTestSuite) TestVerifySignatureV2NotV1() {
+	// v1 signature can't be used as v2 one
+	path := "/" + base64.RawURLEncoding.EncodeToString([]byte("{}")) + "/plain/http://images.dev/lorem.jpg"
+	sig := signatureFor(path, config.Keys[0], config.Salts[0], 32)
+
+	_, _, err := VerifySignatureV2("v2."+base64.RawURLEncoding.EncodeToString(sig), "", path)
+	assert.Equal(s.T(), ErrInvalidSignature, err)
+}
+
 func TestSignature(t *testing.T) {
 	suite.Run(t, new(SignatureTestSuite))
 }
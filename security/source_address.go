@@ -0,0 +1,76 @@
+package security
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// SourceAddressError is returned when imgproxy is not allowed
+// to connect to the source address
+type SourceAddressError string
+
+func (e SourceAddressError) Error() string {
+	return string(e)
+}
+
+var privateNetworks = mustParseCIDRs(
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"fc00::/7",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+
+	for i, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = ipnet
+	}
+
+	return nets
+}
+
+func ipInNetworks(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifySourceNetwork checks if imgproxy is allowed to connect to the address.
+// The address should be already resolved
+func VerifySourceNetwork(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return SourceAddressError(fmt.Sprintf("Invalid source address: %s", addr))
+	}
+
+	if ipInNetworks(ip, config.AllowedSourceNetworks) {
+		return nil
+	}
+
+	switch {
+	case ip.IsUnspecified() || ip.IsMulticast():
+	case ip.IsLoopback() && !config.AllowLoopbackSourceAddresses:
+	case (ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()) && !config.AllowLinkLocalSourceAddresses:
+	case ipInNetworks(ip, privateNetworks) && !config.AllowPrivateSourceAddresses:
+	default:
+		return nil
+	}
+
+	return SourceAddressError(fmt.Sprintf("Source address is not allowed: %s", addr))
+}
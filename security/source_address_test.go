@@ -0,0 +1,49 @@
+package security
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type SourceAddressTestSuite struct {
+	suite.Suite
+}
+
+func (s *SourceAddressTestSuite) SetupTest() {
+	config.Reset()
+}
+
+func (s *SourceAddressTestSuite) TestVerifySourceNetwork() {
+	assert.Nil(s.T(), VerifySourceNetwork("93.184.216.34:80"))
+	assert.Nil(s.T(), VerifySourceNetwork("[2606:2800:220:1:248:1893:25c8:1946]:443"))
+
+	assert.Error(s.T(), VerifySourceNetwork("127.0.0.1:80"))
+	assert.Error(s.T(), VerifySourceNetwork("[::1]:80"))
+	assert.Error(s.T(), VerifySourceNetwork("169.254.169.254:80"))
+	assert.Error(s.T(), VerifySourceNetwork("10.1.2.3:80"))
+	assert.Error(s.T(), VerifySourceNetwork("[fd00:ec2::254]:80"))
+	assert.Error(s.T(), VerifySourceNetwork("0.0.0.0:80"))
+}
+
+func (s *SourceAddressTestSuite) TestVerifySourceNetworkAllowed() {
+	config.AllowLoopbackSourceAddresses = true
+	config.AllowPrivateSourceAddresses = true
+
+	assert.Nil(s.T(), VerifySourceNetwork("127.0.0.1:80"))
+	assert.Nil(s.T(), VerifySourceNetwork("10.1.2.3:80"))
+	assert.Error(s.T(), VerifySourceNetwork("169.254.169.254:80"))
+
+	_, ipnet, _ := net.ParseCIDR("169.254.0.0/16")
+	config.AllowedSourceNetworks = []*net.IPNet{ipnet}
+
+	assert.Nil(s.T(), VerifySourceNetwork("169.254.169.254:80"))
+}
+
+func TestSourceAddress(t *testing.T) {
+	suite.Run(t, new(SourceAddressTestSuite))
+}
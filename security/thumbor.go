@@ -0,0 +1,55 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+// VerifyThumborSignature checks the signature of the Thumbor-compatible URL.
+// Thumbor signs the path after the signature with HMAC-SHA1 and encodes
+// the result with URL-safe base64
+func VerifyThumborSignature(signature, path string) error {
+	if len(config.ThumborSecurityKey) == 0 {
+		// Unsigned Thumbor URLs would bypass the imgproxy URL signature
+		if len(config.Keys) > 0 {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	if unescaped, err := url.PathUnescape(signature); err == nil {
+		signature = unescaped
+	}
+
+	messageMAC, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(signature, "="))
+	if err != nil {
+		return ErrInvalidSignatureEncoding
+	}
+
+	path = strings.TrimPrefix(path, "/")
+
+	if hmac.Equal(messageMAC, thumborSignatureFor(path)) {
+		return nil
+	}
+
+	// Thumbor clients may sign either the escaped or the unescaped path
+	if unescaped, err := url.PathUnescape(path); err == nil && unescaped != path {
+		if hmac.Equal(messageMAC, thumborSignatureFor(unescaped)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func thumborSignatureFor(path string) []byte {
+	mac := hmac.New(sha1.New, []byte(config.ThumborSecurityKey))
+	mac.Write([]byte(path))
+	return mac.Sum(nil)
+}
@@ -3,24 +3,38 @@ package main
 import (
 	"context"
 	"crypto/subtle"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"golang.org/x/net/netutil"
 
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/errorreport"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/listener"
 	"github.com/imgproxy/imgproxy/v3/metrics"
-	"github.com/imgproxy/imgproxy/v3/reuseport"
 	"github.com/imgproxy/imgproxy/v3/router"
 )
 
 var (
 	imgproxyIsRunningMsg = []byte("imgproxy is running")
 
+	// tlsCertificate is the server TLS certificate. It's nil when TLS is disabled
+	tlsCertificate *listener.Certificate
+
+	// http3Server serves HTTP/3 requests. It's nil when HTTP/3 is disabled
+	http3Server *http3.Server
+
 	errInvalidSecret = ierrors.New(403, "Invalid secret", "Forbidden")
 )
 
@@ -28,9 +42,39 @@ func buildRouter() *router.Router {
 	r := router.New(config.PathPrefix)
 
 	r.GET("/", handleLanding, true)
-	r.GET("/health", handleHealth, true)
+	if len(config.PathPrefix) > 0 {
+		// Path-based ingress routing may not add the trailing slash
+		r.GET("", handleLanding, true)
+	}
+	r.GET(config.HealthPath, handleHealth, true)
+	if len(config.LivenessPath) > 0 {
+		r.GET(config.LivenessPath, handleHealth, true)
+	}
+	if len(config.ReadinessPath) > 0 {
+		r.GET(config.ReadinessPath, handleReadiness, true)
+	}
 	r.GET("/favicon.ico", handleFavicon, true)
-	r.GET("/", withMetrics(withPanicHandler(withCORS(withSecret(handleProcessing)))), false)
+
+	if len(config.DebugEndpointsSecret) > 0 {
+		r.GET("/debug/pprof/", withDebugSecret(handleDebugPprof), false)
+		r.GET("/debug/stats", withDebugSecret(handleDebugStats), true)
+		r.POST("/debug/vips/drop_cache", withDebugSecret(handleDebugDropVipsCache), true)
+		r.GET("/debug/presets", withDebugSecret(handleDebugPresets), true)
+	}
+
+	if config.EnableJSONAPI {
+		r.POST("/process", withMetrics(withPanicHandler(withClientLimits(withCORS(withSecret(handleJSONAPI))))), true)
+	}
+
+	if config.EnableInfoEndpoint {
+		r.GET("/info/", withMetrics(withPanicHandler(withClientLimits(withCORS(withSecret(handleInfo))))), false)
+	}
+
+	if config.EnableValidateEndpoint {
+		r.GET("/validate/", withMetrics(withPanicHandler(withClientLimits(withCORS(withSecret(handleValidate))))), false)
+	}
+
+	r.GET("/", withMetrics(withPanicHandler(withClientLimits(withCORS(withSecret(handleProcessing))))), false)
 	r.HEAD("/", withCORS(handleHead), false)
 	r.OPTIONS("/", withCORS(handleHead), false)
 
@@ -38,16 +82,26 @@ func buildRouter() *router.Router {
 }
 
 func startServer(cancel context.CancelFunc) (*http.Server, error) {
-	l, err := reuseport.Listen(config.Network, config.Bind)
+	listeners, err := listener.Listen(config.Network, config.Bind)
 	if err != nil {
 		return nil, fmt.Errorf("Can't start server: %s", err)
 	}
-	l = netutil.LimitListener(l, config.MaxClients)
 
 	s := &http.Server{
-		Handler:        buildRouter(),
-		ReadTimeout:    time.Duration(config.ReadTimeout) * time.Second,
-		MaxHeaderBytes: 1 << 20,
+		Handler:           buildRouter(),
+		ReadTimeout:       time.Duration(config.ReadTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(config.ReadHeaderTimeout) * time.Second,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+		ConnContext:       router.ConnContext,
+		ConnState:         trackConnState,
+	}
+
+	if len(config.TLSCertPath) > 0 {
+		if tlsCertificate, err = listener.LoadCertificate(config.TLSCertPath, config.TLSKeyPath); err != nil {
+			return nil, err
+		}
+
+		s.TLSConfig = &tls.Config{GetCertificate: tlsCertificate.GetCertificate}
 	}
 
 	if config.KeepAliveTimeout > 0 {
@@ -56,15 +110,145 @@ func startServer(cancel context.CancelFunc) (*http.Server, error) {
 		s.SetKeepAlivesEnabled(false)
 	}
 
+	if config.EnableHTTP3 {
+		if err = startHTTP3Server(s, listeners, cancel); err != nil {
+			return nil, err
+		}
+	}
+
+	h2s := &http2.Server{
+		MaxConcurrentStreams: uint32(config.HTTP2MaxConcurrentStreams),
+		IdleTimeout:          s.IdleTimeout,
+	}
+
+	if err = http2.ConfigureServer(s, h2s); err != nil {
+		return nil, fmt.Errorf("Can't configure HTTP/2: %s", err)
+	}
+
+	if config.EnableH2C {
+		s.Handler = h2c.NewHandler(s.Handler, h2s)
+	}
+
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			l = netutil.LimitListener(l, config.MaxClients)
+
+			var err error
+
+			if s.TLSConfig != nil {
+				log.Infof("Starting TLS server at %s", l.Addr())
+				err = s.ServeTLS(l, "", "")
+			} else {
+				log.Infof("Starting server at %s", l.Addr())
+				err = s.Serve(l)
+			}
+
+			if err != nil && err != http.ErrServerClosed {
+				log.Error(err)
+			}
+			cancel()
+		}(l)
+	}
+
+	return s, nil
+}
+
+// startHTTP3Server starts the HTTP/3 server that shares the handler and
+// the TLS config with s, and makes s advertise it with the Alt-Svc header.
+// When IMGPROXY_HTTP3_BIND is not set, the HTTP/3 server listens
+// on the UDP port of the first TCP listener
+func startHTTP3Server(s *http.Server, listeners []net.Listener, cancel context.CancelFunc) error {
+	addr := config.HTTP3Bind
+
+	if len(addr) == 0 {
+		for _, l := range listeners {
+			if tcpAddr, ok := l.Addr().(*net.TCPAddr); ok {
+				addr = tcpAddr.String()
+				break
+			}
+		}
+	}
+
+	if len(addr) == 0 {
+		return errors.New("Can't start HTTP/3 server: there are no TCP listeners to share the port with, set IMGPROXY_HTTP3_BIND")
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("Can't start HTTP/3 server: %s", err)
+	}
+
+	ln, err := quic.ListenEarly(
+		conn,
+		http3.ConfigureTLSConfig(s.TLSConfig),
+		&quic.Config{MaxIdleTimeout: s.IdleTimeout},
+	)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Can't start HTTP/3 server: %s", err)
+	}
+
+	http3Server = &http3.Server{
+		Handler:        s.Handler,
+		MaxHeaderBytes: s.MaxHeaderBytes,
+	}
+
+	handler := s.Handler
+	s.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// It fails only until the HTTP/3 server starts listening,
+		// so we don't need to handle the error
+		http3Server.SetQuicHeaders(rw.Header())
+		handler.ServeHTTP(rw, r)
+	})
+
 	go func() {
-		log.Infof("Starting server at %s", config.Bind)
-		if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+		log.Infof("Starting HTTP/3 server at %s", ln.Addr())
+
+		err := http3Server.ServeListener(newHTTP3Listener(ln, config.MaxClients))
+		if err != nil && err != http.ErrServerClosed {
 			log.Error(err)
 		}
 		cancel()
 	}()
 
-	return s, nil
+	return nil
+}
+
+// http3Listener limits the number of simultaneously open HTTP/3 connections
+// the same way netutil.LimitListener does for TCP listeners,
+// and counts them as open connections
+type http3Listener struct {
+	*quic.EarlyListener
+
+	sem chan struct{}
+}
+
+func newHTTP3Listener(l *quic.EarlyListener, n int) http3Listener {
+	return http3Listener{EarlyListener: l, sem: make(chan struct{}, n)}
+}
+
+func (l http3Listener) Accept(ctx context.Context) (quic.EarlyConnection, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	conn, err := l.EarlyListener.Accept(ctx)
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+
+	atomic.AddInt64(&openConnections, 1)
+
+	go func() {
+		<-conn.Context().Done()
+		atomic.AddInt64(&openConnections, -1)
+		<-l.sem
+	}()
+
+	return conn, nil
 }
 
 func shutdownServer(s *http.Server) {
@@ -73,6 +257,12 @@ func shutdownServer(s *http.Server) {
 	ctx, close := context.WithTimeout(context.Background(), 5*time.Second)
 	defer close()
 
+	if http3Server != nil {
+		if err := http3Server.Close(); err != nil {
+			log.Errorf("Can't shut down HTTP/3 server: %s", err)
+		}
+	}
+
 	s.Shutdown(ctx)
 }
 
@@ -89,17 +279,6 @@ func withMetrics(h router.RouteHandler) router.RouteHandler {
 	}
 }
 
-func withCORS(h router.RouteHandler) router.RouteHandler {
-	return func(reqID string, rw http.ResponseWriter, r *http.Request) {
-		if len(config.AllowOrigin) > 0 {
-			rw.Header().Set("Access-Control-Allow-Origin", config.AllowOrigin)
-			rw.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		}
-
-		h(reqID, rw, r)
-	}
-}
-
 func withSecret(h router.RouteHandler) router.RouteHandler {
 	if len(config.Secret) == 0 {
 		return h
@@ -120,6 +299,10 @@ func withPanicHandler(h router.RouteHandler) router.RouteHandler {
 	return func(reqID string, rw http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rerr := recover(); rerr != nil {
+				if rerr == http.ErrAbortHandler {
+					panic(rerr)
+				}
+
 				err, ok := rerr.(error)
 				if !ok {
 					panic(rerr)
@@ -128,7 +311,7 @@ func withPanicHandler(h router.RouteHandler) router.RouteHandler {
 				ierr := ierrors.Wrap(err, 3)
 
 				if ierr.Unexpected {
-					errorreport.Report(err, r)
+					errorreport.Report(err, reqID, r)
 				}
 
 				router.LogResponse(reqID, r, ierr.StatusCode, ierr)
@@ -143,6 +326,8 @@ func withPanicHandler(h router.RouteHandler) router.RouteHandler {
 			}
 		}()
 
+		r = r.WithContext(errorreport.StartRequest(r.Context()))
+
 		h(reqID, rw, r)
 	}
 }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/http/cookiejar"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/bufpool"
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/cookies"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/router"
+)
+
+var (
+	streamReqHeaders = []string{
+		"If-None-Match",
+		"If-Modified-Since",
+		"If-Range",
+		"Range",
+	}
+
+	streamRespHeaders = []string{
+		"Cache-Control",
+		"Expires",
+		"ETag",
+		"Last-Modified",
+		"Content-Type",
+		"Content-Disposition",
+		"Content-Range",
+		"Accept-Ranges",
+	}
+
+	errInvalidRange        = errors.New("Invalid range")
+	errRangeNotSatisfiable = errors.New("Range not satisfiable")
+
+	errRawContentTypeNotAllowed = ierrors.New(422, "Source content type is not allowed in raw mode", "Invalid source image")
+)
+
+// isRawContentTypeAllowed checks if the content of the type can be served in raw mode.
+// Only the images imgproxy knows and videos are allowed. SVG is not allowed
+// since it may contain scripts and raw content is not sanitized
+func isRawContentTypeAllowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(mediaType, "video/") {
+		return true
+	}
+
+	for _, t := range imagetype.Types {
+		if t != imagetype.SVG && t.Mime() == mediaType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifRangeMatches checks if the If-Range request header matches the ETag
+// or the Last-Modified response header. When it doesn't, the Range header
+// is ignored and the whole content is sent
+func ifRangeMatches(r *http.Request, header http.Header) bool {
+	ifRange := r.Header.Get("If-Range")
+	if len(ifRange) == 0 {
+		return true
+	}
+
+	// If-Range requires the strong comparison of the entity tags,
+	// so weak ones never match
+	if strings.HasPrefix(ifRange, `"`) {
+		etag := header.Get("ETag")
+		return len(etag) > 0 && etag == ifRange
+	}
+
+	if strings.HasPrefix(ifRange, "W/") {
+		return false
+	}
+
+	ifRangeTime, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return ifRangeTime.Equal(lastModified)
+}
+
+// parseRange parses the Range header value for the content of the provided size.
+// Only single byte ranges are supported
+func parseRange(header string, size int) (int, int, error) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, 0, errInvalidRange
+	}
+
+	spec := strings.TrimSpace(header[len("bytes="):])
+
+	// We don't support multipart ranges
+	if strings.IndexByte(spec, ',') >= 0 {
+		return 0, 0, errInvalidRange
+	}
+
+	i := strings.IndexByte(spec, '-')
+	if i < 0 {
+		return 0, 0, errInvalidRange
+	}
+
+	startStr, endStr := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	// Suffix range: the last N bytes
+	if len(startStr) == 0 {
+		n, err := strconv.Atoi(endStr)
+		if err != nil || n < 0 {
+			return 0, 0, errInvalidRange
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, errRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, nil
+	}
+
+	start, err := strconv.Atoi(startStr)
+	if err != nil || start < 0 {
+		return 0, 0, errInvalidRange
+	}
+
+	if start >= size {
+		return 0, 0, errRangeNotSatisfiable
+	}
+
+	end := size - 1
+
+	if len(endStr) > 0 {
+		e, err := strconv.Atoi(endStr)
+		if err != nil || e < start {
+			return 0, 0, errInvalidRange
+		}
+		if e < end {
+			end = e
+		}
+	}
+
+	return start, end - start + 1, nil
+}
+
+func streamOriginImage(reqID string, r *http.Request, rw http.ResponseWriter, po *options.ProcessingOptions, imageURL string) {
+	var (
+		cookieJar *cookiejar.Jar
+		err       error
+	)
+
+	imgRequestHeader := make(http.Header)
+
+	for _, k := range streamReqHeaders {
+		if v := r.Header.Get(k); len(v) != 0 {
+			imgRequestHeader.Set(k, v)
+		}
+	}
+
+	if config.ForwardRequestID {
+		imgRequestHeader.Set(router.RequestIDHeader, reqID)
+	}
+
+	if config.CookiePassthrough {
+		if cookieJar, err = cookies.JarFromRequest(r); err != nil {
+			panic(err)
+		}
+	}
+
+	res, err := imagedata.RequestRaw(imageURL, imgRequestHeader, cookieJar)
+	if err != nil {
+		panic(err)
+	}
+	defer res.Body.Close()
+
+	// Not modified and range not satisfiable responses don't have the content
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusPartialContent {
+		if !isRawContentTypeAllowed(res.Header.Get("Content-Type")) {
+			panic(errRawContentTypeNotAllowed)
+		}
+
+		if po.SecurityOptions.MaxSrcFileSize > 0 && res.ContentLength > int64(po.SecurityOptions.MaxSrcFileSize) {
+			panic(imagedata.ErrSourceFileTooBig)
+		}
+	}
+
+	for _, k := range streamRespHeaders {
+		if v := res.Header.Get(k); len(v) != 0 {
+			rw.Header().Set(k, v)
+		}
+	}
+
+	if res.ContentLength >= 0 {
+		rw.Header().Set("Content-Length", strconv.Itoa(int(res.ContentLength)))
+	}
+
+	setCacheControl(rw, po, map[string]string{
+		"Cache-Control": res.Header.Get("Cache-Control"),
+		"Expires":       res.Header.Get("Expires"),
+	})
+	setSurrogateKey(rw, po, imageURL)
+	setPresetResponseHeaders(rw, po)
+
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(res.StatusCode)
+
+	_, copyErr := bufpool.Copy(rw, imagedata.LimitReader(res.Body, po.SecurityOptions))
+
+	router.LogResponse(
+		reqID, r, res.StatusCode, nil,
+		log.Fields{
+			"image_url":          imageURL,
+			"processing_options": po,
+		},
+	)
+
+	if copyErr != nil {
+		// The response is already partially sent, so the only thing we can do
+		// is to abort it
+		log.Warningf("Could not stream image %s: %s", imageURL, copyErr)
+		panic(http.ErrAbortHandler)
+	}
+}
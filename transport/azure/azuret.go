@@ -2,21 +2,49 @@ package azure
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 
+	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/imgproxy/imgproxy/v3/config"
 )
 
 type transport struct {
 	serviceURL *azblob.ServiceURL
+	// sasPipeline is used for the containers that have SAS tokens.
+	// SAS tokens are passed in the query string, so no credential is needed
+	sasPipeline pipeline.Pipeline
+}
+
+func newCredential() (azblob.Credential, error) {
+	switch {
+	case config.ABSUseManagedIdentity:
+		return newManagedIdentityCredential()
+	case len(config.ABSKey) > 0:
+		return azblob.NewSharedKeyCredential(config.ABSName, config.ABSKey)
+	default:
+		// Public containers or the containers accessed with SAS tokens only
+		return azblob.NewAnonymousCredential(), nil
+	}
+}
+
+// containerSASToken returns the SAS token for the container.
+// The account SAS token is used if the container doesn't have its own one
+func containerSASToken(container string) string {
+	if token, ok := config.ABSSASTokens[container]; ok {
+		return strings.TrimPrefix(token, "?")
+	}
+
+	return strings.TrimPrefix(config.ABSSASToken, "?")
 }
 
 func New() (http.RoundTripper, error) {
-	credential, err := azblob.NewSharedKeyCredential(config.ABSName, config.ABSKey)
+	credential, err := newCredential()
 	if err != nil {
 		return nil, err
 	}
@@ -34,15 +62,54 @@ func New() (http.RoundTripper, error) {
 
 	serviceURL := azblob.NewServiceURL(*endpointURL, pipeline)
 
-	return transport{&serviceURL}, nil
+	return transport{
+		serviceURL:  &serviceURL,
+		sasPipeline: azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{}),
+	}, nil
 }
 
 func (t transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
-	containerURL := t.serviceURL.NewContainerURL(strings.ToLower(req.URL.Host))
+	container := strings.ToLower(req.URL.Host)
+
+	containerURL := t.serviceURL.NewContainerURL(container)
 	blobURL := containerURL.NewBlockBlobURL(strings.TrimPrefix(req.URL.Path, "/"))
 
+	// Previous versions of the blob are available even if the blob
+	// was deleted when soft delete and versioning are enabled
+	if len(req.URL.RawQuery) > 0 {
+		blobURL = blobURL.WithVersionID(req.URL.RawQuery)
+	}
+
+	if sas := containerSASToken(container); len(sas) > 0 {
+		u := blobURL.URL()
+		if len(u.RawQuery) > 0 {
+			u.RawQuery += "&" + sas
+		} else {
+			u.RawQuery = sas
+		}
+
+		blobURL = azblob.NewBlockBlobURL(u, t.sasPipeline)
+	}
+
 	get, err := blobURL.Download(context.Background(), 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
 	if err != nil {
+		var stgErr azblob.StorageError
+		if errors.As(err, &stgErr) && stgErr.Response() != nil {
+			// Respond with the storage status so imgproxy can tell
+			// a missing or deleted blob from a failure
+			return &http.Response{
+				StatusCode:    stgErr.Response().StatusCode,
+				Proto:         "HTTP/1.0",
+				ProtoMajor:    1,
+				ProtoMinor:    0,
+				Header:        make(http.Header),
+				ContentLength: int64(len(stgErr.ServiceCode())),
+				Body:          ioutil.NopCloser(strings.NewReader(string(stgErr.ServiceCode()))),
+				Close:         false,
+				Request:       req,
+			}, nil
+		}
+
 		return nil, err
 	}
 
@@ -0,0 +1,142 @@
+package azure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type AzureTestSuite struct {
+	suite.Suite
+
+	server  *httptest.Server
+	request *http.Request
+}
+
+func (s *AzureTestSuite) SetupSuite() {
+	s.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		s.request = r
+
+		if r.URL.Path == "/test/deleted.jpg" {
+			rw.Header().Set("x-ms-error-code", "BlobNotFound")
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		rw.Header().Set("ETag", "\"test-etag\"")
+		rw.Write([]byte("test data"))
+	}))
+}
+
+func (s *AzureTestSuite) TearDownSuite() {
+	s.server.Close()
+}
+
+func (s *AzureTestSuite) SetupTest() {
+	config.Reset()
+
+	config.ABSEndpoint = s.server.URL
+
+	s.request = nil
+}
+
+func (s *AzureTestSuite) get(url string) *http.Response {
+	t, err := New()
+	s.Require().Nil(err)
+
+	req, err := http.NewRequest("GET", url, nil)
+	s.Require().Nil(err)
+
+	res, err := t.RoundTrip(req)
+	s.Require().Nil(err)
+
+	return res
+}
+
+func (s *AzureTestSuite) TestAnonymous() {
+	res := s.get("abs://test/image.jpg")
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	s.Require().Nil(err)
+
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().Equal("test data", string(data))
+	s.Require().Equal("/test/image.jpg", s.request.URL.Path)
+	s.Require().Empty(s.request.Header.Get("Authorization"))
+}
+
+func (s *AzureTestSuite) TestContainerSASToken() {
+	config.ABSSASToken = "sig=account"
+	config.ABSSASTokens = map[string]string{"test": "?sv=2020-08-04&sig=container"}
+
+	res := s.get("abs://test/image.jpg")
+	res.Body.Close()
+
+	s.Require().Equal("container", s.request.URL.Query().Get("sig"))
+	s.Require().Equal("2020-08-04", s.request.URL.Query().Get("sv"))
+
+	res = s.get("abs://other/image.jpg")
+	res.Body.Close()
+
+	s.Require().Equal("account", s.request.URL.Query().Get("sig"))
+}
+
+func (s *AzureTestSuite) TestVersionID() {
+	config.ABSSASToken = "sig=account"
+
+	res := s.get("abs://test/image.jpg?2021-10-25T05:41:32.5526810Z")
+	res.Body.Close()
+
+	s.Require().Equal("2021-10-25T05:41:32.5526810Z", s.request.URL.Query().Get("versionid"))
+	s.Require().Equal("account", s.request.URL.Query().Get("sig"))
+}
+
+func (s *AzureTestSuite) TestNotFound() {
+	res := s.get("abs://test/deleted.jpg")
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	s.Require().Nil(err)
+
+	s.Require().Equal(http.StatusNotFound, res.StatusCode)
+	s.Require().Equal("BlobNotFound", string(data))
+}
+
+func (s *AzureTestSuite) TestManagedIdentityToken() {
+	expiresOn := time.Now().Add(time.Hour).Unix()
+
+	identityServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		s.Require().Equal("test-header", r.Header.Get("X-IDENTITY-HEADER"))
+		s.Require().Equal(storageResource, r.URL.Query().Get("resource"))
+		s.Require().Equal("test-client", r.URL.Query().Get("client_id"))
+
+		fmt.Fprintf(rw, `{"access_token":"test-token","expires_on":"%d"}`, expiresOn)
+	}))
+	defer identityServer.Close()
+
+	os.Setenv("IDENTITY_ENDPOINT", identityServer.URL)
+	os.Setenv("IDENTITY_HEADER", "test-header")
+	defer os.Unsetenv("IDENTITY_ENDPOINT")
+	defer os.Unsetenv("IDENTITY_HEADER")
+
+	config.ABSManagedIdentityClientID = "test-client"
+
+	token, expires, err := fetchManagedIdentityToken(http.DefaultClient)
+	s.Require().Nil(err)
+
+	s.Require().Equal("test-token", token)
+	s.Require().Equal(expiresOn, expires.Unix())
+}
+
+func TestAzureTransport(t *testing.T) {
+	suite.Run(t, new(AzureTestSuite))
+}
@@ -0,0 +1,143 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+const (
+	imdsTokenEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	storageResource   = "https://storage.azure.com/"
+
+	// tokenRefreshMargin is how long before the expiration the token is refreshed
+	tokenRefreshMargin = 5 * time.Minute
+	// tokenRetryInterval is how long to wait before retrying a failed token refresh
+	tokenRetryInterval = 30 * time.Second
+)
+
+type managedIdentityToken struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresOn   json.Number `json:"expires_on"`
+}
+
+// managedIdentityRequest creates the token request. App Service, Azure Functions,
+// and Container Apps provide the identity endpoint through environment variables.
+// Otherwise, Azure Instance Metadata Service is used
+func managedIdentityRequest() (*http.Request, error) {
+	query := make(url.Values)
+	query.Set("resource", storageResource)
+
+	if len(config.ABSManagedIdentityClientID) > 0 {
+		query.Set("client_id", config.ABSManagedIdentityClientID)
+	}
+
+	endpoint := imdsTokenEndpoint
+	header := make(http.Header)
+
+	if identityEndpoint, identityHeader := os.Getenv("IDENTITY_ENDPOINT"), os.Getenv("IDENTITY_HEADER"); len(identityEndpoint) > 0 && len(identityHeader) > 0 {
+		endpoint = identityEndpoint
+		query.Set("api-version", "2019-08-01")
+		header.Set("X-IDENTITY-HEADER", identityHeader)
+	} else {
+		query.Set("api-version", "2018-02-01")
+		header.Set("Metadata", "true")
+	}
+
+	req, err := http.NewRequest("GET", endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = header
+
+	return req, nil
+}
+
+func fetchManagedIdentityToken(client *http.Client) (string, time.Time, error) {
+	req, err := managedIdentityRequest()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("Can't request Azure managed identity token: %s", err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("Can't read Azure managed identity token: %s", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("Can't get Azure managed identity token. Status: %d; %s", res.StatusCode, string(body))
+	}
+
+	var token managedIdentityToken
+
+	if err = json.Unmarshal(body, &token); err != nil {
+		return "", time.Time{}, fmt.Errorf("Invalid Azure managed identity token: %s", err)
+	}
+
+	if len(token.AccessToken) == 0 {
+		return "", time.Time{}, fmt.Errorf("Azure managed identity token is empty")
+	}
+
+	expiresOn, err := strconv.ParseInt(token.ExpiresOn.String(), 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("Invalid Azure managed identity token expiration: %s", token.ExpiresOn)
+	}
+
+	return token.AccessToken, time.Unix(expiresOn, 0), nil
+}
+
+func tokenRefreshIn(expiresOn time.Time) time.Duration {
+	if d := time.Until(expiresOn) - tokenRefreshMargin; d > tokenRetryInterval {
+		return d
+	}
+
+	return tokenRetryInterval
+}
+
+// newManagedIdentityCredential creates a token credential that gets
+// the tokens from the managed identity and refreshes them before they expire
+func newManagedIdentityCredential() (azblob.TokenCredential, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	token, expiresOn, err := fetchManagedIdentityToken(client)
+	if err != nil {
+		return nil, err
+	}
+
+	initial := true
+
+	return azblob.NewTokenCredential(token, func(credential azblob.TokenCredential) time.Duration {
+		// The refresher is called immediately, and we already have a fresh token
+		if initial {
+			initial = false
+			return tokenRefreshIn(expiresOn)
+		}
+
+		token, expiresOn, err := fetchManagedIdentityToken(client)
+		if err != nil {
+			log.Warningf("Can't refresh Azure managed identity token: %s", err)
+			return tokenRetryInterval
+		}
+
+		credential.SetToken(token)
+
+		return tokenRefreshIn(expiresOn)
+	}), nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"cloud.google.com/go/storage"
 	"github.com/imgproxy/imgproxy/v3/config"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 )
 
@@ -16,18 +17,37 @@ type transport struct {
 	client *storage.Client
 }
 
+// credentials returns the credentials from the JSON key if it's set.
+// Otherwise, it looks for Application Default Credentials which include
+// GOOGLE_APPLICATION_CREDENTIALS, gcloud credentials, and the metadata server
+// of Google Cloud infrastructure including GKE workload identity.
+// The credentials' token source refreshes tokens automatically
+func credentials(ctx context.Context) (*google.Credentials, error) {
+	if len(config.GCSKey) > 0 {
+		creds, err := google.CredentialsFromJSON(ctx, []byte(config.GCSKey), storage.ScopeReadOnly)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid GCS key: %s", err)
+		}
+		return creds, nil
+	}
+
+	creds, err := google.FindDefaultCredentials(ctx, storage.ScopeReadOnly)
+	if err != nil {
+		return nil, fmt.Errorf("Can't find GCS credentials. Set IMGPROXY_GCS_KEY or configure Application Default Credentials: %s", err)
+	}
+
+	return creds, nil
+}
+
 func New() (http.RoundTripper, error) {
-	var (
-		client *storage.Client
-		err    error
-	)
+	ctx := context.Background()
 
-	if len(config.GCSKey) > 0 {
-		client, err = storage.NewClient(context.Background(), option.WithCredentialsJSON([]byte(config.GCSKey)))
-	} else {
-		client, err = storage.NewClient(context.Background())
+	creds, err := credentials(ctx)
+	if err != nil {
+		return nil, err
 	}
 
+	client, err := storage.NewClient(ctx, option.WithCredentials(creds))
 	if err != nil {
 		return nil, fmt.Errorf("Can't create GCS client: %s", err)
 	}
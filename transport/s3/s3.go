@@ -1,6 +1,7 @@
 package s3
 
 import (
+	"crypto/tls"
 	"fmt"
 	http "net/http"
 
@@ -17,7 +18,9 @@ type transport struct {
 	svc *s3.S3
 }
 
-func New() (http.RoundTripper, error) {
+// NewService creates an S3 client using the S3 config.
+// Custom endpoints allow to use S3-compatible storages like MinIO or Cloudflare R2
+func NewService() (*s3.S3, error) {
 	s3Conf := aws.NewConfig()
 
 	if len(config.S3Region) != 0 {
@@ -26,7 +29,14 @@ func New() (http.RoundTripper, error) {
 
 	if len(config.S3Endpoint) != 0 {
 		s3Conf.Endpoint = aws.String(config.S3Endpoint)
-		s3Conf.S3ForcePathStyle = aws.Bool(true)
+		s3Conf.S3ForcePathStyle = aws.Bool(config.S3ForcePathStyle)
+	}
+
+	if config.S3IgnoreSslVerification {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+		s3Conf.HTTPClient = &http.Client{Transport: transport}
 	}
 
 	sess, err := session.NewSession()
@@ -38,7 +48,16 @@ func New() (http.RoundTripper, error) {
 		sess.Config.Region = aws.String("us-west-1")
 	}
 
-	return transport{s3.New(sess, s3Conf)}, nil
+	return s3.New(sess, s3Conf), nil
+}
+
+func New() (http.RoundTripper, error) {
+	svc, err := NewService()
+	if err != nil {
+		return nil, err
+	}
+
+	return transport{svc}, nil
 }
 
 func (t transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
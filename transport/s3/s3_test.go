@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type S3TestSuite struct {
+	suite.Suite
+
+	server      *httptest.Server
+	requestPath string
+}
+
+func (s *S3TestSuite) SetupSuite() {
+	os.Setenv("AWS_ACCESS_KEY_ID", "test")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		s.requestPath = r.URL.Path
+		rw.Write([]byte("test data"))
+	}))
+}
+
+func (s *S3TestSuite) TearDownSuite() {
+	s.server.Close()
+
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+}
+
+func (s *S3TestSuite) SetupTest() {
+	config.Reset()
+
+	config.S3Endpoint = s.server.URL
+	config.S3IgnoreSslVerification = true
+
+	s.requestPath = ""
+}
+
+func (s *S3TestSuite) get(url string) (*http.Response, error) {
+	t, err := New()
+	s.Require().Nil(err)
+
+	req, err := http.NewRequest("GET", url, nil)
+	s.Require().Nil(err)
+
+	return t.RoundTrip(req)
+}
+
+func (s *S3TestSuite) TestCustomEndpoint() {
+	res, err := s.get("s3://test-bucket/path/to/image.jpg")
+	s.Require().Nil(err)
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	s.Require().Nil(err)
+
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().Equal("test data", string(data))
+	s.Require().Equal("/test-bucket/path/to/image.jpg", s.requestPath)
+}
+
+func (s *S3TestSuite) TestSslVerification() {
+	config.S3IgnoreSslVerification = false
+
+	_, err := s.get("s3://test-bucket/image.jpg")
+	s.Require().NotNil(err)
+}
+
+func TestS3Transport(t *testing.T) {
+	suite.Run(t, new(S3TestSuite))
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/security"
+	"github.com/imgproxy/imgproxy/v3/urlbuilder"
+)
+
+const urlCLIUsage = `Usage:
+  imgproxy url sign [-plain] [-ext extension] [-base URL] [-prefix path_prefix] source_url [processing_options]
+  imgproxy url verify URL
+  imgproxy url parse URL
+
+Keys, salts, and other settings are read from the environment variables
+the same way the server does.
+`
+
+type urlParseResult struct {
+	SignatureValid bool                       `json:"signature_valid"`
+	SignatureError string                     `json:"signature_error,omitempty"`
+	Claims         *security.Claims           `json:"claims,omitempty"`
+	SourceURL      string                     `json:"source_url"`
+	Options        *options.ProcessingOptions `json:"options"`
+}
+
+// urlCLI runs the "imgproxy url" command and returns the exit code
+func urlCLI(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, urlCLIUsage)
+		return 2
+	}
+
+	if err := config.Configure(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	var err error
+
+	switch args[0] {
+	case "sign":
+		err = urlCLISign(args[1:], stdout)
+	case "verify":
+		err = urlCLIVerify(args[1:], stdout)
+	case "parse":
+		err = urlCLIParse(args[1:], stdout)
+	default:
+		fmt.Fprint(stderr, urlCLIUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func urlCLISign(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("sign", flag.ContinueOnError)
+
+	plain := fs.Bool("plain", false, "add the source URL as is instead of encoding it with Base64")
+	ext := fs.String("ext", "", "result extension")
+	base := fs.String("base", "", "imgproxy base URL")
+	prefix := fs.String("prefix", "", "path prefix from IMGPROXY_PATH_PREFIX_PRESETS")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("Expected source URL and optional processing options")
+	}
+
+	var sb strings.Builder
+
+	if opts := strings.Trim(fs.Arg(1), "/"); len(opts) > 0 {
+		sb.WriteByte('/')
+		sb.WriteString(opts)
+	}
+
+	sb.WriteByte('/')
+
+	if *plain {
+		sb.WriteString("plain/")
+		sb.WriteString(urlbuilder.EscapePlainURL(fs.Arg(0)))
+
+		if len(*ext) > 0 {
+			sb.WriteByte('@')
+			sb.WriteString(*ext)
+		}
+	} else {
+		sb.WriteString(base64.RawURLEncoding.EncodeToString([]byte(fs.Arg(0))))
+
+		if len(*ext) > 0 {
+			sb.WriteByte('.')
+			sb.WriteString(*ext)
+		}
+	}
+
+	path := sb.String()
+	presetsPrefix := strings.TrimSuffix(*prefix, "/")
+
+	fmt.Fprintln(stdout, strings.TrimSuffix(*base, "/")+config.PathPrefix+presetsPrefix+"/"+security.Sign(presetsPrefix+path)+path)
+
+	return nil
+}
+
+// urlCLISplitPath strips the scheme, host, query, and path prefix from the URL
+// and splits the rest to the presets path prefix, the signature, and the path
+func urlCLISplitPath(u string) (string, string, string, error) {
+	if parsed, err := url.Parse(u); err == nil && len(parsed.Host) > 0 {
+		u = parsed.EscapedPath()
+	}
+
+	if queryStart := strings.IndexByte(u, '?'); queryStart >= 0 {
+		u = u[:queryStart]
+	}
+
+	if len(config.PathPrefix) > 0 {
+		u = strings.TrimPrefix(u, config.PathPrefix)
+	}
+
+	u, presetsPrefix, _ := splitPathPrefixPresets(u)
+
+	u = strings.TrimPrefix(u, "/")
+
+	signatureEnd := strings.IndexByte(u, '/')
+	if signatureEnd <= 0 {
+		return "", "", "", fmt.Errorf("Invalid path: %s", u)
+	}
+
+	return presetsPrefix, u[:signatureEnd], u[signatureEnd:], nil
+}
+
+// urlCLICheckSignature verifies the URL signature and returns the path
+// without the claims
+func urlCLICheckSignature(presetsPrefix, signature, path string) (*security.Claims, string, error) {
+	if security.IsSignatureV2(signature) {
+		claims, p, err := security.VerifySignatureV2(signature, presetsPrefix, path)
+		if err != nil {
+			// Strip the claims anyway so the path can be parsed
+			if claimsEnd := strings.IndexByte(path[1:], '/'); claimsEnd >= 0 {
+				p = path[claimsEnd+1:]
+			}
+		}
+
+		return claims, p, err
+	}
+
+	return nil, path, security.VerifySignature(signature, presetsPrefix+path)
+}
+
+func urlCLIVerify(args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("Expected URL")
+	}
+
+	presetsPrefix, signature, path, err := urlCLISplitPath(args[0])
+	if err != nil {
+		return err
+	}
+
+	if _, _, err = urlCLICheckSignature(presetsPrefix, signature, path); err != nil {
+		return err
+	}
+
+	if len(config.Keys) == 0 || len(config.Salts) == 0 {
+		fmt.Fprintln(stdout, "URL signature is disabled")
+	} else {
+		fmt.Fprintln(stdout, "Signature is valid")
+	}
+
+	return nil
+}
+
+func urlCLIParse(args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("Expected URL")
+	}
+
+	if err := options.ParsePresets(config.Presets); err != nil {
+		return err
+	}
+
+	if err := options.ParseSourceHostOptions(config.SourceHostOptions); err != nil {
+		return err
+	}
+
+	presetsPrefix, signature, path, err := urlCLISplitPath(args[0])
+	if err != nil {
+		return err
+	}
+
+	var res urlParseResult
+
+	res.Claims, path, err = urlCLICheckSignature(presetsPrefix, signature, path)
+	if err != nil {
+		res.SignatureError = err.Error()
+	} else {
+		res.SignatureValid = true
+	}
+
+	if res.Options, res.SourceURL, err = options.ParsePathWithDefaultPresets(path, nil, config.PathPrefixPresets[presetsPrefix]); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(res)
+}
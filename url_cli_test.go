@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+)
+
+type URLCLITestSuite struct {
+	suite.Suite
+}
+
+func (s *URLCLITestSuite) SetupTest() {
+	config.Reset()
+
+	// test-key and test-salt
+	os.Setenv("IMGPROXY_KEY", "746573742d6b6579")
+	os.Setenv("IMGPROXY_SALT", "746573742d73616c74")
+}
+
+func (s *URLCLITestSuite) TearDownTest() {
+	os.Unsetenv("IMGPROXY_KEY")
+	os.Unsetenv("IMGPROXY_SALT")
+
+	config.Reset()
+}
+
+func (s *URLCLITestSuite) run(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+
+	code := urlCLI(args, &stdout, &stderr)
+
+	return code, strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String())
+}
+
+func (s *URLCLITestSuite) TestSign() {
+	code, out, _ := s.run("sign", "-plain", "-base", "http://imgproxy.test/", "local:///test1.png", "rs:fill:4:4")
+
+	require.Equal(s.T(), 0, code)
+	assert.Equal(s.T(), "http://imgproxy.test/My9d3xq_PYpVHsPrCyww0Kh1w5KZeZhIlWhsa4az1TI/rs:fill:4:4/plain/local:///test1.png", out)
+}
+
+func (s *URLCLITestSuite) TestVerify() {
+	code, out, _ := s.run("verify", "http://imgproxy.test/My9d3xq_PYpVHsPrCyww0Kh1w5KZeZhIlWhsa4az1TI/rs:fill:4:4/plain/local:///test1.png")
+
+	assert.Equal(s.T(), 0, code)
+	assert.Equal(s.T(), "Signature is valid", out)
+
+	code, _, errOut := s.run("verify", "/unsafe/rs:fill:4:4/plain/local:///test1.png")
+
+	assert.Equal(s.T(), 1, code)
+	assert.Equal(s.T(), "Invalid signature encoding", errOut)
+}
+
+func (s *URLCLITestSuite) TestSignPathPrefixPresets() {
+	os.Setenv("IMGPROXY_PRESETS", "avatar=rs:fill:4:4")
+	os.Setenv("IMGPROXY_PATH_PREFIX_PRESETS", "/avatars=avatar")
+	defer os.Unsetenv("IMGPROXY_PRESETS")
+	defer os.Unsetenv("IMGPROXY_PATH_PREFIX_PRESETS")
+
+	code, out, _ := s.run("sign", "-plain", "-prefix", "/avatars", "local:///test1.png")
+
+	require.Equal(s.T(), 0, code)
+	require.True(s.T(), strings.HasPrefix(out, "/avatars/"))
+
+	code, _, _ = s.run("verify", out)
+	assert.Equal(s.T(), 0, code)
+
+	// The signature doesn't match when the URL is moved to another prefix
+	code, _, _ = s.run("verify", strings.TrimPrefix(out, "/avatars"))
+	assert.Equal(s.T(), 1, code)
+}
+
+func (s *URLCLITestSuite) TestParse() {
+	code, out, _ := s.run("parse", "/unsafe/rs:fill:4:4/q:50/plain/local:///test1.png@webp")
+
+	require.Equal(s.T(), 0, code)
+
+	var res struct {
+		SignatureValid bool                   `json:"signature_valid"`
+		SignatureError string                 `json:"signature_error"`
+		SourceURL      string                 `json:"source_url"`
+		Options        map[string]interface{} `json:"options"`
+	}
+
+	require.Nil(s.T(), json.Unmarshal([]byte(out), &res))
+
+	assert.False(s.T(), res.SignatureValid)
+	assert.NotEmpty(s.T(), res.SignatureError)
+	assert.Equal(s.T(), "local:///test1.png", res.SourceURL)
+	assert.Equal(s.T(), "fill", res.Options["ResizingType"])
+	assert.Equal(s.T(), float64(4), res.Options["Width"])
+	assert.Equal(s.T(), float64(50), res.Options["Quality"])
+	assert.Equal(s.T(), "webp", res.Options["Format"])
+}
+
+func (s *URLCLITestSuite) TestUnknownCommand() {
+	code, _, errOut := s.run("unknown")
+
+	assert.Equal(s.T(), 2, code)
+	assert.Contains(s.T(), errOut, "Usage:")
+}
+
+func TestURLCLI(t *testing.T) {
+	suite.Run(t, new(URLCLITestSuite))
+}
@@ -0,0 +1,290 @@
+package urlbuilder
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Gravity defines the gravity of the crop, extend, or resize.
+// Type is one of the gravity types: "no", "so", "ea", "we", "noea", "nowe",
+// "soea", "sowe", "ce", "sm", or "fp"
+type Gravity struct {
+	Type string
+	X    float64
+	Y    float64
+}
+
+// Extend enables extending the image to the requested size
+type Extend struct {
+	// Gravity is optional
+	Gravity *Gravity
+}
+
+// Crop defines the area of the source image to be processed
+type Crop struct {
+	Width  float64
+	Height float64
+	// Gravity is optional
+	Gravity *Gravity
+}
+
+// Trim enables removing the surrounding background
+type Trim struct {
+	Threshold float64
+	// Color is a hex-encoded color. When empty, imgproxy detects it automatically
+	Color    string
+	EqualHor bool
+	EqualVer bool
+}
+
+// Padding defines the padding added to the result image
+type Padding struct {
+	Top    int
+	Right  int
+	Bottom int
+	Left   int
+}
+
+// Watermark defines the watermark placement
+type Watermark struct {
+	Opacity float64
+	// Position is one of the gravity types (except "sm" and "fp") or "re"
+	Position string
+	XOffset  int
+	YOffset  int
+	Scale    float64
+}
+
+// Options are the processing options. The zero values and nil pointers
+// mean that the option is not set and the imgproxy defaults are used
+type Options struct {
+	Presets []string
+
+	ResizingType string
+	Width        int
+	Height       int
+	MinWidth     int
+	MinHeight    int
+	ZoomWidth    float64
+	ZoomHeight   float64
+	Dpr          float64
+	Enlarge      bool
+	Extend       *Extend
+	Gravity      *Gravity
+	Crop         *Crop
+	Trim         *Trim
+	Padding      *Padding
+	Rotate       int
+	AutoRotate   *bool
+	// Background is a hex-encoded color
+	Background string
+	Blur       float64
+	Sharpen    float64
+	Pixelate   int
+	Watermark  *Watermark
+
+	StripMetadata     *bool
+	StripColorProfile *bool
+
+	Quality       int
+	FormatQuality map[string]int
+	MaxBytes      int
+	Format        string
+
+	SkipProcessing []string
+	CacheBuster    string
+	Expires        time.Time
+	Filename       string
+	Raw            bool
+}
+
+// Bool returns the pointer to the provided value.
+// It's handy to set the tri-state options
+func Bool(b bool) *bool {
+	return &b
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func writeOption(sb *strings.Builder, name string, args ...string) {
+	sb.WriteByte('/')
+	sb.WriteString(name)
+
+	for _, arg := range args {
+		sb.WriteByte(':')
+		sb.WriteString(arg)
+	}
+}
+
+func gravityArgs(g *Gravity) []string {
+	args := []string{g.Type}
+
+	if g.Type == "fp" || g.X != 0 || g.Y != 0 {
+		args = append(args, formatFloat(g.X), formatFloat(g.Y))
+	}
+
+	return args
+}
+
+func (o *Options) writeTo(sb *strings.Builder) {
+	if o == nil {
+		return
+	}
+
+	if len(o.Presets) > 0 {
+		writeOption(sb, "pr", o.Presets...)
+	}
+
+	if len(o.ResizingType) > 0 {
+		writeOption(sb, "rt", o.ResizingType)
+	}
+	if o.Width > 0 {
+		writeOption(sb, "w", strconv.Itoa(o.Width))
+	}
+	if o.Height > 0 {
+		writeOption(sb, "h", strconv.Itoa(o.Height))
+	}
+	if o.MinWidth > 0 {
+		writeOption(sb, "mw", strconv.Itoa(o.MinWidth))
+	}
+	if o.MinHeight > 0 {
+		writeOption(sb, "mh", strconv.Itoa(o.MinHeight))
+	}
+	if o.ZoomWidth > 0 || o.ZoomHeight > 0 {
+		zw, zh := o.ZoomWidth, o.ZoomHeight
+		if zw == 0 {
+			zw = 1
+		}
+		if zh == 0 {
+			zh = 1
+		}
+		writeOption(sb, "z", formatFloat(zw), formatFloat(zh))
+	}
+	if o.Dpr > 0 {
+		writeOption(sb, "dpr", formatFloat(o.Dpr))
+	}
+	if o.Enlarge {
+		writeOption(sb, "el", "1")
+	}
+	if o.Extend != nil {
+		args := []string{"1"}
+		if o.Extend.Gravity != nil {
+			args = append(args, gravityArgs(o.Extend.Gravity)...)
+		}
+		writeOption(sb, "ex", args...)
+	}
+	if o.Gravity != nil {
+		writeOption(sb, "g", gravityArgs(o.Gravity)...)
+	}
+	if o.Crop != nil {
+		args := []string{formatFloat(o.Crop.Width), formatFloat(o.Crop.Height)}
+		if o.Crop.Gravity != nil {
+			args = append(args, gravityArgs(o.Crop.Gravity)...)
+		}
+		writeOption(sb, "c", args...)
+	}
+	if o.Trim != nil {
+		writeOption(
+			sb, "t",
+			formatFloat(o.Trim.Threshold),
+			o.Trim.Color,
+			strconv.FormatBool(o.Trim.EqualHor),
+			strconv.FormatBool(o.Trim.EqualVer),
+		)
+	}
+	if o.Padding != nil {
+		writeOption(
+			sb, "pd",
+			strconv.Itoa(o.Padding.Top),
+			strconv.Itoa(o.Padding.Right),
+			strconv.Itoa(o.Padding.Bottom),
+			strconv.Itoa(o.Padding.Left),
+		)
+	}
+	if o.Rotate != 0 {
+		writeOption(sb, "rot", strconv.Itoa(o.Rotate))
+	}
+	if o.AutoRotate != nil {
+		writeOption(sb, "ar", strconv.FormatBool(*o.AutoRotate))
+	}
+	if len(o.Background) > 0 {
+		writeOption(sb, "bg", strings.TrimPrefix(o.Background, "#"))
+	}
+	if o.Blur > 0 {
+		writeOption(sb, "bl", formatFloat(o.Blur))
+	}
+	if o.Sharpen > 0 {
+		writeOption(sb, "sh", formatFloat(o.Sharpen))
+	}
+	if o.Pixelate > 0 {
+		writeOption(sb, "pix", strconv.Itoa(o.Pixelate))
+	}
+	if o.Watermark != nil {
+		args := []string{formatFloat(o.Watermark.Opacity), o.Watermark.Position, "", "", ""}
+		if o.Watermark.XOffset != 0 {
+			args[2] = strconv.Itoa(o.Watermark.XOffset)
+		}
+		if o.Watermark.YOffset != 0 {
+			args[3] = strconv.Itoa(o.Watermark.YOffset)
+		}
+		if o.Watermark.Scale > 0 {
+			args[4] = formatFloat(o.Watermark.Scale)
+		}
+		// Trim the empty trailing arguments
+		for len(args) > 1 && len(args[len(args)-1]) == 0 {
+			args = args[:len(args)-1]
+		}
+		writeOption(sb, "wm", args...)
+	}
+
+	if o.StripMetadata != nil {
+		writeOption(sb, "sm", strconv.FormatBool(*o.StripMetadata))
+	}
+	if o.StripColorProfile != nil {
+		writeOption(sb, "scp", strconv.FormatBool(*o.StripColorProfile))
+	}
+
+	if o.Quality > 0 {
+		writeOption(sb, "q", strconv.Itoa(o.Quality))
+	}
+	if len(o.FormatQuality) > 0 {
+		formats := make([]string, 0, len(o.FormatQuality))
+		for f := range o.FormatQuality {
+			formats = append(formats, f)
+		}
+		// Sort formats to get the same URL for the same options
+		sort.Strings(formats)
+
+		args := make([]string, 0, len(formats)*2)
+		for _, f := range formats {
+			args = append(args, f, strconv.Itoa(o.FormatQuality[f]))
+		}
+		writeOption(sb, "fq", args...)
+	}
+	if o.MaxBytes > 0 {
+		writeOption(sb, "mb", strconv.Itoa(o.MaxBytes))
+	}
+	if len(o.Format) > 0 {
+		writeOption(sb, "f", o.Format)
+	}
+
+	if len(o.SkipProcessing) > 0 {
+		writeOption(sb, "skp", o.SkipProcessing...)
+	}
+	if len(o.CacheBuster) > 0 {
+		writeOption(sb, "cb", o.CacheBuster)
+	}
+	if !o.Expires.IsZero() {
+		writeOption(sb, "exp", strconv.FormatInt(o.Expires.Unix(), 10))
+	}
+	if len(o.Filename) > 0 {
+		writeOption(sb, "fn", o.Filename)
+	}
+	if o.Raw {
+		writeOption(sb, "raw", "1")
+	}
+}
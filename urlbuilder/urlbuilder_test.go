@@ -0,0 +1,119 @@
+package urlbuilder
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type URLBuilderTestSuite struct {
+	suite.Suite
+
+	builder *Builder
+}
+
+func (s *URLBuilderTestSuite) SetupTest() {
+	s.builder = New("http://imgproxy.test/", []byte("test-key"), []byte("test-salt"))
+}
+
+func (s *URLBuilderTestSuite) TestSign() {
+	assert.Equal(s.T(), "dtLwhdnPPiu_epMl1LrzheLpvHas-4mwvY6L3Z8WwlY", s.builder.sign("asd"))
+}
+
+func (s *URLBuilderTestSuite) TestSignTruncated() {
+	s.builder.SignatureSize = 8
+
+	assert.Equal(s.T(), "dtLwhdnPPis", s.builder.sign("asd"))
+}
+
+func (s *URLBuilderTestSuite) TestUnsigned() {
+	b := New("http://imgproxy.test", nil, nil)
+
+	assert.Equal(
+		s.T(),
+		"http://imgproxy.test/unsafe/w:300/aHR0cDovL2V4YW1wbGUuY29tL2ltYWdlLmpwZw",
+		b.Build("http://example.com/image.jpg", &Options{Width: 300}),
+	)
+}
+
+func (s *URLBuilderTestSuite) TestNewFromHex() {
+	b, err := NewFromHex("http://imgproxy.test", "746573742d6b6579", "746573742d73616c74")
+	require.Nil(s.T(), err)
+
+	assert.Equal(s.T(), s.builder.sign("asd"), b.sign("asd"))
+
+	_, err = NewFromHex("http://imgproxy.test", "not-a-hex", "746573742d73616c74")
+	assert.NotNil(s.T(), err)
+}
+
+func (s *URLBuilderTestSuite) TestBuild() {
+	u := s.builder.Build("http://example.com/image.jpg", nil)
+
+	require.True(s.T(), strings.HasPrefix(u, "http://imgproxy.test/"))
+
+	path := strings.TrimPrefix(u, "http://imgproxy.test")
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+
+	assert.Equal(s.T(), "/aHR0cDovL2V4YW1wbGUuY29tL2ltYWdlLmpwZw", "/"+parts[1])
+	assert.Equal(s.T(), s.builder.sign("/"+parts[1]), parts[0])
+}
+
+func (s *URLBuilderTestSuite) TestPlainSourceURL() {
+	s.builder.PlainSourceURL = true
+
+	path := s.builder.Path("http://example.com/image 1.jpg?size=large#top", nil)
+
+	assert.True(s.T(), strings.HasSuffix(path, "/plain/http://example.com/image%201.jpg%3Fsize=large%23top"))
+}
+
+func (s *URLBuilderTestSuite) TestOptions() {
+	opts := Options{
+		Presets:           []string{"thumb", "sharp"},
+		ResizingType:      "fill",
+		Width:             300,
+		Height:            400,
+		ZoomWidth:         1.5,
+		Dpr:               2,
+		Enlarge:           true,
+		Extend:            &Extend{Gravity: &Gravity{Type: "so"}},
+		Gravity:           &Gravity{Type: "fp", X: 0.5, Y: 0.25},
+		Crop:              &Crop{Width: 100, Height: 0.5, Gravity: &Gravity{Type: "nowe", X: 10, Y: 5}},
+		Trim:              &Trim{Threshold: 10, Color: "ffffff", EqualHor: true},
+		Padding:           &Padding{Top: 1, Right: 2, Bottom: 3, Left: 4},
+		Rotate:            90,
+		AutoRotate:        Bool(false),
+		Background:        "#ff00ff",
+		Blur:              0.5,
+		Watermark:         &Watermark{Opacity: 0.5, Position: "soea", XOffset: 10},
+		StripMetadata:     Bool(true),
+		Quality:           80,
+		FormatQuality:     map[string]int{"webp": 70, "avif": 50},
+		Format:            "webp",
+		SkipProcessing:    []string{"svg", "gif"},
+		CacheBuster:       "abc",
+		Expires:           time.Unix(1700000000, 0),
+		Filename:          "result",
+		Raw:               true,
+		StripColorProfile: Bool(true),
+	}
+
+	var sb strings.Builder
+	opts.writeTo(&sb)
+
+	assert.Equal(
+		s.T(),
+		"/pr:thumb:sharp/rt:fill/w:300/h:400/z:1.5:1/dpr:2/el:1/ex:1:so/g:fp:0.5:0.25"+
+			"/c:100:0.5:nowe:10:5/t:10:ffffff:true:false/pd:1:2:3:4/rot:90/ar:false"+
+			"/bg:ff00ff/bl:0.5/wm:0.5:soea:10/sm:true/scp:true/q:80/fq:avif:50:webp:70"+
+			"/f:webp/skp:svg:gif/cb:abc/exp:1700000000/fn:result/raw:1",
+		sb.String(),
+	)
+}
+
+func TestURLBuilder(t *testing.T) {
+	suite.Run(t, new(URLBuilderTestSuite))
+}
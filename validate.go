@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/router"
+)
+
+type validationResult struct {
+	SourceURL string                     `json:"source_url"`
+	Options   *options.ProcessingOptions `json:"options"`
+}
+
+// handleValidate checks the processing URL the same way the processing handler
+// does but doesn't download or process the image. The response contains
+// the processing options that differ from the defaults
+func handleValidate(reqID string, rw http.ResponseWriter, r *http.Request) {
+	path := r.RequestURI
+	if queryStart := strings.IndexByte(path, '?'); queryStart >= 0 {
+		path = path[:queryStart]
+	}
+
+	path = strings.TrimPrefix(path, config.PathPrefix+"/validate")
+
+	po, imageURL := parseProcessingPath(r.Context(), path, r.Header)
+
+	checkProcessingRequest(po, imageURL)
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(200)
+	json.NewEncoder(rw).Encode(validationResult{SourceURL: imageURL, Options: po})
+
+	router.LogResponse(reqID, r, 200, nil, log.Fields{"image_url": imageURL})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/detection"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/options"
+	"github.com/imgproxy/imgproxy/v3/vips"
+)
+
+// configReport collects the results of the config checks
+type configReport struct {
+	w      io.Writer
+	failed bool
+}
+
+func (r *configReport) ok(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "[ OK ] "+format+"\n", args...)
+}
+
+func (r *configReport) warn(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "[WARN] "+format+"\n", args...)
+}
+
+func (r *configReport) fail(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "[FAIL] "+format+"\n", args...)
+	r.failed = true
+}
+
+// checkImageDecodes checks that the image can be fully decoded
+func checkImageDecodes(imgdata *imagedata.ImageData) error {
+	// SVG is rasterized only when it's processed
+	if imgdata.Type == imagetype.SVG {
+		return nil
+	}
+
+	if !vips.SupportsLoad(imgdata.Type) {
+		return fmt.Errorf("Loading %s is not supported", imgdata.Type)
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	defer vips.Cleanup()
+
+	img := new(vips.Image)
+	defer img.Clear()
+
+	if err := img.Load(imgdata, 1, 1.0, 1); err != nil {
+		return err
+	}
+
+	// vips loads images lazily, so we need to copy the image
+	// to memory to make sure it's decoded
+	return img.CopyMemory()
+}
+
+func checkAsset(report *configReport, desc string, imgdata *imagedata.ImageData) {
+	if imgdata == nil {
+		return
+	}
+
+	if err := checkImageDecodes(imgdata); err != nil {
+		report.fail("Can't decode %s: %s", desc, err)
+		return
+	}
+
+	report.ok("The %s (%s) is decoded successfully", desc, imgdata.Type)
+}
+
+// validateConfig loads the config and checks it the same way imgproxy does
+// on start. It writes the report to w and returns the exit code
+func validateConfig(w io.Writer) int {
+	report := configReport{w: w}
+
+	if err := config.Configure(); err != nil {
+		report.fail("Invalid config: %s", err)
+		return 1
+	}
+	report.ok("Config is loaded")
+
+	if len(config.Keys) == 0 {
+		report.warn("URL signature is disabled. It's highly recommended to enable it in production")
+	} else {
+		report.ok("%d key/salt pair(s) are loaded", len(config.Keys))
+	}
+
+	if err := vips.Init(); err != nil {
+		report.fail("Can't initialize libvips: %s", err)
+		return 1
+	}
+	defer vips.Shutdown()
+
+	if err := detection.Init(); err != nil {
+		report.fail("Can't load detection cascades: %s", err)
+	}
+
+	// Collect all the invalid presets instead of stopping at the first one
+	config.SkipInvalidPresets = true
+
+	if err := options.ParsePresets(config.Presets); err != nil {
+		report.fail("Invalid presets: %s", err)
+	} else if err := options.ValidatePresets(); err != nil {
+		report.fail("Invalid presets: %s", err)
+	}
+
+	for _, p := range options.RejectedPresets() {
+		report.fail("Invalid preset: %s", p.Reason)
+	}
+
+	if presets := options.LoadedPresets(); len(presets) > 0 {
+		report.ok("%d preset(s) are loaded", len(presets))
+	}
+
+	if err := options.ParseSourceHostOptions(config.SourceHostOptions); err != nil {
+		report.fail("Invalid source host options: %s", err)
+	} else if len(config.SourceHostOptions) > 0 {
+		report.ok("Source host options are loaded")
+	}
+
+	for prefix, presets := range config.PathPrefixPresets {
+		if err := options.CheckPresetsExist(presets); err != nil {
+			report.fail("Invalid presets for path prefix %s: %s", prefix, err)
+		}
+	}
+
+	if err := imagedata.Init(); err != nil {
+		report.fail("Can't load assets: %s", err)
+	} else {
+		checkAsset(&report, "watermark", imagedata.Watermark())
+		checkAsset(&report, "fallback image", imagedata.FallbackImage)
+	}
+
+	if report.failed {
+		fmt.Fprintln(w, "Config is invalid")
+		return 1
+	}
+
+	fmt.Fprintln(w, "Config is valid")
+	return 0
+}
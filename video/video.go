@@ -0,0 +1,254 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/ierrors"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/router"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+// SourcePrefix marks the source URL as a video that should be passed through ffmpeg
+const SourcePrefix = "video:"
+
+const (
+	msgInvalidSourceVideo = "Invalid source video"
+
+	// ffmpeg is allowed to read only the local temporary file using these demuxers.
+	// This prevents playlists and other indirect formats from making ffmpeg
+	// request arbitrary URLs or read arbitrary local files
+	protocolWhitelist = "file"
+	formatWhitelist   = "mov,mp4,m4a,3gp,3g2,mj2,matroska,webm,avi,mpegts,flv,ogg"
+
+	maxStderrSize = 4096
+)
+
+var (
+	ffmpegPath string
+	videoSem   chan struct{}
+
+	ErrVideoSourcesDisabled = ierrors.New(422, "Video sources are disabled", msgInvalidSourceVideo)
+	ErrSourceVideoTooBig    = ierrors.New(422, "Source video file is too big", msgInvalidSourceVideo)
+	ErrNoVideoFrames        = ierrors.New(422, "Source video has no frames at the requested position", msgInvalidSourceVideo)
+
+	errOutputTooBig = errors.New("ffmpeg output is too big")
+)
+
+// Init looks up the ffmpeg binary if video sources are enabled
+func Init() error {
+	if !config.EnableVideoSources {
+		return nil
+	}
+
+	path, err := exec.LookPath(config.FFmpegPath)
+	if err != nil {
+		return fmt.Errorf("Can't find ffmpeg: %s", err)
+	}
+
+	ffmpegPath = path
+	videoSem = make(chan struct{}, config.VideoConcurrency)
+
+	return nil
+}
+
+// ParseSourceURL strips SourcePrefix from the source URL
+// and reports whether it was present
+func ParseSourceURL(u string) (string, bool) {
+	if strings.HasPrefix(u, SourcePrefix) {
+		return strings.TrimPrefix(u, SourcePrefix), true
+	}
+
+	return u, false
+}
+
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	truncate bool
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && b.Len()+len(p) > b.limit {
+		if !b.truncate {
+			b.exceeded = true
+			return 0, errOutputTooBig
+		}
+
+		b.Buffer.Write(p[:b.limit-b.Len()])
+		return len(p), nil
+	}
+
+	return b.Buffer.Write(p)
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
+
+// ffmpegArgs builds the ffmpeg arguments to extract a single frame as PNG
+// or, if duration is greater than 0, a segment as an animated GIF
+func ffmpegArgs(path string, start, duration float64, fps int) []string {
+	args := []string{
+		"-nostdin",
+		"-hide_banner",
+		"-loglevel", "error",
+		"-protocol_whitelist", protocolWhitelist,
+		"-format_whitelist", formatWhitelist,
+		"-ss", formatSeconds(start),
+	}
+
+	if duration > 0 {
+		args = append(args, "-t", formatSeconds(duration))
+	}
+
+	args = append(args, "-i", path, "-an", "-sn", "-dn")
+
+	if duration > 0 {
+		filter := fmt.Sprintf("fps=%d,split[a][b];[a]palettegen[p];[b][p]paletteuse", fps)
+		return append(args, "-vf", filter, "-loop", "0", "-f", "gif", "pipe:1")
+	}
+
+	return append(args, "-frames:v", "1", "-c:v", "png", "-f", "image2pipe", "pipe:1")
+}
+
+func downloadToFile(f *os.File, sourceURL string, header http.Header, jar *cookiejar.Jar, secopts security.Options) error {
+	// The whole video is needed, so we don't allow conditional and partial requests
+	reqHeader := make(http.Header)
+	for k, v := range header {
+		reqHeader[k] = v
+	}
+	reqHeader.Del("If-None-Match")
+	reqHeader.Del("If-Modified-Since")
+	reqHeader.Del("Range")
+
+	res, err := imagedata.RequestRaw(sourceURL, reqHeader, jar)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return ierrors.New(
+			404,
+			fmt.Sprintf("Can't download source video: Status: %d", res.StatusCode),
+			"Source video is unreachable",
+		)
+	}
+
+	limit := int64(secopts.MaxSrcFileSize)
+
+	if limit > 0 && res.ContentLength > limit {
+		return ErrSourceVideoTooBig
+	}
+
+	var body io.Reader = res.Body
+	if limit > 0 {
+		body = io.LimitReader(res.Body, limit+1)
+	}
+
+	n, err := io.Copy(f, body)
+	if err != nil {
+		return ierrors.New(500, fmt.Sprintf("Can't download source video: %s", err), "Source video is unreachable")
+	}
+
+	if limit > 0 && n > limit {
+		return ErrSourceVideoTooBig
+	}
+
+	return nil
+}
+
+func runFFmpeg(ctx context.Context, path string, start, duration float64, secopts security.Options) ([]byte, error) {
+	select {
+	case videoSem <- struct{}{}:
+	case <-ctx.Done():
+		router.CheckTimeout(ctx)
+	}
+	defer func() { <-videoSem }()
+
+	timeout := time.Duration(config.VideoTimeout) * time.Second
+
+	ffmpegCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout := limitedBuffer{limit: secopts.MaxSrcFileSize}
+	stderr := limitedBuffer{limit: maxStderrSize, truncate: true}
+
+	cmd := exec.CommandContext(ffmpegCtx, ffmpegPath, ffmpegArgs(path, start, duration, config.VideoSegmentFPS)...)
+	cmd.Env = []string{}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		router.CheckTimeout(ctx)
+
+		if ffmpegCtx.Err() == context.DeadlineExceeded {
+			return nil, ierrors.New(422, fmt.Sprintf("Video processing timed out after %v", timeout), msgInvalidSourceVideo)
+		}
+
+		if stdout.exceeded {
+			return nil, ErrSourceVideoTooBig
+		}
+
+		return nil, ierrors.New(
+			422,
+			fmt.Sprintf("Can't extract video frames: %s; %s", err, strings.TrimSpace(stderr.String())),
+			msgInvalidSourceVideo,
+		)
+	}
+
+	if stdout.Len() == 0 {
+		return nil, ErrNoVideoFrames
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Extract downloads the source video and extracts a single frame starting at start
+// seconds or, if duration is greater than 0, a segment as an animated GIF.
+// The result is checked against secopts like a regular source image
+func Extract(ctx context.Context, sourceURL string, header http.Header, jar *cookiejar.Jar, secopts security.Options, start, duration float64) (*imagedata.ImageData, error) {
+	if !config.EnableVideoSources {
+		return nil, ErrVideoSourcesDisabled
+	}
+
+	if duration > config.MaxVideoSegmentDuration {
+		duration = config.MaxVideoSegmentDuration
+	}
+
+	f, err := ioutil.TempFile("", "imgproxy-video-*")
+	if err != nil {
+		return nil, ierrors.New(500, fmt.Sprintf("Can't create temporary file: %s", err), "Internal error")
+	}
+	defer os.Remove(f.Name())
+
+	err = downloadToFile(f, sourceURL, header, jar, secopts)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = ierrors.New(500, fmt.Sprintf("Can't write temporary file: %s", closeErr), "Internal error")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := runFFmpeg(ctx, f.Name(), start, duration, secopts)
+	if err != nil {
+		return nil, err
+	}
+
+	return imagedata.FromBytes(data, "extracted video frames", secopts)
+}
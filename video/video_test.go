@@ -0,0 +1,97 @@
+package video
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/imgproxy/imgproxy/v3/config"
+	"github.com/imgproxy/imgproxy/v3/security"
+)
+
+type VideoTestSuite struct {
+	suite.Suite
+}
+
+func (s *VideoTestSuite) SetupTest() {
+	config.Reset()
+}
+
+func (s *VideoTestSuite) TestParseSourceURL() {
+	u, isVideo := ParseSourceURL("video:http://example.com/video.mp4")
+	s.Require().True(isVideo)
+	s.Require().Equal("http://example.com/video.mp4", u)
+
+	u, isVideo = ParseSourceURL("http://example.com/video:image.jpg")
+	s.Require().False(isVideo)
+	s.Require().Equal("http://example.com/video:image.jpg", u)
+}
+
+func (s *VideoTestSuite) TestFFmpegArgsFrame() {
+	args := ffmpegArgs("/tmp/video", 1.5, 0, 10)
+
+	s.Require().Contains(args, "-frames:v")
+	s.Require().NotContains(args, "-t")
+	s.Require().Equal("pipe:1", args[len(args)-1])
+	s.Require().Equal([]string{"-ss", "1.500", "-i", "/tmp/video"}, s.argsAround(args, "-ss", 4))
+}
+
+func (s *VideoTestSuite) TestFFmpegArgsSegment() {
+	args := ffmpegArgs("/tmp/video", 0, 2, 12)
+
+	s.Require().NotContains(args, "-frames:v")
+	s.Require().Equal([]string{"-t", "2.000", "-i", "/tmp/video"}, s.argsAround(args, "-t", 4))
+	s.Require().Equal([]string{"-f", "gif"}, s.argsAround(args, "-f", 2))
+	s.Require().Contains(s.argsAround(args, "-vf", 2)[1], "fps=12,")
+}
+
+func (s *VideoTestSuite) TestFFmpegArgsWhitelists() {
+	args := ffmpegArgs("/tmp/video", 0, 0, 10)
+
+	s.Require().Equal([]string{"-protocol_whitelist", "file"}, s.argsAround(args, "-protocol_whitelist", 2))
+	s.Require().NotContains(s.argsAround(args, "-format_whitelist", 2)[1], "hls")
+	s.Require().NotContains(s.argsAround(args, "-format_whitelist", 2)[1], "concat")
+}
+
+func (s *VideoTestSuite) TestLimitedBuffer() {
+	b := limitedBuffer{limit: 4}
+
+	_, err := b.Write([]byte("abc"))
+	s.Require().Nil(err)
+
+	_, err = b.Write([]byte("de"))
+	s.Require().Equal(errOutputTooBig, err)
+	s.Require().True(b.exceeded)
+
+	t := limitedBuffer{limit: 4, truncate: true}
+
+	n, err := t.Write([]byte("abcdef"))
+	s.Require().Nil(err)
+	s.Require().Equal(6, n)
+	s.Require().Equal("abcd", t.String())
+}
+
+func (s *VideoTestSuite) TestExtractDisabled() {
+	config.EnableVideoSources = false
+
+	_, err := Extract(context.Background(), "http://example.com/video.mp4", nil, nil, security.DefaultOptions(), 0, 0)
+	s.Require().Equal(ErrVideoSourcesDisabled, err)
+}
+
+// argsAround returns n arguments starting from the first occurrence of name
+func (s *VideoTestSuite) argsAround(args []string, name string, n int) []string {
+	for i, a := range args {
+		if a == name {
+			s.Require().LessOrEqual(i+n, len(args))
+			return args[i : i+n]
+		}
+	}
+
+	s.Failf("Argument not found", "%s is not found in %v", name, args)
+	return nil
+}
+
+func TestVideo(t *testing.T) {
+	suite.Run(t, new(VideoTestSuite))
+}
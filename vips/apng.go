@@ -0,0 +1,507 @@
+package vips
+
+/*
+#include "vips.h"
+*/
+import "C"
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"unsafe"
+
+	"github.com/imgproxy/imgproxy/v3/bufpool"
+	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagetype"
+	"github.com/imgproxy/imgproxy/v3/imath"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+const (
+	apngDisposeOpNone       = 0
+	apngDisposeOpBackground = 1
+	apngDisposeOpPrevious   = 2
+
+	apngBlendOpSource = 0
+	apngBlendOpOver   = 1
+)
+
+var errApngInvalid = errors.New("invalid APNG image")
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+type apngFrame struct {
+	width, height int
+	x, y          int
+	delay         int
+	disposeOp     byte
+	blendOp       byte
+	data          []byte
+}
+
+func readPngChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a PNG image")
+	}
+
+	var chunks []pngChunk
+
+	pos := len(pngSignature)
+
+	for pos+8 <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		typ := string(data[pos+4 : pos+8])
+
+		// Data + CRC
+		if size < 0 || pos+8+size+4 > len(data) {
+			return nil, errApngInvalid
+		}
+
+		chunks = append(chunks, pngChunk{typ: typ, data: data[pos+8 : pos+8+size]})
+
+		if typ == "IEND" {
+			break
+		}
+
+		pos += 8 + size + 4
+	}
+
+	return chunks, nil
+}
+
+func writePngChunk(buf *bytes.Buffer, typ string, data []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], typ)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+
+	buf.Write(header[:])
+	buf.Write(data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
+
+// decodeApngFrame builds a standalone PNG image from the frame data
+// and the chunks shared by all the frames, and decodes it
+func decodeApngFrame(ihdr []byte, shared []pngChunk, frame *apngFrame) (image.Image, error) {
+	var buf bytes.Buffer
+
+	buf.Write(pngSignature)
+
+	frameIhdr := append([]byte(nil), ihdr...)
+	binary.BigEndian.PutUint32(frameIhdr[0:4], uint32(frame.width))
+	binary.BigEndian.PutUint32(frameIhdr[4:8], uint32(frame.height))
+	writePngChunk(&buf, "IHDR", frameIhdr)
+
+	for _, c := range shared {
+		writePngChunk(&buf, c.typ, c.data)
+	}
+
+	writePngChunk(&buf, "IDAT", frame.data)
+	writePngChunk(&buf, "IEND", nil)
+
+	return png.Decode(&buf)
+}
+
+func isApng(data []byte) bool {
+	chunks, err := readPngChunks(data)
+	if err != nil {
+		return false
+	}
+
+	for _, c := range chunks {
+		switch c.typ {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+	}
+
+	return false
+}
+
+// loadApng decodes the APNG image into the vertical strip of the frames.
+// Only the first pages frames are decoded. If pages < 1, all the frames are decoded
+func (img *Image) loadApng(data []byte, pages int) error {
+	chunks, err := readPngChunks(data)
+	if err != nil {
+		return err
+	}
+
+	var (
+		ihdr     []byte
+		shared   []pngChunk
+		frames   []*apngFrame
+		cur      *apngFrame
+		numPlays int
+		seenIDAT bool
+	)
+
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			if len(c.data) != 13 {
+				return errApngInvalid
+			}
+			ihdr = c.data
+		case "acTL":
+			if len(c.data) != 8 {
+				return errApngInvalid
+			}
+			numPlays = int(binary.BigEndian.Uint32(c.data[4:8]))
+		case "fcTL":
+			if len(c.data) != 26 {
+				return errApngInvalid
+			}
+
+			delayNum := int(binary.BigEndian.Uint16(c.data[20:22]))
+			delayDen := int(binary.BigEndian.Uint16(c.data[22:24]))
+			if delayDen == 0 {
+				delayDen = 100
+			}
+
+			cur = &apngFrame{
+				width:     int(binary.BigEndian.Uint32(c.data[4:8])),
+				height:    int(binary.BigEndian.Uint32(c.data[8:12])),
+				x:         int(binary.BigEndian.Uint32(c.data[12:16])),
+				y:         int(binary.BigEndian.Uint32(c.data[16:20])),
+				delay:     delayNum * 1000 / delayDen,
+				disposeOp: c.data[24],
+				blendOp:   c.data[25],
+			}
+			frames = append(frames, cur)
+		case "IDAT":
+			seenIDAT = true
+			// If there was no fcTL before IDAT, the default image is not a part of the animation
+			if cur != nil {
+				cur.data = append(cur.data, c.data...)
+			}
+		case "fdAT":
+			if cur == nil || len(c.data) < 4 {
+				return errApngInvalid
+			}
+			cur.data = append(cur.data, c.data[4:]...)
+		case "IEND":
+		default:
+			// Chunks like PLTE and tRNS are required to decode the frames
+			if !seenIDAT {
+				shared = append(shared, c)
+			}
+		}
+	}
+
+	if ihdr == nil || len(frames) == 0 {
+		return errApngInvalid
+	}
+
+	if pages > 0 && len(frames) > pages {
+		frames = frames[:pages]
+	}
+
+	width := int(binary.BigEndian.Uint32(ihdr[0:4]))
+	height := int(binary.BigEndian.Uint32(ihdr[4:8]))
+
+	if width <= 0 || height <= 0 {
+		return errApngInvalid
+	}
+
+	tmp, imgData, err := prepareCanvas(width, height*len(frames), 4)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if rerr := recover(); rerr != nil {
+			C.clear_image(&tmp)
+			panic(rerr)
+		}
+	}()
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var prev []byte
+
+	delay := make([]int, len(frames))
+
+	for i, frame := range frames {
+		rect := image.Rect(frame.x, frame.y, frame.x+frame.width, frame.y+frame.height)
+		if rect.Empty() || !rect.In(canvas.Bounds()) {
+			C.clear_image(&tmp)
+			return errApngInvalid
+		}
+
+		frameImg, err := decodeApngFrame(ihdr, shared, frame)
+		if err != nil {
+			C.clear_image(&tmp)
+			return err
+		}
+
+		if frame.disposeOp == apngDisposeOpPrevious {
+			prev = append(prev[:0], canvas.Pix...)
+		}
+
+		op := draw.Over
+		if frame.blendOp == apngBlendOpSource {
+			op = draw.Src
+		}
+
+		draw.Draw(canvas, rect, frameImg, frameImg.Bounds().Min, op)
+
+		copy(imgData[i*len(canvas.Pix):], canvas.Pix)
+
+		switch frame.disposeOp {
+		case apngDisposeOpBackground:
+			draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+		case apngDisposeOpPrevious:
+			copy(canvas.Pix, prev)
+		}
+
+		delay[i] = frame.delay
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	img.SetInt("page-height", height)
+	img.SetInt("n-pages", len(frames))
+	img.SetIntSlice("delay", delay)
+	img.SetInt("loop", numPlays)
+	// These are checked to detect animated images
+	img.SetInt("gif-delay", delay[0]/10)
+	img.SetInt("gif-loop", numPlays)
+
+	return nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// filterPngRow applies all the PNG filters to the row and writes the one
+// with the minimal sum of absolute differences to out
+func filterPngRow(out, cur, prev []byte, bpp int, candidates [5][]byte) {
+	for f := range candidates {
+		c := candidates[f]
+
+		for i := range cur {
+			var left, up, upLeft byte
+
+			if i >= bpp {
+				left = cur[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up = prev[i]
+
+			switch f {
+			case 0:
+				c[i] = cur[i]
+			case 1:
+				c[i] = cur[i] - left
+			case 2:
+				c[i] = cur[i] - up
+			case 3:
+				c[i] = cur[i] - byte((int(left)+int(up))/2)
+			case 4:
+				c[i] = cur[i] - paeth(left, up, upLeft)
+			}
+		}
+	}
+
+	best, bestSum := 0, -1
+
+	for f, c := range candidates {
+		sum := 0
+		for _, v := range c {
+			sum += absInt(int(int8(v)))
+		}
+
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = f, sum
+		}
+	}
+
+	out[0] = byte(best)
+	copy(out[1:], candidates[best])
+}
+
+func compressApngFrame(data []byte, width, height, bands int) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, err := zlib.NewWriterLevel(&buf, zlib.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	stride := width * bands
+
+	var candidates [5][]byte
+	for i := range candidates {
+		candidates[i] = make([]byte, stride)
+	}
+
+	prev := make([]byte, stride)
+	out := make([]byte, stride+1)
+
+	for y := 0; y < height; y++ {
+		cur := data[y*stride : (y+1)*stride]
+
+		filterPngRow(out, cur, prev, bands, candidates)
+
+		if _, err := w.Write(out); err != nil {
+			return nil, err
+		}
+
+		prev = cur
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (img *Image) isMultiPage() bool {
+	pageHeight, err := img.GetIntDefault("page-height", 0)
+	return err == nil && pageHeight > 0 && pageHeight < img.Height()
+}
+
+func (img *Image) saveAsApng() (*imagedata.ImageData, error) {
+	if err := img.CastUchar(); err != nil {
+		return nil, err
+	}
+
+	if err := img.CopyMemory(); err != nil {
+		return nil, err
+	}
+
+	width, height := img.Width(), img.Height()
+	bands := int(img.VipsImage.Bands)
+
+	frameHeight, err := img.GetIntDefault("page-height", height)
+	if err != nil {
+		return nil, err
+	}
+
+	framesCount := height / frameHeight
+
+	delay, err := img.GetIntSliceDefault("delay", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	loop, err := img.GetIntDefault("loop", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var colorType byte
+
+	switch bands {
+	case 1:
+		colorType = 0
+	case 2:
+		colorType = 4
+	case 3:
+		colorType = 2
+	case 4:
+		colorType = 6
+	default:
+		return nil, errors.New("Unsupported number of bands for APNG")
+	}
+
+	data := unsafe.Pointer(C.vips_image_get_data(img.VipsImage))
+	imgData := ptrToBytes(data, bands*width*height)
+	frameSize := bands * width * frameHeight
+
+	// Compressed frames are usually much smaller than the raw data
+	buf := bufpool.GetSized(len(imgData) / 4)
+	buf.Write(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(frameHeight))
+	ihdr[8] = 8
+	ihdr[9] = colorType
+	writePngChunk(buf, "IHDR", ihdr)
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:4], uint32(framesCount))
+	binary.BigEndian.PutUint32(actl[4:8], uint32(loop))
+	writePngChunk(buf, "acTL", actl)
+
+	seq := uint32(0)
+
+	for i := 0; i < framesCount; i++ {
+		frameDelay := 100
+		if i < len(delay) {
+			// Delay numerator is 16-bit
+			frameDelay = imath.Min(delay[i], 0xffff)
+		}
+
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:4], seq)
+		binary.BigEndian.PutUint32(fctl[4:8], uint32(width))
+		binary.BigEndian.PutUint32(fctl[8:12], uint32(frameHeight))
+		binary.BigEndian.PutUint16(fctl[20:22], uint16(frameDelay))
+		binary.BigEndian.PutUint16(fctl[22:24], 1000)
+		fctl[24] = apngDisposeOpNone
+		fctl[25] = apngBlendOpSource
+		writePngChunk(buf, "fcTL", fctl)
+		seq++
+
+		compressed, err := compressApngFrame(imgData[i*frameSize:(i+1)*frameSize], width, frameHeight, bands)
+		if err != nil {
+			bufpool.PutSized(buf)
+			return nil, err
+		}
+
+		// The first frame is also the default image
+		if i == 0 {
+			writePngChunk(buf, "IDAT", compressed)
+			continue
+		}
+
+		fdat := make([]byte, 4+len(compressed))
+		binary.BigEndian.PutUint32(fdat[0:4], seq)
+		copy(fdat[4:], compressed)
+		writePngChunk(buf, "fdAT", fdat)
+		seq++
+	}
+
+	writePngChunk(buf, "IEND", nil)
+
+	imgdata := imagedata.ImageData{
+		Type: imagetype.PNG,
+		Data: buf.Bytes(),
+	}
+	imgdata.SetCancel(func() { bufpool.PutSized(buf) })
+
+	return &imgdata, nil
+}
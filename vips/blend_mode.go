@@ -0,0 +1,54 @@
+package vips
+
+/*
+#include "vips.h"
+*/
+import "C"
+
+type BlendMode int
+
+const (
+	BlendOver       BlendMode = C.VIPS_BLEND_MODE_OVER
+	BlendMultiply   BlendMode = C.VIPS_BLEND_MODE_MULTIPLY
+	BlendScreen     BlendMode = C.VIPS_BLEND_MODE_SCREEN
+	BlendOverlay    BlendMode = C.VIPS_BLEND_MODE_OVERLAY
+	BlendDarken     BlendMode = C.VIPS_BLEND_MODE_DARKEN
+	BlendLighten    BlendMode = C.VIPS_BLEND_MODE_LIGHTEN
+	BlendColorDodge BlendMode = C.VIPS_BLEND_MODE_COLOUR_DODGE
+	BlendColorBurn  BlendMode = C.VIPS_BLEND_MODE_COLOUR_BURN
+	BlendHardLight  BlendMode = C.VIPS_BLEND_MODE_HARD_LIGHT
+	BlendSoftLight  BlendMode = C.VIPS_BLEND_MODE_SOFT_LIGHT
+	BlendDifference BlendMode = C.VIPS_BLEND_MODE_DIFFERENCE
+	BlendExclusion  BlendMode = C.VIPS_BLEND_MODE_EXCLUSION
+)
+
+var BlendModes = map[string]BlendMode{
+	"over":        BlendOver,
+	"multiply":    BlendMultiply,
+	"screen":      BlendScreen,
+	"overlay":     BlendOverlay,
+	"darken":      BlendDarken,
+	"lighten":     BlendLighten,
+	"color_dodge": BlendColorDodge,
+	"color_burn":  BlendColorBurn,
+	"hard_light":  BlendHardLight,
+	"soft_light":  BlendSoftLight,
+	"difference":  BlendDifference,
+	"exclusion":   BlendExclusion,
+}
+
+func (bm BlendMode) String() string {
+	for k, v := range BlendModes {
+		if v == bm {
+			return k
+		}
+	}
+	return ""
+}
+
+func (bm BlendMode) MarshalJSON() ([]byte, error) {
+	if s := bm.String(); len(s) > 0 {
+		return []byte(`"` + s + `"`), nil
+	}
+	return []byte("null"), nil
+}
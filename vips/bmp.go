@@ -13,6 +13,7 @@ import (
 	"io"
 	"unsafe"
 
+	"github.com/imgproxy/imgproxy/v3/bufpool"
 	"github.com/imgproxy/imgproxy/v3/imagedata"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
 )
@@ -47,7 +48,7 @@ func readUint32(b []byte) uint32 {
 	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
 }
 
-func prepareBmpCanvas(width, height, bands int) (*C.VipsImage, []byte, error) {
+func prepareCanvas(width, height, bands int) (*C.VipsImage, []byte, error) {
 	var tmp *C.VipsImage
 
 	if C.vips_black_go(&tmp, C.int(width), C.int(height), C.int(bands)) != 0 {
@@ -63,7 +64,7 @@ func prepareBmpCanvas(width, height, bands int) (*C.VipsImage, []byte, error) {
 // decodeBmpPaletted reads an 8 bit-per-pixel BMP image from r.
 // If topDown is false, the image rows will be read bottom-up.
 func (img *Image) decodeBmpPaletted(r io.Reader, width, height, bpp int, palette []Color, topDown bool) error {
-	tmp, imgData, err := prepareBmpCanvas(width, height, 3)
+	tmp, imgData, err := prepareCanvas(width, height, 3)
 	if err != nil {
 		return err
 	}
@@ -145,7 +146,7 @@ func (img *Image) decodeBmpRGB(r io.Reader, width, height, bands int, topDown, n
 		imgBands = 4
 	}
 
-	tmp, imgData, err := prepareBmpCanvas(width, height, imgBands)
+	tmp, imgData, err := prepareCanvas(width, height, imgBands)
 	if err != nil {
 		return err
 	}
@@ -323,8 +324,7 @@ func (img *Image) saveAsBmp() (*imagedata.ImageData, error) {
 	h.imageSize = uint32(height * lineSize)
 	h.fileSize += h.imageSize
 
-	buf := new(bytes.Buffer)
-	buf.Grow(int(h.fileSize))
+	buf := bufpool.GetSized(int(h.fileSize))
 
 	if err := binary.Write(buf, binary.LittleEndian, h); err != nil {
 		return nil, err
@@ -364,8 +364,11 @@ func (img *Image) saveAsBmp() (*imagedata.ImageData, error) {
 		}
 	}
 
-	return &imagedata.ImageData{
+	imgdata := imagedata.ImageData{
 		Type: imagetype.BMP,
 		Data: buf.Bytes(),
-	}, nil
+	}
+	imgdata.SetCancel(func() { bufpool.PutSized(buf) })
+
+	return &imgdata, nil
 }
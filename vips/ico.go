@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"unsafe"
 
+	"github.com/imgproxy/imgproxy/v3/bufpool"
 	"github.com/imgproxy/imgproxy/v3/imagedata"
 	"github.com/imgproxy/imgproxy/v3/imagemeta"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
@@ -72,8 +73,7 @@ func (img *Image) saveAsIco() (*imagedata.ImageData, error) {
 
 	b := ptrToBytes(ptr, int(imgsize))
 
-	buf := new(bytes.Buffer)
-	buf.Grow(22 + int(imgsize))
+	buf := bufpool.GetSized(22 + int(imgsize))
 
 	// ICONDIR header
 	if _, err := buf.Write([]byte{0, 0, 1, 0, 1, 0}); err != nil {
@@ -126,6 +126,7 @@ func (img *Image) saveAsIco() (*imagedata.ImageData, error) {
 		Type: imagetype.ICO,
 		Data: buf.Bytes(),
 	}
+	imgdata.SetCancel(func() { bufpool.PutSized(buf) })
 
 	return &imgdata, nil
 }
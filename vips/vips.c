@@ -12,6 +12,15 @@
 #define VIPS_SUPPORT_GIFSAVE \
   (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 12))
 
+#define VIPS_SUPPORT_GIFSAVE_OPTIMIZATION \
+  (VIPS_MAJOR_VERSION > 8 || (VIPS_MAJOR_VERSION == 8 && VIPS_MINOR_VERSION >= 13))
+
+// Pixels that differ from the previous frame less than this are made transparent
+#define GIF_INTERFRAME_MAXERROR 8.0
+// The previous frame palette is reused if it causes an error less than this
+#define GIF_INTERPALETTE_MAXERROR 8.0
+#define GIF_DEFAULT_INTERPALETTE_MAXERROR 3.0
+
 int
 vips_initialize() {
   return vips_init("imgproxy");
@@ -103,6 +112,19 @@ vips_black_go(VipsImage **out, int width, int height, int bands) {
   return res;
 }
 
+int
+vips_health_check() {
+  VipsImage *tmp;
+  double avg;
+
+  int res = vips_black(&tmp, 4, 4, NULL) ||
+    vips_avg(tmp, &avg, NULL);
+
+  clear_image(&tmp);
+
+  return res;
+}
+
 int
 vips_get_orientation(VipsImage *image) {
   int orientation;
@@ -206,6 +228,409 @@ vips_resize_go(VipsImage *in, VipsImage **out, double wscale, double hscale) {
   return 0;
 }
 
+int
+vips_upscale_go(VipsImage *in, VipsImage **out, double wscale, double hscale) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 4);
+
+  VipsBandFormat format = vips_band_format(in);
+  gboolean has_alpha = vips_image_hasalpha(in);
+
+  // Nohalo is designed for enlarging and produces sharp edges without halos
+  VipsInterpolate *interpolate = vips_interpolate_new("nohalo");
+
+  // Align the centers of the input and the output pixels
+  double odx = 0.5 * wscale - 0.5;
+  double ody = 0.5 * hscale - 0.5;
+
+  VipsArrayInt *oarea = vips_array_int_newv(
+    4, 0, 0, (int)(in->Xsize * wscale + 0.5), (int)(in->Ysize * hscale + 0.5)
+  );
+
+  VipsImage *x = in;
+
+  if (has_alpha) {
+    if (vips_premultiply(in, &t[0], NULL)) {
+      g_object_unref(interpolate);
+      vips_area_unref(VIPS_AREA(oarea));
+      clear_image(&base);
+      return 1;
+    }
+    x = t[0];
+  }
+
+  int res =
+    vips_affine(
+      x, &t[1], wscale, 0, 0, hscale,
+      "interpolate", interpolate,
+      "odx", odx, "ody", ody,
+      "oarea", oarea,
+      "extend", VIPS_EXTEND_COPY,
+      "premultiplied", has_alpha,
+      NULL
+    );
+
+  g_object_unref(interpolate);
+  vips_area_unref(VIPS_AREA(oarea));
+
+  if (res) {
+    clear_image(&base);
+    return 1;
+  }
+
+  x = t[1];
+
+  if (has_alpha) {
+    if (vips_unpremultiply(x, &t[2], NULL)) {
+      clear_image(&base);
+      return 1;
+    }
+    x = t[2];
+  }
+
+  res = vips_cast(x, &t[3], format, NULL) ||
+    vips_sharpen(t[3], out, "sigma", 0.5, NULL);
+
+  clear_image(&base);
+
+  return res;
+}
+
+// vips_color_bands extracts the color bands and the alpha band of the image.
+// alpha is set to NULL if the image doesn't have alpha
+static int
+vips_color_bands(VipsImage *in, VipsImage **color, VipsImage **alpha) {
+  *alpha = NULL;
+
+  if (!vips_image_hasalpha(in))
+    return vips_copy(in, color, NULL);
+
+  if (vips_extract_band(in, color, 0, "n", in->Bands - 1, NULL))
+    return 1;
+
+  if (vips_extract_band(in, alpha, in->Bands - 1, "n", 1, NULL)) {
+    clear_image(color);
+    return 1;
+  }
+
+  return 0;
+}
+
+// vips_join_alpha joins the alpha band back to the processed color bands
+// and casts the result to the format of the original image
+static int
+vips_join_alpha(VipsImage *color, VipsImage *alpha, VipsImage **out, VipsBandFormat format) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 1);
+
+  int res;
+
+  if (alpha == NULL) {
+    res = vips_cast(color, out, format, NULL);
+  } else {
+    res =
+      vips_cast(color, &t[0], format, NULL) ||
+      vips_bandjoin2(t[0], alpha, out, NULL);
+  }
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_white_balance_go(VipsImage *in, VipsImage **out, gboolean retinex) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 3);
+
+  VipsBandFormat format = vips_band_format(in);
+
+  if (vips_color_bands(in, &t[0], &t[1])) {
+    clear_image(&base);
+    return 1;
+  }
+
+  int bands = t[0]->Bands;
+  double *levels = VIPS_ARRAY(base, bands, double);
+  double *a = VIPS_ARRAY(base, bands, double);
+  double *b = VIPS_ARRAY(base, bands, double);
+  double target = 0.0;
+
+  for (int i = 0; i < bands; i++) {
+    VipsImage *band;
+    int res;
+
+    if (vips_extract_band(t[0], &band, i, NULL)) {
+      clear_image(&base);
+      return 1;
+    }
+
+    if (retinex) {
+      // Ignore the brightest pixels since they are likely to be clipped highlights
+      int high;
+      res = vips_percent(band, 99.5, &high, NULL);
+      levels[i] = high;
+    } else {
+      res = vips_avg(band, &levels[i], NULL);
+    }
+
+    clear_image(&band);
+
+    if (res) {
+      clear_image(&base);
+      return 1;
+    }
+
+    if (retinex)
+      target = VIPS_MAX(target, levels[i]);
+    else
+      target += levels[i] / bands;
+  }
+
+  for (int i = 0; i < bands; i++) {
+    a[i] = levels[i] > 0 ? target / levels[i] : 1.0;
+    b[i] = 0.0;
+  }
+
+  int res =
+    vips_linear(t[0], &t[2], a, b, bands, NULL) ||
+    vips_join_alpha(t[2], t[1], out, format);
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_recomb_go(VipsImage *in, VipsImage **out, double *matrix, double *offset) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 5);
+
+  VipsBandFormat format = vips_band_format(in);
+  double scale = format == VIPS_FORMAT_USHORT ? 257.0 : 1.0;
+
+  double a[3] = {1.0, 1.0, 1.0};
+  double b[3] = {offset[0] * scale, offset[1] * scale, offset[2] * scale};
+
+  int res =
+    vips_color_bands(in, &t[0], &t[1]) ||
+    !(t[2] = vips_image_new_matrix_from_array(3, 3, matrix, 9)) ||
+    vips_recomb(t[0], &t[3], t[2], NULL) ||
+    vips_linear(t[3], &t[4], a, b, 3, NULL) ||
+    vips_join_alpha(t[4], t[1], out, format);
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_negate_go(VipsImage *in, VipsImage **out, gboolean negate_alpha) {
+  if (negate_alpha || !vips_image_hasalpha(in))
+    return vips_invert(in, out, NULL);
+
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 3);
+
+  int res =
+    vips_color_bands(in, &t[0], &t[1]) ||
+    vips_invert(t[0], &t[2], NULL) ||
+    vips_join_alpha(t[2], t[1], out, vips_band_format(in));
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_apply_lut3d_go(VipsImage *in, VipsImage **out, int size, float *lut) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 5);
+
+  VipsBandFormat format = vips_band_format(in);
+  double max = format == VIPS_FORMAT_USHORT ? 65535.0 : 255.0;
+
+  if (vips_color_bands(in, &t[0], &t[1]) ||
+      vips_cast(t[0], &t[2], VIPS_FORMAT_FLOAT, NULL)) {
+    clear_image(&base);
+    return 1;
+  }
+
+  if (t[2]->Bands != 3) {
+    vips_error("vips_apply_lut3d_go", "LUT can be applied to RGB images only");
+    clear_image(&base);
+    return 1;
+  }
+
+  int width = t[2]->Xsize;
+  int height = t[2]->Ysize;
+  size_t len;
+
+  float *data = (float *) vips_image_write_to_memory(t[2], &len);
+  if (data == NULL) {
+    clear_image(&base);
+    return 1;
+  }
+
+  int last = size - 1;
+  int stride_g = size;
+  int stride_b = size * size;
+
+  for (size_t i = 0; i < len / sizeof(float); i += 3) {
+    float pos[3];
+    int idx0[3], idx1[3];
+    float frac[3];
+
+    for (int c = 0; c < 3; c++) {
+      pos[c] = VIPS_CLIP(0.0, data[i + c] / max, 1.0) * last;
+      idx0[c] = VIPS_MIN((int) pos[c], last);
+      idx1[c] = VIPS_MIN(idx0[c] + 1, last);
+      frac[c] = pos[c] - idx0[c];
+    }
+
+    for (int c = 0; c < 3; c++) {
+      float v = 0.0;
+
+      // Trilinear interpolation between the 8 nearest table entries
+      for (int corner = 0; corner < 8; corner++) {
+        int r = corner & 1 ? idx1[0] : idx0[0];
+        int g = corner & 2 ? idx1[1] : idx0[1];
+        int b = corner & 4 ? idx1[2] : idx0[2];
+
+        float w =
+          (corner & 1 ? frac[0] : 1.0 - frac[0]) *
+          (corner & 2 ? frac[1] : 1.0 - frac[1]) *
+          (corner & 4 ? frac[2] : 1.0 - frac[2]);
+
+        v += w * lut[(r + g * stride_g + b * stride_b) * 3 + c];
+      }
+
+      data[i + c] = v * max;
+    }
+  }
+
+  t[3] = vips_image_new_from_memory_copy(data, len, width, height, 3, VIPS_FORMAT_FLOAT);
+  g_free(data);
+
+  if (t[3] == NULL) {
+    clear_image(&base);
+    return 1;
+  }
+
+  int res =
+    vips_copy(t[3], &t[4],
+      "interpretation", t[2]->Type,
+      "xres", t[2]->Xres,
+      "yres", t[2]->Yres,
+      NULL) ||
+    vips_join_alpha(t[4], t[1], out, format);
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_enhance_go(VipsImage *in, VipsImage **out) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 3);
+
+  VipsBandFormat format = vips_band_format(in);
+  double max = format == VIPS_FORMAT_USHORT ? 65535.0 : 255.0;
+
+  if (vips_color_bands(in, &t[0], &t[1])) {
+    clear_image(&base);
+    return 1;
+  }
+
+  int bands = t[0]->Bands;
+  double *a = VIPS_ARRAY(base, bands, double);
+  double *b = VIPS_ARRAY(base, bands, double);
+
+  for (int i = 0; i < bands; i++) {
+    VipsImage *band;
+    int low, high;
+
+    if (vips_extract_band(t[0], &band, i, NULL)) {
+      clear_image(&base);
+      return 1;
+    }
+
+    // Ignore the darkest and the brightest pixels so noise doesn't affect the result
+    int res =
+      vips_percent(band, 0.5, &low, NULL) ||
+      vips_percent(band, 99.5, &high, NULL);
+
+    clear_image(&band);
+
+    if (res) {
+      clear_image(&base);
+      return 1;
+    }
+
+    if (high > low) {
+      a[i] = max / (high - low);
+      b[i] = -low * a[i];
+    } else {
+      a[i] = 1.0;
+      b[i] = 0.0;
+    }
+  }
+
+  int res =
+    vips_linear(t[0], &t[2], a, b, bands, NULL) ||
+    vips_join_alpha(t[2], t[1], out, format);
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_equalize_go(VipsImage *in, VipsImage **out, gboolean local, int size, int max_slope) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 12);
+
+  VipsBandFormat format = vips_band_format(in);
+  VipsInterpretation interpretation = in->Type;
+
+  if (vips_color_bands(in, &t[0], &t[1])) {
+    clear_image(&base);
+    return 1;
+  }
+
+  // Equalize only the lightness so colors are not shifted.
+  // Histogram functions work with uchar images, so we scale L from 0..100 to 0..255
+  if (
+    vips_colourspace(t[0], &t[2], VIPS_INTERPRETATION_LAB, NULL) ||
+    vips_extract_band(t[2], &t[3], 0, NULL) ||
+    vips_extract_band(t[2], &t[4], 1, "n", 2, NULL) ||
+    vips_linear1(t[3], &t[5], 2.55, 0, NULL) ||
+    vips_cast(t[5], &t[6], VIPS_FORMAT_UCHAR, NULL)
+  ) {
+    clear_image(&base);
+    return 1;
+  }
+
+  int res;
+
+  if (local)
+    res = vips_hist_local(t[6], &t[7], size, size, "max_slope", max_slope, NULL);
+  else
+    res = vips_hist_equal(t[6], &t[7], NULL);
+
+  res = res ||
+    vips_linear1(t[7], &t[8], 1.0 / 2.55, 0, NULL) ||
+    vips_bandjoin2(t[8], t[4], &t[9], NULL) ||
+    vips_copy(t[9], &t[10], "interpretation", VIPS_INTERPRETATION_LAB, NULL) ||
+    vips_colourspace(t[10], &t[11], interpretation, NULL) ||
+    vips_join_alpha(t[11], t[1], out, format);
+
+  clear_image(&base);
+
+  return res;
+}
+
 int
 vips_pixelate(VipsImage *in, VipsImage **out, int pixels) {
   VipsImage *base = vips_image_new();
@@ -330,14 +755,110 @@ vips_rot_go(VipsImage *in, VipsImage **out, VipsAngle angle) {
   return vips_rot(in, out, angle, NULL);
 }
 
+int
+vips_affine_go(VipsImage *in, VipsImage **out, double a, double b, double c, double d,
+               gboolean transparent, double bg_r, double bg_g, double bg_b) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 4);
+
+  VipsBandFormat format = vips_band_format(in);
+  double max = format == VIPS_FORMAT_USHORT ? 65535.0 : 255.0;
+
+  // Transparent background requires alpha
+  if (transparent) {
+    if (vips_ensure_alpha(in, &t[0])) {
+      clear_image(&base);
+      return 1;
+    }
+  } else if (vips_copy(in, &t[0], NULL)) {
+    clear_image(&base);
+    return 1;
+  }
+
+  gboolean has_alpha = vips_image_hasalpha(t[0]);
+  int bands = t[0]->Bands;
+  int color_bands = has_alpha ? bands - 1 : bands;
+
+  double *bg = VIPS_ARRAY(base, bands, double);
+
+  for (int i = 0; i < color_bands; i++) {
+    if (transparent)
+      bg[i] = 0;
+    else if (color_bands < 3)
+      bg[i] = (bg_r + bg_g + bg_b) / 3 * max / 255.0;
+    else
+      bg[i] = (i == 0 ? bg_r : (i == 1 ? bg_g : bg_b)) * max / 255.0;
+  }
+
+  if (has_alpha)
+    bg[bands - 1] = transparent ? 0 : max;
+
+  VipsArrayDouble *background = vips_array_double_new(bg, bands);
+
+  int res;
+
+  // Transform premultiplied image to get rid of dark edges
+  if (has_alpha) {
+    res =
+      vips_premultiply(t[0], &t[1], NULL) ||
+      vips_affine(
+        t[1], &t[2], a, b, c, d,
+        "background", background, "extend", VIPS_EXTEND_BACKGROUND, "premultiplied", TRUE, NULL
+      ) ||
+      vips_unpremultiply(t[2], &t[3], NULL) ||
+      vips_cast(t[3], out, format, NULL);
+  } else {
+    res = vips_affine(
+      t[0], out, a, b, c, d,
+      "background", background, "extend", VIPS_EXTEND_BACKGROUND, NULL
+    );
+  }
+
+  vips_area_unref(VIPS_AREA(background));
+  clear_image(&base);
+
+  return res;
+}
+
 int
 vips_flip_horizontal_go(VipsImage *in, VipsImage **out) {
   return vips_flip(in, out, VIPS_DIRECTION_HORIZONTAL, NULL);
 }
 
 int
-vips_smartcrop_go(VipsImage *in, VipsImage **out, int width, int height) {
-  return vips_smartcrop(in, out, width, height, NULL);
+vips_grayscale_pixels_go(VipsImage *in, double scale, void **buf, size_t *len,
+  int *width, int *height) {
+
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 4);
+
+  int res = vips_resize(in, &t[0], scale, NULL) ||
+    vips_colourspace(t[0], &t[1], VIPS_INTERPRETATION_B_W, NULL) ||
+    vips_extract_band(t[1], &t[2], 0, "n", 1, NULL) ||
+    vips_cast(t[2], &t[3], VIPS_FORMAT_UCHAR, NULL);
+
+  if (!res) {
+    *width = t[3]->Xsize;
+    *height = t[3]->Ysize;
+    *buf = vips_image_write_to_memory(t[3], len);
+    res = *buf == NULL;
+  }
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_smartcrop_go(VipsImage *in, VipsImage **out, int width, int height,
+  int *attention_x, int *attention_y) {
+
+  return vips_smartcrop(
+    in, out, width, height,
+    "attention_x", attention_x,
+    "attention_y", attention_y,
+    NULL
+  );
 }
 
 int
@@ -511,11 +1032,172 @@ vips_apply_watermark(VipsImage *in, VipsImage *watermark, VipsImage **out, doubl
   return res;
 }
 
+int
+vips_apply_mask_go(VipsImage *in, VipsImage *mask, VipsImage **out) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 10);
+
+  VipsBandFormat format = vips_band_format(in);
+  double max = format == VIPS_FORMAT_USHORT ? 65535.0 : 255.0;
+
+  // Use the mask alpha if it has one, otherwise use its lightness
+  if (vips_image_hasalpha(mask)) {
+    if (vips_extract_band(mask, &t[0], mask->Bands - 1, "n", 1, NULL)) {
+      clear_image(&base);
+      return 1;
+    }
+  } else {
+    if (
+      vips_colourspace(mask, &t[1], VIPS_INTERPRETATION_B_W, NULL) ||
+      vips_extract_band(t[1], &t[0], 0, "n", 1, NULL)
+    ) {
+      clear_image(&base);
+      return 1;
+    }
+  }
+
+  double mask_max = vips_band_format(t[0]) == VIPS_FORMAT_USHORT ? 65535.0 : 255.0;
+
+  // Stretch the mask to the image size and normalize it to 0..1
+  if (
+    vips_resize(
+      t[0], &t[2],
+      (double) in->Xsize / t[0]->Xsize,
+      "vscale", (double) in->Ysize / t[0]->Ysize,
+      NULL
+    ) ||
+    vips_gravity(
+      t[2], &t[3], VIPS_COMPASS_DIRECTION_CENTRE, in->Xsize, in->Ysize,
+      "extend", VIPS_EXTEND_COPY, NULL
+    ) ||
+    vips_linear1(t[3], &t[4], 1.0 / mask_max, 0, NULL) ||
+    vips_color_bands(in, &t[5], &t[6])
+  ) {
+    clear_image(&base);
+    return 1;
+  }
+
+  int res;
+
+  if (t[6] != NULL)
+    res = vips_multiply(t[6], t[4], &t[7], NULL);
+  else
+    res = vips_linear1(t[4], &t[7], max, 0, NULL);
+
+  res = res ||
+    vips_cast(t[5], &t[8], format, NULL) ||
+    vips_cast(t[7], &t[9], format, NULL) ||
+    vips_bandjoin2(t[8], t[9], out, NULL);
+
+  clear_image(&base);
+
+  return res;
+}
+
+int
+vips_composite_go(VipsImage *in, VipsImage *overlay, VipsImage **out, int mode) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 2);
+
+  int res =
+    vips_ensure_alpha(overlay, &t[0]) ||
+    vips_composite2(in, t[0], &t[1], (VipsBlendMode) mode, "compositing_space", in->Type, NULL) ||
+    vips_cast(t[1], out, vips_image_get_format(in), NULL);
+
+  clear_image(&base);
+
+  return res;
+}
+
 int
 vips_arrayjoin_go(VipsImage **in, VipsImage **out, int n) {
   return vips_arrayjoin(in, out, n, "across", 1, NULL);
 }
 
+int
+vips_arrayjoin_grid_go(VipsImage **in, VipsImage **out, int n, int across, double r, double g, double b) {
+  // Empty cells are filled with the background color, or are transparent if the images have alpha
+  double bg[4] = {r, g, b, 0.0};
+  int bands = VIPS_MIN(in[0]->Bands, 4);
+
+  if (bands < 3)
+    bg[0] = bg[1] = 0.0;
+
+  VipsArrayDouble *background = vips_array_double_new(bg, bands);
+
+  int res = vips_arrayjoin(in, out, n, "across", across, "background", background, NULL);
+
+  vips_area_unref(VIPS_AREA(background));
+
+  return res;
+}
+
+int
+vips_image_equal_go(VipsImage *a, VipsImage *b, int *equal) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 1);
+
+  double max;
+
+  int res =
+    vips_relational(a, b, &t[0], VIPS_OPERATION_RELATIONAL_NOTEQ, NULL) ||
+    vips_max(t[0], &max, NULL);
+
+  clear_image(&base);
+
+  if (!res)
+    *equal = max == 0;
+
+  return res;
+}
+
+int
+vips_average_color_go(VipsImage *in, double *r, double *g, double *b, double *a) {
+  VipsImage *base = vips_image_new();
+  VipsImage **t = (VipsImage **) vips_object_local_array(VIPS_OBJECT(base), 3);
+
+  VipsImage *rgb;
+  gboolean has_alpha = FALSE;
+
+  int res = vips_colourspace(in, &t[0], VIPS_INTERPRETATION_sRGB, NULL);
+
+  if (!res) {
+    rgb = t[0];
+    has_alpha = vips_image_hasalpha(rgb);
+
+    // Premultiplied colors let us weight the pixels by their opacity
+    if (has_alpha && !(res = vips_premultiply(rgb, &t[1], NULL)))
+      rgb = t[1];
+  }
+
+  if (!res)
+    res = vips_stats(rgb, &t[2], NULL);
+
+  if (!res) {
+    // The first row of the stats matrix contains the stats of all bands,
+    // the next rows contain the stats of each band.
+    // The 5th column contains the mean value
+    *r = *VIPS_MATRIX(t[2], 4, 1);
+    *g = *VIPS_MATRIX(t[2], 4, 2);
+    *b = *VIPS_MATRIX(t[2], 4, 3);
+    *a = 255.0;
+
+    if (has_alpha) {
+      *a = *VIPS_MATRIX(t[2], 4, 4);
+
+      if (*a > 0) {
+        *r *= 255.0 / *a;
+        *g *= 255.0 / *a;
+        *b *= 255.0 / *a;
+      }
+    }
+  }
+
+  clear_image(&base);
+
+  return res;
+}
+
 int
 vips_strip(VipsImage *in, VipsImage **out) {
   static double default_resolution = 72.0 / 25.4;
@@ -543,6 +1225,25 @@ vips_strip(VipsImage *in, VipsImage **out) {
   return 0;
 }
 
+int
+vips_strip_gps_go(VipsImage *in, VipsImage **out) {
+  if (vips_copy(in, out, NULL)) return 1;
+
+  gchar **fields = vips_image_get_fields(in);
+
+  // libvips stores GPS tags as exif-ifd3-* fields and writes them back to EXIF on save
+  for (int i = 0; fields[i] != NULL; i++) {
+    gchar *name = fields[i];
+
+    if (vips_isprefix("exif-ifd3-", name))
+      vips_image_remove(*out, name);
+  }
+
+  g_strfreev(fields);
+
+  return 0;
+}
+
 int
 vips_jpegsave_go(VipsImage *in, void **buf, size_t *len, int quality, int interlace) {
   return vips_jpegsave_buffer(
@@ -599,9 +1300,18 @@ vips_webpsave_go(VipsImage *in, void **buf, size_t *len, int quality) {
 }
 
 int
-vips_gifsave_go(VipsImage *in, void **buf, size_t *len) {
-#if VIPS_SUPPORT_GIFSAVE
-  return vips_gifsave_buffer(in, buf, len, NULL);
+vips_gifsave_go(VipsImage *in, void **buf, size_t *len, double dither, int effort, int optimize_frames, int optimize_transparency) {
+#if VIPS_SUPPORT_GIFSAVE_OPTIMIZATION
+  return vips_gifsave_buffer(
+    in, buf, len,
+    "dither", dither,
+    "effort", effort,
+    "interframe_maxerror", optimize_transparency ? GIF_INTERFRAME_MAXERROR : 0.0,
+    "interpalette_maxerror", optimize_frames ? GIF_INTERPALETTE_MAXERROR : GIF_DEFAULT_INTERPALETTE_MAXERROR,
+    NULL
+  );
+#elif VIPS_SUPPORT_GIFSAVE
+  return vips_gifsave_buffer(in, buf, len, "dither", dither, "effort", effort, NULL);
 #else
   vips_error("vips_gifsave_go", "Saving GIF is not supported (libvips 8.12+ reuired)");
   return 1;
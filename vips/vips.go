@@ -21,8 +21,10 @@ import (
 	"github.com/imgproxy/imgproxy/v3/config"
 	"github.com/imgproxy/imgproxy/v3/ierrors"
 	"github.com/imgproxy/imgproxy/v3/imagedata"
+	"github.com/imgproxy/imgproxy/v3/imagemeta"
 	"github.com/imgproxy/imgproxy/v3/imagetype"
-	"github.com/imgproxy/imgproxy/v3/metrics/prometheus"
+	"github.com/imgproxy/imgproxy/v3/imath"
+	"github.com/imgproxy/imgproxy/v3/metrics"
 )
 
 type Image struct {
@@ -35,11 +37,15 @@ var (
 )
 
 var vipsConf struct {
-	JpegProgressive       C.int
-	PngInterlaced         C.int
-	PngQuantize           C.int
-	PngQuantizationColors C.int
-	AvifSpeed             C.int
+	JpegProgressive         C.int
+	PngInterlaced           C.int
+	PngQuantize             C.int
+	PngQuantizationColors   C.int
+	GifDither               C.double
+	GifEffort               C.int
+	GifOptimizeFrames       C.int
+	GifOptimizeTransparency C.int
+	AvifSpeed               C.int
 }
 
 func Init() error {
@@ -51,12 +57,14 @@ func Init() error {
 		return fmt.Errorf("unable to start vips!")
 	}
 
-	// Disable libvips cache. Since processing pipeline is fine tuned, we won't get much profit from it.
+	// libvips cache is disabled by default. Since processing pipeline is fine tuned,
+	// we won't get much profit from it.
 	// Enabled cache can cause SIGSEGV on Musl-based systems like Alpine.
-	C.vips_cache_set_max_mem(0)
-	C.vips_cache_set_max(0)
+	C.vips_cache_set_max_mem(C.size_t(config.VipsCacheMaxMem))
+	C.vips_cache_set_max(C.int(config.VipsCacheMax))
+	C.vips_cache_set_max_files(C.int(config.VipsCacheMaxFiles))
 
-	C.vips_concurrency_set(1)
+	C.vips_concurrency_set(C.int(config.VipsConcurrency))
 
 	// Vector calculations cause SIGSEGV sometimes when working with JPEG.
 	// It's better to disable it since profit it quite small
@@ -74,19 +82,23 @@ func Init() error {
 	vipsConf.PngInterlaced = gbool(config.PngInterlaced)
 	vipsConf.PngQuantize = gbool(config.PngQuantize)
 	vipsConf.PngQuantizationColors = C.int(config.PngQuantizationColors)
+	vipsConf.GifDither = C.double(config.GifDither)
+	vipsConf.GifEffort = C.int(config.GifEffort)
+	vipsConf.GifOptimizeFrames = gbool(config.GifOptimizeFrames)
+	vipsConf.GifOptimizeTransparency = gbool(config.GifOptimizeTransparency)
 	vipsConf.AvifSpeed = C.int(config.AvifSpeed)
 
-	prometheus.AddGaugeFunc(
+	metrics.AddGaugeFunc(
 		"vips_memory_bytes",
 		"A gauge of the vips tracked memory usage in bytes.",
 		GetMem,
 	)
-	prometheus.AddGaugeFunc(
+	metrics.AddGaugeFunc(
 		"vips_max_memory_bytes",
 		"A gauge of the max vips tracked memory usage in bytes.",
 		GetMemHighwater,
 	)
-	prometheus.AddGaugeFunc(
+	metrics.AddGaugeFunc(
 		"vips_allocs",
 		"A gauge of the number of active vips allocations.",
 		GetAllocs,
@@ -111,6 +123,42 @@ func GetAllocs() float64 {
 	return float64(C.vips_tracked_get_allocs())
 }
 
+// GetCacheSize returns the number of operations in the vips operations cache
+func GetCacheSize() int {
+	return int(C.vips_cache_get_size())
+}
+
+// GetCacheMax returns the max number of operations in the vips operations cache
+func GetCacheMax() int {
+	return int(C.vips_cache_get_max())
+}
+
+// GetCacheMaxMem returns the max memory size of the vips operations cache in bytes
+func GetCacheMaxMem() int {
+	return int(C.vips_cache_get_max_mem())
+}
+
+// DropCache drops all the operations from the vips operations cache
+func DropCache() {
+	// Setting the max cache size to zero trims the cache completely
+	max := C.vips_cache_get_max()
+	C.vips_cache_set_max(0)
+	C.vips_cache_set_max(max)
+}
+
+// Check runs a tiny operation to make sure vips is functional
+func Check() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer Cleanup()
+
+	if C.vips_health_check() != 0 {
+		return Error()
+	}
+
+	return nil
+}
+
 func Cleanup() {
 	C.vips_cleanup()
 }
@@ -221,6 +269,10 @@ func (img *Image) Load(imgdata *imagedata.ImageData, shrink int, scale float64,
 	case imagetype.JPEG:
 		err = C.vips_jpegload_go(data, dataSize, C.int(shrink), &tmp)
 	case imagetype.PNG:
+		// libvips doesn't support APNG, so we decode it ourselves
+		if pages != 1 && isApng(imgdata.Data) {
+			return img.loadApng(imgdata.Data, pages)
+		}
 		err = C.vips_pngload_go(data, dataSize, &tmp)
 	case imagetype.WEBP:
 		err = C.vips_webpload_go(data, dataSize, C.double(scale), C.int(pages), &tmp)
@@ -253,6 +305,10 @@ func (img *Image) Save(imgtype imagetype.Type, quality int) (*imagedata.ImageDat
 		return img.saveAsBmp()
 	}
 
+	if imgtype == imagetype.PNG && img.isMultiPage() {
+		return img.saveAsApng()
+	}
+
 	var ptr unsafe.Pointer
 	cancel := func() {
 		C.g_free_go(&ptr)
@@ -269,7 +325,7 @@ func (img *Image) Save(imgtype imagetype.Type, quality int) (*imagedata.ImageDat
 	case imagetype.WEBP:
 		err = C.vips_webpsave_go(img.VipsImage, &ptr, &imgsize, C.int(quality))
 	case imagetype.GIF:
-		err = C.vips_gifsave_go(img.VipsImage, &ptr, &imgsize)
+		err = C.vips_gifsave_go(img.VipsImage, &ptr, &imgsize, vipsConf.GifDither, vipsConf.GifEffort, vipsConf.GifOptimizeFrames, vipsConf.GifOptimizeTransparency)
 	case imagetype.AVIF:
 		err = C.vips_avifsave_go(img.VipsImage, &ptr, &imgsize, C.int(quality), vipsConf.AvifSpeed)
 	case imagetype.TIFF:
@@ -314,6 +370,56 @@ func (img *Image) Arrayjoin(in []*Image) error {
 	return nil
 }
 
+// ArrayjoinGrid joins the images into a grid with the provided number of columns.
+// The images are expected to have the same size
+func (img *Image) ArrayjoinGrid(in []*Image, across int, bg Color) error {
+	var tmp *C.VipsImage
+
+	arr := make([]*C.VipsImage, len(in))
+	for i, im := range in {
+		arr[i] = im.VipsImage
+	}
+
+	if C.vips_arrayjoin_grid_go(
+		&arr[0], &tmp, C.int(len(arr)), C.int(across),
+		C.double(bg.R), C.double(bg.G), C.double(bg.B),
+	) != 0 {
+		return Error()
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+	return nil
+}
+
+// IsEqual checks if img has the same pixels as other.
+// The images should have the same size, bands number, and format
+func (img *Image) IsEqual(other *Image) (bool, error) {
+	var equal C.int
+
+	if C.vips_image_equal_go(img.VipsImage, other.VipsImage, &equal) != 0 {
+		return false, Error()
+	}
+
+	return equal != 0, nil
+}
+
+// AverageColor returns the average color of the image in sRGB
+// and its average opacity. The colors of semi-transparent pixels
+// are weighted by their opacity
+func (img *Image) AverageColor() (Color, uint8, error) {
+	var r, g, b, a C.double
+
+	if C.vips_average_color_go(img.VipsImage, &r, &g, &b, &a) != 0 {
+		return Color{}, 0, Error()
+	}
+
+	toUint8 := func(v C.double) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(255, float64(v)))))
+	}
+
+	return Color{toUint8(r), toUint8(g), toUint8(b)}, toUint8(a), nil
+}
+
 func (img *Image) IsAnimated() bool {
 	return C.vips_is_animated(img.VipsImage) > 0
 }
@@ -391,6 +497,59 @@ func (img *Image) GetIntSliceDefault(name string, def []int) ([]int, error) {
 	return img.GetIntSlice(name)
 }
 
+func (img *Image) GetStringDefault(name string, def string) (string, error) {
+	if C.vips_image_get_typeof(img.VipsImage, cachedCString(name)) == 0 {
+		return def, nil
+	}
+
+	var s *C.char
+
+	if C.vips_image_get_string(img.VipsImage, cachedCString(name), &s) != 0 {
+		return "", Error()
+	}
+
+	return C.GoString(s), nil
+}
+
+func (img *Image) GetBlobDefault(name string, def []byte) ([]byte, error) {
+	if C.vips_image_get_typeof(img.VipsImage, cachedCString(name)) == 0 {
+		return def, nil
+	}
+
+	var (
+		ptr  unsafe.Pointer
+		size C.size_t
+	)
+
+	if C.vips_image_get_blob(img.VipsImage, cachedCString(name), &ptr, &size) != 0 {
+		return nil, Error()
+	}
+
+	blob := make([]byte, int(size))
+	copy(blob, ptrToBytes(ptr, int(size)))
+
+	return blob, nil
+}
+
+func (img *Image) HasField(name string) bool {
+	return C.vips_image_get_typeof(img.VipsImage, cachedCString(name)) != 0
+}
+
+func (img *Image) SetString(name, value string) {
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+
+	C.vips_image_set_string(img.VipsImage, cachedCString(name), cvalue)
+}
+
+func (img *Image) SetBlob(name string, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+
+	C.vips_image_set_blob_copy(img.VipsImage, cachedCString(name), unsafe.Pointer(&value[0]), C.size_t(len(value)))
+}
+
 func (img *Image) SetInt(name string, value int) {
 	C.vips_image_set_int(img.VipsImage, cachedCString(name), C.int(value))
 }
@@ -441,6 +600,124 @@ func (img *Image) Resize(wscale, hscale float64) error {
 	return nil
 }
 
+// Upscale enlarges the image using the edge-preserving interpolation
+// and restores the fine details with sharpening
+func (img *Image) Upscale(wscale, hscale float64) error {
+	var tmp *C.VipsImage
+
+	if C.vips_upscale_go(img.VipsImage, &tmp, C.double(wscale), C.double(hscale)) != 0 {
+		return Error()
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// WhiteBalance corrects the color cast of the image. When retinex is false,
+// the gray world method is used, assuming that the average color is gray.
+// Otherwise, the retinex method is used, assuming that the brightest color is white
+func (img *Image) WhiteBalance(retinex bool) error {
+	var tmp *C.VipsImage
+
+	if C.vips_white_balance_go(img.VipsImage, &tmp, gbool(retinex)) != 0 {
+		return Error()
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// Recomb transforms the RGB values of the image with the 3x3 matrix
+// and adds the offsets to the result
+func (img *Image) Recomb(matrix [9]float64, offset [3]float64) error {
+	var tmp *C.VipsImage
+
+	if C.vips_recomb_go(
+		img.VipsImage, &tmp,
+		(*C.double)(unsafe.Pointer(&matrix[0])),
+		(*C.double)(unsafe.Pointer(&offset[0])),
+	) != 0 {
+		return Error()
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// ApplyLUT3D maps the RGB values of the image through the 3D lookup table
+// using trilinear interpolation. lut should contain size^3 RGB triplets in the 0..1 range
+func (img *Image) ApplyLUT3D(size int, lut []float32) error {
+	var tmp *C.VipsImage
+
+	if C.vips_apply_lut3d_go(
+		img.VipsImage, &tmp, C.int(size),
+		(*C.float)(unsafe.Pointer(&lut[0])),
+	) != 0 {
+		return Error()
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// Negate inverts the colors of the image. Alpha is inverted only if negateAlpha is true
+func (img *Image) Negate(negateAlpha bool) error {
+	var tmp *C.VipsImage
+
+	if C.vips_negate_go(img.VipsImage, &tmp, gbool(negateAlpha)) != 0 {
+		return Error()
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// Enhance stretches the histogram of each color band
+// so the image uses the full range of intensities
+func (img *Image) Enhance() error {
+	var tmp *C.VipsImage
+
+	if C.vips_enhance_go(img.VipsImage, &tmp) != 0 {
+		return Error()
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// Equalize equalizes the histogram of the image lightness
+func (img *Image) Equalize() error {
+	var tmp *C.VipsImage
+
+	if C.vips_equalize_go(img.VipsImage, &tmp, 0, 0, 0) != 0 {
+		return Error()
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// CLAHE applies the contrast limited adaptive histogram equalization
+// to the image lightness. size is the size of the local area
+func (img *Image) CLAHE(size, maxSlope int) error {
+	var tmp *C.VipsImage
+
+	if C.vips_equalize_go(img.VipsImage, &tmp, 1, C.int(size), C.int(maxSlope)) != 0 {
+		return Error()
+	}
+
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
 func (img *Image) Pixelate(pixels int) error {
 	var tmp *C.VipsImage
 
@@ -453,8 +730,8 @@ func (img *Image) Pixelate(pixels int) error {
 	return nil
 }
 
-func (img *Image) Orientation() C.int {
-	return C.vips_get_orientation(img.VipsImage)
+func (img *Image) Orientation() int {
+	return int(C.vips_get_orientation(img.VipsImage))
 }
 
 func (img *Image) Rotate(angle int) error {
@@ -501,15 +778,42 @@ func (img *Image) Extract(out *Image, left, top, width, height int) error {
 	return nil
 }
 
-func (img *Image) SmartCrop(width, height int) error {
-	var tmp *C.VipsImage
+// GrayscalePixels returns the pixels of the grayscale copy of the image
+// downscaled to fit the max size. The image itself is not changed
+func (img *Image) GrayscalePixels(maxSize int) ([]byte, int, int, error) {
+	var (
+		ptr           unsafe.Pointer
+		size          C.size_t
+		width, height C.int
+	)
 
-	if C.vips_smartcrop_go(img.VipsImage, &tmp, C.int(width), C.int(height)) != 0 {
-		return Error()
+	scale := math.Min(1, float64(maxSize)/float64(imath.Max(img.Width(), img.Height())))
+
+	if C.vips_grayscale_pixels_go(img.VipsImage, C.double(scale), &ptr, &size, &width, &height) != 0 {
+		return nil, 0, 0, Error()
+	}
+	defer C.g_free_go(&ptr)
+
+	pixels := make([]byte, int(size))
+	copy(pixels, ptrToBytes(ptr, int(size)))
+
+	return pixels, int(width), int(height), nil
+}
+
+// SmartCrop crops the image to the most interesting area
+// and returns the coordinates of the attention center
+func (img *Image) SmartCrop(width, height int) (int, int, error) {
+	var (
+		tmp        *C.VipsImage
+		attX, attY C.int
+	)
+
+	if C.vips_smartcrop_go(img.VipsImage, &tmp, C.int(width), C.int(height), &attX, &attY) != 0 {
+		return 0, 0, Error()
 	}
 
 	C.swap_and_clear(&img.VipsImage, tmp)
-	return nil
+	return int(attX), int(attY), nil
 }
 
 func (img *Image) Trim(threshold float64, smart bool, color Color, equalHor bool, equalVer bool) error {
@@ -540,6 +844,23 @@ func (img *Image) EnsureAlpha() error {
 	return nil
 }
 
+// Affine transforms the image with the [a, b, c, d] matrix and expands
+// the canvas to fit the result. The new areas are filled with the background
+// color or are made transparent
+func (img *Image) Affine(a, b, c, d float64, bg Color, transparent bool) error {
+	var tmp *C.VipsImage
+
+	if C.vips_affine_go(
+		img.VipsImage, &tmp, C.double(a), C.double(b), C.double(c), C.double(d),
+		gbool(transparent), C.double(bg.R), C.double(bg.G), C.double(bg.B),
+	) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
 func (img *Image) Flatten(bg Color) error {
 	var tmp *C.VipsImage
 
@@ -577,6 +898,21 @@ func (img *Image) IsCMYK() bool {
 	return C.vips_image_guess_interpretation(img.VipsImage) == C.VIPS_INTERPRETATION_CMYK
 }
 
+func (img *Image) IsGrayscale() bool {
+	interpretation := C.vips_image_guess_interpretation(img.VipsImage)
+	return interpretation == C.VIPS_INTERPRETATION_B_W || interpretation == C.VIPS_INTERPRETATION_GREY16
+}
+
+// BitDepth returns the number of bits per sample of the image.
+// If the loader reported the source bit depth, it's returned as is
+func (img *Image) BitDepth() int {
+	if depth, err := img.GetIntDefault("bits-per-sample", 0); err == nil && depth > 0 {
+		return depth
+	}
+
+	return int(C.vips_format_sizeof(img.VipsImage.BandFmt)) * 8
+}
+
 func (img *Image) ImportColourProfile() error {
 	var tmp *C.VipsImage
 
@@ -727,6 +1063,32 @@ func (img *Image) ApplyWatermark(wm *Image, opacity float64) error {
 	return nil
 }
 
+// ApplyMask uses the mask as the alpha channel of the image. The mask is stretched
+// to the image size. If the mask has alpha, it's used, otherwise, the mask lightness is used
+func (img *Image) ApplyMask(mask *Image) error {
+	var tmp *C.VipsImage
+
+	if C.vips_apply_mask_go(img.VipsImage, mask.VipsImage, &tmp) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
+// Composite places the overlay over the image using the blend mode.
+// The overlay should have the same size as the image
+func (img *Image) Composite(overlay *Image, mode BlendMode) error {
+	var tmp *C.VipsImage
+
+	if C.vips_composite_go(img.VipsImage, overlay.VipsImage, &tmp, C.int(mode)) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	return nil
+}
+
 func (img *Image) Strip() error {
 	var tmp *C.VipsImage
 
@@ -737,3 +1099,37 @@ func (img *Image) Strip() error {
 
 	return nil
 }
+
+// StripGPS removes the location info from the image EXIF
+// and keeps the rest of the metadata
+func (img *Image) StripGPS() error {
+	var tmp *C.VipsImage
+
+	if C.vips_strip_gps_go(img.VipsImage, &tmp) != 0 {
+		return Error()
+	}
+	C.swap_and_clear(&img.VipsImage, tmp)
+
+	name := cachedCString("exif-data")
+
+	if C.vips_image_get_typeof(img.VipsImage, name) == 0 {
+		return nil
+	}
+
+	var ptr unsafe.Pointer
+	size := C.size_t(0)
+
+	if C.vips_image_get_blob(img.VipsImage, name, &ptr, &size) != 0 {
+		return Error()
+	}
+
+	if size == 0 {
+		return nil
+	}
+
+	if data, ok := imagemeta.StripExifGPS(C.GoBytes(ptr, C.int(size))); ok {
+		C.vips_image_set_blob_copy(img.VipsImage, name, unsafe.Pointer(&data[0]), C.size_t(len(data)))
+	}
+
+	return nil
+}
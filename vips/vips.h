@@ -24,6 +24,8 @@ int vips_tiffload_go(void *buf, size_t len, VipsImage **out);
 
 int vips_black_go(VipsImage **out, int width, int height, int bands);
 
+int vips_health_check();
+
 int vips_get_orientation(VipsImage *image);
 void vips_strip_meta(VipsImage *image);
 
@@ -45,6 +47,13 @@ int vips_rad2float_go(VipsImage *in, VipsImage **out);
 
 int vips_resize_go(VipsImage *in, VipsImage **out, double wscale, double hscale);
 
+int vips_upscale_go(VipsImage *in, VipsImage **out, double wscale, double hscale);
+int vips_white_balance_go(VipsImage *in, VipsImage **out, gboolean retinex);
+int vips_recomb_go(VipsImage *in, VipsImage **out, double *matrix, double *offset);
+int vips_negate_go(VipsImage *in, VipsImage **out, gboolean negate_alpha);
+int vips_apply_lut3d_go(VipsImage *in, VipsImage **out, int size, float *lut);
+int vips_enhance_go(VipsImage *in, VipsImage **out);
+int vips_equalize_go(VipsImage *in, VipsImage **out, gboolean local, int size, int max_slope);
 int vips_pixelate(VipsImage *in, VipsImage **out, int pixels);
 
 int vips_icc_is_srgb_iec61966(VipsImage *in);
@@ -57,10 +66,15 @@ int vips_icc_remove(VipsImage *in, VipsImage **out);
 int vips_colourspace_go(VipsImage *in, VipsImage **out, VipsInterpretation cs);
 
 int vips_rot_go(VipsImage *in, VipsImage **out, VipsAngle angle);
+int vips_affine_go(VipsImage *in, VipsImage **out, double a, double b, double c, double d,
+                   gboolean transparent, double bg_r, double bg_g, double bg_b);
 int vips_flip_horizontal_go(VipsImage *in, VipsImage **out);
 
 int vips_extract_area_go(VipsImage *in, VipsImage **out, int left, int top, int width, int height);
-int vips_smartcrop_go(VipsImage *in, VipsImage **out, int width, int height);
+int vips_grayscale_pixels_go(VipsImage *in, double scale, void **buf, size_t *len,
+  int *width, int *height);
+int vips_smartcrop_go(VipsImage *in, VipsImage **out, int width, int height,
+  int *attention_x, int *attention_y);
 int vips_trim(VipsImage *in, VipsImage **out, double threshold,
               gboolean smart, double r, double g, double b,
               gboolean equal_hor, gboolean equal_ver);
@@ -76,15 +90,22 @@ int vips_embed_go(VipsImage *in, VipsImage **out, int x, int y, int width, int h
 int vips_ensure_alpha(VipsImage *in, VipsImage **out);
 
 int vips_apply_watermark(VipsImage *in, VipsImage *watermark, VipsImage **out, double opacity);
+int vips_apply_mask_go(VipsImage *in, VipsImage *mask, VipsImage **out);
+int vips_composite_go(VipsImage *in, VipsImage *overlay, VipsImage **out, int mode);
 
 int vips_arrayjoin_go(VipsImage **in, VipsImage **out, int n);
+int vips_arrayjoin_grid_go(VipsImage **in, VipsImage **out, int n, int across, double r, double g, double b);
+
+int vips_image_equal_go(VipsImage *a, VipsImage *b, int *equal);
+int vips_average_color_go(VipsImage *in, double *r, double *g, double *b, double *a);
 
 int vips_strip(VipsImage *in, VipsImage **out);
+int vips_strip_gps_go(VipsImage *in, VipsImage **out);
 
 int vips_jpegsave_go(VipsImage *in, void **buf, size_t *len, int quality, int interlace);
 int vips_pngsave_go(VipsImage *in, void **buf, size_t *len, int interlace, int quantize, int colors);
 int vips_webpsave_go(VipsImage *in, void **buf, size_t *len, int quality);
-int vips_gifsave_go(VipsImage *in, void **buf, size_t *len);
+int vips_gifsave_go(VipsImage *in, void **buf, size_t *len, double dither, int effort, int optimize_frames, int optimize_transparency);
 int vips_avifsave_go(VipsImage *in, void **buf, size_t *len, int quality, int speed);
 int vips_tiffsave_go(VipsImage *in, void **buf, size_t *len, int quality);
 